@@ -0,0 +1,120 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	// activitiesOverlap is how long before the channel was last enumerated
+	// activities are listed from, as uploads may appear in the activities
+	// some time after being published.
+	activitiesOverlap = 24 * time.Hour
+	// activitiesVerifyInterval is how often the uploads are paged anyway,
+	// which catches any uploads the activities have silently missed.
+	activitiesVerifyInterval = 7 * 24 * time.Hour
+	// maxActivityPages is the number of pages of activities beyond which
+	// they are assumed to be truncated.
+	maxActivityPages = 4
+)
+
+var ErrActivitiesInconsistent = errors.New("activities inconsistent with uploads")
+
+// canUseActivities reports if new uploads to c may be found from its
+// activities (see EnumerateActivities).
+func (c *cachedChannel) canUseActivities() bool {
+	return c.Backfilled && !c.Playlist && slices.Equal(c.Playlists, []string{c.UploadsID}) &&
+		!c.Enumerated.IsZero() && time.Since(c.Paged) < activitiesVerifyInterval
+}
+
+// ForeachNew runs cmd on each new video of the channel. Unless activities is
+// set and the channel's activities can be used, this is Foreach. Otherwise,
+// the videos uploaded since the channel was last enumerated are found from
+// its activities, or Foreach is used after all if they are inconsistent.
+func (c *cachedChannel) ForeachNew(ctx context.Context, cl YouTubeClient, vc *videoCache, activities bool, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	start := time.Now()
+
+	if activities && c.canUseActivities() {
+		err := c.ForeachActivity(ctx, cl, vc, cmd)
+		if err == nil {
+			c.Enumerated = start
+			return nil
+		}
+		if !errors.Is(err, ErrActivitiesInconsistent) {
+			return err
+		}
+		fmt.Printf("[%s] %v; paging uploads instead\n", c.ID, err)
+	}
+
+	if err := c.Foreach(ctx, cl, vc, cmd); err != nil {
+		return err
+	}
+	c.Enumerated, c.Paged = start, start
+	return nil
+}
+
+// ForeachActivity runs cmd on each video uploaded to the channel since it
+// was last enumerated, as found from its activities. Upcoming videos are
+// tracked as by Foreach. The activities are checked for consistency before
+// any video is visited, returning an error wrapping
+// ErrActivitiesInconsistent if they cannot be trusted.
+func (c *cachedChannel) ForeachActivity(ctx context.Context, cl YouTubeClient, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	after := c.Enumerated.Add(-activitiesOverlap)
+
+	var ids []string
+	token := ""
+	for page := 1; ; page++ {
+		if page > maxActivityPages {
+			return fmt.Errorf("%w: more than %d pages", ErrActivitiesInconsistent, maxActivityPages)
+		}
+
+		r, err := cl.ListActivities(ctx, c.ID, after, token)
+		switch {
+		case errors.Is(err, ErrQuotaExceeded) || ctx.Err() != nil:
+			return fmt.Errorf("foreach activity on %s: %w", c.ID, err)
+		case err != nil:
+			// Paging the uploads may yet work.
+			return fmt.Errorf("%w: %v", ErrActivitiesInconsistent, err)
+		}
+
+		for _, a := range r.Items {
+			if a == nil || a.Snippet == nil || a.Snippet.Type != "upload" {
+				continue
+			}
+			if a.ContentDetails == nil || a.ContentDetails.Upload == nil || a.ContentDetails.Upload.VideoId == "" {
+				return fmt.Errorf("%w: upload with no video", ErrActivitiesInconsistent)
+			}
+			if id := a.ContentDetails.Upload.VideoId; !c.Videos.Has(id) && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+
+		if r.NextPageToken == "" {
+			break
+		}
+		token = r.NextPageToken
+	}
+
+	// Every upload must exist, and be on this channel.
+	if err := vc.Prefetch(ctx, ids); err != nil {
+		return fmt.Errorf("foreach activity on %s: %w", c.ID, err)
+	}
+	for _, id := range ids {
+		v, err := vc.Get(ctx, id)
+		switch {
+		case err != nil:
+			return fmt.Errorf("foreach activity on %s: %w", c.ID, err)
+		case v == nil:
+			return fmt.Errorf("%w: upload %s not found", ErrActivitiesInconsistent, id)
+		case v.Snippet.ChannelId != c.ID:
+			return fmt.Errorf("%w: upload %s is on channel %s", ErrActivitiesInconsistent, id, v.Snippet.ChannelId)
+		}
+	}
+
+	return c.ForeachVideo(ctx, ids, vc, cmd)
+}
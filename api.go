@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"google.golang.org/api/youtube/v3"
 )
@@ -31,29 +33,91 @@ func isHTTPError(status int) bool {
 //
 // YouTubeChannel also contains a slice of VideoSelectors which will
 // be applied in addition to the global video selectors configured in
-// the root.
+// the root, and a slice of extra downloader arguments which are appended
+// after the global ones.
+//
+// If MetadataOnly is set, the metadata, thumbnail and subtitles of every
+// video on the channel are archived, but only videos matching the selectors
+// are downloaded. This implies Config.DumpVideoInfo for the channel.
+//
+// Tabs selects which tabs of the channel are archived, out of "videos",
+// "streams" (live stream VODs) and "shorts". All uploads are archived if
+// empty.
+//
+// If PlaylistID is set, the videos in that playlist are archived instead of
+// the channel's uploads. If VideoIDs is set, only those videos are. Either
+// way, they are stored with the rest of the channel's videos.
+//
+// If Mine is set, the channel is that of the user authorised with OAuth
+// (see Config.OAuthClientID), whose private playlists LikedPlaylist and
+// WatchLaterPlaylist may then be archived.
 type YouTubeChannel struct {
-	ID        string
-	Handle    string
-	Username  string
-	Selectors []VideoSelector
+	ID             string
+	Handle         string
+	Username       string
+	Mine           bool
+	Selectors      []VideoSelector
+	DownloaderArgs []string
+	MetadataOnly   bool
+	Tabs           []string
+	PlaylistID     string
+	VideoIDs       []string
+}
+
+// tabPrefixes map each channel tab to the prefix of the system playlist of
+// its videos, which otherwise shares the ID of the uploads playlist.
+var tabPrefixes = map[string]string{
+	"videos":  "UULF",
+	"streams": "UULV",
+	"shorts":  "UUSH",
+}
+
+var ErrUnknownTab = errors.New("unknown channel tab (want 'videos', 'streams' or 'shorts')")
+
+// tabPlaylists returns the IDs of the system playlists of the given tabs of
+// the channel with the given uploads playlist.
+func tabPlaylists(uploads string, tabs []string) ([]string, error) {
+	ids := make([]string, 0, len(tabs))
+	for _, tab := range tabs {
+		prefix, ok := tabPrefixes[strings.ToLower(tab)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownTab, tab)
+		}
+		ids = append(ids, prefix+strings.TrimPrefix(uploads, "UU"))
+	}
+
+	return ids, nil
 }
 
 func (c YouTubeChannel) String() string {
 	return c.Identity()
 }
 
+// Identity returns the most specific identifier of the channel, qualified
+// by the playlist or videos archived from it, if any.
 func (c YouTubeChannel) Identity() string {
+	var id string
 	switch {
 	case c.ID != "":
-		return c.ID
+		id = c.ID
 	case c.Handle != "":
-		return c.Handle
+		id = c.Handle
 	case c.Username != "":
-		return c.Username
+		id = c.Username
+	case c.Mine:
+		id = "mine"
 	default:
 		return "unknown"
 	}
+
+	switch {
+	case c.PlaylistID != "":
+		return id + "/playlist/" + c.PlaylistID
+	case len(c.VideoIDs) > 0:
+		return id + "/videos"
+	default:
+		return id
+	}
 }
 
 func (c YouTubeChannel) requestAddIdentity(r *youtube.ChannelsListCall) error {
@@ -64,6 +128,8 @@ func (c YouTubeChannel) requestAddIdentity(r *youtube.ChannelsListCall) error {
 		r.ForHandle(c.Handle)
 	case c.Username != "":
 		r.ForUsername(c.Username)
+	case c.Mine:
+		r.Mine(true)
 	default:
 		return ErrChannelNotIdentified
 	}
@@ -72,31 +138,37 @@ func (c YouTubeChannel) requestAddIdentity(r *youtube.ChannelsListCall) error {
 }
 
 // newCachedChannel requests the API to build a cached channel.
-func (c YouTubeChannel) getCachedChannel(srv *youtube.Service) (cachedChannel, error) {
-	req := srv.Channels.List([]string{"id", "snippet", "contentDetails"})
-	if err := c.requestAddIdentity(req); err != nil {
-		return cachedChannel{}, fmt.Errorf("caching %s: %v", c.Identity(), err)
-	}
-
-	r, err := req.Do()
+func (c YouTubeChannel) getCachedChannel(ctx context.Context, cl YouTubeClient) (cachedChannel, error) {
+	rs, err := cl.ListChannel(ctx, c)
 	if err != nil {
-		return cachedChannel{}, fmt.Errorf("caching %s: list channel: %v", c.Identity(), err)
+		return cachedChannel{}, fmt.Errorf("caching %s: list channel: %w", c.Identity(), err)
 	}
-	if isHTTPError(r.HTTPStatusCode) {
-		return cachedChannel{}, fmt.Errorf("caching %s: list channel: http status %d", c.Identity(), r.HTTPStatusCode)
-	}
-	if len(r.Items) == 0 {
+	if rs == nil {
 		return cachedChannel{}, fmt.Errorf("caching %s: list channel: %w", c.Identity(), ErrNoSuchChannel)
 	}
 
-	rs := r.Items[0]
+	cc := cachedChannel{
+		ID:          rs.Id,
+		Name:        rs.Snippet.Title,
+		Handle:      rs.Snippet.CustomUrl,
+		Description: rs.Snippet.Description,
+		UploadsID:   rs.ContentDetails.RelatedPlaylists.Uploads,
+		Fetched:     time.Now(),
+		Videos:      nil,
+	}
+	switch {
+	case c.PlaylistID != "":
+		cc.Playlists = []string{c.PlaylistID}
+		cc.Playlist = true
+	case len(c.Tabs) > 0:
+		if cc.Playlists, err = tabPlaylists(cc.UploadsID, c.Tabs); err != nil {
+			return cachedChannel{}, fmt.Errorf("caching %s: %w", c.Identity(), err)
+		}
+	default:
+		cc.Playlists = []string{cc.UploadsID}
+	}
 
-	return cachedChannel{
-		ID:        rs.Id,
-		Name:      rs.Snippet.Title,
-		UploadsID: rs.ContentDetails.RelatedPlaylists.Uploads,
-		Videos:    nil,
-	}, nil
+	return cc, nil
 }
 
 // cachedChannel contains details of a channel pertinent to the operation
@@ -106,59 +178,179 @@ type cachedChannel struct {
 	ID string
 	// Friendly name of the channel.
 	Name string
+	// Handle (custom URL) and description of the channel.
+	Handle      string
+	Description string
 	// ID of the uploads playlist.
 	UploadsID string
+	// IDs of the playlists enumerated for new videos: the uploads, those
+	// of the configured tabs or a configured playlist.
+	Playlists []string
+	// Set if Playlists is a configured playlist, which is always
+	// enumerated in full, as new items may be anywhere in it.
+	Playlist bool
+	// When the above details were last fetched from the API.
+	Fetched time.Time
 	// Videos indicates if a given video ID has been seen yet.
 	// This is initially nil and is then populated exactly once on the first archive run.
-	Videos map[string]struct{}
+	Videos *videoSet
+	// Backfilled is set once every video of the channel has been
+	// enumerated, after which only the newest are. It is kept in the
+	// archiver's state (see Archiver.backfilled), not inferred from Videos,
+	// as a run may be interrupted part way through the first enumeration.
+	Backfilled bool
+	// Described contains the IDs of videos of which only the metadata has
+	// been archived. Only used in metadata-only mode.
+	Described *videoSet
+	// Upcoming maps the IDs of upcoming videos and premieres seen on the
+	// channel to their scheduled start time (zero if unknown), so that they
+	// can be re-checked once started. Nil if upcoming videos are not tracked.
+	// Videos held back for the grace period are tracked here too, until
+	// they become eligible.
+	Upcoming map[string]time.Time
+	// When the last enumeration of the channel's videos which succeeded
+	// started, and the last of those which paged its playlists rather
+	// than listing its activities.
+	Enumerated, Paged time.Time
 }
 
 func (c cachedChannel) String() string {
 	return c.Name
 }
 
+// Stale reports if the channel details were fetched longer than ttl ago.
+func (c cachedChannel) Stale(ttl time.Duration) bool {
+	return time.Since(c.Fetched) > ttl
+}
+
+// Update replaces the channel details with those in fresh, keeping track of
+// seen and upcoming videos. If the channel identity now refers to another
+// channel altogether (e.g a handle has moved), nothing is kept.
+func (c *cachedChannel) Update(fresh cachedChannel) {
+	if fresh.ID != c.ID {
+		*c = fresh
+		return
+	}
+
+	c.Name = fresh.Name
+	c.Handle = fresh.Handle
+	c.Description = fresh.Description
+	c.UploadsID = fresh.UploadsID
+	c.Playlists = fresh.Playlists
+	c.Playlist = fresh.Playlist
+	c.Fetched = fresh.Fetched
+}
+
+// isUpcoming reports if v has not yet been broadcast or premiered, or is
+// currently live, and so cannot be archived yet.
+func isUpcoming(v *youtube.Video) bool {
+	return v.Snippet.LiveBroadcastContent != "none" && v.Snippet.LiveBroadcastContent != "completed"
+}
+
+// scheduledStart returns the scheduled start time of an upcoming video, or
+// the zero time if unknown.
+func scheduledStart(v *youtube.Video) time.Time {
+	if v.LiveStreamingDetails == nil {
+		return time.Time{}
+	}
+
+	t, _ := time.Parse(time.RFC3339, v.LiveStreamingDetails.ScheduledStartTime)
+	return t
+}
+
+// playlistItemFromVideo builds a playlist item describing v, as would be
+// returned when listing a playlist containing v.
+func playlistItemFromVideo(v *youtube.Video) *youtube.PlaylistItem {
+	return &youtube.PlaylistItem{
+		Snippet: &youtube.PlaylistItemSnippet{
+			ChannelId:           v.Snippet.ChannelId,
+			ChannelTitle:        v.Snippet.ChannelTitle,
+			Title:               v.Snippet.Title,
+			Description:         v.Snippet.Description,
+			PublishedAt:         v.Snippet.PublishedAt,
+			Thumbnails:          v.Snippet.Thumbnails,
+			VideoOwnerChannelId: v.Snippet.ChannelId,
+		},
+		ContentDetails: &youtube.PlaylistItemContentDetails{
+			VideoId:          v.Id,
+			VideoPublishedAt: v.Snippet.PublishedAt,
+		},
+	}
+}
+
+// publishedAt returns the time at which the video in pi was published, if
+// known.
+func publishedAt(pi *youtube.PlaylistItem) (time.Time, bool) {
+	published := ""
+	if pi.ContentDetails != nil {
+		published = pi.ContentDetails.VideoPublishedAt
+	}
+	if published == "" && pi.Snippet != nil {
+		published = pi.Snippet.PublishedAt
+	}
+
+	t, err := time.Parse(time.RFC3339, published)
+	return t, err == nil
+}
+
 // checkUpcoming returns a map containing any videos in the given set which are upcoming and - as a
-// result - should not be considered for archiving.
-// To conserve quota, the set contained within resp should be as large as permitted by the API (probably
-// 50 max).
-func (c *cachedChannel) checkUpcoming(resp *youtube.PlaylistItemListResponse, srv *youtube.Service) (map[string]struct{}, error) {
+// result - should not be considered for archiving, along with their scheduled start times.
+// To conserve quota, the metadata for the whole set is looked up in as few requests as possible
+// and kept in vc for use by selectors.
+func (c *cachedChannel) checkUpcoming(ctx context.Context, resp *youtube.PlaylistItemListResponse, vc *videoCache) (map[string]time.Time, error) {
 	ids := make([]string, 0, len(resp.Items))
 	for _, it := range resp.Items {
 		ids = append(ids, it.ContentDetails.VideoId)
 	}
 
-	r, err := srv.Videos.List([]string{"snippet"}).Id(ids...).Do()
-	if err != nil {
-		return nil, fmt.Errorf("check upcoming: %v", err)
+	if err := vc.Prefetch(ctx, ids); err != nil {
+		return nil, fmt.Errorf("check upcoming: %w", err)
 	}
 
-	upcoming := make(map[string]struct{})
-	for _, v := range r.Items {
+	upcoming := make(map[string]time.Time)
+	for _, id := range ids {
+		v, err := vc.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("check upcoming: %w", err)
+		}
 		if v == nil {
 			continue
 		}
 
-		if v.Snippet.LiveBroadcastContent != "none" && v.Snippet.LiveBroadcastContent != "completed" {
-			upcoming[v.Id] = struct{}{}
+		if isUpcoming(v) {
+			upcoming[v.Id] = scheduledStart(v)
 		}
 	}
 
 	return upcoming, nil
 }
 
-func (c *cachedChannel) foreach(resp *youtube.PlaylistItemListResponse, srv *youtube.Service, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
-	if isHTTPError(resp.HTTPStatusCode) {
-		return fmt.Errorf("foreach video on %s: http status %d", c.ID, resp.HTTPStatusCode)
-	}
+// preparePage checks a page of uploads and looks up the metadata of the
+// videos on it, returning those which are upcoming. It does not touch c, so
+// may run concurrently with visitPage.
+func (c *cachedChannel) preparePage(ctx context.Context, resp *youtube.PlaylistItemListResponse, vc *videoCache) (map[string]time.Time, error) {
 	if resp == nil || len(resp.Items) == 0 {
-		return ErrEmptyResults
+		return nil, ErrEmptyResults
 	}
+	if isHTTPError(resp.HTTPStatusCode) {
+		return nil, fmt.Errorf("foreach video on %s: http status %d", c.ID, resp.HTTPStatusCode)
+	}
+
+	return c.checkUpcoming(ctx, resp, vc)
+}
 
-	upcoming, err := c.checkUpcoming(resp, srv)
+func (c *cachedChannel) foreach(ctx context.Context, resp *youtube.PlaylistItemListResponse, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	upcoming, err := c.preparePage(ctx, resp, vc)
 	if err != nil {
 		return err
 	}
 
+	return c.visitPage(resp, upcoming, cmd)
+}
+
+// visitPage runs cmd on each video on a prepared page of uploads, other than
+// those which are upcoming.
+func (c *cachedChannel) visitPage(resp *youtube.PlaylistItemListResponse, upcoming map[string]time.Time, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
 	for _, v := range resp.Items {
 		if v == nil {
 			continue
@@ -166,9 +358,13 @@ func (c *cachedChannel) foreach(resp *youtube.PlaylistItemListResponse, srv *you
 		// Video flagged as upcoming; skip it for now
 		// NOTE: As we aren't running the callback here, we also aren't
 		// marking this as present in the map so this check is re-done.
-		if _, ok := upcoming[v.ContentDetails.VideoId]; ok {
+		if start, ok := upcoming[v.ContentDetails.VideoId]; ok {
+			if c.Upcoming != nil {
+				c.Upcoming[v.ContentDetails.VideoId] = start
+			}
 			continue
 		}
+		delete(c.Upcoming, v.ContentDetails.VideoId)
 
 		if err := cmd(c, v); err != nil {
 			return err
@@ -178,32 +374,169 @@ func (c *cachedChannel) foreach(resp *youtube.PlaylistItemListResponse, srv *you
 	return nil
 }
 
-// Foreach runs cmd on each video returned from a given channel.
-// This does involve an API hit and is not just for each video in the Videos map.
-// If the Videos map is nil, it is initialized and every video on the channel is visited.
-// Else, only the first page of results is visited.
-// If cmd returns an error, the foreach sequence halts (no more videos are visited).
-func (c *cachedChannel) Foreach(ctx context.Context, srv *youtube.Service, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
-	rq := srv.PlaylistItems.List([]string{"contentDetails", "snippet"}).PlaylistId(c.UploadsID).MaxResults(50)
-	if c.Videos == nil {
-		n := 0
-		err := rq.Pages(ctx, func(pilr *youtube.PlaylistItemListResponse) error {
-			n++
-			return c.foreach(pilr, srv, cmd)
-		})
+// RecheckUpcoming looks up each tracked upcoming video whose scheduled start
+// has passed (or is unknown), running cmd on any which are now available.
+// This catches videos which have since fallen off the first page of uploads.
+// Videos which no longer exist are forgotten.
+func (c *cachedChannel) RecheckUpcoming(ctx context.Context, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	now := time.Now()
+	ids := make([]string, 0, len(c.Upcoming))
+	for id, start := range c.Upcoming {
+		if start.Before(now) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := vc.Prefetch(ctx, ids); err != nil {
+		return fmt.Errorf("recheck upcoming on %s: %w", c.ID, err)
+	}
 
+	for _, id := range ids {
+		v, err := vc.Get(ctx, id)
 		if err != nil {
-			return fmt.Errorf("foreach video on %s (page %d): %v", c.ID, n, err)
+			return fmt.Errorf("recheck upcoming on %s: %w", c.ID, err)
 		}
-	} else {
-		r, err := rq.Do()
+
+		switch {
+		case v == nil:
+			delete(c.Upcoming, id)
+		case isUpcoming(v):
+			c.Upcoming[id] = scheduledStart(v)
+		default:
+			delete(c.Upcoming, id)
+			if err := cmd(c, playlistItemFromVideo(v)); err != nil {
+				return fmt.Errorf("recheck upcoming on %s: %w", c.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ForeachVideo calls cmd for each of the videos with the given IDs which
+// exist and have not yet been archived, as if found in the uploads.
+// Upcoming videos are tracked as by Foreach.
+func (c *cachedChannel) ForeachVideo(ctx context.Context, ids []string, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	if err := vc.Prefetch(ctx, ids); err != nil {
+		return fmt.Errorf("foreach video on %s: %w", c.ID, err)
+	}
+
+	for _, id := range ids {
+		if c.Videos.Has(id) {
+			continue
+		}
+
+		v, err := vc.Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("foreach video on %s: %w", c.ID, err)
+		}
+
+		switch {
+		case v == nil:
+			fmt.Printf("[%s] video %s not found\n", c.ID, id)
+		case isUpcoming(v):
+			if c.Upcoming != nil {
+				c.Upcoming[id] = scheduledStart(v)
+			}
+		default:
+			if err := cmd(c, playlistItemFromVideo(v)); err != nil {
+				return fmt.Errorf("foreach video on %s: %w", c.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pipelineDepth is the number of pages of uploads prepared ahead of the one
+// being visited during a full enumeration.
+const pipelineDepth = 2
+
+// preparedPage is a page of uploads which has been through preparePage.
+type preparedPage struct {
+	resp     *youtube.PlaylistItemListResponse
+	upcoming map[string]time.Time
+	err      error
+}
+
+// foreachPipelined visits every page of the playlist pl. As visiting a page blocks until
+// its videos have been handed to a download worker, the following pages are
+// fetched and prepared concurrently, so that the first backfill of a large
+// channel overlaps API requests with downloads.
+func (c *cachedChannel) foreachPipelined(ctx context.Context, cl YouTubeClient, pl string, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make(chan preparedPage, pipelineDepth)
+	go func() {
+		defer close(pages)
+
+		err := forEachPage(pctx, cl, pl, func(pilr *youtube.PlaylistItemListResponse) error {
+			upcoming, err := c.preparePage(pctx, pilr, vc)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case pages <- preparedPage{resp: pilr, upcoming: upcoming}:
+				return nil
+			case <-pctx.Done():
+				return pctx.Err()
+			}
+		})
 		if err != nil {
-			return fmt.Errorf("foreach video on %s: request: %v", c.ID, err)
+			select {
+			case pages <- preparedPage{err: err}:
+			case <-pctx.Done():
+			}
 		}
+	}()
 
-		err = c.foreach(r, srv, cmd)
+	n := 0
+	for p := range pages {
+		n++
+		err := p.err
+		if err == nil {
+			err = c.visitPage(p.resp, p.upcoming, cmd)
+		}
 		if err != nil {
-			return fmt.Errorf("foreach video on %s: %v", c.ID, err)
+			return fmt.Errorf("foreach video on %s (page %d): %w", c.ID, n, err)
+		}
+	}
+
+	return nil
+}
+
+// Foreach runs cmd on each video returned from a given channel.
+// This does involve an API hit and is not just for each video in the Videos map.
+// Until the channel is backfilled, every video on the channel is visited.
+// Else, only the first page of results is visited.
+// If cmd returns an error, the foreach sequence halts (no more videos are visited).
+// Metadata for each video visited is available in vc while cmd runs.
+//
+// Each of the channel's playlists is visited in turn. Those of tabs with no
+// videos do not exist, and are skipped.
+func (c *cachedChannel) Foreach(ctx context.Context, cl YouTubeClient, vc *videoCache, cmd func(*cachedChannel, *youtube.PlaylistItem) error) error {
+	full := !c.Backfilled || c.Playlist
+
+	for _, pl := range c.Playlists {
+		var err error
+		if full {
+			err = c.foreachPipelined(ctx, cl, pl, vc, cmd)
+		} else {
+			var r *youtube.PlaylistItemListResponse
+			if r, err = cl.ListPlaylistItems(ctx, pl, ""); err != nil {
+				err = fmt.Errorf("foreach video on %s: request: %w", c.ID, err)
+			} else if err = c.foreach(ctx, r, vc, cmd); err != nil {
+				err = fmt.Errorf("foreach video on %s: %w", c.ID, err)
+			}
+		}
+
+		if err != nil && !(pl != c.UploadsID && !c.Playlist && isNotFound(err)) {
+			return err
 		}
 	}
 
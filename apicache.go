@@ -0,0 +1,138 @@
+package ytarchiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// apiCacheDir is the directory within StateDir holding the API responses
+// cached by cachingClient.
+const apiCacheDir = "apicache"
+
+// An apiCache persists API responses in the root for a while, so that
+// restarting the archiver, or anything else creating one over the same root,
+// does not repeat the same requests.
+type apiCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// apiCacheEntry is a cached response.
+type apiCacheEntry struct {
+	Stored time.Time       `json:"stored"`
+	Value  json.RawMessage `json:"value"`
+}
+
+func newAPICache(root string, ttl time.Duration) apiCache {
+	return apiCache{dir: filepath.Join(root, StateDir, apiCacheDir), ttl: ttl}
+}
+
+// path returns the path of the entry for key.
+func (c apiCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Get decodes the entry for key into v, reporting false if there is none
+// younger than the TTL.
+func (c apiCache) Get(key string, v any) bool {
+	dat, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	var e apiCacheEntry
+	if json.Unmarshal(dat, &e) != nil || time.Since(e.Stored) >= c.ttl {
+		return false
+	}
+	return json.Unmarshal(e.Value, v) == nil
+}
+
+// Put stores v as the entry for key. Failing to is ignored, as the request
+// is only made again.
+func (c apiCache) Put(key string, v any) {
+	val, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	dat, err := json.Marshal(apiCacheEntry{Stored: time.Now(), Value: val})
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(c.dir, 0755) == nil {
+		writeFileAtomic(c.path(key), dat)
+	}
+}
+
+// Forget removes the entry for key, so that the next request is made again.
+func (c apiCache) Forget(key string) {
+	os.Remove(c.path(key))
+}
+
+// channelCacheKey returns the cache key of the channel ch, which is looked
+// up by its ID, handle or username as the API would be asked.
+func channelCacheKey(ch YouTubeChannel) string {
+	switch {
+	case ch.ID != "":
+		return "channel/id/" + ch.ID
+	case ch.Handle != "":
+		return "channel/handle/" + ch.Handle
+	case ch.Mine:
+		return "channel/mine"
+	default:
+		return "channel/username/" + ch.Username
+	}
+}
+
+// cachingClient serves the details of channels and video categories, which
+// rarely change, from an apiCache where it can, and caches those it
+// requests. Other requests are passed on.
+type cachingClient struct {
+	YouTubeClient
+	cache apiCache
+}
+
+func (c cachingClient) ListChannel(ctx context.Context, ch YouTubeChannel) (*youtube.Channel, error) {
+	key := channelCacheKey(ch)
+	var cached youtube.Channel
+	if c.cache.Get(key, &cached) {
+		return &cached, nil
+	}
+
+	r, err := c.YouTubeClient.ListChannel(ctx, ch)
+	// Channels which do not exist may yet be created.
+	if err == nil && r != nil {
+		c.cache.Put(key, r)
+	}
+	return r, err
+}
+
+func (c cachingClient) ListChannels(ctx context.Context, ids []string) ([]*youtube.Channel, error) {
+	r, err := c.YouTubeClient.ListChannels(ctx, ids)
+	if err == nil {
+		for _, ch := range r {
+			c.cache.Put(channelCacheKey(YouTubeChannel{ID: ch.Id}), ch)
+		}
+	}
+	return r, err
+}
+
+func (c cachingClient) ListVideoCategories(ctx context.Context, regionCode string) ([]*youtube.VideoCategory, error) {
+	key := "categories/" + regionCode
+	var cached []*youtube.VideoCategory
+	if c.cache.Get(key, &cached) {
+		return cached, nil
+	}
+
+	r, err := c.YouTubeClient.ListVideoCategories(ctx, regionCode)
+	if err == nil {
+		c.cache.Put(key, r)
+	}
+	return r, err
+}
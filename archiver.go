@@ -7,14 +7,20 @@ package ytarchiver
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"google.golang.org/api/option"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/youtube/v3"
 )
 
@@ -23,12 +29,23 @@ var (
 	ErrAPIKey      = errors.New("ytarchiver: api key")
 	ErrAPIConnect  = errors.New("ytarchiver: api")
 	ErrDownloader  = errors.New("ytarchiver: downloader")
+	ErrAria2c      = errors.New("ytarchiver: aria2c")
+	ErrFFmpeg      = errors.New("ytarchiver: ffmpeg")
+	ErrLimits      = errors.New("ytarchiver: resource limits")
+	ErrSync        = errors.New("ytarchiver: sync")
 	ErrDownloadDir = errors.New("ytarchiver: bad download directory")
 	ErrCacheBuild  = errors.New("ytarchiver: build channel cache")
 
 	ErrCacheMiss = errors.New("ytarchiver archive: channel not in cache")
 
-	ErrVideo = errors.New("ytarchiver: archive video")
+	ErrVideo           = errors.New("ytarchiver: archive video")
+	ErrWorkerPanic     = errors.New("ytarchiver: worker panic")
+	ErrNotArchived     = errors.New("ytarchiver: video missing after download")
+	ErrSelectorRefresh = errors.New("ytarchiver: refresh selector")
+
+	ErrRunInProgress  = errors.New("ytarchiver: archive run already in progress")
+	ErrInterrupted    = errors.New("ytarchiver: run interrupted")
+	ErrUnknownChannel = errors.New("ytarchiver: channel not configured")
 )
 
 // videoError is an error caused during the archiving of a given video.
@@ -41,8 +58,8 @@ func (v videoError) Error() string {
 	return fmt.Sprintf("%s %s: %s", ErrVideo.Error(), v.VideoID, v.Cause.Error())
 }
 
-func (v videoError) Unwrap() error {
-	return ErrVideo
+func (v videoError) Unwrap() []error {
+	return []error{ErrVideo, v.Cause}
 }
 
 type channelError struct {
@@ -61,6 +78,10 @@ func (c channelError) Error() string {
 	return sb.String()
 }
 
+func (c channelError) Unwrap() []error {
+	return c.Errors
+}
+
 func (c *channelError) Add(e error) {
 	c.Errors = append(c.Errors, e)
 }
@@ -87,49 +108,218 @@ func (a ArchiveError) Error() string {
 	return sb.String()
 }
 
+func (a ArchiveError) Unwrap() []error {
+	errs := make([]error, len(a))
+	for i, e := range a {
+		errs[i] = e
+	}
+
+	return errs
+}
+
+// metadataOnlyArgs are passed to the downloader to archive everything about a
+// video except the video itself.
+var metadataOnlyArgs = []string{"--skip-download", "--write-thumbnail", "--write-subs"}
+
+// archiveJob is a single video to be archived by an archiveMultiplexer.
+type archiveJob struct {
+	Item *youtube.PlaylistItem
+	// Only archive the metadata of the video, not the video itself.
+	MetadataOnly bool
+	// Proxy through which to download the video, if any.
+	Proxy string
+}
+
+// workerResult collects the jobs completed by a worker, each verified as
+// archived, and the errors from those which failed.
+type workerResult struct {
+	Done []archiveJob
+	Errs []error
+}
+
 // archiveMultiplexer is responsible for maintaining the pack of goroutines which are
 // downloading videos for archive.
 type archiveMultiplexer struct {
-	ctx      context.Context
-	cfg      Config
-	workChan chan *youtube.PlaylistItem
-	errChan  chan []error
+	ctx       context.Context
+	cfg       Config
+	client    YouTubeClient
+	http      *http.Client
+	progress  *progressTracker
+	bandwidth *bandwidthBudget
+	// downloader detected when the archiver was created.
+	downloader DownloaderInfo
+	workChan   chan archiveJob
+	resChan    chan workerResult
+	// submitted holds the IDs of the videos submitted during the run.
+	// Only touched by the submitting goroutine.
+	submitted map[string]bool
+	// finished, if non-nil, is called as each job finishes, with the
+	// error if it failed.
+	finished func(job archiveJob, err error)
 }
 
 func (mp archiveMultiplexer) worker() {
-	errs := make([]error, 0)
+	var res workerResult
 	defer func() {
-		mp.errChan <- errs
+		mp.resChan <- res
 	}()
 
-	for pi := range mp.workChan {
-		outPath := filepath.Join(mp.cfg.Root, pi.Snippet.ChannelId, pi.ContentDetails.VideoId)
-		err := youtubeDownload(mp.cfg, pi.ContentDetails.VideoId, outPath)
+	for job := range mp.workChan {
+		// Once cancelled, the remaining jobs are handed back unattempted
+		// so that nothing is lost.
+		err := mp.ctx.Err()
 		if err != nil {
-			errs = append(errs, err)
+			err = videoError{VideoID: job.Item.ContentDetails.VideoId, Cause: err}
+		} else {
+			err = mp.archive(job)
 		}
 
-		select {
-		case <-mp.ctx.Done():
-			return
-		default:
+		if err != nil {
+			res.Errs = append(res.Errs, err)
+		} else {
+			res.Done = append(res.Done, job)
+		}
+		if mp.finished != nil {
+			mp.finished(job, err)
+		}
+	}
+}
+
+// archive archives the video in job. A panic while doing so is converted
+// into an error, so that a single bad video cannot take down the whole
+// process.
+func (mp archiveMultiplexer) archive(job archiveJob) (err error) {
+	var vid string
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("worker panic archiving %q: %v\n%s", vid, r, debug.Stack())
+			err = videoError{VideoID: vid, Cause: fmt.Errorf("%w: %v", ErrWorkerPanic, r)}
+		}
+	}()
+
+	vid = job.Item.ContentDetails.VideoId
+	cid := job.Item.Snippet.ChannelId
+	outPath := filepath.Join(mp.cfg.Root, cid, vid)
+
+	_, span := trace.SpanFromContext(mp.ctx).TracerProvider().Tracer(tracerName).Start(mp.ctx, "download",
+		trace.WithAttributes(attribute.String(attrVideoID, vid), attribute.Bool(attrMetadataOnly, job.MetadataOnly)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	cfg := mp.cfg
+	if job.MetadataOnly {
+		cfg.DumpVideoInfo = true
+		cfg.DownloaderArgs = append(append([]string{}, metadataOnlyArgs...), cfg.DownloaderArgs...)
+	}
+	if job.Proxy != "" {
+		cfg.DownloaderArgs = append([]string{"--proxy", job.Proxy}, cfg.DownloaderArgs...)
+	}
+
+	defer mp.progress.Done(vid)
+	lease := mp.bandwidth.Acquire()
+	defer lease.Release()
+	err = youtubeDownload(mp.ctx, cfg, mp.downloader, vid, outPath, lease, func(p Progress) {
+		p.VideoID, p.ChannelID = vid, cid
+		mp.progress.Update(p)
+	})
+	// Extracted before the metadata is written, so that it is recorded
+	// as the thumbnail.
+	if err == nil && cfg.PosterFrames && !job.MetadataOnly && !hasThumbnail(filepath.Join(mp.cfg.Root, cid), vid) {
+		mp.postProcess(cid, vid, "poster frame", GeneratePosterFrame)
+	}
+	if err == nil && cfg.DumpVideoInfo {
+		if merr := writeVideoMeta(filepath.Join(mp.cfg.Root, cid), vid); merr != nil {
+			err = fmt.Errorf("%w: %v", ErrVideoMeta, merr)
+		}
+	}
+	if err != nil {
+		return videoError{VideoID: vid, Cause: err}
+	}
+
+	if cfg.Storyboards && !job.MetadataOnly {
+		mp.postProcess(cid, vid, "storyboard", GenerateStoryboard)
+	}
+	if cfg.WatchPage != WatchPageNone && !job.MetadataOnly {
+		werr := CaptureWatchPage(mp.ctx, mp.client, mp.http, cfg.WatchPageURL, cfg.WatchPage, filepath.Join(mp.cfg.Root, cid), vid)
+		if werr != nil && mp.ctx.Err() == nil {
+			fmt.Printf("[%s] watch page for %s: %v\n", cid, vid, werr)
+		}
+	}
+	// Last, as the steps above may still write to the video.
+	if cfg.ContentAddressed && !job.MetadataOnly {
+		path, serr := videoFile(filepath.Join(mp.cfg.Root, cid), vid)
+		if serr == nil {
+			serr = storeObject(mp.cfg.Root, path)
+		}
+		if serr != nil && !errors.Is(serr, os.ErrNotExist) {
+			fmt.Printf("[%s] storing %s: %v\n", cid, vid, serr)
+		}
+	}
+
+	// The downloader exiting cleanly is not enough.
+	if err := verifyArchived(filepath.Join(mp.cfg.Root, cid), vid, job.MetadataOnly); err != nil {
+		return videoError{VideoID: vid, Cause: err}
+	}
+	return nil
+}
+
+// verifyArchived checks that the video id has been archived into the
+// channel directory dir: that its file exists and is not empty, or that its
+// metadata exists if only that was archived. An empty file is removed, so
+// that it is not taken for the video when the root is next crawled.
+func verifyArchived(dir, id string, metadataOnly bool) error {
+	if metadataOnly {
+		if _, err := os.Stat(filepath.Join(dir, id+VideoMetaSuffix)); err != nil {
+			return fmt.Errorf("%w: %v", ErrNotArchived, err)
 		}
+		return nil
+	}
+
+	path, err := videoFile(dir, id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotArchived, err)
+	}
+	// Through any link into the object store.
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotArchived, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a file", ErrNotArchived, filepath.Base(path))
+	}
+	if fi.Size() == 0 {
+		os.Remove(path)
+		return fmt.Errorf("%w: %s is empty", ErrNotArchived, filepath.Base(path))
+	}
+	return nil
+}
+
+// postProcess runs gen on the downloaded video vid of channel cid. The video
+// itself is archived, so a failure is only logged rather than being reason
+// to download it again.
+func (mp archiveMultiplexer) postProcess(cid, vid, what string, gen func(ctx context.Context, ffmpeg, path string) error) {
+	path, err := videoFile(filepath.Join(mp.cfg.Root, cid), vid)
+	if err == nil {
+		err = gen(mp.ctx, mp.cfg.FFmpeg, path)
+	}
+	if err != nil && mp.ctx.Err() == nil {
+		fmt.Printf("[%s] %s for %s: %v\n", cid, what, vid, err)
 	}
 }
 
 // Wait awaits the termination of any ongoing jobs and quits the process.
 // This *must* be called after the context has been cancelled and before
 // discarding the multiplexer, else processes and goroutines will be leaked.
-func (mp archiveMultiplexer) Wait() []error {
-	errs := make([]error, 0, mp.cfg.MaxParallel)
+func (mp archiveMultiplexer) Wait() workerResult {
+	var res workerResult
 	for i := uint(0); i < mp.cfg.MaxParallel; i++ {
-		err := <-mp.errChan
-		if err != nil {
-			errs = append(errs, err...)
-		}
+		r := <-mp.resChan
+		res.Done = append(res.Done, r.Done...)
+		res.Errs = append(res.Errs, r.Errs...)
 	}
 
-	return errs
+	return res
 }
 
 // Done indicates to the workers that no more work is coming and that they must exit
@@ -140,14 +330,43 @@ func (mp archiveMultiplexer) Done() {
 	close(mp.workChan)
 }
 
-func (mp archiveMultiplexer) Submit(pi *youtube.PlaylistItem) {
-	mp.workChan <- pi
+// Submit queues pi to be downloaded, through proxy if not empty. It reports
+// false if the video was already submitted during the run, in which case it
+// is not queued again.
+func (mp archiveMultiplexer) Submit(pi *youtube.PlaylistItem, proxy string) bool {
+	return mp.submit(archiveJob{Item: pi, Proxy: proxy})
+}
+
+// SubmitMetadata queues the metadata of pi to be archived, without the
+// video itself. It reports false, as Submit, if the video was already
+// submitted.
+func (mp archiveMultiplexer) SubmitMetadata(pi *youtube.PlaylistItem) bool {
+	return mp.submit(archiveJob{Item: pi, MetadataOnly: true})
+}
+
+func (mp archiveMultiplexer) submit(job archiveJob) bool {
+	if mp.Submitted(job.Item.ContentDetails.VideoId) {
+		return false
+	}
+	mp.submitted[job.Item.ContentDetails.VideoId] = true
+	mp.workChan <- job
+	return true
+}
+
+// Submitted reports if the video id has been submitted during the run. It
+// is only recorded as archived once the job is acknowledged as done by
+// Wait.
+func (mp archiveMultiplexer) Submitted(id string) bool {
+	return mp.submitted[id]
 }
 
-func newArchiveMultiplexer(ctx context.Context, cfg Config) archiveMultiplexer {
-	a := archiveMultiplexer{ctx, cfg,
-		make(chan *youtube.PlaylistItem, cfg.MaxParallel),
-		make(chan []error),
+func newArchiveMultiplexer(ctx context.Context, cfg Config, client YouTubeClient, progress *progressTracker, bandwidth *bandwidthBudget, downloader DownloaderInfo, finished func(archiveJob, error)) archiveMultiplexer {
+	hc := &http.Client{Transport: tracedTransport(http.DefaultTransport, cfg.tracerProvider())}
+	a := archiveMultiplexer{ctx, cfg, client, hc, progress, bandwidth, downloader,
+		make(chan archiveJob, cfg.MaxParallel),
+		make(chan workerResult),
+		make(map[string]bool),
+		finished,
 	}
 
 	for i := uint(0); i < cfg.MaxParallel; i++ {
@@ -157,19 +376,73 @@ func newArchiveMultiplexer(ctx context.Context, cfg Config) archiveMultiplexer {
 	return a
 }
 
+// Archiver archives the configured channels into the archive root.
+//
+// An Archiver is safe for concurrent use by multiple goroutines. Archive
+// runs never overlap: Archive waits for any run in progress to complete
+// before starting its own, whereas TryArchive returns ErrRunInProgress.
+// Progress may be called at any time, including during a run.
+//
+// The embedded Config must not be modified after the Archiver is created.
 type Archiver struct {
 	Config
 
-	ctx    context.Context
-	client *youtube.Service
+	ctx      context.Context
+	client   YouTubeClient
+	progress *progressTracker
+
+	// runMut is held for the duration of an archive run. Selectors and the
+	// contents of cached channels are only touched with runMut held.
+	runMut sync.Mutex
+
+	// quotaReset is the time until which the API quota is known to be
+	// exhausted. Only touched with runMut held.
+	quotaReset time.Time
+	// runVideos counts the videos queued during the current run. Only
+	// touched with runMut held.
+	runVideos int
+	// outcomes of the new videos considered during the current run. Only
+	// touched with runMut held.
+	outcomes runOutcomes
+	// hookDelays holds the time until which each video delayed by the
+	// pre-download hook is skipped. Only touched with runMut held.
+	hookDelays map[string]time.Time
+	// quarantine of failing videos, loaded at the start of each run. Only
+	// touched with runMut held.
+	quarantine quarantine
+	// unavailable videos, loaded at the start of each run. Only touched
+	// with runMut held.
+	unavailable tombstones
+	// runForecast of the space needed by the videos queued during the
+	// current run. Nil unless forecasting. Only touched with runMut held.
+	runForecast *StorageForecast
+	// forecastWarned is set once the current run has warned that its
+	// videos may not fit. Only touched with runMut held.
+	forecastWarned bool
+	// downloader in use, detected when the archiver was created and
+	// replaced when updated. Only touched with runMut held once created.
+	downloader DownloaderInfo
+	// downloaderBroken is set if the downloader failed the canary check
+	// before the current run. Only touched with runMut held.
+	downloaderBroken bool
+	// quota used by requests made through client.
+	quota quotaCounter
+	// apiCache of the channel details requested through client.
+	apiCache apiCache
+	// bandwidth shared by the downloads of every run. Nil if unlimited.
+	bandwidth *bandwidthBudget
 
+	// cacheMut protects the chancache map itself.
+	cacheMut sync.Mutex
 	// chancache is a map between the YoutubeChannel.Ident() of a channel
 	// and its cached channel object.
 	chancache map[string]*cachedChannel
 }
 
-func checkDownloader(exe string) error {
-	proc, err := os.StartProcess(exe, []string{exe, "--version"}, &os.ProcAttr{})
+// checkExecutable runs exe with the given version flag to ensure that it
+// exists and is in working order.
+func checkExecutable(exe string, versionFlag string) error {
+	proc, err := os.StartProcess(exe, []string{exe, versionFlag}, &os.ProcAttr{})
 	if err != nil {
 		return fmt.Errorf("start process: %v", err)
 	}
@@ -177,7 +450,7 @@ func checkDownloader(exe string) error {
 	state, err := proc.Wait()
 	if err != nil || !state.Success() {
 		ret := 255
-		if state == nil {
+		if state != nil {
 			ret = state.ExitCode()
 		}
 		return fmt.Errorf("abnormal termination (PID %v, exit code %v)", proc.Pid, ret)
@@ -185,53 +458,129 @@ func checkDownloader(exe string) error {
 	return nil
 }
 
-func checkDownloadDirectory(dir string) error {
-	testpath := dir + string(os.PathSeparator) + ".ytarchiver"
-	f, err := os.Create(testpath)
-	if err != nil {
-		return err
+func checkDownloader(exe string) error {
+	return checkExecutable(exe, "--version")
+}
+
+// lookFFmpeg returns exe, or the path of ffmpeg in $PATH if exe is empty.
+func lookFFmpeg(exe string) (string, error) {
+	if exe == "" {
+		return exec.LookPath("ffmpeg")
 	}
-	_, err = fmt.Fprintln(f, "This file was created as a test by ytarchiver. Feel free to delete it.")
+	return exe, nil
+}
+
+// checkFFmpeg ensures that ffmpeg is available, looking it up in $PATH if
+// exe is empty.
+func checkFFmpeg(exe string) error {
+	exe, err := lookFFmpeg(exe)
 	if err != nil {
 		return err
 	}
 
-	return f.Close()
+	return checkExecutable(exe, "-version")
 }
 
 // NewArchiver returns an initialised archiver struct which is ready to perform archiving.
-// This will fail if the passed API key is invalid or if there is no internet connection.
+// This will fail if the config is invalid (see ValidateConfig), the passed API key is
+// invalid or if there is no internet connection.
 func NewArchiver(cfg Config) (*Archiver, error) {
 	return NewArchiverWithContext(context.Background(), cfg)
 }
 
 // NewArchiverWithContext is NewArchiver but with a user-specified context.
 func NewArchiverWithContext(ctx context.Context, cfg Config) (*Archiver, error) {
-	if cfg.APIKey == "" {
-		return nil, fmt.Errorf("%w: empty API key", ErrAPIKey)
+	if cfg.MaxParallel == 0 {
+		cfg.MaxParallel = defaultConfig.MaxParallel
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
 	}
 
 	ar := &Archiver{
-		cfg,
-		ctx,
-		nil,
-		make(map[string]*cachedChannel),
+		Config:    cfg,
+		ctx:       ctx,
+		progress:  newProgressTracker(),
+		bandwidth: newBandwidthBudget(cfg.BandwidthLimit),
+		chancache: make(map[string]*cachedChannel),
 	}
 
-	cl, err := youtube.NewService(ar.ctx, option.WithAPIKey(cfg.APIKey))
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrAPIConnect, err)
+	var err error
+	if ar.client, err = NewClient(ar.ctx, cfg); err != nil {
+		return nil, err
 	}
-	ar.client = cl
+	ar.client = countingClient{ar.client, &ar.quota}
+	// Responses served from the cache use no quota.
+	ar.apiCache = newAPICache(cfg.Root, ar.channelCacheTTL())
+	ar.client = cachingClient{ar.client, ar.apiCache}
 
-	if err = checkDownloader(cfg.Downloader); err != nil {
+	if ar.downloader, err = ar.startDownloader(); err != nil {
 		return nil, fmt.Errorf("%w %s: %v", ErrDownloader, cfg.Downloader, err)
 	}
 
-	if err = checkDownloadDirectory(cfg.Root); err != nil {
+	if cfg.Aria2c != "" {
+		if cfg.Aria2cConnections == 0 {
+			ar.Aria2cConnections = defaultAria2cConnections
+		}
+		if err = checkDownloader(cfg.Aria2c); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrAria2c, cfg.Aria2c, err)
+		}
+	}
+
+	if ar.downloader.Flavor == FlavorYtDlp {
+		if cfg.ConcurrentFragments == 0 {
+			ar.ConcurrentFragments = max(1, fragmentBudget/max(1, cfg.MaxParallel))
+		}
+		if cfg.HTTPChunkSize == 0 {
+			ar.HTTPChunkSize = defaultHTTPChunkSize
+		}
+	}
+	// Features it lacks are left out, but its own arguments are passed
+	// on regardless.
+	if unsup := ar.downloader.Unsupported(ar.Config); len(unsup) > 0 {
+		fmt.Printf("warning: %s (%s) does not support %s; update it\n", cfg.Downloader, ar.downloader, strings.Join(unsup, ", "))
+	}
+
+	if cfg.needFFmpeg() {
+		if err = checkFFmpeg(cfg.FFmpeg); err != nil {
+			return nil, fmt.Errorf("%w: required to embed metadata, generate storyboards or poster frames: %v", ErrFFmpeg, err)
+		}
+	}
+
+	if cfg.SyncRemote != "" {
+		exe, err := lookRclone(cfg.Rclone)
+		if err == nil {
+			err = checkExecutable(exe, "version")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: rclone: %v", ErrSync, err)
+		}
+	}
+
+	if err = setupResourceLimits(cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLimits, err)
+	}
+
+	if cfg.AutoMigrate {
+		if err = Migrate(cfg.Root, nil); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDownloadDir, err)
+		}
+	}
+	// An outdated layout is only missing what the migrations add.
+	if _, err = CheckRoot(cfg.Root, false); errors.Is(err, ErrLayoutOutdated) {
+		fmt.Printf("warning: %v; migrate the root (ytarchiver migrate) or set AutoMigrate\n", err)
+	} else if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrDownloadDir, err)
 	}
 
+	if len(cfg.URLs) > 0 {
+		chans, err := ResolveURLs(ar.ctx, ar.client, cfg.URLs)
+		if err != nil {
+			return nil, err
+		}
+		ar.Channels = append(append([]YouTubeChannel{}, cfg.Channels...), chans...)
+	}
+
 	if err = ar.buildChancache(); err != nil {
 		return nil, err
 	}
@@ -244,12 +593,15 @@ func NewArchiverWithContext(ctx context.Context, cfg Config) (*Archiver, error)
 }
 
 func (a *Archiver) buildChancache() error {
+	a.cacheMut.Lock()
+	defer a.cacheMut.Unlock()
+
 	if a.chancache == nil {
 		panic("build channel cache: encountered nil cache map")
 	}
 
 	for _, c := range a.Channels {
-		cchan, err := c.getCachedChannel(a.client)
+		cchan, err := c.getCachedChannel(a.ctx, a.client)
 		if err != nil {
 			return fmt.Errorf("%w: %v", ErrCacheBuild, err)
 		}
@@ -260,92 +612,744 @@ func (a *Archiver) buildChancache() error {
 	return nil
 }
 
+// channelCacheTTL returns the time for which channel details are cached.
+func (a *Archiver) channelCacheTTL() time.Duration {
+	if a.ChannelCacheTTL == 0 {
+		return defaultChannelCacheTTL
+	}
+	return a.ChannelCacheTTL
+}
+
+// refreshChannel fetches the details of chc again if they are stale.
+func (a *Archiver) refreshChannel(ctx context.Context, ch YouTubeChannel, chc *cachedChannel) error {
+	if !chc.Stale(a.channelCacheTTL()) {
+		return nil
+	}
+
+	return a.fetchChannel(ctx, ch, chc)
+}
+
+// fetchChannel fetches the details of chc again.
+func (a *Archiver) fetchChannel(ctx context.Context, ch YouTubeChannel, chc *cachedChannel) error {
+	fresh, err := ch.getCachedChannel(ctx, a.client)
+	if err != nil {
+		return fmt.Errorf("%w: refresh: %w", ErrCacheBuild, err)
+	}
+	if fresh.Name != chc.Name {
+		fmt.Printf("[%s] channel renamed from %q to %q\n", chc.ID, chc.Name, fresh.Name)
+	}
+	chc.Update(fresh)
+
+	return nil
+}
+
+// RefreshChannels fetches the details of every channel again, regardless of
+// Config.ChannelCacheTTL, and dumps them if Config.DumpChannelInfo is set.
+// It waits for any run in progress.
+func (a *Archiver) RefreshChannels() error {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	if now := time.Now(); now.Before(a.quotaReset) {
+		return fmt.Errorf("%w: waiting until %v", ErrQuotaExceeded, a.quotaReset.Format(time.RFC1123))
+	}
+
+	var err ArchiveError
+	for _, ch := range a.Channels {
+		chc, ok := a.cachedChannel(ch.Identity())
+		if !ok {
+			continue
+		}
+
+		cerr := channelError{ChannelID: chc.ID}
+		a.apiCache.Forget(channelCacheKey(ch))
+		if e := a.fetchChannel(a.ctx, ch, chc); e != nil {
+			cerr.Add(e)
+		} else if e := a.dumpChanInfo(chc); e != nil {
+			cerr.Add(e)
+		}
+		if !cerr.Nil() {
+			err = append(err, cerr)
+		}
+
+		if errors.Is(cerr, ErrQuotaExceeded) {
+			a.quotaReset = QuotaReset(time.Now())
+			break
+		}
+	}
+
+	if len(err) == 0 {
+		return nil
+	}
+	return err
+}
+
+// cachedChannel returns the cached channel for the given channel identity.
+func (a *Archiver) cachedChannel(ident string) (*cachedChannel, bool) {
+	a.cacheMut.Lock()
+	defer a.cacheMut.Unlock()
+
+	c, ok := a.chancache[ident]
+	return c, ok
+}
+
 func (a *Archiver) dumpChanInfo(c *cachedChannel) error {
 	if !a.DumpChannelInfo {
 		return nil
 	}
 
-	path := filepath.Join(a.Root, c.ID, "channel.json")
-	dat, err := json.Marshal(*c)
-	if err != nil {
+	if err := writeChannelInfo(a.Root, c); err != nil {
 		return fmt.Errorf("dump chan info: %w", err)
 	}
-	err = os.WriteFile(path, dat, 0644)
+
+	return nil
+}
+
+// Progress returns the latest reported progress of each download currently
+// in flight, ordered by video ID. It is safe to call while Archive is running.
+func (a *Archiver) Progress() []Progress {
+	return a.progress.Snapshot()
+}
+
+// Bandwidth returns the total speed of the downloads in flight and
+// Config.BandwidthLimit, in bytes per second.
+func (a *Archiver) Bandwidth() (float64, uint64) {
+	var used float64
+	for _, p := range a.Progress() {
+		used += p.Rate
+	}
+	return used, a.BandwidthLimit
+}
+
+// Archive performs an archive run over every configured channel, waiting
+// for any run already in progress to finish first.
+func (a *Archiver) Archive() error {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	return a.archiveAll()
+}
+
+// ArchiveChannels is like Archive, but only archives the configured channels
+// with the given identities (see YouTubeChannel.Identity).
+func (a *Archiver) ArchiveChannels(idents ...string) error {
+	chans, err := a.selectChannels(idents)
 	if err != nil {
-		return fmt.Errorf("dump chan info: %w", err)
+		return err
+	}
+
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	return a.archive(chans)
+}
+
+// selectChannels returns the configured channels with the given identities,
+// in configuration order.
+func (a *Archiver) selectChannels(idents []string) ([]YouTubeChannel, error) {
+	want := make(map[string]bool, len(idents))
+	for _, id := range idents {
+		want[id] = false
+	}
+
+	chans := make([]YouTubeChannel, 0, len(idents))
+	for _, ch := range a.Channels {
+		if _, ok := want[ch.Identity()]; ok {
+			chans = append(chans, ch)
+			want[ch.Identity()] = true
+		}
+	}
+	for id, found := range want {
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownChannel, id)
+		}
+	}
+
+	return chans, nil
+}
+
+// TryArchive is like Archive, but returns ErrRunInProgress immediately if
+// a run is already in progress rather than waiting for it.
+func (a *Archiver) TryArchive() error {
+	if !a.runMut.TryLock() {
+		return ErrRunInProgress
+	}
+	defer a.runMut.Unlock()
+
+	return a.archiveAll()
+}
+
+// archiveAll performs a full archive run and records its outcome.
+// runMut must be held.
+func (a *Archiver) archiveAll() error {
+	start := time.Now()
+	err := a.archive(a.Channels)
+
+	if serr := a.recordRun(start, err == nil); serr != nil && err == nil {
+		return serr
+	}
+	return err
+}
+
+// QuotaExhausted reports if the API quota was exhausted during a previous
+// run and, if so, when it is expected to reset. Until then, archive runs
+// fail immediately with ErrQuotaExceeded rather than making API requests.
+func (a *Archiver) QuotaExhausted() (bool, time.Time) {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	return time.Now().Before(a.quotaReset), a.quotaReset
+}
+
+// refreshSelectors refreshes any stale cached selectors in sels.
+func (a *Archiver) refreshSelectors(ctx context.Context, sels []VideoSelector) error {
+	for _, m := range sels {
+		cs, ok := unwrapSelector(m).(CachedSelector)
+		if !ok || !cs.Stale() {
+			continue
+		}
+
+		if err := cs.Refresh(ctx, a.client); err != nil {
+			return fmt.Errorf("%w: %w", ErrSelectorRefresh, err)
+		}
 	}
 
 	return nil
 }
 
-func (a *Archiver) Archive() error {
+// selects reports if selector m selects the video pi, looking up its full
+// metadata through vc if m requires it. Selectors scoped out by whether pi
+// is in the backlog (backfill) select every video.
+func (a *Archiver) selects(ctx context.Context, m VideoSelector, pi *youtube.PlaylistItem, vc *videoCache, backfill bool) (bool, error) {
+	if e, ok := m.(ExcludeSelector); ok {
+		if !selectorApplies(m, backfill) {
+			return true, nil
+		}
+		ok, err := a.selects(ctx, e.Selector, pi, vc, backfill)
+		return !ok && err == nil, err
+	}
+	if s, ok := m.(ScopedSelector); ok {
+		if !s.Applies(backfill) {
+			return true, nil
+		}
+		m = s.Selector
+	}
+
+	ms, ok := m.(MetadataSelector)
+	if !ok {
+		return m.Should(pi, a.client), nil
+	}
+
+	v, err := vc.Get(ctx, pi.ContentDetails.VideoId)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return ms.ShouldVideo(v), nil
+}
+
+// archive performs an archive run over chans. runMut must be held.
+func (a *Archiver) archive(chans []YouTubeChannel) error {
 	var err ArchiveError
+	start := time.Now()
 
-	for _, ch := range a.Channels {
-		var e error
-		cerr := channelError{ChannelID: ch.Identity()}
-		runCtx, cancel := context.WithCancel(a.ctx)
-		defer cancel()
-		mp := newArchiveMultiplexer(runCtx, a.Config)
+	if now := time.Now(); now.Before(a.quotaReset) {
+		return fmt.Errorf("%w: waiting until %v", ErrQuotaExceeded, a.quotaReset.Format(time.RFC1123))
+	}
 
-		chc, ok := a.chancache[ch.Identity()]
-		if !ok {
-			cerr.Add(ErrCacheMiss)
-			err = append(err, cerr)
+	ctx, span := a.tracerProvider().Tracer(tracerName).Start(a.ctx, "archive",
+		trace.WithAttributes(attribute.Int(attrChannels, len(chans))))
+	defer func() {
+		if len(err) != 0 {
+			endSpan(span, err)
+		} else {
+			endSpan(span, nil)
+		}
+	}()
+
+	a.maintainDownloader()
+	a.checkDownloader(ctx)
+	a.runVideos = 0
+	a.outcomes = runOutcomes{}
+	q, qerr := loadQuarantine(a.Root)
+	if qerr != nil {
+		return qerr
+	}
+	a.quarantine = q
+	t, terr := loadTombstones(a.Root)
+	if terr != nil {
+		return terr
+	}
+	a.unavailable = t
+	a.runForecast, a.forecastWarned = nil, false
+	if a.StorageForecast != ForecastOff {
+		f, ferr := newStorageForecast(a.Root, a.MinFreeSpace)
+		if ferr != nil {
+			return fmt.Errorf("storage forecast: %w", ferr)
+		}
+		a.runForecast = &f
+	}
+
+	brk, berr := loadBreakers(a.Root)
+	if berr != nil {
+		return berr
+	}
+
+	a.pingHealthcheck("/start", fmt.Sprintf("Archiving %d channel(s).", len(chans)))
+	var done []YouTubeChannel
+	for _, ch := range chans {
+		// Failing too often to be worth attempting.
+		if b := brk[ch.Identity()]; b.Open(time.Now()) {
+			fmt.Printf("[%s] skipping until %v after %d consecutive failed runs\n", ch.Identity(), b.OpenUntil.Format(time.RFC3339), b.Failures)
 			continue
 		}
-		fmt.Printf("[%s] %v\n", chc.ID, chc)
 
-		a.dumpChanInfo(chc)
+		chctx, release := ctx, func() {}
+		if chc, ok := a.cachedChannel(ch.Identity()); ok {
+			var lerr error
+			chctx, release, lerr = a.leaseChannel(ctx, chc)
+			if lerr != nil {
+				err = append(err, channelError{ChannelID: ch.Identity(), Errors: []error{lerr}})
+				continue
+			}
+			// Archived by another instance.
+			if chctx == nil {
+				continue
+			}
+		}
 
-		e = chc.Foreach(a.ctx, a.client, func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
-			// Setup map if it isn't already - prevents full video enumeration happening again
-			if cc.Videos == nil {
-				cc.Videos = make(map[string]struct{})
+		cerr := a.archiveChannel(chctx, ch)
+		release()
+		done = append(done, ch)
+		if !errors.Is(cerr, ErrQuotaExceeded) {
+			if berr := a.recordChannelRun(ch.Identity(), a.channelFailure(ch, cerr)); berr != nil {
+				cerr.Add(berr)
 			}
-			// If already seen, skip this video
-			if _, ok := cc.Videos[pi.ContentDetails.VideoId]; ok {
+		}
+		if !cerr.Nil() {
+			err = append(err, cerr)
+		}
+
+		// No point carrying on with the other channels; every request
+		// will fail until the quota resets.
+		if errors.Is(cerr, ErrQuotaExceeded) {
+			a.quotaReset = QuotaReset(time.Now())
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	a.notifyRun(start, chans, err)
+	if derr := a.recordDigest(a.outcomes.videos); derr != nil {
+		fmt.Println("digest:", derr)
+	}
+
+	herr := a.withStateLock(func() error {
+		return a.recordHistory(start, chans, err)
+	})
+	if herr != nil && len(err) == 0 {
+		return herr
+	}
+	cerr := a.withStateLock(func() error {
+		return a.recordChannels(start, done, err)
+	})
+	if cerr != nil && len(err) == 0 {
+		return cerr
+	}
+	if serr := a.syncRemote(ctx); serr != nil {
+		fmt.Println("[sync]", serr)
+		if len(err) == 0 {
+			return serr
+		}
+	}
+	if len(err) != 0 {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// archiveChannel archives any new videos on a single channel. runMut must
+// be held.
+func (a *Archiver) archiveChannel(ctx context.Context, ch YouTubeChannel) (cerr channelError) {
+	cerr = channelError{ChannelID: ch.Identity()}
+
+	ctx, span := a.tracerProvider().Tracer(tracerName).Start(ctx, "channel",
+		trace.WithAttributes(attribute.String(attrChannelID, ch.Identity())))
+	defer func() {
+		if !cerr.Nil() {
+			endSpan(span, cerr)
+		} else {
+			endSpan(span, nil)
+		}
+	}()
+
+	chc, ok := a.cachedChannel(ch.Identity())
+	if !ok {
+		cerr.Add(ErrCacheMiss)
+		return cerr
+	}
+	if e := a.refreshChannel(ctx, ch, chc); e != nil {
+		// The stale details are still usable.
+		cerr.Add(e)
+	}
+	fmt.Printf("[%s] %v\n", chc.ID, chc)
+
+	if e := a.dumpChanInfo(chc); e != nil {
+		cerr.Add(e)
+	}
+
+	// Without up to date selectors, nothing can be decided.
+	sels := a.channelSelectors(ch)
+	if e := a.refreshSelectors(ctx, sels); e != nil {
+		cerr.Add(e)
+		return cerr
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Channel-specific arguments go after the global ones.
+	chcfg := a.Config
+	chcfg.DownloaderArgs = append(append([]string{}, a.DownloaderArgs...), ch.DownloaderArgs...)
+	if ch.MetadataOnly {
+		// The catalogue must be complete, whether or not the videos are
+		// downloaded.
+		chcfg.DumpVideoInfo = true
+		chcfg.DownloaderArgs = append([]string{"--write-thumbnail", "--write-subs"}, chcfg.DownloaderArgs...)
+	}
+	// Videos stay pending until they are archived, or fail for any
+	// reason but the run being interrupted.
+	pending, e := a.loadPending(chc.ID)
+	if e != nil {
+		cerr.Add(e)
+		return cerr
+	}
+	mp := newArchiveMultiplexer(runCtx, chcfg, a.client, a.progress, a.bandwidth, a.downloader, func(job archiveJob, err error) {
+		var ve videoError
+		if errors.As(err, &ve) && isInterrupted(ve.Cause) {
+			return
+		}
+		if err := pending.Remove(job.Item.ContentDetails.VideoId); err != nil {
+			fmt.Printf("[%s] %v\n", chc.ID, err)
+		}
+	})
+
+	if a.Upcoming == UpcomingRecheck && chc.Upcoming == nil {
+		chc.Upcoming = make(map[string]time.Time)
+	}
+
+	maxFailures := a.MaxVideoFailures
+	if maxFailures == 0 {
+		maxFailures = defaultMaxVideoFailures
+	}
+	backoff := a.QuarantineBackoff
+	if backoff == 0 {
+		backoff = defaultQuarantineBackoff
+	}
+
+	// Quarantined videos attempted in this run.
+	var retried []string
+
+	// Videos published before this are in the channel's backlog.
+	var backfillStart time.Time
+	e = a.withStateLock(func() (err error) {
+		if backfillStart, err = a.backfillStart(chc.ID); err != nil {
+			return err
+		}
+		chc.Backfilled, err = a.backfilled(chc.ID)
+		return err
+	})
+	if e != nil {
+		cerr.Add(e)
+		return cerr
+	}
+
+	vc := newVideoCache(a.client)
+	var describe, submit func(cc *cachedChannel, pi *youtube.PlaylistItem) error
+	visit := func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+		// Setup map if it isn't already - prevents full video enumeration happening again
+		if cc.Videos == nil {
+			cc.Videos = newVideoSet()
+		}
+		// If already seen, or already being archived, skip this video
+		if cc.Videos.Has(pi.ContentDetails.VideoId) || mp.Submitted(pi.ContentDetails.VideoId) {
+			return nil
+		}
+		// If too fresh, wait until it has settled
+		if a.GracePeriod > 0 {
+			if t, ok := publishedAt(pi); ok && time.Since(t) < a.GracePeriod {
+				eligible := t.Add(a.GracePeriod)
+				if cc.Upcoming != nil {
+					cc.Upcoming[pi.ContentDetails.VideoId] = eligible
+				}
+				a.outcomes.Skip(pi, "in grace period until "+eligible.Format(time.RFC3339))
 				return nil
 			}
-			// If any selectors object, skip this video
-			for _, m := range append(a.Selectors, ch.Selectors...) {
-				if !m.Should(pi, a.client) {
-					return nil
-				}
+		}
+		// If failing, wait until the backoff has expired
+		if !a.quarantine.Allowed(pi.ContentDetails.VideoId, time.Now(), maxFailures) {
+			a.outcomes.Skip(pi, "quarantined until "+a.quarantine[pi.ContentDetails.VideoId].NextAttempt.Format(time.RFC3339))
+			return nil
+		}
+		// If unavailable, wait until it is due to be checked again
+		if !a.unavailable.Allowed(pi.ContentDetails.VideoId, time.Now(), a.UnavailableRecheck) {
+			a.outcomes.Skip(pi, "unavailable ("+a.unavailable[pi.ContentDetails.VideoId].Reason+")")
+			return nil
+		}
+		// If any selectors object, skip this video (or just archive
+		// its metadata, once)
+		for _, m := range sels {
+			ok, err := a.selects(ctx, m, pi, vc, inBacklog(pi, backfillStart))
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+
+			if ch.MetadataOnly && !cc.Described.Has(pi.ContentDetails.VideoId) {
+				return describe(cc, pi)
+			} else if !cc.Described.Has(pi.ContentDetails.VideoId) {
+				a.outcomes.Skip(pi, "not selected by "+DescribeSelector(m))
 			}
+			return nil
+		}
+
+		return submit(cc, pi)
+	}
+	describe = func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+		if mp.Submitted(pi.ContentDetails.VideoId) {
+			return nil
+		}
+		if err := pending.Add(pi.ContentDetails.VideoId, true); err != nil {
+			cerr.Add(err)
+		}
+		mp.SubmitMetadata(pi)
+		a.runVideos++
+		a.outcomes.Queue(pi)
+		return nil
+	}
+	submit = func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+		if mp.Submitted(pi.ContentDetails.VideoId) {
+			return nil
+		}
 
-			// We're sure we need to be getting this video - submit it
-			mp.Submit(pi)
-			// And mark it as done (for now)
-			cc.Videos[pi.ContentDetails.VideoId] = struct{}{}
+		// Don't bother if it can't be downloaded from here
+		proxy, reason, err := a.checkGeo(ctx, pi, vc)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			a.outcomes.Skip(pi, reason)
+			return nil
+		}
 
+		// Give the hook its chance to object
+		if reason, err := a.checkPreDownload(ctx, pi); err != nil || reason != "" {
+			if err != nil {
+				cerr.Add(err)
+				reason = "pre-download hook failed: " + err.Error()
+			}
+			a.outcomes.Skip(pi, reason)
+			return nil
+		}
+
+		// Leave it for later if it won't fit
+		if reason, err := a.forecastRun(ctx, chc.ID, pi, vc); err != nil || reason != "" {
+			if err != nil {
+				return err
+			}
+			a.outcomes.Skip(pi, reason)
+			return nil
+		}
+
+		// We're sure we need to be getting this video - submit it
+		if _, ok := a.quarantine[pi.ContentDetails.VideoId]; ok {
+			retried = append(retried, pi.ContentDetails.VideoId)
+		}
+		if err := pending.Add(pi.ContentDetails.VideoId, false); err != nil {
+			cerr.Add(err)
+		}
+		// It is only marked as seen once the multiplexer has
+		// verified that it was archived.
+		mp.Submit(pi, proxy)
+		a.runVideos++
+		a.outcomes.Queue(pi)
+
+		return nil
+	}
+
+	// Videos left pending by an interrupted run are resumed first, as they
+	// were selected then. Those which are already archived, or no longer
+	// exist, are forgotten.
+	if ids := pending.IDs(); len(ids) > 0 {
+		if chc.Videos == nil {
+			chc.Videos = newVideoSet()
+		}
+		fmt.Printf("[%s] resuming %d pending video(s)\n", chc.ID, len(ids))
+		resumed := make(map[string]bool, len(ids))
+		e := chc.ForeachVideo(ctx, ids, vc, func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+			id := pi.ContentDetails.VideoId
+			if !pending.MetadataOnly(id) {
+				if cc.Videos.Has(id) {
+					return nil
+				}
+				resumed[id] = true
+				return submit(cc, pi)
+			}
+			if !cc.Described.Has(id) {
+				resumed[id] = true
+				return describe(cc, pi)
+			}
 			return nil
 		})
+		if e != nil {
+			cerr.Add(e)
+		} else {
+			ids = slices.DeleteFunc(ids, func(id string) bool { return resumed[id] })
+			if e := pending.Remove(ids...); e != nil {
+				cerr.Add(e)
+			}
+		}
+	}
 
+	if len(ch.VideoIDs) > 0 {
+		if e := chc.ForeachVideo(ctx, ch.VideoIDs, vc, visit); e != nil {
+			cerr.Add(e)
+		}
+	} else if e := chc.ForeachNew(ctx, a.client, vc, a.Enumeration == EnumerateActivities, visit); e != nil {
+		cerr.Add(e)
+	} else if !chc.Backfilled && ctx.Err() == nil {
+		// Every video has now been visited, so later runs need only
+		// list the newest. Those submitted are pending until archived.
+		e := a.withStateLock(func() error { return a.markBackfilled(chc.ID) })
 		if e != nil {
-			cerr.Errors = append(cerr.Errors, e)
+			cerr.Add(e)
+		} else {
+			chc.Backfilled = true
 		}
+	}
+	if e := chc.RecheckUpcoming(ctx, vc, visit); e != nil {
+		cerr.Add(e)
+	}
 
-		mp.Done()
-		errs := mp.Wait()
-		for _, ve := range errs {
-			cerr.Add(ve)
-			if errors.Is(ve, ErrVideo) {
-				// Video download errored - try again next time maybe?
-				delete(a.chancache[ch.Identity()].Videos, ve.(videoError).VideoID)
+	// Queued videos are downloaded whatever the selectors say.
+	queue, e := loadQueue(a.Root)
+	if e != nil {
+		cerr.Add(e)
+	}
+	var queued, dequeued []string
+	for id, cid := range queue {
+		if cid == chc.ID {
+			queued = append(queued, id)
+		}
+	}
+	if len(queued) > 0 {
+		if chc.Videos == nil {
+			chc.Videos = newVideoSet()
+		}
+		for _, id := range queued {
+			delete(a.quarantine, id)
+			delete(a.unavailable, id)
+			// Already archived.
+			if chc.Videos.Has(id) {
+				dequeued = append(dequeued, id)
 			}
 		}
+		e := chc.ForeachVideo(ctx, queued, vc, func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+			dequeued = append(dequeued, pi.ContentDetails.VideoId)
+			return submit(cc, pi)
+		})
+		if e != nil {
+			cerr.Add(e)
+		}
+	}
 
-		a.dumpChanInfo(chc)
+	mp.Done()
+	res := mp.Wait()
+	// Only the videos verified as archived are marked as seen; any other
+	// is considered again by the next run.
+	if chc.Videos == nil {
+		chc.Videos = newVideoSet()
+	}
+	for _, job := range res.Done {
+		id := job.Item.ContentDetails.VideoId
+		outcome := OutcomeDownloaded
+		if job.MetadataOnly {
+			if chc.Described == nil {
+				chc.Described = newVideoSet()
+			}
+			chc.Described.Add(id)
+			outcome = OutcomeMetadata
+		} else {
+			chc.Videos.Add(id)
+			chc.Described.Delete(id)
+		}
+		a.outcomes.Done(id, outcome)
+		delete(a.unavailable, id)
+	}
+	failed := make(map[string]bool, len(res.Errs))
+	interrupted := 0
+	for _, e := range res.Errs {
+		// Videos interrupted by the run being cancelled are left to be
+		// attempted again next run, without counting as failures.
+		var ve videoError
+		if errors.As(e, &ve) && isInterrupted(ve.Cause) {
+			failed[ve.VideoID] = true
+			interrupted++
+			continue
+		}
+		// Unavailable videos are not attempted again, so are no longer
+		// an error, nor left queued.
+		var ue UnavailableError
+		if a.Unavailable == TombstoneUnavailable && errors.As(e, &ve) && errors.As(ve.Cause, &ue) {
+			a.unavailable.Mark(chc.ID, ve.VideoID, ue, time.Now())
+			a.outcomes.Fail(ve.VideoID, ve.Cause)
+			fmt.Printf("[%s] %s: %v\n", chc.ID, ve.VideoID, ue)
+			continue
+		}
 
-		if !cerr.Nil() {
-			err = append(err, cerr)
+		cerr.Add(e)
+
+		// Video IDs are unknown if the job was malformed.
+		if errors.As(e, &ve) && ve.VideoID != "" {
+			// Video download errored - try again once the backoff
+			// expires, unless the downloader is to blame.
+			if !a.downloaderBroken {
+				a.quarantine.Fail(chc.ID, ve.VideoID, ve.Cause, time.Now(), backoff)
+			}
+			a.outcomes.Fail(ve.VideoID, ve.Cause)
+			failed[ve.VideoID] = true
+		}
+	}
+	if interrupted > 0 {
+		cerr.Add(fmt.Errorf("%w: %d video(s) left to archive", ErrInterrupted, interrupted))
+	}
+	for _, id := range retried {
+		if !failed[id] {
+			delete(a.quarantine, id)
 		}
 	}
+	if e := a.saveFailures(chc.ID); e != nil {
+		cerr.Add(e)
+	}
+	// Videos interrupted by the run being cancelled stay queued.
+	dequeued = slices.DeleteFunc(dequeued, func(id string) bool {
+		return failed[id] && a.quarantine[id].Failures == 0
+	})
+	if e := dequeue(a.Root, dequeued); e != nil {
+		cerr.Add(e)
+	}
 
-	if len(err) != 0 {
-		return err
-	} else {
-		return nil
+	if e := a.dumpChanInfo(chc); e != nil {
+		cerr.Add(e)
 	}
+
+	return cerr
+}
+
+// isInterrupted reports if err was caused by the cancellation of a run.
+func isInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
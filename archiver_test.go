@@ -0,0 +1,166 @@
+package ytarchiver_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/ejv2/yt-archiver/internal/ytartest"
+	"google.golang.org/api/youtube/v3"
+)
+
+const testChannel = "UCtestchannel"
+
+// testVideo returns a video published on the given day of January 2024.
+func testVideo(id string, day int, title, category, lang string) *youtube.Video {
+	return &youtube.Video{
+		Id: id,
+		Snippet: &youtube.VideoSnippet{
+			Title:                title,
+			CategoryId:           category,
+			DefaultAudioLanguage: lang,
+			PublishedAt:          time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		},
+	}
+}
+
+// newTestEnv returns an environment with a single channel, testChannel,
+// which has uploaded four videos. Requests go straight to the fake client
+// rather than over HTTP.
+func newTestEnv(t *testing.T) (*ytartest.Env, ytarchiver.Config) {
+	t.Helper()
+
+	e := ytartest.New(t)
+	e.API.AddChannel(testChannel, "test")
+	e.API.AddCategory("10", "Music")
+	e.API.AddCategory("20", "Gaming")
+	for _, v := range []*youtube.Video{
+		testVideo("aaaaaaaaaaA", 1, "Live at the Hall", "10", "en"),
+		testVideo("bbbbbbbbbbA", 2, "Speedrun world record", "20", "en-GB"),
+		testVideo("ccccccccccA", 3, "A day out", "22", "de"),
+		testVideo("ddddddddddA", 4, "Live speedrun", "20", ""),
+	} {
+		e.API.AddVideo(testChannel, v)
+	}
+
+	cfg := e.Config(ytarchiver.YouTubeChannel{ID: testChannel})
+	cfg.Client = e.API
+	return e, cfg
+}
+
+// archive runs a new archiver with cfg once.
+func archive(t *testing.T, cfg ytarchiver.Config) *ytarchiver.Archiver {
+	t.Helper()
+
+	a, err := ytarchiver.NewArchiver(cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	if err = a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	return a
+}
+
+// downloaded returns the IDs of the videos downloaded in e so far, sorted.
+func downloaded(t *testing.T, e *ytartest.Env) []string {
+	t.Helper()
+
+	ids, err := e.Downloader.Calls()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestArchive(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	a := archive(t, cfg)
+
+	want := []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"}
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Fatalf("downloaded %q, want %q", got, want)
+	}
+	got, err := e.Videos(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Sort(got); !slices.Equal(got, want) {
+		t.Errorf("archived %q, want %q", got, want)
+	}
+
+	// Nothing is downloaded twice, only what has been uploaded since.
+	e.API.AddVideo(testChannel, testVideo("eeeeeeeeeeA", 5, "New video", "22", "en"))
+	if err = a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	want = append(want, "eeeeeeeeeeA")
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+}
+
+func TestArchiveDefaultParallel(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	cfg.MaxParallel = 0
+	a := archive(t, cfg)
+
+	if want := ytarchiver.DefaultConfig("").MaxParallel; a.MaxParallel != want {
+		t.Errorf("MaxParallel = %d, want the default %d", a.MaxParallel, want)
+	}
+	if got := downloaded(t, e); len(got) != 4 {
+		t.Errorf("downloaded %q, want all 4 videos", got)
+	}
+}
+
+func TestArchiveAPIError(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	a, err := ytarchiver.NewArchiver(cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+
+	errAPI := errors.New("API unavailable")
+	e.API.Err = errAPI
+	var aerr ytarchiver.ArchiveError
+	if err = a.Archive(); !errors.As(err, &aerr) || !errors.Is(err, errAPI) {
+		t.Fatalf("Archive = %v, want an ArchiveError wrapping %v", err, errAPI)
+	}
+	if got := downloaded(t, e); len(got) != 0 {
+		t.Errorf("downloaded %q despite the error", got)
+	}
+
+	e.API.Err = nil
+	if err = a.Archive(); err != nil {
+		t.Fatalf("Archive after recovery: %v", err)
+	}
+	if got := downloaded(t, e); len(got) != 4 {
+		t.Errorf("downloaded %q after recovery, want all 4 videos", got)
+	}
+}
+
+func TestArchiveChannelCache(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	archive(t, cfg)
+	if n := e.API.Calls().Channels; n != 1 {
+		t.Fatalf("%d channel requests, want 1", n)
+	}
+
+	// The details of the channel are cached in the root, so a new archiver
+	// need not look it up again.
+	archive(t, cfg)
+	if n := e.API.Calls().Channels; n != 1 {
+		t.Errorf("%d channel requests after restarting, want 1", n)
+	}
+
+	// Unless they have expired.
+	cfg.ChannelCacheTTL = time.Nanosecond
+	n := e.API.Calls().Channels
+	archive(t, cfg)
+	if e.API.Calls().Channels == n {
+		t.Error("channel not requested again once its details expired")
+	}
+}
@@ -0,0 +1,177 @@
+package ytarchiver
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bandwidthRaiseFactor is how much a download's share of the bandwidth must
+// have grown before it is restarted to use it, so that downloads are not
+// restarted for small gains.
+const bandwidthRaiseFactor = 2
+
+// bandwidthSettle is how long a download waits after its share has grown
+// before it is restarted to use it, as the next download usually takes
+// the share straight back.
+const bandwidthSettle = 10 * time.Second
+
+// rateUnits are the multipliers of the units of the speeds reported by the
+// downloader.
+var rateUnits = map[string]float64{
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+}
+
+// parseRate parses a speed reported by the downloader (e.g "1.21MiB/s") into
+// bytes per second. It reports false if the speed is not (yet) known.
+func parseRate(s string) (float64, bool) {
+	s, ok := strings.CutSuffix(s, "/s")
+	if !ok {
+		return 0, false
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i <= 0 {
+		return 0, false
+	}
+	mul, ok := rateUnits[s[i:]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n * mul, true
+}
+
+// A bandwidthBudget shares Config.BandwidthLimit equally between the
+// downloads in flight, however many there are. The downloader cannot change
+// its limit once started, so a download whose share shrinks below its limit
+// is restarted with the new limit, resuming where it left off, as is one
+// whose share has grown by at least bandwidthRaiseFactor. The limits given
+// out never add up to more than the budget.
+//
+// A nil *bandwidthBudget is unlimited.
+type bandwidthBudget struct {
+	limit uint64
+
+	mut    sync.Mutex
+	leases map[*bandwidthLease]struct{}
+}
+
+func newBandwidthBudget(limit uint64) *bandwidthBudget {
+	if limit == 0 {
+		return nil
+	}
+	return &bandwidthBudget{limit: limit, leases: make(map[*bandwidthLease]struct{})}
+}
+
+// A bandwidthLease is the share of a bandwidthBudget held by one download.
+// A nil *bandwidthLease is unlimited.
+type bandwidthLease struct {
+	b *bandwidthBudget
+	// Guarded by b.mut.
+	rate uint64
+	// Signalled when rate changes.
+	changed chan struct{}
+}
+
+// Acquire returns a share of b for a new download, which must be released
+// once done.
+func (b *bandwidthBudget) Acquire() *bandwidthLease {
+	if b == nil {
+		return nil
+	}
+
+	l := &bandwidthLease{b: b, changed: make(chan struct{}, 1)}
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	b.leases[l] = struct{}{}
+	b.rebalance()
+	return l
+}
+
+// rebalance adjusts the rate of each lease to its share of b. It must be
+// called with b.mut held.
+func (b *bandwidthBudget) rebalance() {
+	if len(b.leases) == 0 {
+		return
+	}
+
+	share := max(1, b.limit/uint64(len(b.leases)))
+	for l := range b.leases {
+		if l.rate != 0 && share >= l.rate && share < l.rate*bandwidthRaiseFactor {
+			continue
+		}
+
+		l.rate = share
+		select {
+		case l.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Rate returns the rate to which the download holding l is limited, in
+// bytes per second. Zero is unlimited.
+func (l *bandwidthLease) Rate() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	l.b.mut.Lock()
+	defer l.b.mut.Unlock()
+
+	return l.rate
+}
+
+// Take is Rate, but also clears any pending change, as a download started
+// with the rate already has it.
+func (l *bandwidthLease) Take() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	l.b.mut.Lock()
+	defer l.b.mut.Unlock()
+
+	select {
+	case <-l.changed:
+	default:
+	}
+	return l.rate
+}
+
+// Changed returns a channel which receives when the rate of l has changed
+// since it was last taken. It never receives if l is nil.
+func (l *bandwidthLease) Changed() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.changed
+}
+
+// Release returns the share held by l to the budget.
+func (l *bandwidthLease) Release() {
+	if l == nil {
+		return
+	}
+
+	l.b.mut.Lock()
+	defer l.b.mut.Unlock()
+
+	delete(l.b.leases, l)
+	l.b.rebalance()
+}
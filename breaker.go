@@ -0,0 +1,198 @@
+package ytarchiver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultMaxChannelFailures is used if Config.MaxChannelFailures is
+	// zero.
+	defaultMaxChannelFailures = 5
+	// defaultChannelCooldown is used if Config.ChannelCooldown is zero.
+	defaultChannelCooldown = 24 * time.Hour
+)
+
+// A ChannelBreaker tracks the consecutive failed runs over a channel. Once
+// there are too many, the breaker opens and the channel is skipped until
+// the cooldown has passed, rather than spending quota and retries on it
+// every run. The channel is then attempted once more, and the breaker
+// opens again straight away if that fails too.
+type ChannelBreaker struct {
+	// Identity of the channel (see YouTubeChannel.Identity).
+	ChannelID string `json:"-"`
+	// Number of consecutive failed runs.
+	Failures int `json:"failures"`
+	// Error from the most recent failed run.
+	LastError   string    `json:"last_error"`
+	LastFailure time.Time `json:"last_failure"`
+	// Time until which the channel is skipped, if the breaker is open.
+	OpenUntil time.Time `json:"open_until"`
+}
+
+// Open reports if the breaker is open at now.
+func (b ChannelBreaker) Open(now time.Time) bool {
+	return now.Before(b.OpenUntil)
+}
+
+// breakers maps channel identities to their breakers. It is persisted in the
+// state directory.
+type breakers map[string]ChannelBreaker
+
+func loadBreakers(root string) (breakers, error) {
+	b := make(breakers)
+	err := loadState(root, stateBreakers, &b)
+	return b, err
+}
+
+// maxChannelFailures returns the number of consecutive failed runs over a
+// channel after which its breaker opens.
+func (a *Archiver) maxChannelFailures() int {
+	if a.MaxChannelFailures == 0 {
+		return defaultMaxChannelFailures
+	}
+	return int(a.MaxChannelFailures)
+}
+
+// channelFailure returns why the run over ch which produced cerr failed as a
+// whole, or nil if it did not. Failures of single videos only count if
+// every video attempted failed and the downloader passed its canary check,
+// and being interrupted or running out of quota never counts.
+func (a *Archiver) channelFailure(ch YouTubeChannel, cerr channelError) error {
+	for _, e := range cerr.Errors {
+		var ve videoError
+		if errors.As(e, &ve) || errors.Is(e, ErrInterrupted) || errors.Is(e, ErrQuotaExceeded) || isInterrupted(e) {
+			continue
+		}
+		return e
+	}
+
+	// The downloader is to blame, not the channel.
+	if a.downloaderBroken {
+		return nil
+	}
+	cid := ch.Identity()
+	if chc, ok := a.cachedChannel(cid); ok {
+		cid = chc.ID
+	}
+	failed, done := 0, 0
+	last := ""
+	for _, v := range a.outcomes.videos {
+		if v.ChannelID != cid {
+			continue
+		}
+		switch {
+		case v.Outcome == OutcomeDownloaded || v.Outcome == OutcomeMetadata:
+			done++
+		case v.Outcome == OutcomeFailed && v.ErrorClass != ErrorClassCanceled && v.ErrorClass != ErrorClassUnavailable:
+			failed++
+			last = v.Error
+		}
+	}
+	if failed > 0 && done == 0 {
+		return fmt.Errorf("all %d video(s) failed; last: %s", failed, last)
+	}
+	return nil
+}
+
+// recordChannelRun updates the breaker of the channel with identity cid
+// after a run over it which failed with ferr, or succeeded if ferr is nil,
+// notifying if the breaker opens.
+func (a *Archiver) recordChannelRun(cid string, ferr error) error {
+	var opened ChannelBreaker
+	err := a.withStateLock(func() error {
+		b, err := loadBreakers(a.Root)
+		if err != nil {
+			return err
+		}
+
+		if ferr == nil {
+			if _, ok := b[cid]; !ok {
+				return nil
+			}
+			delete(b, cid)
+			return saveState(a.Root, stateBreakers, b)
+		}
+
+		now := time.Now()
+		e := b[cid]
+		e.Failures++
+		e.LastError = ferr.Error()
+		e.LastFailure = now
+		if e.Failures >= a.maxChannelFailures() {
+			cooldown := a.ChannelCooldown
+			if cooldown == 0 {
+				cooldown = defaultChannelCooldown
+			}
+			e.OpenUntil = now.Add(cooldown)
+			opened = e
+			opened.ChannelID = cid
+		}
+		b[cid] = e
+		return saveState(a.Root, stateBreakers, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opened.ChannelID != "" {
+		fmt.Printf("[%s] %d consecutive failed runs, skipping until %v\n", cid, opened.Failures, opened.OpenUntil.Format(time.RFC3339))
+		a.notify(Event{
+			Kind:  EventChannelSuspended,
+			Title: "Channel suspended: " + cid,
+			Message: fmt.Sprintf("Channel %s failed to archive %d runs in a row, so will be skipped until %v.\n\nLast error: %s",
+				cid, opened.Failures, opened.OpenUntil.Format(time.RFC1123), opened.LastError),
+			Failure: true,
+		})
+	}
+	return nil
+}
+
+// ReadBreakers returns the breakers of the channels of the archive at root
+// which have failed since they last succeeded, ordered by channel identity.
+func ReadBreakers(root string) ([]ChannelBreaker, error) {
+	return readBreakers(osReader(root))
+}
+
+// readBreakers is ReadBreakers for the root read by read.
+func readBreakers(read readFunc) ([]ChannelBreaker, error) {
+	b := make(breakers)
+	if err := readState(read, stateBreakers, &b); err != nil {
+		return nil, err
+	}
+
+	chans := make([]ChannelBreaker, 0, len(b))
+	for cid, e := range b {
+		e.ChannelID = cid
+		chans = append(chans, e)
+	}
+	sort.Slice(chans, func(i, j int) bool {
+		return chans[i].ChannelID < chans[j].ChannelID
+	})
+
+	return chans, nil
+}
+
+// ClearBreakers resets the breakers of the channels with the given
+// identities in the archive at root, so that they are archived by the next run and may
+// fail as many times again before being skipped. If no IDs are given, every
+// breaker is reset.
+//
+// Changes made while an archive run is in progress may be lost.
+func ClearBreakers(root string, ids ...string) error {
+	b, err := loadBreakers(root)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		clear(b)
+	}
+	for _, id := range ids {
+		delete(b, id)
+	}
+
+	return saveState(root, stateBreakers, b)
+}
@@ -0,0 +1,162 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultCanaryVideo is used if Config.CanaryVideo is empty: "Me at
+	// the zoo", the first video uploaded to YouTube, which is short and
+	// unlikely to ever be taken down.
+	defaultCanaryVideo = "jNQXAC9IVRw"
+	// canaryTimeout bounds the time taken by each canary check.
+	canaryTimeout = 2 * time.Minute
+)
+
+var ErrCanary = errors.New("downloader canary failed")
+
+// CanaryStatus is the result of the last canary check of the downloader.
+type CanaryStatus struct {
+	Checked time.Time `json:"checked"`
+	Healthy bool      `json:"healthy"`
+	// Time of the first check with the current result.
+	Since time.Time `json:"since"`
+	// Downloader checked, and the error it printed if it failed.
+	Downloader string `json:"downloader"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReadCanary returns the result of the last canary check of the downloader
+// of the archive at root. The zero CanaryStatus is returned if it was never
+// checked.
+func ReadCanary(root string) (CanaryStatus, error) {
+	var st CanaryStatus
+	err := loadState(root, stateCanary, &st)
+	return st, err
+}
+
+// RunCanary checks that the downloader dl still works for cfg by simulating
+// the download of Config.CanaryVideo, which is known to be available, and
+// so only fails to download if the downloader is broken, such as by a
+// change to YouTube.
+func RunCanary(ctx context.Context, cfg Config, dl DownloaderInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+	defer cancel()
+
+	id := cfg.CanaryVideo
+	if id == "" {
+		id = defaultCanaryVideo
+	}
+	args := []string{"--simulate", "--no-playlist"}
+	// Cookies, proxies and the like may be needed to reach YouTube at all.
+	args = append(args, cfg.DownloaderArgs...)
+	args = append(args, youtubeWatchURL+id)
+
+	cmd := exec.CommandContext(ctx, dl.Path, args...)
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = interruptGrace
+	if err := cmd.Run(); err != nil {
+		if line := lastError(string(stderr)); line != "" {
+			return fmt.Errorf("%w: %s: %s", ErrCanary, id, line)
+		}
+		return fmt.Errorf("%w: %s: %v", ErrCanary, id, err)
+	}
+	return nil
+}
+
+// lastError returns the last error printed by the downloader to stderr.
+func lastError(stderr string) string {
+	last := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		if msg, ok := strings.CutPrefix(line, "ERROR: "); ok {
+			last = msg
+		}
+	}
+	return last
+}
+
+// canaryDue reports if the downloader should be checked before this run:
+// once every Config.CanaryInterval, or every run while it is broken so that
+// its recovery is noticed.
+func (a *Archiver) canaryDue(st CanaryStatus) bool {
+	if a.CanaryInterval == 0 {
+		return false
+	}
+	return !st.Healthy || time.Since(st.Checked) >= a.CanaryInterval
+}
+
+// checkDownloader runs the canary check if it is due, setting
+// downloaderBroken to the result. If it fails and downloader updates are
+// enabled, an update is tried straight away, as it is most likely the
+// downloader which needs fixing. Notifiers are told when the downloader
+// breaks and once it recovers. runMut must be held.
+func (a *Archiver) checkDownloader(ctx context.Context) {
+	st, err := ReadCanary(a.Root)
+	if err != nil {
+		fmt.Println("[canary]", err)
+		return
+	}
+	if !a.canaryDue(st) {
+		a.downloaderBroken = false
+		return
+	}
+
+	cerr := RunCanary(ctx, a.Config, a.downloader)
+	if cerr != nil && a.DownloaderUpdate != DownloaderUpdateOff {
+		fmt.Println("[canary]", cerr)
+		if dl, uerr := UpdateDownloader(ctx, a.Config); uerr != nil {
+			fmt.Println("[update]", uerr)
+		} else {
+			if dl.Path != a.downloader.Path || dl.Version != a.downloader.Version {
+				fmt.Printf("[update] downloader updated from %s to %s\n", a.downloader, dl)
+			}
+			a.downloader = dl
+			cerr = RunCanary(ctx, a.Config, a.downloader)
+		}
+	}
+	// Not the downloader's fault.
+	if ctx.Err() != nil {
+		return
+	}
+
+	wasHealthy := st.Healthy || st.Checked.IsZero()
+	now := time.Now()
+	next := CanaryStatus{Checked: now, Healthy: cerr == nil, Since: st.Since, Downloader: a.downloader.String()}
+	if cerr != nil {
+		next.Error = cerr.Error()
+	}
+	if next.Healthy != st.Healthy || st.Checked.IsZero() {
+		next.Since = now
+	}
+	a.downloaderBroken = cerr != nil
+	if err := a.withStateLock(func() error {
+		return saveState(a.Root, stateCanary, next)
+	}); err != nil {
+		fmt.Println("[canary]", err)
+	}
+
+	switch {
+	case cerr != nil && wasHealthy:
+		fmt.Println("[canary]", cerr)
+		a.notify(Event{
+			Kind:  EventDownloaderBroken,
+			Title: "Downloader broken",
+			Message: fmt.Sprintf("The downloader (%s) failed to extract a video known to be available, so is most likely broken by a change to YouTube rather than any one video. Videos failing meanwhile are not quarantined.\n\nError: %v",
+				a.downloader, cerr),
+			Failure: true,
+		})
+	case cerr == nil && !wasHealthy:
+		fmt.Printf("[canary] downloader working again after %v\n", now.Sub(st.Since).Round(time.Second))
+		a.notify(Event{
+			Kind:    EventDownloaderRecovered,
+			Title:   "Downloader working again",
+			Message: fmt.Sprintf("The downloader (%s) is working again, having been broken since %v.", a.downloader, st.Since.Format(time.RFC1123)),
+		})
+	}
+}
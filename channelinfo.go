@@ -0,0 +1,115 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ChannelInfoName is the name of the channel information file written to
+// each channel directory.
+const ChannelInfoName = "channel.json"
+
+// ChannelInfoVersion is the current version of the ChannelInfo schema.
+// It is incremented whenever a field is removed or changes meaning; new
+// fields may be added without changing the version.
+const ChannelInfoVersion = 1
+
+// ChannelInfo is the schema of the channel information file written to each
+// channel directory when Config.DumpChannelInfo is set. The file is written
+// at the start and end of each archive run of the channel. For example:
+//
+//	{
+//		"version": 1,
+//		"id": "UCuAXFkgsw1L7xaCfnd5JJOw",
+//		"name": "Rick Astley",
+//		"handle": "@rickastleyyt",
+//		"description": "...",
+//		"archived_at": "2025-01-02T15:04:05Z",
+//		"updated_at": "2025-03-04T15:04:05Z"
+//	}
+type ChannelInfo struct {
+	// Version of the schema, currently ChannelInfoVersion.
+	Version int `json:"version"`
+	// Unique channel ID. Also the name of the channel directory.
+	ID string `json:"id"`
+	// Current display name of the channel.
+	Name string `json:"name"`
+	// Channel handle, including the leading "@". May be empty.
+	Handle string `json:"handle"`
+	// Current channel description.
+	Description string `json:"description"`
+	// When the channel was first archived.
+	ArchivedAt time.Time `json:"archived_at"`
+	// When this file was last written.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReadChannelInfo reads the channel information file from the channel
+// directory dir.
+func ReadChannelInfo(dir string) (ChannelInfo, error) {
+	return readChannelInfo(osReader(dir), ChannelInfoName)
+}
+
+// readChannelInfo reads the named channel information file with read.
+func readChannelInfo(read readFunc, name string) (ChannelInfo, error) {
+	var ci ChannelInfo
+
+	dat, err := read(name)
+	if err != nil {
+		return ci, fmt.Errorf("read channel info: %w", err)
+	}
+	if err = json.Unmarshal(dat, &ci); err != nil {
+		return ci, fmt.Errorf("read channel info: %w", err)
+	}
+
+	return ci, nil
+}
+
+// writeChannelInfo writes the channel information for c into its directory
+// under root, preserving when it was first archived.
+func writeChannelInfo(root string, c *cachedChannel) error {
+	dir := filepath.Join(root, c.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("write channel info: %w", err)
+	}
+
+	now := time.Now()
+	ci := ChannelInfo{
+		Version:     ChannelInfoVersion,
+		ID:          c.ID,
+		Name:        c.Name,
+		Handle:      c.Handle,
+		Description: c.Description,
+		ArchivedAt:  now,
+		UpdatedAt:   now,
+	}
+
+	// Files written by older versions have no archived_at; in that case
+	// the best we can do is now.
+	old, err := ReadChannelInfo(dir)
+	if err == nil && !old.ArchivedAt.IsZero() {
+		ci.ArchivedAt = old.ArchivedAt
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Don't clobber a file we can't read (e.g permissions).
+		return err
+	}
+
+	dat, err := json.MarshalIndent(ci, "", "\t")
+	if err != nil {
+		return fmt.Errorf("write channel info: %w", err)
+	}
+
+	path := filepath.Join(dir, ChannelInfoName)
+	if err = os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		return fmt.Errorf("write channel info: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("write channel info: %w", err)
+	}
+
+	return nil
+}
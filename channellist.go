@@ -0,0 +1,223 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// channelBatchSize is the maximum number of IDs the API accepts in one
+// channel lookup.
+const channelBatchSize = 50
+
+var ErrChannelList = errors.New("ytarchiver: channel list")
+
+// channelIDPattern matches a bare channel ID.
+var channelIDPattern = regexp.MustCompile(`^UC[\w-]{22}$`)
+
+// opmlOutline is an outline of an OPML file, which may be a feed or a group
+// of further outlines.
+type opmlOutline struct {
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// ReadChannelList reads the channels listed in the file at path, which is
+// either an OPML file of feeds, as exported by RSS readers subscribed to
+// YouTube channel feeds, or a CSV file with a channel URL, handle or ID in
+// a column of each row, such as the subscriptions.csv of a Google Takeout
+// export. Feeds and rows which are not of a channel are skipped. Each
+// channel is returned once, in the order first listed.
+func ReadChannelList(path string) ([]YouTubeChannel, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrChannelList, err)
+	}
+
+	var chans []YouTubeChannel
+	if bytes.HasPrefix(bytes.TrimSpace(dat), []byte("<")) {
+		chans, err = readChannelOPML(dat)
+	} else {
+		chans, err = readChannelCSV(dat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrChannelList, path, err)
+	}
+	if len(chans) == 0 {
+		return nil, fmt.Errorf("%w: %s: no channels found", ErrChannelList, path)
+	}
+
+	seen := make(map[string]bool)
+	uniq := chans[:0]
+	for _, ch := range chans {
+		if id := strings.ToLower(ch.Identity()); !seen[id] {
+			seen[id] = true
+			uniq = append(uniq, ch)
+		}
+	}
+	return uniq, nil
+}
+
+func readChannelOPML(dat []byte) ([]YouTubeChannel, error) {
+	var doc struct {
+		Outlines []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.Unmarshal(dat, &doc); err != nil {
+		return nil, err
+	}
+
+	var chans []YouTubeChannel
+	var walk func([]opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			if ch, ok := feedChannel(o.XMLURL); ok {
+				chans = append(chans, ch)
+			} else if ch, ok := parseChannel(o.HTMLURL); ok {
+				chans = append(chans, ch)
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Outlines)
+
+	return chans, nil
+}
+
+// feedChannel returns the channel of the YouTube feed URL raw (e.g
+// "https://www.youtube.com/feeds/videos.xml?channel_id=UC..."), if it is
+// one.
+func feedChannel(raw string) (YouTubeChannel, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasSuffix(u.Path, "/feeds/videos.xml") {
+		return YouTubeChannel{}, false
+	}
+	if id := u.Query().Get("channel_id"); id != "" {
+		return YouTubeChannel{ID: id}, true
+	}
+	if user := u.Query().Get("user"); user != "" {
+		return YouTubeChannel{Username: user}, true
+	}
+	return YouTubeChannel{}, false
+}
+
+// parseChannel returns the channel identified by s, which is a channel URL,
+// handle or ID, if it is one.
+func parseChannel(s string) (YouTubeChannel, bool) {
+	s = strings.TrimSpace(s)
+	switch {
+	case channelIDPattern.MatchString(s):
+		return YouTubeChannel{ID: s}, true
+	case strings.HasPrefix(s, "@") && !strings.ContainsAny(s, "/ "):
+		return YouTubeChannel{Handle: s}, true
+	}
+	if ch, ok := feedChannel(s); ok {
+		return ch, true
+	}
+	if t, err := parseTargetURL(s); err == nil && t.Kind == targetChannel {
+		return t.Channel, true
+	}
+	// Channel URLs are often given without a scheme.
+	if !strings.Contains(s, "://") {
+		if t, err := parseTargetURL("https://" + s); err == nil && t.Kind == targetChannel {
+			return t.Channel, true
+		}
+	}
+	return YouTubeChannel{}, false
+}
+
+// readChannelCSV reads the first channel in each row of a CSV file. Rows
+// without one, such as the header, are skipped.
+func readChannelCSV(dat []byte) ([]YouTubeChannel, error) {
+	r := csv.NewReader(bytes.NewReader(dat))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var chans []YouTubeChannel
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cell := range rec {
+			if ch, ok := parseChannel(cell); ok {
+				chans = append(chans, ch)
+				break
+			}
+		}
+	}
+
+	return chans, nil
+}
+
+// ResolveChannels looks up chans using cl, returning the id, snippet and
+// contentDetails parts of those which exist in the order given, each once.
+// Channels given by ID are looked up 50 to a request; handles and usernames
+// cannot be looked up together, so take a request each.
+func ResolveChannels(ctx context.Context, cl YouTubeClient, chans []YouTubeChannel) ([]*youtube.Channel, error) {
+	found := make([]*youtube.Channel, len(chans))
+	var ids []string
+	pos := make(map[string][]int)
+	for i, ch := range chans {
+		if ch.ID != "" {
+			if _, ok := pos[ch.ID]; !ok {
+				ids = append(ids, ch.ID)
+			}
+			pos[ch.ID] = append(pos[ch.ID], i)
+			continue
+		}
+
+		r, err := cl.ListChannel(ctx, ch)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", ch.Identity(), err)
+		}
+		found[i] = r
+	}
+
+	for len(ids) > 0 {
+		batch := ids[:min(channelBatchSize, len(ids))]
+		ids = ids[len(batch):]
+
+		rs, err := cl.ListChannels(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("resolve channels: %w", err)
+		}
+		for _, r := range rs {
+			for _, i := range pos[r.Id] {
+				found[i] = r
+			}
+		}
+	}
+
+	var resolved []*youtube.Channel
+	seen := make(map[string]bool)
+	missing := 0
+	for _, r := range found {
+		switch {
+		case r == nil:
+			missing++
+		case !seen[r.Id]:
+			seen[r.Id] = true
+			resolved = append(resolved, r)
+		}
+	}
+	if missing > 0 {
+		fmt.Printf("resolve channels: %d of %d not found\n", missing, len(chans))
+	}
+
+	return resolved, nil
+}
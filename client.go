@@ -0,0 +1,61 @@
+package ytarchiver
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+	"google.golang.org/api/youtube/v3"
+)
+
+// apiKeyHeader carries the API key in place of the usual query parameter,
+// so that the key is kept out of the request URLs included in errors and
+// traces.
+const apiKeyHeader = "X-Goog-Api-Key"
+
+// apiKeyTransport authenticates each request with an API key.
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t apiKeyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(apiKeyHeader, t.key)
+	return t.base.RoundTrip(r)
+}
+
+// newYouTubeService connects to the YouTube API as configured by cfg.
+// Every request made through the returned service, including those made by
+// selectors, passes through the configured rate limiter and is traced.
+func newYouTubeService(ctx context.Context, cfg Config) (*youtube.Service, error) {
+	// Requests are made as the user if OAuth is configured.
+	var auth http.RoundTripper = apiKeyTransport{cfg.APIKey, http.DefaultTransport}
+	if cfg.OAuthClientID != "" {
+		src, err := oauthTokenSource(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		auth = &oauth2.Transport{Source: src, Base: http.DefaultTransport}
+	}
+
+	// Time spent waiting on the rate limiter is not part of the request.
+	base := tracedTransport(auth, cfg.tracerProvider())
+	if cfg.APIRateLimit > 0 {
+		base = rateLimitedTransport{newTokenBucket(cfg.APIRateLimit, cfg.APIBurst), base}
+	}
+
+	// The built-in telemetry would ignore the configured tracer provider.
+	tr, err := htransport.NewTransport(ctx, base, option.WithoutAuthentication(), option.WithTelemetryDisabled())
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: tr})}
+	if cfg.APIEndpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.APIEndpoint))
+	}
+	return youtube.NewService(ctx, opts...)
+}
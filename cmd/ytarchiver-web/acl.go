@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// userKey is the key of the user of a request in its context.
+	userKey = "user"
+	// authRealm is the realm of the credentials of users.
+	authRealm = `Basic realm="ytarchiver", charset="UTF-8"`
+)
+
+var (
+	ErrUserName     = errors.New("user has no name")
+	ErrUserDup      = errors.New("duplicate user")
+	ErrUserPassword = errors.New("invalid password hash")
+	ErrUserGroup    = errors.New("unknown group")
+)
+
+// A webUser is a user of the interface. For example:
+//
+//	{
+//		"name": "kids",
+//		"password": "$2a$10$...",
+//		"channels": ["@somecartoon"],
+//		"groups": ["kids"]
+//	}
+//
+// A user given neither channels nor groups may see every channel.
+type webUser struct {
+	Name string `json:"name"`
+	// Bcrypt hash of the password, as printed by -hash-password.
+	Password string `json:"password"`
+	// Channels the user may see, by ID or handle, and groups (by ID)
+	// whose channels they may see.
+	Channels []string `json:"channels"`
+	Groups   []string `json:"groups"`
+}
+
+// webUsers are the users of the interface by name, or nil if the interface
+// is open to all.
+var webUsers map[string]*webUser
+
+// verified caches the hash of the last password of each user found to be
+// correct, as bcrypt is deliberately too slow to run for every request of a
+// video being streamed.
+var verified = struct {
+	sync.Mutex
+	sums map[string][sha256.Size]byte
+}{sums: make(map[string][sha256.Size]byte)}
+
+// loadUsers loads the users in the file at path, which holds a JSON array of
+// webUser. The groups must have been loaded.
+func loadUsers(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var users []*webUser
+	if err := json.Unmarshal(dat, &users); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	webUsers = make(map[string]*webUser, len(users))
+	for _, u := range users {
+		switch {
+		case u.Name == "":
+			return ErrUserName
+		case webUsers[u.Name] != nil || u.Name == adminUser:
+			return fmt.Errorf("%w: %q", ErrUserDup, u.Name)
+		}
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			return fmt.Errorf("%w: %q: %v", ErrUserPassword, u.Name, err)
+		}
+		for _, gid := range u.Groups {
+			if !groupConfigured(gid) {
+				return fmt.Errorf("%w: %q of %q", ErrUserGroup, gid, u.Name)
+			}
+		}
+		webUsers[u.Name] = u
+	}
+	return nil
+}
+
+// hashPassword prints the hash of the password read from stdin, for the
+// users file.
+func hashPassword() error {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(strings.TrimRight(line, "\r\n")), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
+// handleUser requires the credentials of a user, if any are configured, and
+// records the user for requestUser. The administrator may see everything.
+func handleUser(c *gin.Context) {
+	if webUsers == nil || isShareRoute(c) {
+		c.Next()
+		return
+	}
+
+	name, pass, ok := c.Request.BasicAuth()
+	sum := sha256.Sum256([]byte(pass))
+	switch u := webUsers[name]; {
+	case !ok:
+	case name == adminUser && adminEnabled():
+		if subtle.ConstantTimeCompare([]byte(pass), []byte(os.Getenv(adminPasswordEnv))) == 1 {
+			c.Set(userKey, &webUser{Name: adminUser})
+			c.Next()
+			return
+		}
+	case u != nil:
+		verified.Lock()
+		known, cached := verified.sums[name]
+		verified.Unlock()
+		if (cached && subtle.ConstantTimeCompare(known[:], sum[:]) == 1) ||
+			bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(pass)) == nil {
+			verified.Lock()
+			verified.sums[name] = sum
+			verified.Unlock()
+
+			c.Set(userKey, u)
+			c.Next()
+			return
+		}
+	}
+
+	c.Header("WWW-Authenticate", authRealm)
+	c.AbortWithStatus(401)
+}
+
+// requestUser returns the user who made the request c, or nil if the
+// interface is open to all.
+func requestUser(c *gin.Context) *webUser {
+	if u, ok := c.Get(userKey); ok {
+		return u.(*webUser)
+	}
+	return nil
+}
+
+// Restricted reports if u may see only some channels.
+func (u *webUser) Restricted() bool {
+	return u != nil && (len(u.Channels) != 0 || len(u.Groups) != 0)
+}
+
+// Allows reports if u may see the channel ch.
+func (u *webUser) Allows(ch ytarchiver.ChannelInfo) bool {
+	if !u.Restricted() {
+		return true
+	}
+
+	refs := []string{ch.ID}
+	if ch.Handle != "" {
+		refs = append(refs, channelRef(ch.Handle))
+	}
+	has := func(list []string) bool {
+		for _, r := range list {
+			for _, ref := range refs {
+				if channelRef(r) == ref {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if has(u.Channels) {
+		return true
+	}
+	for _, g := range groupConfigs {
+		for _, gid := range u.Groups {
+			if g.ID == gid && has(g.Channels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restrict returns dat with only the channels u may see.
+func restrict(dat standardData, u *webUser) standardData {
+	if !u.Restricted() {
+		return dat
+	}
+
+	out := standardData{Videos: make(map[string]videoArray), L: dat.L, restricted: true}
+	for _, ch := range dat.Chans {
+		if u.Allows(ch) {
+			out.Chans = append(out.Chans, ch)
+			out.Videos[ch.ID] = dat.Videos[ch.ID]
+		}
+	}
+	return out
+}
+
+// handleChannelFiles allows only those who may see a channel to fetch the
+// files in its directory, named by the first element of the filepath
+// parameter.
+func handleChannelFiles(c *gin.Context) {
+	u := requestUser(c)
+	if !u.Restricted() {
+		c.Next()
+		return
+	}
+
+	cid, _, _ := strings.Cut(strings.TrimPrefix(c.Param("filepath"), "/"), "/")
+	if !validName(cid) {
+		c.AbortWithStatus(404)
+		return
+	}
+	ch, err := ytarchiver.ReadChannelInfoFS(rootFS, cid)
+	if err != nil || !u.Allows(ch) {
+		c.AbortWithStatus(404)
+		return
+	}
+	c.Next()
+}
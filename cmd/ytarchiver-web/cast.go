@@ -0,0 +1,85 @@
+package main
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mediaTypes are the types of files in the root unknown to the mime package
+// on some systems. Cast receivers refuse media without the right type.
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".m4a":  "audio/mp4",
+	".opus": "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".vtt":  "text/vtt",
+	".srt":  "application/x-subrip",
+}
+
+// registerMediaTypes registers mediaTypes with the mime package, which
+// chooses the Content-Type of files served.
+func registerMediaTypes() error {
+	for ext, typ := range mediaTypes {
+		if err := mime.AddExtensionType(ext, typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCORS allows pages of any origin to fetch files of the root, as cast
+// receivers do for subtitles and streams, and to read the headers needed to
+// seek within them.
+func handleCORS(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Range, Content-Type")
+	c.Header("Access-Control-Expose-Headers", "Accept-Ranges, Content-Length, Content-Range, Content-Type")
+	if c.Request.Method == "OPTIONS" {
+		c.AbortWithStatus(204)
+		return
+	}
+	c.Next()
+}
+
+// publicBase returns the URL at which others on the network reach this
+// server, for links followed away from the page requested by c.
+func publicBase(c *gin.Context) string {
+	if *PublicURL != "" {
+		return strings.TrimSuffix(*PublicURL, "/")
+	}
+
+	// Others cannot reach a host only the browser knows as localhost, for
+	// which -public-url must be given.
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// castMedia describes a video to a cast receiver, which must be given
+// absolute URLs it can reach over the network.
+type castMedia struct {
+	URL, Type, Image string
+}
+
+// newCastMedia returns the media of the video v for a cast from the page
+// requested by c.
+func newCastMedia(c *gin.Context, v videoData) castMedia {
+	base := publicBase(c)
+	m := castMedia{
+		URL:   base + "/videos/" + v.ChannelID + "/" + v.ID + "." + v.Extension,
+		Type:  mime.TypeByExtension("." + v.Extension),
+		Image: v.ThumbnailSrc(),
+	}
+	if strings.HasPrefix(m.Image, "/") {
+		m.Image = base + m.Image
+	}
+	return m
+}
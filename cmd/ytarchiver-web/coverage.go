@@ -0,0 +1,220 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+)
+
+// writableRoot is the path of the root if it is on the local filesystem,
+// for the few changes the interface makes to it, or else empty.
+var writableRoot string
+
+// A coverageMonth counts the known and archived uploads of a channel in one
+// month.
+type coverageMonth struct {
+	Month           time.Time
+	Known, Archived int
+}
+
+// Missing returns the number of known uploads in the month not archived.
+func (m coverageMonth) Missing() int {
+	return m.Known - m.Archived
+}
+
+// A coverageGap is a known upload of a channel which is not archived.
+type coverageGap struct {
+	ID, Title  string
+	UploadedAt time.Time
+	// Whether the video is queued to be downloaded on the next run.
+	Queued bool
+	// Failed attempts at the video, and the error of the last.
+	Failures  int
+	LastError string
+	// Why the downloader reports the video to be permanently unavailable,
+	// if it does, and since when.
+	Unavailable *ytarchiver.UnavailableVideo
+}
+
+// coverage compares the known uploads of a channel, which include those of
+// which only the metadata was archived and those which failed to archive,
+// with those archived.
+type coverage struct {
+	Known, Archived int
+	// Oldest and newest archived uploads.
+	First, Last time.Time
+	// Newest first.
+	Months []coverageMonth
+	// Newest first, followed by those of unknown date.
+	Gaps []coverageGap
+}
+
+// Percent returns the percentage of the known uploads which are archived.
+func (c coverage) Percent() int {
+	if c.Known == 0 {
+		return 100
+	}
+	return c.Archived * 100 / c.Known
+}
+
+// newCoverage returns the coverage of the channel cid given its videos, the
+// quarantined and unavailable videos of the root and the queued videos of
+// the channel.
+func newCoverage(cid string, vids videoArray, quar []ytarchiver.QuarantinedVideo, unavail []ytarchiver.UnavailableVideo, queued []string) coverage {
+	var cov coverage
+	gaps := make(map[string]*coverageGap)
+	months := make(map[time.Time]*coverageMonth)
+
+	count := func(t time.Time, archived bool) {
+		cov.Known++
+		if archived {
+			cov.Archived++
+		}
+		if t.IsZero() {
+			return
+		}
+
+		m := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if months[m] == nil {
+			months[m] = &coverageMonth{Month: m}
+		}
+		months[m].Known++
+		if archived {
+			months[m].Archived++
+			if cov.First.IsZero() || t.Before(cov.First) {
+				cov.First = t
+			}
+			if t.After(cov.Last) {
+				cov.Last = t
+			}
+		}
+	}
+
+	for _, v := range vids {
+		count(v.UploadedAt, !v.MetadataOnly)
+		if v.MetadataOnly {
+			gaps[v.ID] = &coverageGap{ID: v.ID, Title: v.Title, UploadedAt: v.UploadedAt}
+		}
+	}
+	// Videos which failed before anything of them was archived are only
+	// known from the quarantine and unavailable videos.
+	gap := func(id string) *coverageGap {
+		if gaps[id] == nil && !vids.has(id) {
+			count(time.Time{}, false)
+			gaps[id] = &coverageGap{ID: id}
+		}
+		return gaps[id]
+	}
+	for _, q := range quar {
+		if q.ChannelID != cid {
+			continue
+		}
+		if g := gap(q.VideoID); g != nil {
+			g.Failures = q.Failures
+			g.LastError = q.LastError
+		}
+	}
+	for _, u := range unavail {
+		if u.ChannelID != cid {
+			continue
+		}
+		if g := gap(u.VideoID); g != nil {
+			g.Unavailable = &u
+		}
+	}
+	for _, id := range queued {
+		if g := gaps[id]; g != nil {
+			g.Queued = true
+		}
+	}
+
+	for _, m := range months {
+		cov.Months = append(cov.Months, *m)
+	}
+	slices.SortFunc(cov.Months, func(a, b coverageMonth) int {
+		return b.Month.Compare(a.Month)
+	})
+	for _, g := range gaps {
+		cov.Gaps = append(cov.Gaps, *g)
+	}
+	slices.SortFunc(cov.Gaps, func(a, b coverageGap) int {
+		if c := b.UploadedAt.Compare(a.UploadedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return cov
+}
+
+// has reports if v includes the video id.
+func (v videoArray) has(id string) bool {
+	return slices.ContainsFunc(v, func(vid videoData) bool {
+		return vid.ID == id
+	})
+}
+
+// handleCoverage shows the coverage of the channel named by the id
+// parameter.
+func handleCoverage(c *gin.Context) {
+	cid := c.Param("id")
+	dat, cind, err := loadStandardDataChannel(c, cid)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if cind < 0 {
+		c.AbortWithStatus(404)
+		return
+	}
+	dat.L = requestLocale(c)
+
+	quar, err := ytarchiver.ReadQuarantineFS(rootFS)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	unavail, err := ytarchiver.ReadUnavailableFS(rootFS)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	queue, err := ytarchiver.ReadQueueFS(rootFS)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.HTML(200, "coverage.gohtml", struct {
+		standardData
+		Cid      string
+		Cind     int
+		Coverage coverage
+		// Whether gaps may be queued to be downloaded.
+		CanQueue bool
+	}{dat, cid, cind, newCoverage(cid, dat.Videos[cid], quar, unavail, queue[cid]), writableRoot != "" && adminEnabled()})
+}
+
+// handleQueue queues the videos named by the vid form values of the channel
+// named by the cid parameter to be downloaded on its next run.
+func handleQueue(c *gin.Context) {
+	cid := c.Param("cid")
+	ids := c.PostFormArray("vid")
+	if writableRoot == "" {
+		c.AbortWithStatus(404)
+		return
+	}
+	if !validName(cid) || len(ids) == 0 || slices.ContainsFunc(ids, func(id string) bool { return !validName(id) }) {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	if err := ytarchiver.QueueVideos(writableRoot, cid, ids...); err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	c.Redirect(303, "/coverage/"+cid)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+)
+
+// dateFormat is the format of the dates bounding a download.
+const dateFormat = "2006-01-02"
+
+// maxNameLen is the most bytes of a video title kept in a download name,
+// leaving room for the ID and extension within common filesystem limits.
+const maxNameLen = 200
+
+var (
+	ErrDateRange = errors.New("invalid date range")
+	ErrNoSeek    = errors.New("file cannot be seeked")
+)
+
+// handleDownload streams a tar archive of the videos and metadata of the
+// channel named by the cid parameter ("{cid}.tar"). If either of the from
+// and to query parameters are given, only the videos uploaded within those
+// dates (inclusive) are included, which excludes any without metadata.
+func handleDownload(c *gin.Context) {
+	cid, ok := strings.CutSuffix(c.Param("cid"), ".tar")
+	if !ok || !validName(cid) {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	from, to, err := parseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+	filtered := !from.IsZero() || !to.IsZero()
+
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	vids, ok := dat.Videos[cid]
+	if !ok {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	include := make(map[string]bool, len(vids))
+	for _, v := range vids {
+		include[v.ID] = (from.IsZero() || !v.UploadedAt.Before(from)) &&
+			(to.IsZero() || v.UploadedAt.Before(to))
+	}
+
+	ents, err := fs.ReadDir(rootFS, cid)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	// A whole channel takes far longer to send than the server allows
+	// for an ordinary response.
+	clearWriteDeadline(c)
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cid+".tar"))
+	c.Status(200)
+
+	tw := tar.NewWriter(c.Writer)
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		// Everything but the channel info belongs to a video.
+		if id, _, _ := strings.Cut(name, "."); filtered && name != ytarchiver.ChannelInfoName && !include[id] {
+			continue
+		}
+
+		// Once the response has begun, an error can only be signalled
+		// by cutting the archive short.
+		if err := addTarFile(tw, cid, name); err != nil {
+			c.Error(err)
+			log.Println("Download:", err)
+			return
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// handleDownloadVideo serves the video file of the video vid of the channel
+// cid as an attachment named after its title, supporting ranges so that an
+// interrupted download may be resumed.
+func handleDownloadVideo(c *gin.Context) {
+	cid, vid := c.Param("cid"), c.Param("vid")
+	if !validName(cid) || !validName(vid) {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	dat, _, vind, err := loadStandardDataVideo(c, cid, vid)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if vind < 0 || dat.Videos[cid][vind].MetadataOnly {
+		c.AbortWithStatus(404)
+		return
+	}
+	serveVideoFile(c, dat.Videos[cid][vind], true)
+}
+
+// serveVideoFile serves the video file of v, supporting ranges, and as an
+// attachment named after its title if attach is set.
+func serveVideoFile(c *gin.Context, v videoData, attach bool) {
+	f, err := rootFS.Open(path.Join(v.ChannelID, v.ID+"."+v.Extension))
+	if errors.Is(err, fs.ErrNotExist) {
+		c.AbortWithStatus(404)
+		return
+	} else if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		c.AbortWithError(500, ErrNoSeek)
+		return
+	}
+
+	clearWriteDeadline(c)
+	if attach {
+		c.Header("Content-Disposition", contentDisposition(downloadName(v)))
+	}
+	http.ServeContent(c.Writer, c.Request, "."+v.Extension, info.ModTime(), rs)
+}
+
+// clearWriteDeadline lifts the write timeout of the server for a response
+// which may take much longer to send.
+func clearWriteDeadline(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Println("Download: clearing write deadline:", err)
+	}
+}
+
+// validName reports if name may name a file in the root, without leaving
+// the directory it is in or naming archiver state.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/\\") && !strings.HasPrefix(name, ".")
+}
+
+// addTarFile adds the file name in the channel directory cid to tw.
+func addTarFile(tw *tar.Writer, cid, name string) error {
+	f, err := rootFS.Open(path.Join(cid, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = path.Join(cid, name)
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// parseDateRange parses the dates bounding a download, either of which may
+// be empty. The returned range is [from, to), so includes the whole of the
+// day to.
+func parseDateRange(fromStr, toStr string) (from, to time.Time, err error) {
+	if fromStr != "" {
+		if from, err = time.Parse(dateFormat, fromStr); err != nil {
+			return from, to, fmt.Errorf("%w: %v", ErrDateRange, err)
+		}
+	}
+	if toStr != "" {
+		if to, err = time.Parse(dateFormat, toStr); err != nil {
+			return from, to, fmt.Errorf("%w: %v", ErrDateRange, err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("%w: %s is after %s", ErrDateRange, fromStr, toStr)
+	}
+	return from, to, nil
+}
+
+// downloadName returns the name under which the file of v is downloaded:
+// "<title> [<id>].<ext>", with the title made safe for common filesystems.
+func downloadName(v videoData) string {
+	title := strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ' || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, v.Title)
+	title = strings.Join(strings.Fields(title), " ")
+
+	// Truncate on a rune boundary.
+	if len(title) > maxNameLen {
+		title = title[:maxNameLen]
+		for !utf8.ValidString(title) {
+			title = title[:len(title)-1]
+		}
+	}
+	// Leading dots would hide the file, and Windows strips trailing ones.
+	title = strings.Trim(title, ". ")
+
+	if title == "" {
+		return fmt.Sprintf("%s.%s", v.ID, v.Extension)
+	}
+	return fmt.Sprintf("%s [%s].%s", title, v.ID, v.Extension)
+}
+
+// contentDisposition returns the Content-Disposition header attaching a file
+// named name, which may contain any characters. Clients which do not
+// understand the extended parameter (RFC 6266) get an ASCII approximation.
+func contentDisposition(name string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > '~' || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	ext := &strings.Builder{}
+	for _, b := range []byte(name) {
+		if b >= '0' && b <= '9' || b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			ext.WriteByte(b)
+		} else {
+			fmt.Fprintf(ext, "%%%02X", b)
+		}
+	}
+
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, ascii, ext)
+}
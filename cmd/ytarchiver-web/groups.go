@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrGroupID       = errors.New("invalid group ID")
+	ErrGroupDup      = errors.New("duplicate group ID")
+	ErrGroupChanDup  = errors.New("channel in more than one group")
+	ErrGroupNoName   = errors.New("group has no name")
+	ErrGroupNoChans  = errors.New("group has no channels")
+	ErrGroupEmptyRef = errors.New("empty channel in group")
+)
+
+// A groupConfig configures a group of channels, listed together on the
+// index page and on a page of their own. For example:
+//
+//	{
+//		"id": "music",
+//		"name": "Music",
+//		"channels": ["UCuAXFkgsw1L7xaCfnd5JJOw", "@someband"]
+//	}
+type groupConfig struct {
+	// Unique ID of the group, which names its page.
+	ID string `json:"id"`
+	// Display name of the group.
+	Name string `json:"name"`
+	// Channels in the group, in the order they are listed, by ID or by
+	// handle (including the leading "@").
+	Channels []string `json:"channels"`
+}
+
+// groupConfigs is every configured group, in the order they are listed.
+var groupConfigs []groupConfig
+
+// loadGroups loads the groups configured in the file at path, which holds a
+// JSON array of groupConfig.
+func loadGroups(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var groups []groupConfig
+	if err := json.Unmarshal(dat, &groups); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	ids := make(map[string]bool, len(groups))
+	refs := make(map[string]string)
+	for _, g := range groups {
+		switch {
+		case !validName(g.ID):
+			return fmt.Errorf("%w: %q", ErrGroupID, g.ID)
+		case ids[g.ID]:
+			return fmt.Errorf("%w: %q", ErrGroupDup, g.ID)
+		case g.Name == "":
+			return fmt.Errorf("%w: %q", ErrGroupNoName, g.ID)
+		case len(g.Channels) == 0:
+			return fmt.Errorf("%w: %q", ErrGroupNoChans, g.ID)
+		}
+		ids[g.ID] = true
+
+		for _, ref := range g.Channels {
+			if ref == "" {
+				return fmt.Errorf("%w: %q", ErrGroupEmptyRef, g.ID)
+			}
+			ref = channelRef(ref)
+			if other, ok := refs[ref]; ok {
+				return fmt.Errorf("%w: %s in %q and %q", ErrGroupChanDup, ref, other, g.ID)
+			}
+			refs[ref] = g.ID
+		}
+	}
+
+	groupConfigs = groups
+	return nil
+}
+
+// channelRef normalizes a reference to a channel in a group, as handles are
+// not case sensitive.
+func channelRef(ref string) string {
+	if strings.HasPrefix(ref, "@") {
+		return strings.ToLower(ref)
+	}
+	return ref
+}
+
+// A channelGroup is a group of the channels in the root.
+type channelGroup struct {
+	// ID and display name of the group, both empty for the channels in no
+	// group.
+	ID, Name string
+	Chans    []ytarchiver.ChannelInfo
+}
+
+// groupChannels arranges chans into the configured groups, in their
+// configured order, followed by any channels in no group ordered by name.
+// Configured groups are included even if none of their channels are in
+// chans. Hidden channels are left out.
+func groupChannels(chans []ytarchiver.ChannelInfo) []channelGroup {
+	chans = slices.DeleteFunc(slices.Clone(chans), func(c ytarchiver.ChannelInfo) bool {
+		return hiddenChannels.Hidden(c.ID)
+	})
+
+	byRef := make(map[string]ytarchiver.ChannelInfo, 2*len(chans))
+	for _, c := range chans {
+		byRef[c.ID] = c
+		if c.Handle != "" {
+			byRef[channelRef(c.Handle)] = c
+		}
+	}
+
+	groups := make([]channelGroup, 0, len(groupConfigs)+1)
+	grouped := make(map[string]bool, len(chans))
+	for _, gc := range groupConfigs {
+		g := channelGroup{ID: gc.ID, Name: gc.Name}
+		for _, ref := range gc.Channels {
+			// A channel may be named both by ID and by handle.
+			if c, ok := byRef[channelRef(ref)]; ok && !grouped[c.ID] {
+				g.Chans = append(g.Chans, c)
+				grouped[c.ID] = true
+			}
+		}
+		groups = append(groups, g)
+	}
+
+	var rest []ytarchiver.ChannelInfo
+	for _, c := range chans {
+		if !grouped[c.ID] {
+			rest = append(rest, c)
+		}
+	}
+	if len(rest) != 0 {
+		slices.SortStableFunc(rest, func(a, b ytarchiver.ChannelInfo) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+		groups = append(groups, channelGroup{Chans: rest})
+	}
+
+	return groups
+}
+
+// Groups returns the channels arranged into groups. Groups with none of the
+// channels a user may see are left out for them.
+func (d standardData) Groups() []channelGroup {
+	groups := groupChannels(d.Chans)
+	if d.restricted {
+		groups = slices.DeleteFunc(groups, func(g channelGroup) bool {
+			return len(g.Chans) == 0
+		})
+	}
+	return groups
+}
+
+// groupConfigured reports if the group id is configured.
+func groupConfigured(id string) bool {
+	return slices.ContainsFunc(groupConfigs, func(g groupConfig) bool {
+		return g.ID == id
+	})
+}
+
+// indexData is the data of the index page, which lists channels.
+type indexData struct {
+	standardData
+	Title, Heading string
+	// Groups of channels listed, with headings if Sections is set.
+	Shown    []channelGroup
+	Sections bool
+	// ID of the group whose page this is, else empty.
+	Group string
+}
+
+// handleGroup lists the channels of the group named by the id parameter.
+func handleGroup(c *gin.Context) {
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	dat.L = requestLocale(c)
+
+	groups := dat.Groups()
+	ind := slices.IndexFunc(groups, func(g channelGroup) bool {
+		return g.ID != "" && g.ID == c.Param("id")
+	})
+	if ind < 0 {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	c.HTML(200, "index.gohtml", indexData{
+		standardData: dat,
+		Title:        groups[ind].Name,
+		Heading:      groups[ind].Name,
+		Shown:        groups[ind : ind+1],
+		Group:        groups[ind].ID,
+	})
+}
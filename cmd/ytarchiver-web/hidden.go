@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// adminUser is the user name for administration of the interface.
+	adminUser = "admin"
+	// adminPasswordEnv holds the password for administration of the
+	// interface, which is disabled if it is unset.
+	adminPasswordEnv = "YTARCHIVER_WEB_ADMIN_PASSWORD"
+)
+
+// hiddenChannels are the channels left off the index page and menus, such
+// as those no longer archived, though still served by their own URLs.
+var hiddenChannels = &hiddenSet{ids: make(map[string]bool)}
+
+// A hiddenSet is a set of hidden channels, saved to a file as a JSON array
+// of their IDs.
+type hiddenSet struct {
+	mut  sync.RWMutex
+	path string
+	ids  map[string]bool
+}
+
+// Load loads the set saved at path, which is then saved to whenever the set
+// changes. A missing file is an empty set.
+func (h *hiddenSet) Load(path string) error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	h.path = path
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var ids []string
+	if err := json.Unmarshal(dat, &ids); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, id := range ids {
+		h.ids[id] = true
+	}
+	return nil
+}
+
+// Hidden reports if the channel cid is hidden.
+func (h *hiddenSet) Hidden(cid string) bool {
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+
+	return h.ids[cid]
+}
+
+// Set hides or shows the channel cid, and saves the set.
+func (h *hiddenSet) Set(cid string, hidden bool) error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if h.ids[cid] == hidden {
+		return nil
+	}
+	if hidden {
+		h.ids[cid] = true
+	} else {
+		delete(h.ids, cid)
+	}
+
+	ids := make([]string, 0, len(h.ids))
+	for id := range h.ids {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	dat, err := json.MarshalIndent(ids, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Written whole then renamed, so that a crash never loses the set.
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// adminEnabled reports if administration of the interface is enabled.
+func adminEnabled() bool {
+	return os.Getenv(adminPasswordEnv) != ""
+}
+
+// handleAdmin requires the credentials of the administrator. As browsers
+// send remembered credentials with forms posted from any site, requests
+// from other origins are refused.
+func handleAdmin(c *gin.Context) {
+	pass := os.Getenv(adminPasswordEnv)
+	if pass == "" {
+		c.AbortWithStatus(404)
+		return
+	}
+	if origin := c.GetHeader("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != c.Request.Host {
+			c.AbortWithStatus(403)
+			return
+		}
+	}
+	gin.BasicAuth(gin.Accounts{adminUser: pass})(c)
+}
+
+// handleHide hides the channel named by the cid parameter if the hidden form
+// value is "true", or else shows it, then returns to the channel page.
+func handleHide(c *gin.Context) {
+	cid := c.Param("cid")
+	if !validName(cid) {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	if err := hiddenChannels.Set(cid, c.PostForm("hidden") == "true"); err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	c.Redirect(303, "/chan/"+cid)
+}
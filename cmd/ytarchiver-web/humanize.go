@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// humanDuration formats a duration in seconds as [h:]mm:ss (e.g "1:02:33").
+func humanDuration(secs int) string {
+	h, m, s := secs/3600, secs/60%60, secs%60
+	if h != 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// humanBytes formats a size in bytes in binary units (e.g "1.4 GiB"), or is
+// empty if the size is zero (unknown).
+func humanBytes(n int64) string {
+	const units = "KMGTPE"
+
+	switch {
+	case n == 0:
+		return ""
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(1<<10), 0
+	for m := n >> 10; m >= 1<<10 && exp < len(units)-1; m >>= 10 {
+		div <<= 10
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), units[exp])
+}
+
+// Ago formats how long before now t was (e.g "3 days ago"), to the largest
+// whole unit, or is empty if t is zero.
+func (l *locale) Ago(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := time.Since(t)
+	units := []struct {
+		dur       time.Duration
+		one, many string
+	}{
+		{365 * 24 * time.Hour, "ago_year", "ago_years"},
+		{30 * 24 * time.Hour, "ago_month", "ago_months"},
+		{7 * 24 * time.Hour, "ago_week", "ago_weeks"},
+		{24 * time.Hour, "ago_day", "ago_days"},
+		{time.Hour, "ago_hour", "ago_hours"},
+		{time.Minute, "ago_minute", "ago_minutes"},
+	}
+	for _, u := range units {
+		switch n := int(d / u.dur); {
+		case n == 1:
+			return l.T(u.one)
+		case n > 1:
+			return l.T(u.many, n)
+		}
+	}
+
+	// Including anything dated in the future, such as a premiere.
+	return l.T("ago_now")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+const (
+	// localesDir holds a message catalog for each language of the
+	// interface, named by its BCP 47 tag (e.g "de.json").
+	localesDir = "locales"
+	// defaultLang is used for any message missing from the catalog of
+	// another language, and if no other language is acceptable.
+	defaultLang = "en"
+	// langCookie holds the language chosen by the user, which takes
+	// precedence over the Accept-Language header.
+	langCookie = "lang"
+	// langCookieAge is how long the choice of language is remembered.
+	langCookieAge = 365 * 24 * 60 * 60
+	// localeKey is the key of the locale of a request in its context.
+	localeKey = "locale"
+)
+
+var ErrNoDefaultLang = errors.New("no catalog for the default language " + defaultLang)
+
+// A catalog holds the messages of the interface in one language, and how
+// dates and durations are written in it.
+type catalog struct {
+	// Name of the language, in that language.
+	Name string `json:"name"`
+	// Layouts (see time.Layout) of dates, and of dates with times.
+	// Month names are written in full ("January"), and replaced by those
+	// in Months.
+	DateLayout     string `json:"date_layout"`
+	DateTimeLayout string `json:"datetime_layout"`
+	// Names of the months, January first. English if empty.
+	Months []string `json:"months"`
+	// Messages by key, which are formats for fmt.Sprintf.
+	Messages map[string]string `json:"messages"`
+}
+
+// catalogs is every catalog loaded, by language tag.
+var catalogs map[string]*catalog
+
+// langMatcher chooses between the languages of catalogs, in the order of
+// langTags.
+var (
+	langTags    []language.Tag
+	langMatcher language.Matcher
+)
+
+// loadCatalogs loads the catalogs in dir.
+func loadCatalogs(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	catalogs = make(map[string]*catalog, len(paths))
+	for _, p := range paths {
+		dat, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		cat := &catalog{}
+		if err := json.Unmarshal(dat, cat); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if len(cat.Months) != 0 && len(cat.Months) != 12 {
+			return fmt.Errorf("%s: %d months", p, len(cat.Months))
+		}
+
+		tag, err := language.Parse(strings.TrimSuffix(filepath.Base(p), ".json"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		catalogs[tag.String()] = cat
+	}
+	if catalogs[defaultLang] == nil {
+		return ErrNoDefaultLang
+	}
+
+	// The default comes first, so that it is chosen if nothing else
+	// matches.
+	langTags = []language.Tag{language.Make(defaultLang)}
+	for tag := range catalogs {
+		if tag != defaultLang {
+			langTags = append(langTags, language.Make(tag))
+		}
+	}
+	slices.SortFunc(langTags[1:], func(a, b language.Tag) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	langMatcher = language.NewMatcher(langTags)
+
+	return nil
+}
+
+// handleLocale chooses the locale of each request: that given by the lang
+// query parameter, which is then remembered, or else the one last chosen,
+// or else the best match for the Accept-Language header.
+func handleLocale(c *gin.Context) {
+	choice, _ := c.Cookie(langCookie)
+	if q := c.Query("lang"); q != "" {
+		if tag, err := language.Parse(q); err == nil && catalogs[tag.String()] != nil {
+			choice = tag.String()
+			c.SetCookie(langCookie, choice, langCookieAge, "/", "", false, true)
+		}
+	}
+
+	_, i := language.MatchStrings(langMatcher, choice, c.GetHeader("Accept-Language"))
+	tag := langTags[i].String()
+	c.Set(localeKey, &locale{Tag: tag, cat: catalogs[tag]})
+	c.Next()
+}
+
+// requestLocale returns the locale chosen for c by handleLocale.
+func requestLocale(c *gin.Context) *locale {
+	if l, ok := c.Get(localeKey); ok {
+		return l.(*locale)
+	}
+	return &locale{Tag: defaultLang, cat: catalogs[defaultLang]}
+}
+
+// A locale localizes the interface for a request.
+type locale struct {
+	// Language tag, for the lang attribute of pages.
+	Tag string
+	cat *catalog
+}
+
+// T returns the message key, formatted with args.
+func (l *locale) T(key string, args ...any) string {
+	msg, ok := l.cat.Messages[key]
+	if !ok {
+		if msg, ok = catalogs[defaultLang].Messages[key]; !ok {
+			msg = key
+		}
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Date formats the date of t, or is empty if t is zero.
+func (l *locale) Date(t time.Time) string {
+	return l.format(t, l.cat.DateLayout)
+}
+
+// DateTime formats the date and time of t, or is empty if t is zero.
+func (l *locale) DateTime(t time.Time) string {
+	return l.format(t, l.cat.DateTimeLayout)
+}
+
+func (l *locale) format(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	s := t.Format(layout)
+	if len(l.cat.Months) != 0 {
+		s = strings.Replace(s, t.Month().String(), l.cat.Months[t.Month()-1], 1)
+	}
+	return s
+}
+
+// Duration formats d to the second, with the units of the language.
+func (l *locale) Duration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+
+	var parts []string
+	if h != 0 {
+		parts = append(parts, l.T("unit_hours", h))
+	}
+	if m != 0 {
+		parts = append(parts, l.T("unit_minutes", m))
+	}
+	if s != 0 || len(parts) == 0 {
+		parts = append(parts, l.T("unit_seconds", s))
+	}
+	return strings.Join(parts, " ")
+}
+
+// A langOption is a language which may be chosen for the interface.
+type langOption struct {
+	Tag, Name string
+}
+
+// Languages returns the languages which may be chosen.
+func (l *locale) Languages() []langOption {
+	opts := make([]langOption, len(langTags))
+	for i, tag := range langTags {
+		opts[i] = langOption{tag.String(), catalogs[tag.String()].Name}
+	}
+	return opts
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// videoOrders are the orders in which the videos of a channel may be listed,
+// by the value of the sort query parameter. The default is newest first.
+var videoOrders = map[string]func(a, b videoData) int{
+	"oldest": func(a, b videoData) int { return a.UploadedAt.Compare(b.UploadedAt) },
+	"title":  func(a, b videoData) int { return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) },
+	// The rest are largest first.
+	"duration":   func(a, b videoData) int { return cmp.Compare(b.Duration, a.Duration) },
+	"size":       func(a, b videoData) int { return cmp.Compare(b.Size, a.Size) },
+	"resolution": func(a, b videoData) int { return cmp.Compare(b.Height, a.Height) },
+}
+
+// listing is the videos of a channel, sorted and filtered as given by the
+// query parameters of the request:
+//
+//	sort   - one of the keys of videoOrders
+//	codec  - video codec family (e.g "vp9"), as given by CodecFamily
+//	height - least vertical resolution
+type listing struct {
+	Vids      videoArray
+	Sort      string
+	Codec     string
+	MinHeight int
+	// Video codec families of all the videos, for filtering.
+	Codecs []string
+}
+
+func newListing(vids videoArray, q url.Values) listing {
+	l := listing{
+		Sort:  q.Get("sort"),
+		Codec: q.Get("codec"),
+	}
+	l.MinHeight, _ = strconv.Atoi(q.Get("height"))
+
+	// The videos are shared with the mirror index, so are never sorted
+	// in place.
+	for _, v := range vids {
+		if c := v.CodecFamily(); c != "" && !slices.Contains(l.Codecs, c) {
+			l.Codecs = append(l.Codecs, c)
+		}
+		if l.Codec != "" && v.CodecFamily() != l.Codec || v.Height < l.MinHeight {
+			continue
+		}
+		l.Vids = append(l.Vids, v)
+	}
+	slices.Sort(l.Codecs)
+
+	if order, ok := videoOrders[l.Sort]; ok {
+		slices.SortStableFunc(l.Vids, order)
+	}
+
+	return l
+}
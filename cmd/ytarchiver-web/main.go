@@ -2,26 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"path"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	ytarchiver "github.com/ejv2/yt-archiver"
 	"github.com/gin-gonic/gin"
 )
 
 var (
 	ListenAddr = flag.String("listen", ":80", "Address to listen on, in the format [hostname]:port")
-	Root       = flag.String("root", ".", "ytarchiver root directory to load files from")
+	Root       = flag.String("root", ".", "ytarchiver root directory to load files from, or an sftp:// or http(s):// WebDAV URL of a remote root")
+	Mirror     = flag.Bool("mirror", false, "serve a root written from another host (e.g over NFS) from a periodically rebuilt index")
+	Reindex    = flag.Duration("reindex", 10*time.Minute, "interval between full reindexes of the root in mirror mode")
+	Groups     = flag.String("groups", "", "JSON file of groups of channels to list together, in order (see groups.json.sample)")
+	PublicURL  = flag.String("public-url", "", "URL at which cast devices and the recipients of shared links reach this server, if not that in the address bar (e.g when browsing it as localhost)")
+	ShareKey   = flag.String("share-key", "share.key", "file of the key signing shared links, generated if missing; replace it to revoke every link")
+	Hidden     = flag.String("hidden", "hidden.json", "JSON file of the channels hidden from the index, written when the administrator hides a channel")
+	Users      = flag.String("users", "", "JSON file of the users allowed to log in, and the channels each may see (see users.json.sample)")
+	HashPass   = flag.Bool("hash-password", false, "print the hash of a password read from standard input, for the users file, and exit")
 )
 
+// rootFS is the archive root, which may be remote.
+var rootFS fs.FS
+
 type multiError []error
 
 func (m multiError) Error() string {
@@ -37,39 +50,41 @@ func (m multiError) Error() string {
 	return sb.String()
 }
 
-type channelData struct {
-	ID   string
-	Name string
+type videoData struct {
+	ytarchiver.VideoMeta
+	// Whether a storyboard was generated for the video.
+	Storyboard bool
 }
 
-type videoTimestamp time.Time
-
-func (v *videoTimestamp) UnmarshalJSON(src []byte) error {
-	buf := ""
-	err := json.Unmarshal(src, &buf)
-	if err != nil {
-		return err
+// ThumbnailSrc returns the local thumbnail of the video if one was
+// downloaded, else the thumbnail on YouTube.
+func (v videoData) ThumbnailSrc() string {
+	if v.Thumbnail != "" {
+		return "/videos/" + v.ChannelID + "/" + v.Thumbnail
 	}
 
-	t, err := time.Parse("20060102", buf)
-	if err != nil {
-		return err
+	return v.ThumbnailURL
+}
+
+// ResolutionString formats the vertical resolution of the video (e.g
+// "1080p"), or is empty if unknown.
+func (v videoData) ResolutionString() string {
+	if v.Height == 0 {
+		return ""
 	}
+	return fmt.Sprintf("%dp", v.Height)
+}
 
-	*v = videoTimestamp(t)
-	return nil
+// CodecFamily returns the video codec without its profile and level (e.g
+// "avc1" for "avc1.640028").
+func (v videoData) CodecFamily() string {
+	family, _, _ := strings.Cut(v.VideoCodec, ".")
+	return family
 }
 
-type videoData struct {
-	ID           string         `json:"id"`
-	Title        string         `json:"title"`
-	Description  string         `json:"description"`
-	ThumbnailURL string         `json:"thumbnail"`
-	Duration     string         `json:"duration_string"`
-	ChannelID    string         `json:"channel_id"`
-	Timestamp    videoTimestamp `json:"upload_date"`
-	WasLive      bool           `json:"was_live"`
-	Extension    string         `json:"ext"`
+// StoryboardSrc returns the storyboard WebVTT file of the video.
+func (v videoData) StoryboardSrc() string {
+	return "/videos/" + v.ChannelID + "/" + v.ID + ytarchiver.StoryboardVTTSuffix
 }
 
 type videoArray []videoData
@@ -80,7 +95,7 @@ func (v videoArray) Len() int {
 
 func (v videoArray) Less(i, j int) bool {
 	// NOTE: Sorting in reverse here so that most recent timestamp comes first.
-	return time.Time(v[j].Timestamp).Before(time.Time(v[i].Timestamp))
+	return v[j].UploadedAt.Before(v[i].UploadedAt)
 }
 
 func (v videoArray) Swap(i, j int) {
@@ -90,64 +105,105 @@ func (v videoArray) Swap(i, j int) {
 }
 
 type standardData struct {
-	Chans  []channelData
+	Chans  []ytarchiver.ChannelInfo
 	Videos map[string]videoArray
+	// Locale of the request being served.
+	L *locale
+	// Set if only the channels a user may see are included.
+	restricted bool
 }
 
-func loadStandardData() (standardData, error) {
+// Restricted reports if only the channels a user may see are included.
+func (d standardData) Restricted() bool {
+	return d.restricted
+}
+
+// loadStandardData returns the contents of the root which the user of c may
+// see, from the index in mirror mode.
+func loadStandardData(c *gin.Context) (standardData, error) {
+	var dat standardData
+	var err error
+	if mirror != nil {
+		dat, err = mirror.Data()
+	} else {
+		dat, err = readStandardData()
+	}
+	return restrict(dat, requestUser(c)), err
+}
+
+// loadHistory returns the run history of the root, from the index in mirror
+// mode.
+func loadHistory() ([]ytarchiver.RunRecord, error) {
+	if mirror != nil {
+		return mirror.History()
+	}
+	return ytarchiver.ReadHistoryFS(rootFS)
+}
+
+// readStandardData reads the contents of the root.
+func readStandardData() (standardData, error) {
 	dat := standardData{Videos: make(map[string]videoArray)}
 	errs := make(multiError, 0, 4)
 
-	chandirs, err := os.ReadDir(*Root)
+	chandirs, err := fs.ReadDir(rootFS, ".")
 	if err != nil {
 		return dat, fmt.Errorf("standard data: reading channels: %w", err)
 	}
 
 	for _, c := range chandirs {
-		if !c.IsDir() {
-			continue
-		}
-
-		path := filepath.Join(*Root, c.Name(), "channel.json")
-		fdat, err := os.ReadFile(path)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("standard data: reading channel data: %w", err))
+		// Hidden directories hold archiver state, and the object
+		// store media files, not channels.
+		if !c.IsDir() || strings.HasPrefix(c.Name(), ".") || c.Name() == ytarchiver.ObjectsDir {
 			continue
 		}
 
-		var chanobj channelData
-		err = json.Unmarshal(fdat, &chanobj)
+		chanobj, err := ytarchiver.ReadChannelInfoFS(rootFS, c.Name())
 		if err != nil {
-			errs = append(errs, fmt.Errorf("standard data: parsing channel data: %w", err))
+			errs = append(errs, fmt.Errorf("standard data: %w", err))
 			continue
 		}
 
 		dat.Chans = append(dat.Chans, chanobj)
 
-		chanpath := filepath.Join(*Root, c.Name())
-		vidfiles, err := os.ReadDir(chanpath)
+		vidfiles, err := fs.ReadDir(rootFS, c.Name())
 		if err != nil {
 			errs = append(errs, fmt.Errorf("standard data: reading channel videos: %w", err))
 			continue
 		}
 
+		names := make(map[string]fs.DirEntry, len(vidfiles))
 		for _, v := range vidfiles {
-			if strings.HasSuffix(v.Name(), ".info.json") {
-				path := filepath.Join(*Root, c.Name(), v.Name())
-				fdat, err := os.ReadFile(path)
+			names[v.Name()] = v
+		}
+
+		for _, v := range vidfiles {
+			if id, ok := strings.CutSuffix(v.Name(), ytarchiver.VideoMetaSuffix); ok {
+				meta, err := ytarchiver.ReadVideoMetaFS(rootFS, c.Name(), id)
 				if err != nil {
-					errs = append(errs, fmt.Errorf("standard data: reading video data: %w", err))
+					errs = append(errs, fmt.Errorf("standard data: %w", err))
 					continue
 				}
 
-				var video videoData
-				err = json.Unmarshal(fdat, &video)
-				if err != nil {
-					errs = append(errs, fmt.Errorf("standard data: parsing video data: %w", err))
-					continue
+				// Metadata written before a poster frame was
+				// extracted does not name it.
+				if _, ok := names[id+ytarchiver.PosterSuffix]; ok && meta.Thumbnail == "" {
+					meta.Thumbnail = id + ytarchiver.PosterSuffix
+				}
+				// Nor does metadata written before sizes were
+				// recorded.
+				if ent, ok := names[id+"."+meta.Extension]; ok && meta.Size == 0 && !meta.MetadataOnly {
+					// Videos in the object store are linked to.
+					info, err := ent.Info()
+					if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+						info, err = fs.Stat(rootFS, path.Join(c.Name(), ent.Name()))
+					}
+					if err == nil {
+						meta.Size = info.Size()
+					}
 				}
 
-				dat.Videos[chanobj.ID] = append(dat.Videos[chanobj.ID], video)
+				_, storyboard := names[id+ytarchiver.StoryboardVTTSuffix]
+				dat.Videos[chanobj.ID] = append(dat.Videos[chanobj.ID], videoData{meta, storyboard})
 			}
 		}
 
@@ -163,13 +219,13 @@ func loadStandardData() (standardData, error) {
 }
 
 // loadStandardDataChannel is kind of lazy and inefficient, but what the hell
-func loadStandardDataChannel(cid string) (standardData, int, error) {
-	dat, err := loadStandardData()
+func loadStandardDataChannel(c *gin.Context, cid string) (standardData, int, error) {
+	dat, err := loadStandardData(c)
 	if err != nil {
 		return dat, -1, err
 	}
 
-	chanind := 0
+	chanind := -1
 	for i, c := range dat.Chans {
 		if c.ID == cid {
 			chanind = i
@@ -182,8 +238,8 @@ func loadStandardDataChannel(cid string) (standardData, int, error) {
 
 // loadStandardDataVideo has the same problems (if not worse) as loadStandardDataChannel,
 // but I am tired and can't be bothered.
-func loadStandardDataVideo(cid, vid string) (standardData, int, int, error) {
-	dat, chanind, err := loadStandardDataChannel(cid)
+func loadStandardDataVideo(c *gin.Context, cid, vid string) (standardData, int, int, error) {
+	dat, chanind, err := loadStandardDataChannel(c, cid)
 	if err != nil {
 		return dat, -1, -1, err
 	}
@@ -208,12 +264,19 @@ func limitString(arg string, lim int) string {
 }
 
 func handleRoot(c *gin.Context) {
-	dat, err := loadStandardData()
+	dat, err := loadStandardData(c)
 	if err != nil {
 		c.AbortWithError(500, err)
 	}
-
-	c.HTML(200, "index.gohtml", dat)
+	dat.L = requestLocale(c)
+
+	c.HTML(200, "index.gohtml", indexData{
+		standardData: dat,
+		Title:        dat.L.T("title_home"),
+		Heading:      dat.L.T("index_heading"),
+		Shown:        dat.Groups(),
+		Sections:     len(groupConfigs) != 0,
+	})
 }
 
 func handleChannel(c *gin.Context) {
@@ -222,16 +285,25 @@ func handleChannel(c *gin.Context) {
 		log.Panicln("got empty ID parameter in required route")
 	}
 
-	dat, cind, err := loadStandardDataChannel(cid)
+	dat, cind, err := loadStandardDataChannel(c, cid)
 	if err != nil {
 		c.AbortWithError(500, err)
 	}
+	if cind < 0 {
+		c.AbortWithStatus(404)
+		return
+	}
+	dat.L = requestLocale(c)
 
+	l := newListing(dat.Videos[cid], c.Request.URL.Query())
 	c.HTML(200, "channel.gohtml", struct {
 		standardData
-		Cid  string
-		Cind int
-	}{dat, cid, cind})
+		Cid    string
+		Cind   int
+		Hidden bool
+		Admin  bool
+		listing
+	}{dat, cid, cind, hiddenChannels.Hidden(cid), adminEnabled(), l})
 }
 
 func handleVideo(c *gin.Context) {
@@ -241,32 +313,139 @@ func handleVideo(c *gin.Context) {
 		log.Panicln("got empty ID/VID parameter in required route")
 	}
 
-	dat, cind, vind, err := loadStandardDataVideo(cid, vid)
+	dat, cind, vind, err := loadStandardDataVideo(c, cid, vid)
 	if err != nil {
 		c.AbortWithError(500, err)
 	}
+	if cind < 0 || vind < 0 {
+		c.AbortWithStatus(404)
+		return
+	}
+	dat.L = requestLocale(c)
+
+	related := relatedVideos(dat, dat.Videos[cid][vind])
+	cast := newCastMedia(c, dat.Videos[cid][vind])
 
 	c.HTML(200, "video.gohtml", struct {
 		standardData
-		Cid  string
-		Vid  string
-		Cind int
-		Vind int
-	}{dat, cid, vid, cind, vind})
+		Cid     string
+		Vid     string
+		Cind    int
+		Vind    int
+		Nav     videoNav
+		Related []relatedVideo
+		Cast    castMedia
+		// Lifetimes in days which a shared link may be given.
+		ShareDays []int
+	}{dat, cid, vid, cind, vind, newVideoNav(dat, cid, vid, c.Request.URL.Query()), related, cast, shareDays})
+}
+
+func handleRuns(c *gin.Context) {
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+	}
+
+	// Errors of runs may name any channel.
+	if requestUser(c).Restricted() {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	runs, err := loadHistory()
+	if err != nil {
+		c.AbortWithError(500, err)
+	}
+	// Most recent first.
+	slices.Reverse(runs)
+	dat.L = requestLocale(c)
+
+	c.HTML(200, "runs.gohtml", struct {
+		standardData
+		Runs []ytarchiver.RunRecord
+	}{dat, runs})
 }
 
 func handleHelp(c *gin.Context) {
-	dat, err := loadStandardData()
+	dat, err := loadStandardData(c)
 	if err != nil {
 		c.AbortWithError(500, err)
 	}
+	dat.L = requestLocale(c)
 
 	c.HTML(200, "help.gohtml", dat)
 }
 
 func main() {
-	log.Println("Starting ytarchiver web interface...")
 	flag.Parse()
+	if *HashPass {
+		if err := hashPassword(); err != nil {
+			log.Fatalln("Hashing password:", err)
+		}
+		return
+	}
+	log.Println("Starting ytarchiver web interface...")
+
+	// The archiver may be writing to the same root, so never touch it.
+	// A mirrored root may only be unavailable for now, so is left to be
+	// read by each reindex.
+	var remote bool
+	var err error
+	rootFS, remote, err = openRoot(*Root)
+	if err != nil && !*Mirror {
+		log.Fatalln("Opening archive root:", err)
+	}
+	if !remote {
+		writableRoot = *Root
+	}
+
+	var layout int
+	if remote {
+		layout, err = ytarchiver.CheckRootFS(rootFS)
+	} else {
+		layout, err = ytarchiver.CheckRoot(*Root, true)
+	}
+	switch {
+	case err != nil && *Mirror:
+		log.Println("Archive root unavailable; serving once indexed:", err)
+	case err != nil:
+		log.Fatalln("Unusable archive root:", err)
+	case layout < ytarchiver.LayoutVersion:
+		log.Printf("Archive root has outdated layout %d: run 'ytarchiver migrate' for videos to be listed", layout)
+	}
+
+	if err := registerMediaTypes(); err != nil {
+		log.Fatalln("Registering media types:", err)
+	}
+
+	if err := loadCatalogs(localesDir); err != nil {
+		log.Fatalln("Loading message catalogs:", err)
+	}
+
+	if *Groups != "" {
+		if err := loadGroups(*Groups); err != nil {
+			log.Fatalln("Loading channel groups:", err)
+		}
+	}
+
+	if *Users != "" {
+		if err := loadUsers(*Users); err != nil {
+			log.Fatalln("Loading users:", err)
+		}
+	}
+
+	if err := loadShareKey(*ShareKey); err != nil {
+		log.Fatalln("Loading share key:", err)
+	}
+
+	if err := hiddenChannels.Load(*Hidden); err != nil {
+		log.Fatalln("Loading hidden channels:", err)
+	}
+
+	if *Mirror {
+		mirror = &mirrorIndex{}
+		go mirror.Run(*Reindex)
+	}
 
 	// Startup and listen
 	router := gin.New()
@@ -277,15 +456,37 @@ func main() {
 		ReadTimeout:       15 * time.Second,
 		WriteTimeout:      5 * time.Second,
 	}
-	router.Use(gin.Logger(), gin.Recovery())
+	router.Use(gin.Logger(), gin.Recovery(), handleLocale, handleUser)
 	router.FuncMap["limit"] = limitString
+	router.FuncMap["duration"] = humanDuration
+	router.FuncMap["bytes"] = humanBytes
 	router.LoadHTMLGlob("*.gohtml")
 
 	router.GET("/", handleRoot)
+	router.GET("/group/:id", handleGroup)
 	router.GET("/chan/:id", handleChannel)
 	router.GET("/vid/:cid/:id", handleVideo)
+	router.GET("/download/:cid", handleDownload)
+	router.GET("/download/:cid/:vid", handleDownloadVideo)
+	router.GET("/random", handleRandom)
+	router.GET("/play", handlePlay)
+	router.GET("/coverage/:id", handleCoverage)
+	router.GET("/runs", handleRuns)
+	router.GET("/stats", handleStats)
 	router.GET("/help", handleHelp)
-	router.Static("/videos/", *Root)
+	router.POST("/vid/:cid/:id/share", handleShareCreate)
+	router.GET("/share/:cid/:vid", handleShare)
+	router.GET("/share/:cid/:vid/file", handleShareFile)
+	router.POST("/admin/hidden/:cid", handleAdmin, handleHide)
+	router.POST("/admin/queue/:cid", handleAdmin, handleQueue)
+	videos := router.Group("/videos", handleCORS, handleChannelFiles)
+	if remote {
+		videos.StaticFS("/", noListFS{http.FS(rootFS)})
+	} else {
+		videos.Static("/", *Root)
+	}
+	// Preflight requests are answered by handleCORS alone.
+	videos.OPTIONS("/*filepath")
 
 	errchan := make(chan error, 1)
 	sigchan := make(chan os.Signal, 1)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+)
+
+// mirrorRetry is the interval between attempts to index the root after an
+// attempt fails.
+const mirrorRetry = 30 * time.Second
+
+var ErrNotIndexed = errors.New("archive root not yet indexed")
+
+// mirror is the index served from in mirror mode, or nil otherwise.
+var mirror *mirrorIndex
+
+// mirrorIndex is a snapshot of the archive root, for serving a root which
+// is written from another host, such as over NFS or SMB. Reading the root
+// anew for each request would be slow, and fail whenever the share is
+// briefly unavailable.
+type mirrorIndex struct {
+	mut     sync.RWMutex
+	dat     standardData
+	runs    []ytarchiver.RunRecord
+	indexed bool
+}
+
+// Run reindexes the root every interval, forever. Failed attempts are
+// retried sooner, and the last snapshot is served meanwhile.
+func (m *mirrorIndex) Run(interval time.Duration) {
+	for {
+		wait := interval
+		start := time.Now()
+		if err := m.reindex(); err != nil {
+			log.Println("Indexing archive root:", err)
+			wait = mirrorRetry
+		} else {
+			log.Printf("Indexed archive root in %v", time.Since(start))
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// reindex replaces the snapshot with the current contents of the root. The
+// snapshot is kept if the root could not be read at all, or has no manifest,
+// as when the share is not mounted. If only some channels could not be read,
+// the rest are indexed and the error is returned.
+func (m *mirrorIndex) reindex() error {
+	if _, err := fs.Stat(rootFS, ytarchiver.ManifestName); err != nil {
+		return err
+	}
+
+	dat, err := readStandardData()
+	var partial multiError
+	if err != nil && !errors.As(err, &partial) {
+		return err
+	}
+
+	runs, herr := ytarchiver.ReadHistoryFS(rootFS)
+	if herr != nil {
+		return herr
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	m.dat, m.runs, m.indexed = dat, runs, true
+	return err
+}
+
+// Data returns the snapshot of the root.
+func (m *mirrorIndex) Data() (standardData, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	if !m.indexed {
+		return standardData{}, ErrNotIndexed
+	}
+	return m.dat, nil
+}
+
+// History returns the snapshot of the run history, which the caller may
+// modify.
+func (m *mirrorIndex) History() ([]ytarchiver.RunRecord, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	if !m.indexed {
+		return nil, ErrNotIndexed
+	}
+	return slices.Clone(m.runs), nil
+}
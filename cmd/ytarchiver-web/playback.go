@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A videoNav links a video page to the videos before and after it, in the
+// order of its channel page, or of the channels of the group given by the
+// group query parameter of the page.
+type videoNav struct {
+	// Pages of the previous and next videos, if any.
+	Prev, Next string
+	// Whether the next video with a video file is played once the video
+	// ends, as set by the autoplay query parameter.
+	Autoplay bool
+	// Page of the next random video, if shuffling.
+	Shuffle string
+	// Page to go to once the video ends, if autoplaying or shuffling.
+	Continue string
+	// This page with autoplay toggled.
+	ToggleAutoplay string
+}
+
+// newVideoNav returns the navigation of the page of the video vid of the
+// channel cid, given the query q of the page.
+func newVideoNav(dat standardData, cid, vid string, q url.Values) videoNav {
+	type entry struct {
+		cid string
+		v   videoData
+	}
+
+	scope := url.Values{}
+	var seq []entry
+	if gid := q.Get("group"); gid != "" {
+		for _, g := range dat.Groups() {
+			if g.ID != gid {
+				continue
+			}
+			scope.Set("group", gid)
+			for _, ch := range g.Chans {
+				for _, v := range dat.Videos[ch.ID] {
+					seq = append(seq, entry{ch.ID, v})
+				}
+			}
+		}
+	}
+	// The channel is the scope if the group is unknown or does not hold
+	// the video.
+	pos := -1
+	for i, e := range seq {
+		if e.cid == cid && e.v.ID == vid {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		scope.Del("group")
+		seq = seq[:0]
+		for i, v := range dat.Videos[cid] {
+			seq = append(seq, entry{cid, v})
+			if v.ID == vid {
+				pos = i
+			}
+		}
+	}
+
+	nav := videoNav{Autoplay: q.Get("autoplay") != ""}
+	if nav.Autoplay {
+		scope.Set("autoplay", "1")
+	}
+	page := func(e entry) string {
+		u := "/vid/" + e.cid + "/" + e.v.ID
+		if len(scope) != 0 {
+			u += "?" + scope.Encode()
+		}
+		return u
+	}
+
+	if pos > 0 {
+		nav.Prev = page(seq[pos-1])
+	}
+	if pos >= 0 && pos < len(seq)-1 {
+		nav.Next = page(seq[pos+1])
+	}
+
+	nav.Shuffle = nextShuffled(q, vid)
+	if nav.Shuffle != "" {
+		nav.Continue = nav.Shuffle
+	} else if nav.Autoplay && pos >= 0 {
+		for _, e := range seq[pos+1:] {
+			if !e.v.MetadataOnly {
+				nav.Continue = page(e)
+				break
+			}
+		}
+	}
+
+	toggle := url.Values{}
+	for k, v := range q {
+		toggle[k] = v
+	}
+	if nav.Autoplay {
+		toggle.Del("autoplay")
+	} else {
+		toggle.Set("autoplay", "1")
+	}
+	nav.ToggleAutoplay = "/vid/" + cid + "/" + vid
+	if len(toggle) != 0 {
+		nav.ToggleAutoplay += "?" + toggle.Encode()
+	}
+
+	return nav
+}
+
+// handlePlay redirects to the first video with a video file of the channel
+// named by the chan query parameter, or of the group named by group, to play
+// the rest in order.
+func handlePlay(c *gin.Context) {
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	scope := url.Values{"autoplay": {"1"}}
+	var cids []string
+	if gid := c.Query("group"); gid != "" {
+		for _, g := range dat.Groups() {
+			if g.ID == gid {
+				scope.Set("group", gid)
+				for _, ch := range g.Chans {
+					cids = append(cids, ch.ID)
+				}
+			}
+		}
+	} else if cid := c.Query("chan"); cid != "" {
+		cids = []string{cid}
+	}
+
+	for _, cid := range cids {
+		for _, v := range dat.Videos[cid] {
+			if !v.MetadataOnly {
+				c.Redirect(303, "/vid/"+cid+"/"+v.ID+"?"+scope.Encode())
+				return
+			}
+		}
+	}
+	c.AbortWithStatus(404)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleRandom redirects to a random archived video (with a video file) of
+// the channel named by the chan query parameter, or of the group named by
+// group, or else of any channel listed on the index. The video named by
+// after is chosen only if there is no other.
+//
+// If the shuffle parameter is set, the video page plays another random video
+// of the same channel or group when the video ends.
+func handleRandom(c *gin.Context) {
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	var cids []string
+	if cid := c.Query("chan"); cid != "" {
+		cids = []string{cid}
+	} else {
+		gid := c.Query("group")
+		for _, g := range dat.Groups() {
+			if gid != "" && g.ID != gid {
+				continue
+			}
+			for _, ch := range g.Chans {
+				cids = append(cids, ch.ID)
+			}
+		}
+	}
+
+	type choice struct{ cid, vid string }
+	var choices []choice
+	for _, cid := range cids {
+		for _, v := range dat.Videos[cid] {
+			if !v.MetadataOnly {
+				choices = append(choices, choice{cid, v.ID})
+			}
+		}
+	}
+	if after := c.Query("after"); len(choices) > 1 {
+		choices = slices.DeleteFunc(choices, func(ch choice) bool {
+			return ch.vid == after
+		})
+	}
+	if len(choices) == 0 {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	ch := choices[rand.IntN(len(choices))]
+	target := "/vid/" + ch.cid + "/" + ch.vid
+	if c.Query("shuffle") != "" {
+		target += "?" + shuffleScope(c.Request.URL.Query()).Encode()
+	}
+	c.Redirect(303, target)
+}
+
+// shuffleScope returns the query parameters of a video page continuing the
+// shuffle of the random video request with query q.
+func shuffleScope(q url.Values) url.Values {
+	scope := url.Values{"shuffle": {"1"}}
+	for _, k := range []string{"chan", "group"} {
+		if v := q.Get(k); v != "" {
+			scope.Set(k, v)
+		}
+	}
+	return scope
+}
+
+// nextShuffled returns the URL of the next video of the shuffle which the
+// video vid was played in, as given by the query q of its page, or is empty
+// if it was not played in a shuffle.
+func nextShuffled(q url.Values, vid string) string {
+	if q.Get("shuffle") == "" {
+		return ""
+	}
+
+	next := shuffleScope(q)
+	next.Set("after", vid)
+	return "/random?" + next.Encode()
+}
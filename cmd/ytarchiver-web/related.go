@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxRelated is the most related videos listed on a video page.
+	maxRelated = 8
+	// relatedWindow is how close in time two videos must be uploaded for
+	// that to count towards them being related.
+	relatedWindow = 7 * 24 * time.Hour
+)
+
+// Weights of each kind of similarity between two videos. Title words are
+// further weighted by how rare they are in the archive.
+const (
+	tagWeight     = 3.0
+	wordWeight    = 1.0
+	windowWeight  = 1.0
+	channelWeight = 0.5
+)
+
+// A relatedVideo is a video related to another.
+type relatedVideo struct {
+	videoData
+	// Name of the channel of the video.
+	Channel string
+}
+
+// relatedVideos returns the videos most related to v, out of those of the
+// channels listed on the index and of the channel of v. Videos are related
+// by shared tags, shared words in their titles, and being uploaded around
+// the same time.
+func relatedVideos(dat standardData, v videoData) []relatedVideo {
+	names := make(map[string]string, len(dat.Chans))
+	for _, ch := range dat.Chans {
+		names[ch.ID] = ch.Name
+	}
+
+	cids := []string{v.ChannelID}
+	for _, g := range dat.Groups() {
+		for _, ch := range g.Chans {
+			if ch.ID != v.ChannelID {
+				cids = append(cids, ch.ID)
+			}
+		}
+	}
+
+	// How many titles each word appears in, for its rarity.
+	var total int
+	docs := make(map[string]int)
+	for _, cid := range cids {
+		for _, o := range dat.Videos[cid] {
+			total++
+			for w := range titleWords(o.Title) {
+				docs[w]++
+			}
+		}
+	}
+
+	tags := make(map[string]bool, len(v.Tags))
+	for _, t := range v.Tags {
+		tags[strings.ToLower(t)] = true
+	}
+	words := titleWords(v.Title)
+
+	type scored struct {
+		relatedVideo
+		score float64
+	}
+	var found []scored
+	for _, cid := range cids {
+		for _, o := range dat.Videos[cid] {
+			if o.ID == v.ID {
+				continue
+			}
+
+			var score float64
+			for _, t := range o.Tags {
+				if tags[strings.ToLower(t)] {
+					score += tagWeight
+				}
+			}
+			for w := range titleWords(o.Title) {
+				if words[w] {
+					score += wordWeight * math.Log(float64(total)/float64(docs[w]))
+				}
+			}
+			// Only worth anything alongside some other similarity.
+			if score == 0 {
+				continue
+			}
+
+			if d := v.UploadedAt.Sub(o.UploadedAt).Abs(); !v.UploadedAt.IsZero() && !o.UploadedAt.IsZero() && d <= relatedWindow {
+				score += windowWeight
+			}
+			if o.ChannelID == v.ChannelID {
+				score += channelWeight
+			}
+			found = append(found, scored{relatedVideo{o, names[cid]}, score})
+		}
+	}
+
+	slices.SortStableFunc(found, func(a, b scored) int {
+		if a.score != b.score {
+			if a.score > b.score {
+				return -1
+			}
+			return 1
+		}
+		return b.UploadedAt.Compare(a.UploadedAt)
+	})
+
+	related := make([]relatedVideo, 0, min(len(found), maxRelated))
+	for _, s := range found[:min(len(found), maxRelated)] {
+		related = append(related, s.relatedVideo)
+	}
+	return related
+}
+
+// titleWords returns the set of words in title, ignoring case and any
+// shorter than three letters, which are rarely meaningful.
+func titleWords(title string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len([]rune(w)) >= 3 {
+			words[w] = true
+		}
+	}
+	return words
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// readAhead is how much of a remote file is fetched at once, so that
+// streaming a video is not a request for every read by the player.
+const readAhead = 4 << 20
+
+// passwordEnv holds the password for a remote root whose URL gives only the
+// user, so that it need not appear on the command line.
+const passwordEnv = "YTARCHIVER_WEB_PASSWORD"
+
+var ErrRemoteSeek = errors.New("seek to negative offset")
+
+// openRoot returns the archive root named by root: a local directory, an
+// sftp:// URL or the http(s):// URL of a WebDAV share. It reports whether
+// the root is remote.
+func openRoot(root string) (fs.FS, bool, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return os.DirFS(root), false, nil
+	}
+
+	switch u.Scheme {
+	case "sftp":
+		fsys, err := newSFTPFS(u)
+		return fsys, true, err
+	case "http", "https":
+		return newWebDAVFS(u), true, nil
+	default:
+		return os.DirFS(root), false, nil
+	}
+}
+
+// remotePassword returns the password for the remote root at u.
+func remotePassword(u *url.URL) string {
+	if pass, ok := u.User.Password(); ok {
+		return pass
+	}
+	return os.Getenv(passwordEnv)
+}
+
+// remoteInfo describes a remote file.
+type remoteInfo struct {
+	name  string
+	size  int64
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+func (i remoteInfo) Name() string       { return i.name }
+func (i remoteInfo) Size() int64        { return i.size }
+func (i remoteInfo) Mode() fs.FileMode  { return i.mode }
+func (i remoteInfo) ModTime() time.Time { return i.mtime }
+func (i remoteInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i remoteInfo) Sys() any           { return nil }
+
+// remoteEntries converts infos to directory entries, sorted by name.
+func remoteEntries(infos []remoteInfo) []fs.DirEntry {
+	ents := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		ents[i] = fs.FileInfoToDirEntry(info)
+	}
+	slices.SortFunc(ents, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return ents
+}
+
+// remoteFile is an open remote file or directory. Files are read through a
+// read-ahead buffer, and may be seeked so that they can be served with
+// ranges.
+type remoteFile struct {
+	info remoteInfo
+	// Reads the file. Nil for directories.
+	r io.ReaderAt
+	// Lists the directory. Nil for files.
+	list    func() ([]fs.DirEntry, error)
+	closeFn func() error
+
+	off    int64
+	buf    []byte
+	bufOff int64
+
+	ents   []fs.DirEntry
+	listed bool
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	if f.off >= f.info.size {
+		return 0, io.EOF
+	}
+
+	if f.off < f.bufOff || f.off >= f.bufOff+int64(len(f.buf)) {
+		n := min(readAhead, f.info.size-f.off)
+		if int64(cap(f.buf)) < n {
+			f.buf = make([]byte, n)
+		}
+
+		m, err := f.r.ReadAt(f.buf[:n], f.off)
+		if m == 0 && err != nil {
+			return 0, err
+		}
+		f.buf, f.bufOff = f.buf[:m], f.off
+	}
+
+	n := copy(p, f.buf[f.off-f.bufOff:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return f.off, &fs.PathError{Op: "seek", Path: f.info.name, Err: ErrRemoteSeek}
+	}
+
+	f.off = offset
+	return offset, nil
+}
+
+// ReadDir lists the directory, which is fetched in full by the first call.
+func (f *remoteFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.list == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	if !f.listed {
+		ents, err := f.list()
+		if err != nil {
+			return nil, err
+		}
+		f.ents, f.listed = ents, true
+	}
+
+	if n <= 0 {
+		ents := f.ents
+		f.ents = nil
+		return ents, nil
+	}
+	if len(f.ents) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(f.ents))
+	ents := f.ents[:n]
+	f.ents = f.ents[n:]
+	return ents, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.closeFn != nil {
+		return f.closeFn()
+	}
+	return nil
+}
+
+// noListFS serves the files of a filesystem without listing its
+// directories, as router.Static does for local roots.
+type noListFS struct {
+	fs http.FileSystem
+}
+
+func (n noListFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noListFile{f}, nil
+}
+
+type noListFile struct {
+	http.File
+}
+
+func (noListFile) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, nil
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTP (version 3) packet types and constants used by the client. See
+// draft-ietf-secsh-filexfer-02.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpStat     = 17
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+	sftpProtocol = 3
+
+	sftpOpenRead = 0x1
+
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpAttrExtended    = 0x80000000
+
+	sftpStatusEOF        = 1
+	sftpStatusNoSuchFile = 2
+	sftpStatusPermission = 3
+
+	// sftpChunk is the most requested by a single read, which every
+	// server supports.
+	sftpChunk = 32 << 10
+	// sftpMaxPacket bounds the packets accepted from the server.
+	sftpMaxPacket = 256 << 10
+)
+
+var (
+	ErrSFTP         = errors.New("sftp")
+	ErrSFTPPacket   = errors.New("sftp: malformed packet")
+	ErrSFTPHostKeys = errors.New("sftp: no known_hosts file to check the host key against")
+)
+
+// sftpFS is an archive root on an SFTP server. The connection is made again
+// if it is lost.
+type sftpFS struct {
+	u    *url.URL
+	base string
+
+	mut sync.Mutex
+	c   *sftpClient
+}
+
+func newSFTPFS(u *url.URL) (*sftpFS, error) {
+	f := &sftpFS{u: u, base: u.Path}
+	if f.base == "" {
+		f.base = "."
+	}
+
+	_, err := f.client()
+	return f, err
+}
+
+// client returns the current connection, reconnecting if it has failed.
+func (f *sftpFS) client() (*sftpClient, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	if f.c != nil && f.c.Err() == nil {
+		return f.c, nil
+	}
+
+	c, err := dialSFTP(f.u)
+	if err != nil {
+		return nil, err
+	}
+	f.c = c
+	return c, nil
+}
+
+func (f *sftpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	c, err := f.client()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	full := path.Join(f.base, name)
+	info, err := c.Stat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info.name = path.Base(name)
+
+	file := &remoteFile{info: info}
+	if info.IsDir() {
+		file.list = func() ([]fs.DirEntry, error) { return f.ReadDir(name) }
+		return file, nil
+	}
+
+	h, err := c.OpenFile(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	file.r = sftpReaderAt{c, h}
+	file.closeFn = func() error { return c.CloseHandle(h) }
+	return file, nil
+}
+
+func (f *sftpFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	c, err := f.client()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	info, err := c.Stat(path.Join(f.base, name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	info.name = path.Base(name)
+	return info, nil
+}
+
+func (f *sftpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	c, err := f.client()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	infos, err := c.ReadDir(path.Join(f.base, name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return remoteEntries(infos), nil
+}
+
+// dialSFTP connects to the SFTP server at u. Keys are taken from the SSH
+// agent and the usual files in ~/.ssh, and host keys are checked against
+// ~/.ssh/known_hosts.
+func dialSFTP(u *url.URL) (*sftpClient, error) {
+	home, _ := os.UserHomeDir()
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTPHostKeys, err)
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	cfg := &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			cfg.Auth = append(cfg.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		dat, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if s, err := ssh.ParsePrivateKey(dat); err == nil {
+			signers = append(signers, s)
+		}
+	}
+	if len(signers) > 0 {
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeys(signers...))
+	}
+	if pass := remotePassword(u); pass != "" {
+		cfg.Auth = append(cfg.Auth, ssh.Password(pass))
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+
+	c, err := newSFTPClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// sftpPacket is a response from the server, with its type and what follows
+// the request ID.
+type sftpPacket struct {
+	typ  byte
+	data []byte
+}
+
+// sftpClient is a connection to an SFTP server. Requests may be made
+// concurrently, and are answered as the server replies to each.
+type sftpClient struct {
+	conn *ssh.Client
+	w    io.Writer
+	wmut sync.Mutex
+
+	mut     sync.Mutex
+	next    uint32
+	pending map[uint32]chan sftpPacket
+	err     error
+}
+
+func newSFTPClient(conn *ssh.Client) (*sftpClient, error) {
+	sess, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+	w, err := sess.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+	r, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+	if err := sess.RequestSubsystem("sftp"); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+
+	// The version exchange has no request IDs.
+	if err := writePacket(w, sftpInit, binary.BigEndian.AppendUint32(nil, sftpProtocol)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+	typ, _, err := readPacket(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSFTP, err)
+	}
+	if typ != sftpVersion {
+		return nil, ErrSFTPPacket
+	}
+
+	c := &sftpClient{conn: conn, w: w, pending: make(map[uint32]chan sftpPacket)}
+	go c.receive(r)
+	return c, nil
+}
+
+// writePacket writes a packet of the given type and payload to w.
+func writePacket(w io.Writer, typ byte, payload []byte) error {
+	pkt := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	pkt = append(pkt, typ)
+	_, err := w.Write(append(pkt, payload...))
+	return err
+}
+
+// readPacket reads a packet from r, returning its type and payload.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > sftpMaxPacket {
+		return 0, nil, ErrSFTPPacket
+	}
+	payload := make([]byte, n-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
+
+// receive hands each response read from r to the request awaiting it, until
+// the connection fails.
+func (c *sftpClient) receive(r io.Reader) {
+	for {
+		typ, payload, err := readPacket(r)
+		if err == nil && len(payload) < 4 {
+			err = ErrSFTPPacket
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		id := binary.BigEndian.Uint32(payload)
+		c.mut.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mut.Unlock()
+
+		if ok {
+			ch <- sftpPacket{typ, payload[4:]}
+		}
+	}
+}
+
+// fail marks the connection as failed with err, failing every request.
+func (c *sftpClient) fail(err error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.err = fmt.Errorf("%w: connection lost: %v", ErrSFTP, err)
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.conn.Close()
+}
+
+// Err returns the error with which the connection failed, if it has.
+func (c *sftpClient) Err() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.err
+}
+
+// send sends a request of the given type, returning a channel on which its
+// response is delivered. The channel is closed if the connection fails.
+func (c *sftpClient) send(typ byte, payload []byte) (<-chan sftpPacket, error) {
+	c.mut.Lock()
+	if c.err != nil {
+		c.mut.Unlock()
+		return nil, c.err
+	}
+	id := c.next
+	c.next++
+	ch := make(chan sftpPacket, 1)
+	c.pending[id] = ch
+	c.mut.Unlock()
+
+	c.wmut.Lock()
+	defer c.wmut.Unlock()
+
+	if err := writePacket(c.w, typ, append(binary.BigEndian.AppendUint32(nil, id), payload...)); err != nil {
+		c.fail(err)
+		return nil, c.Err()
+	}
+	return ch, nil
+}
+
+// wait returns the response delivered on ch.
+func (c *sftpClient) wait(ch <-chan sftpPacket) (sftpPacket, error) {
+	pkt, ok := <-ch
+	if !ok {
+		return pkt, c.Err()
+	}
+	if pkt.typ == sftpStatus {
+		return pkt, sftpStatusError(pkt.data)
+	}
+	return pkt, nil
+}
+
+// request sends a request and waits for its response.
+func (c *sftpClient) request(typ byte, payload []byte) (sftpPacket, error) {
+	ch, err := c.send(typ, payload)
+	if err != nil {
+		return sftpPacket{}, err
+	}
+	return c.wait(ch)
+}
+
+// sftpStatusError returns the error reported by a status response, or nil
+// if it reports success.
+func sftpStatusError(data []byte) error {
+	d := sftpDecoder{b: data}
+	code, msg := d.Uint32(), d.Text()
+	if d.err != nil {
+		return d.err
+	}
+
+	switch code {
+	case 0:
+		return nil
+	case sftpStatusEOF:
+		return io.EOF
+	case sftpStatusNoSuchFile:
+		return fs.ErrNotExist
+	case sftpStatusPermission:
+		return fs.ErrPermission
+	default:
+		return fmt.Errorf("%w: %s", ErrSFTP, msg)
+	}
+}
+
+// Stat returns the attributes of the file at p, following symlinks.
+func (c *sftpClient) Stat(p string) (remoteInfo, error) {
+	pkt, err := c.request(sftpStat, appendString(nil, p))
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	if pkt.typ != sftpAttrs {
+		return remoteInfo{}, ErrSFTPPacket
+	}
+
+	d := sftpDecoder{b: pkt.data}
+	info := d.Attrs()
+	info.name = path.Base(p)
+	return info, d.err
+}
+
+// ReadDir lists the directory at p.
+func (c *sftpClient) ReadDir(p string) ([]remoteInfo, error) {
+	h, err := c.handle(sftpOpendir, appendString(nil, p))
+	if err != nil {
+		return nil, err
+	}
+	defer c.CloseHandle(h)
+
+	var infos []remoteInfo
+	for {
+		pkt, err := c.request(sftpReaddir, appendString(nil, h))
+		if errors.Is(err, io.EOF) {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pkt.typ != sftpName {
+			return nil, ErrSFTPPacket
+		}
+
+		d := sftpDecoder{b: pkt.data}
+		for n := d.Uint32(); n > 0 && d.err == nil; n-- {
+			name := d.Text()
+			d.Text() // Long name, as by ls -l.
+			info := d.Attrs()
+			if name != "." && name != ".." {
+				info.name = name
+				infos = append(infos, info)
+			}
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+}
+
+// OpenFile opens the file at p for reading, returning its handle.
+func (c *sftpClient) OpenFile(p string) (string, error) {
+	payload := appendString(nil, p)
+	payload = binary.BigEndian.AppendUint32(payload, sftpOpenRead)
+	// No attributes.
+	payload = binary.BigEndian.AppendUint32(payload, 0)
+	return c.handle(sftpOpen, payload)
+}
+
+// handle makes a request which returns a handle.
+func (c *sftpClient) handle(typ byte, payload []byte) (string, error) {
+	pkt, err := c.request(typ, payload)
+	if err != nil {
+		return "", err
+	}
+	if pkt.typ != sftpHandle {
+		return "", ErrSFTPPacket
+	}
+
+	d := sftpDecoder{b: pkt.data}
+	h := d.Text()
+	return h, d.err
+}
+
+// CloseHandle closes a handle returned by OpenFile or ReadDir.
+func (c *sftpClient) CloseHandle(h string) error {
+	_, err := c.request(sftpClose, appendString(nil, h))
+	return err
+}
+
+// sftpReaderAt reads an open file. Reads are split into chunks, which are
+// all requested before any reply is awaited.
+type sftpReaderAt struct {
+	c *sftpClient
+	h string
+}
+
+func (r sftpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var chans []<-chan sftpPacket
+	for n := 0; n < len(p); n += sftpChunk {
+		payload := appendString(nil, r.h)
+		payload = binary.BigEndian.AppendUint64(payload, uint64(off)+uint64(n))
+		payload = binary.BigEndian.AppendUint32(payload, uint32(min(sftpChunk, len(p)-n)))
+
+		ch, err := r.c.send(sftpRead, payload)
+		if err != nil {
+			return 0, err
+		}
+		chans = append(chans, ch)
+	}
+
+	// Replies to the chunks after a short read are still awaited, so
+	// that they are not mistaken for replies to later requests.
+	n := 0
+	var rerr error
+	for i, ch := range chans {
+		pkt, err := r.c.wait(ch)
+		if rerr != nil {
+			continue
+		}
+		if err != nil {
+			rerr = err
+			continue
+		}
+		if pkt.typ != sftpData {
+			rerr = ErrSFTPPacket
+			continue
+		}
+
+		d := sftpDecoder{b: pkt.data}
+		dat := d.Text()
+		if d.err != nil {
+			rerr = d.err
+			continue
+		}
+		n += copy(p[n:], dat)
+		if n < (i+1)*sftpChunk && n < len(p) {
+			rerr = io.EOF
+		}
+	}
+
+	if n == len(p) {
+		return n, nil
+	}
+	return n, rerr
+}
+
+// appendString appends s to b as an SFTP string.
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sftpDecoder decodes the fields of a packet. Once a field cannot be
+// decoded, err is set and the rest decode as zero.
+type sftpDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *sftpDecoder) Uint32() uint32 {
+	if d.err != nil || len(d.b) < 4 {
+		d.err = ErrSFTPPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *sftpDecoder) Uint64() uint64 {
+	if d.err != nil || len(d.b) < 8 {
+		d.err = ErrSFTPPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *sftpDecoder) Text() string {
+	n := d.Uint32()
+	if d.err != nil || uint32(len(d.b)) < n {
+		d.err = ErrSFTPPacket
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+// Attrs decodes file attributes.
+func (d *sftpDecoder) Attrs() remoteInfo {
+	var info remoteInfo
+	flags := d.Uint32()
+	if flags&sftpAttrSize != 0 {
+		info.size = int64(d.Uint64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		d.Uint32()
+		d.Uint32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		perm := d.Uint32()
+		info.mode = fs.FileMode(perm & 0777)
+		switch perm & 0170000 {
+		case 0040000:
+			info.mode |= fs.ModeDir
+		case 0120000:
+			info.mode |= fs.ModeSymlink
+		}
+	}
+	if flags&sftpAttrACModTime != 0 {
+		d.Uint32()
+		info.mtime = time.Unix(int64(d.Uint32()), 0)
+	}
+	if flags&sftpAttrExtended != 0 {
+		for n := d.Uint32(); n > 0 && d.err == nil; n-- {
+			d.Text()
+			d.Text()
+		}
+	}
+	return info
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+)
+
+// shareKeySize is the size in bytes of the key signing shared links.
+const shareKeySize = 32
+
+// shareDays are the lifetimes in days which a shared link may be given.
+var shareDays = []int{1, 7, 30}
+
+var ErrShareKey = errors.New("invalid share key")
+
+// shareKey signs shared links. Replacing it revokes every link.
+var shareKey []byte
+
+// loadShareKey loads the key at path, generating it first if there is no
+// such file.
+func loadShareKey(path string) error {
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, shareKeySize)
+		if _, err = rand.Read(key); err == nil {
+			err = os.WriteFile(path, key, 0600)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(key) < shareKeySize {
+		return ErrShareKey
+	}
+
+	shareKey = key
+	return nil
+}
+
+// shareSignature returns the signature of a link to the video vid of the
+// channel cid expiring at expires (Unix time).
+func shareSignature(cid, vid string, expires int64) string {
+	mac := hmac.New(sha256.New, shareKey)
+	mac.Write([]byte(cid + "/" + vid + "/" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// shareQuery returns the query of a link to the video vid of the channel
+// cid which expires at expires.
+func shareQuery(cid, vid string, expires time.Time) string {
+	return url.Values{
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {shareSignature(cid, vid, expires.Unix())},
+	}.Encode()
+}
+
+// sharedVideo returns the video shared by the link requested by c, if its
+// signature is valid and it has not expired.
+func sharedVideo(c *gin.Context) (videoData, bool) {
+	cid, vid := c.Param("cid"), c.Param("vid")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!hmac.Equal([]byte(c.Query("sig")), []byte(shareSignature(cid, vid, expires))) {
+		return videoData{}, false
+	}
+
+	// Only the one video is read, as its file is requested for every
+	// range the player fetches.
+	meta, err := ytarchiver.ReadVideoMetaFS(rootFS, cid, vid)
+	if err != nil || meta.MetadataOnly {
+		return videoData{}, false
+	}
+	return videoData{VideoMeta: meta}, true
+}
+
+// shareData is the data of the page of a shared link.
+type shareData struct {
+	standardData
+	Video videoData
+	// Link to the page, once created, or else to the video file.
+	Link string
+	// When a created link expires.
+	Expires time.Time
+	Created bool
+}
+
+// handleShareCreate creates a link to the video id of the channel cid which
+// expires after the number of days in the days form value, and shows it.
+func handleShareCreate(c *gin.Context) {
+	cid, vid := c.Param("cid"), c.Param("id")
+	days, err := strconv.Atoi(c.PostForm("days"))
+	if err != nil || days < 1 || days > shareDays[len(shareDays)-1] {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	dat, cind, vind, err := loadStandardDataVideo(c, cid, vid)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if cind < 0 || vind < 0 || dat.Videos[cid][vind].MetadataOnly {
+		c.AbortWithStatus(404)
+		return
+	}
+	dat.L = requestLocale(c)
+
+	expires := time.Now().AddDate(0, 0, days)
+	c.HTML(200, "share.gohtml", shareData{
+		standardData: dat,
+		Video:        dat.Videos[cid][vind],
+		Link:         publicBase(c) + "/share/" + cid + "/" + vid + "?" + shareQuery(cid, vid, expires),
+		Expires:      expires,
+		Created:      true,
+	})
+}
+
+// handleShare shows the video of a shared link, to anyone.
+func handleShare(c *gin.Context) {
+	v, ok := sharedVideo(c)
+	if !ok {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	c.HTML(200, "share.gohtml", shareData{
+		standardData: standardData{L: requestLocale(c)},
+		Video:        v,
+		Link:         "/share/" + v.ChannelID + "/" + v.ID + "/file?" + c.Request.URL.RawQuery,
+	})
+}
+
+// handleShareFile serves the video file of a shared link, to anyone.
+func handleShareFile(c *gin.Context) {
+	v, ok := sharedVideo(c)
+	if !ok {
+		c.AbortWithStatus(404)
+		return
+	}
+	serveVideoFile(c, v, c.Query("download") != "")
+}
+
+// isShareRoute reports if c requests a shared link, which needs no login.
+func isShareRoute(c *gin.Context) bool {
+	return strings.HasPrefix(c.FullPath(), "/share/")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/gin-gonic/gin"
+)
+
+// channelStats totals the archived videos of a channel.
+type channelStats struct {
+	ytarchiver.ChannelInfo
+	Videos int
+	Length time.Duration
+	Size   int64
+}
+
+// add adds the video v to s.
+func (s *channelStats) add(v videoData) {
+	s.Videos++
+	s.Length += time.Duration(v.Duration) * time.Second
+	s.Size += v.Size
+}
+
+// forecastData is a storage forecast as shown on the stats page.
+type forecastData struct {
+	Time                    time.Time
+	Videos, UnknownDuration int
+	Length                  time.Duration
+	Need, Free, Reserve     int64
+	Fits                    bool
+}
+
+func newForecastData(f ytarchiver.StorageForecast) forecastData {
+	return forecastData{
+		Time:            f.Time,
+		Videos:          f.Videos,
+		UnknownDuration: f.UnknownDuration,
+		Length:          time.Duration(f.Seconds) * time.Second,
+		Need:            int64(f.Bytes),
+		Free:            int64(f.Free),
+		Reserve:         int64(f.Reserve),
+		Fits:            f.Fits(),
+	}
+}
+
+func handleStats(c *gin.Context) {
+	dat, err := loadStandardData(c)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	dat.L = requestLocale(c)
+
+	chans := make([]channelStats, len(dat.Chans))
+	var total channelStats
+	for i, ch := range dat.Chans {
+		chans[i].ChannelInfo = ch
+		for _, v := range dat.Videos[ch.ID] {
+			chans[i].add(v)
+			total.add(v)
+		}
+	}
+
+	// The forecast covers every channel, so is only shown to those who
+	// may see them all.
+	var forecast *forecastData
+	if !requestUser(c).Restricted() {
+		f, err := ytarchiver.ReadForecastFS(rootFS)
+		if err != nil {
+			c.AbortWithError(500, err)
+			return
+		}
+		if !f.Time.IsZero() {
+			fd := newForecastData(f)
+			forecast = &fd
+		}
+	}
+
+	c.HTML(200, "stats.gohtml", struct {
+		standardData
+		Channels []channelStats
+		Total    channelStats
+		// Nil if there is no forecast to show.
+		Forecast *forecastData
+	}{dat, chans, total, forecast})
+}
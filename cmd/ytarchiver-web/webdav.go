@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// davPropfind requests the properties of files needed for remoteInfo.
+const davPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop>
+<D:resourcetype/><D:getcontentlength/><D:getlastmodified/>
+</D:prop></D:propfind>`
+
+var (
+	ErrWebDAV        = errors.New("webdav")
+	ErrWebDAVNoRange = errors.New("webdav: server does not support ranges")
+)
+
+// davMultistatus is the response to a PROPFIND request.
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				Length   int64  `xml:"getcontentlength"`
+				Modified string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// webdavFS is an archive root on a WebDAV share.
+type webdavFS struct {
+	base       *url.URL
+	user, pass string
+	client     *http.Client
+}
+
+func newWebDAVFS(u *url.URL) *webdavFS {
+	base := *u
+	base.User = nil
+
+	return &webdavFS{
+		base: &base,
+		user: u.User.Username(),
+		pass: remotePassword(u),
+		client: &http.Client{
+			Timeout: time.Minute,
+			// Redirects are followed by hand so that the method is
+			// kept.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// do performs a request for name, following a single redirect.
+func (w *webdavFS) do(method, name string, header http.Header, body string) (*http.Response, error) {
+	u := w.base.JoinPath(name)
+	for redirects := 0; ; redirects++ {
+		req, err := http.NewRequest(method, u.String(), strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if w.user != "" {
+			req.SetBasicAuth(w.user, w.pass)
+		}
+
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, lerr := resp.Location()
+		if redirects > 0 || lerr != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		u = loc
+	}
+}
+
+// propfind returns the info of name and, at depth 1, the entries within it.
+func (w *webdavFS) propfind(op, name string, depth int) (remoteInfo, []remoteInfo, error) {
+	var self remoteInfo
+	header := http.Header{
+		"Depth":        {fmt.Sprint(depth)},
+		"Content-Type": {"application/xml"},
+	}
+	resp, err := w.do("PROPFIND", name, header, davPropfind)
+	if err != nil {
+		return self, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if err := davStatus(resp, http.StatusMultiStatus); err != nil {
+		return self, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return self, nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%w: %v", ErrWebDAV, err)}
+	}
+	if len(ms.Responses) == 0 {
+		return self, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	selfPath := strings.TrimSuffix(resp.Request.URL.Path, "/")
+	var ents []remoteInfo
+	for i, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSuffix(href.Path, "/")
+
+		info := remoteInfo{name: path.Base(p), mode: 0444}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				info.mode = fs.ModeDir | 0555
+			}
+			info.size = ps.Prop.Length
+			info.mtime, _ = http.ParseTime(ps.Prop.Modified)
+		}
+
+		// At depth 0, the only response is for name itself.
+		if p == selfPath || depth == 0 && i == 0 {
+			info.name = path.Base(name)
+			self = info
+		} else {
+			ents = append(ents, info)
+		}
+	}
+
+	return self, ents, nil
+}
+
+// davStatus returns an error for resp unless it has the status want.
+func davStatus(resp *http.Response, want int) error {
+	switch resp.StatusCode {
+	case want:
+		return nil
+	case http.StatusNotFound:
+		return fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fs.ErrPermission
+	default:
+		return fmt.Errorf("%w: %s", ErrWebDAV, resp.Status)
+	}
+}
+
+func (w *webdavFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, _, err := w.propfind("open", name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &remoteFile{info: info}
+	if f.info.IsDir() {
+		f.list = func() ([]fs.DirEntry, error) { return w.ReadDir(name) }
+	} else {
+		f.r = webdavReaderAt{w, name}
+	}
+	return f, nil
+}
+
+func (w *webdavFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, _, err := w.propfind("stat", name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (w *webdavFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// Collections are named with a trailing slash.
+	_, ents, err := w.propfind("readdir", name+"/", 1)
+	if err != nil {
+		return nil, err
+	}
+	return remoteEntries(ents), nil
+}
+
+// ReadFile reads a whole file with a single request.
+func (w *webdavFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	resp, err := w.do(http.MethodGet, name, nil, "")
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if err := davStatus(resp, http.StatusOK); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// webdavReaderAt reads ranges of a file on a WebDAV share.
+type webdavReaderAt struct {
+	w    *webdavFS
+	name string
+}
+
+func (r webdavReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)}}
+	resp, err := r.w.do(http.MethodGet, r.name, header, "")
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: r.name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	case resp.StatusCode == http.StatusOK && off != 0:
+		return 0, &fs.PathError{Op: "read", Path: r.name, Err: ErrWebDAVNoRange}
+	case resp.StatusCode != http.StatusOK:
+		if err := davStatus(resp, http.StatusPartialContent); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: r.name, Err: err}
+		}
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrFragment = errors.New("channel fragment")
+
+// readChannelsDir reads the channel defined by each fragment file in dir,
+// in order of file name. Files other than JSON and YAML are ignored, as are
+// hidden files, so that editor backups are not picked up.
+func readChannelsDir(dir string) ([]configChannel, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFragment, err)
+	}
+
+	names := make([]string, 0, len(ents))
+	for _, ent := range ents {
+		names = append(names, ent.Name())
+	}
+	sort.Strings(names)
+
+	var chans []configChannel
+	for _, name := range names {
+		ext := filepath.Ext(name)
+		if strings.HasPrefix(name, ".") || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		ch, err := readFragment(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrFragment, name, err)
+		}
+		chans = append(chans, ch)
+	}
+
+	return chans, nil
+}
+
+// readFragment reads the channel defined by a single fragment file. Keys
+// are matched against field names, ignoring case.
+func readFragment(path string) (configChannel, error) {
+	var ch configChannel
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return ch, err
+	}
+
+	// YAML is converted to JSON so that keys are matched the same way.
+	if filepath.Ext(path) != ".json" {
+		var v any
+		if err := yaml.Unmarshal(dat, &v); err != nil {
+			return ch, err
+		}
+		if dat, err = json.Marshal(v); err != nil {
+			return ch, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ch); err != nil {
+		return ch, err
+	}
+	if err := expandEnv(reflect.ValueOf(&ch).Elem()); err != nil {
+		return ch, err
+	}
+
+	return ch, nil
+}
@@ -0,0 +1,1340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+)
+
+var (
+	ErrDoctorFailed       = errors.New("one or more checks failed")
+	ErrQuarantineCommand  = errors.New("usage: quarantine list|clear [video ID...] [flags]")
+	ErrUnavailableCommand = errors.New("usage: unavailable list|clear [video ID...] [flags]")
+	ErrCheckFailed        = errors.New("config check failed")
+	ErrExportIACommand    = errors.New("usage: export-ia [-copy] [-collection=NAME] [-prefix=PREFIX] DEST [channel ID...] [flags]")
+	ErrWouldNotFit        = errors.New("forecast does not fit in the free space")
+	ErrObjectsCommand     = errors.New("usage: objects store|verify|gc [flags]")
+	ErrVerifyFailed       = errors.New("object store verification failed")
+	ErrBackupCommand      = errors.New("usage: backup-state FILE [flags]")
+	ErrRestoreCommand     = errors.New("usage: restore-state [-force] FILE [flags]")
+	ErrBreakersCommand    = errors.New("usage: breakers list|clear [channel...] [flags]")
+	ErrTestSelectors      = errors.New("usage: test-selectors --channel ID [--limit N] [flags]")
+	ErrCanaryFailed       = errors.New("downloader canary failed")
+	ErrUpdateDisabled     = errors.New("downloader updates are disabled (set downloader_update to 'self' or 'managed')")
+	ErrReportCommand      = errors.New("usage: report [-html] [-notify] [-out=FILE] [channel ID...] [flags]")
+	ErrNoNotifiers        = errors.New("no notifiers are configured")
+	ErrMetadataHistory    = errors.New("usage: metadata-history CHANNEL_ID [video ID...] [flags]")
+	ErrImportTakeout      = errors.New("usage: import-takeout [-sources=history,watch-later,liked,playlist] [-dir=DIR] TAKEOUT [flags]")
+	ErrImportChannels     = errors.New("usage: import-channels [-dir=DIR] LIST [flags]")
+)
+
+// A command is an alternative mode of operation for the executable,
+// selected by the first argument. Without a command, the daemon is started.
+type command struct {
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"backup-state":      {"write the archiver's state (archived videos, history, quarantine, backlog progress) to a portable file", cmdBackupState},
+		"breakers":          {"list or clear channels which failed too many runs in a row, and so are skipped for a while", cmdBreakers},
+		"canary":            {"check that the downloader can still extract a video known to be available", cmdCanary},
+		"check-config":      {"validate the config and summarise what will be archived (-resolve to look up channels)", cmdCheckConfig},
+		"doctor":            {"check the configuration and environment for problems", cmdDoctor},
+		"export-ia":         {"package archived videos as Internet Archive items, ready for upload", cmdExportIA},
+		"forecast":          {"estimate the disk space needed to archive every video not yet archived, as a dry run", cmdForecast},
+		"help":              {"print this message", cmdHelp},
+		"import-channels":   {"add the channels in an OPML or CSV list (e.g exported from an RSS reader) to the channels directory", cmdImportChannels},
+		"import-takeout":    {"turn the watch history and playlists of a Google Takeout export into channels archiving just those videos", cmdImportTakeout},
+		"init":              {"interactively generate a starter config", cmdInit},
+		"metadata-history":  {"show the changes to the titles and descriptions of a channel's archived videos found by metadata refreshes", cmdMetadataHistory},
+		"migrate":           {"upgrade the archive root to the current layout", cmdMigrate},
+		"oauth-login":       {"authorise the archiver to read your liked videos and watch later playlists (see oauth_client_id)", cmdOAuthLogin},
+		"objects":           {"move videos into the content-addressed store, verify it or remove unlinked objects", cmdObjects},
+		"quarantine":        {"list or clear videos which repeatedly failed to archive", cmdQuarantine},
+		"report":            {"summarise the completeness of each channel's archive as Markdown or HTML (-notify to send it to the notifiers)", cmdReport},
+		"restore-state":     {"restore the archiver's state from a file written by backup-state (-force to replace existing state)", cmdRestoreState},
+		"status":            {"report the state of the running daemon (-json for machine-readable output)", cmdStatus},
+		"test-selectors":    {"show which selectors accept each of a channel's recent videos, without archiving anything", cmdTestSelectors},
+		"trigger":           {"ask the running daemon to run now (see the trigger control command)", cmdTrigger},
+		"unavailable":       {"list or clear videos which the downloader reported to be permanently unavailable", cmdUnavailable},
+		"update-downloader": {"update the downloader now, as set by downloader_update", cmdUpdateDownloader},
+	}
+}
+
+// runCommand runs the command named by args[0], if any. It reports false if
+// there is no such command.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false, nil
+	}
+
+	return true, cmd.Run(args[1:])
+}
+
+func cmdHelp(_ []string) error {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "With no command, the archiver daemon is started. Commands:")
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "\t%-12s %s\n", n, commands[n].Usage)
+	}
+
+	return nil
+}
+
+func cmdDoctor(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	failed := false
+	if err := ValidateConfig(cfg); err != nil && len(cfg.Profiles) > 0 {
+		fmt.Printf("[FAIL] config: %v\n", err)
+		failed = true
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Name != "" {
+			fmt.Printf("Profile %s:\n", p.Name)
+		}
+
+		// Keep going with whatever did convert so that the other checks
+		// still have something to work with.
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			fmt.Printf("[FAIL] config: %v\n", err)
+			failed = true
+		} else {
+			fmt.Println("[ok] config: valid")
+		}
+
+		diags := ytarchiver.Doctor(context.Background(), conf)
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		failed = failed || ytarchiver.DoctorFailed(diags)
+	}
+
+	if failed {
+		return ErrDoctorFailed
+	}
+	return nil
+}
+
+func cmdMigrate(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	for _, p := range cfg.profiles() {
+		if err := migrateRoot(p.Root); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cmdForecast(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	fits := true
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+		a, err := ytarchiver.NewArchiver(conf)
+		if err != nil {
+			return err
+		}
+
+		f, err := a.Forecast()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %v\n", p.Root, f)
+		fits = fits && f.Fits()
+	}
+
+	if !fits {
+		return ErrWouldNotFit
+	}
+	return nil
+}
+
+func cmdObjects(args []string) error {
+	if len(args) == 0 {
+		return ErrObjectsCommand
+	}
+	action := args[0]
+	switch action {
+	case "store", "verify", "gc":
+	default:
+		return ErrObjectsCommand
+	}
+
+	cfg, err := NewConfig(args[1:])
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	ok := true
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+
+		switch action {
+		case "store":
+			n, err := ytarchiver.StoreObjects(p.Root, func(path string) {
+				fmt.Println("stored", path)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: stored %d video(s)\n", p.Root, n)
+		case "verify":
+			n, faults, err := ytarchiver.VerifyObjects(p.Root)
+			if err != nil {
+				return err
+			}
+			for _, f := range faults {
+				fmt.Println("[FAIL]", f)
+			}
+			fmt.Printf("%s: verified %d object(s), %d fault(s)\n", p.Root, n, len(faults))
+			ok = ok && len(faults) == 0
+		case "gc":
+			n, freed, err := ytarchiver.CollectObjects(p.Root)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: removed %d unlinked object(s), freeing %d MiB\n", p.Root, n, freed>>20)
+		}
+	}
+
+	if !ok {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+func cmdBackupState(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return ErrBackupCommand
+	}
+	dest := args[0]
+
+	cfg, err := NewConfig(args[1:])
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	profiles := cfg.profiles()
+	for _, p := range profiles {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		// Each profile has its own root, and so its own state.
+		path := dest
+		if len(profiles) > 1 {
+			path += "." + p.Name
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = ytarchiver.BackupState(p.Root, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("backed up state of %s to %s\n", p.Root, path)
+	}
+	return nil
+}
+
+func cmdRestoreState(args []string) error {
+	// -force comes before the file.
+	force := len(args) > 0 && (args[0] == "-force" || args[0] == "--force")
+	if force {
+		args = args[1:]
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return ErrRestoreCommand
+	}
+	src := args[0]
+
+	cfg, err := NewConfig(args[1:])
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	profiles := cfg.profiles()
+	for _, p := range profiles {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		path := src
+		if len(profiles) > 1 {
+			path += "." + p.Name
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = ytarchiver.RestoreState(p.Root, f, force)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored state of %s from %s\n", p.Root, path)
+	}
+	return nil
+}
+
+func migrateRoot(root string) error {
+	if root == "" {
+		return ErrNoRoot
+	}
+
+	m, err := ytarchiver.ReadManifest(root)
+	if err != nil {
+		return err
+	}
+	if m.LayoutVersion == ytarchiver.LayoutVersion {
+		fmt.Printf("%s: layout %d is up to date\n", root, m.LayoutVersion)
+	}
+
+	return ytarchiver.Migrate(root, func(from, to int, desc string) {
+		fmt.Printf("%s: migrating layout %d to %d: %s\n", root, from, to, desc)
+	})
+}
+
+func cmdQuarantine(args []string) error {
+	if len(args) == 0 {
+		return ErrQuarantineCommand
+	}
+	action := args[0]
+
+	// Video IDs come before any flags.
+	args = args[1:]
+	var ids []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ids = append(ids, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	if action != "list" && action != "clear" {
+		return ErrQuarantineCommand
+	}
+
+	// The quarantines of every profile are listed or cleared together.
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		if action == "clear" {
+			if err := ytarchiver.ClearQuarantine(p.Root, ids...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		vids, err := ytarchiver.ReadQuarantine(p.Root)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range vids {
+			if len(ids) > 0 && !slices.Contains(ids, v.VideoID) {
+				continue
+			}
+			fmt.Printf("%s (channel %s): %d failure(s), next attempt %v\n\t%s\n",
+				v.VideoID, v.ChannelID, v.Failures, v.NextAttempt.Format(time.RFC1123), v.LastError)
+		}
+	}
+
+	return nil
+}
+
+func cmdUnavailable(args []string) error {
+	if len(args) == 0 {
+		return ErrUnavailableCommand
+	}
+	action := args[0]
+
+	// Video IDs come before any flags.
+	args = args[1:]
+	var ids []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ids = append(ids, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	if action != "list" && action != "clear" {
+		return ErrUnavailableCommand
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		if action == "clear" {
+			if err := ytarchiver.ClearUnavailable(p.Root, ids...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		vids, err := ytarchiver.ReadUnavailable(p.Root)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range vids {
+			if len(ids) > 0 && !slices.Contains(ids, v.VideoID) {
+				continue
+			}
+			fmt.Printf("%s (channel %s): %s since %v, last checked %v\n\t%s\n",
+				v.VideoID, v.ChannelID, v.Reason, v.FirstSeen.Format(time.RFC1123), v.LastChecked.Format(time.RFC1123), v.Message)
+		}
+	}
+
+	return nil
+}
+
+func cmdMetadataHistory(args []string) error {
+	// The channel and video IDs come before any flags.
+	var ids []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ids = append(ids, args[0])
+		args = args[1:]
+	}
+	if len(ids) == 0 {
+		return ErrMetadataHistory
+	}
+	cid, ids := ids[0], ids[1:]
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		hists, err := ytarchiver.ReadChannelHistory(filepath.Join(p.Root, cid))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, id := range slices.Sorted(maps.Keys(hists)) {
+			if len(ids) > 0 && !slices.Contains(ids, id) {
+				continue
+			}
+			for _, c := range hists[id] {
+				fmt.Printf("%s: %s changed, seen %v\n", id, c.Field, c.Time.Format(time.RFC1123))
+				for _, line := range strings.Split(strings.TrimSuffix(ytarchiver.LineDiff(c.Old, c.New), "\n"), "\n") {
+					fmt.Printf("\t%s\n", line)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// takeoutChannel is a channel imported by import-takeout or import-channels,
+// as written to the config. The keys of list items in the config are
+// matched against field names, rather than converted.
+type takeoutChannel struct {
+	ID        string            `json:"ID"`
+	Selectors []takeoutSelector `json:"Selectors,omitempty"`
+}
+
+type takeoutSelector struct {
+	Videos []string `json:"Videos"`
+}
+
+func cmdImportTakeout(args []string) error {
+	var sources []string
+	dir := ""
+	// Options come before the export, and the export before any flags.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		switch name, val, _ := strings.Cut(opt, "="); name {
+		case "sources":
+			sources = strings.Split(val, ",")
+			for _, s := range sources {
+				switch s {
+				case ytarchiver.TakeoutHistory, ytarchiver.TakeoutWatchLater, ytarchiver.TakeoutLiked, ytarchiver.TakeoutPlaylist:
+				default:
+					return ErrImportTakeout
+				}
+			}
+		case "dir":
+			dir = val
+		default:
+			return ErrImportTakeout
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return ErrImportTakeout
+	}
+	path := args[0]
+	args = args[1:]
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	videos, err := ytarchiver.ReadTakeout(path)
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 {
+		videos = slices.DeleteFunc(videos, func(v ytarchiver.TakeoutVideo) bool {
+			return !slices.Contains(sources, v.Source)
+		})
+	}
+
+	// Only videos of unknown channels need the API.
+	conf, err := cfg.profiles()[0].ArchiverConfig()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cl, err := ytarchiver.NewClient(ctx, conf)
+	if err != nil {
+		return err
+	}
+	chans, err := ytarchiver.TakeoutTargets(ctx, cl, videos)
+	if err != nil {
+		return err
+	}
+
+	imported := make([]takeoutChannel, len(chans))
+	n := 0
+	for i, ch := range chans {
+		ids := ch.Selectors[0].(ytarchiver.IDSelector).IDs
+		imported[i] = takeoutChannel{ID: ch.ID, Selectors: []takeoutSelector{{Videos: ids}}}
+		n += len(ids)
+	}
+	if dir == "" {
+		dat, err := json.MarshalIndent(imported, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(dat))
+		return nil
+	}
+
+	// Each channel becomes a fragment of the channels directory, which is
+	// replaced if imported again.
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, ch := range imported {
+		dat, err := json.MarshalIndent(ch, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "takeout-"+ch.ID+".json"), append(dat, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d channel(s) with %d video(s) into %s\n", len(imported), n, dir)
+	return nil
+}
+
+func cmdImportChannels(args []string) error {
+	dir := ""
+	// Options come before the list, and the list before any flags.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		switch name, val, _ := strings.Cut(opt, "="); name {
+		case "dir":
+			dir = val
+		default:
+			return ErrImportChannels
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return ErrImportChannels
+	}
+	path := args[0]
+	args = args[1:]
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+	p := cfg.profiles()[0]
+	if dir == "" {
+		dir = p.ChannelsDir
+	}
+
+	listed, err := ytarchiver.ReadChannelList(path)
+	if err != nil {
+		return err
+	}
+	conf, err := p.ArchiverConfig()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cl, err := ytarchiver.NewClient(ctx, conf)
+	if err != nil {
+		return err
+	}
+	found, err := ytarchiver.ResolveChannels(ctx, cl, listed)
+	if err != nil {
+		return err
+	}
+
+	// Channels already configured by handle are matched without looking
+	// them up again.
+	configured := make(map[string]bool)
+	for _, ch := range p.Channels {
+		if ch.ID != "" {
+			configured[ch.ID] = true
+		}
+		if ch.Handle != "" {
+			configured["@"+strings.ToLower(strings.TrimPrefix(ch.Handle, "@"))] = true
+		}
+	}
+	var imported []takeoutChannel
+	for _, c := range found {
+		if configured[c.Id] || configured[strings.ToLower(c.Snippet.CustomUrl)] {
+			fmt.Printf("%s (%s) is already configured\n", c.Id, c.Snippet.Title)
+			continue
+		}
+		imported = append(imported, takeoutChannel{ID: c.Id})
+	}
+	if dir == "" {
+		dat, err := json.MarshalIndent(imported, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(dat))
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, ch := range imported {
+		dat, err := json.MarshalIndent(ch, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "import-"+ch.ID+".json"), append(dat, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d new channel(s) of %d listed into %s\n", len(imported), len(listed), dir)
+	return nil
+}
+
+func cmdOAuthLogin(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	// Each root keeps its own token, so that profiles may archive
+	// different accounts.
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+		if p.Name != "" {
+			fmt.Printf("Profile %s:\n", p.Name)
+		}
+		err = ytarchiver.OAuthLogin(context.Background(), conf, func(url, code string) {
+			fmt.Printf("Go to %s and enter the code %s\n", url, code)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("Logged in")
+	}
+
+	return nil
+}
+
+func cmdCanary(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	failed := false
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+
+		if st, err := ytarchiver.ReadCanary(p.Root); err == nil && !st.Checked.IsZero() {
+			state := "healthy"
+			if !st.Healthy {
+				state = "broken"
+			}
+			fmt.Printf("%s: last checked %v: %s since %v\n", p.Root, st.Checked.Format(time.RFC1123), state, st.Since.Format(time.RFC1123))
+		}
+
+		dl, err := ytarchiver.DetectDownloader(conf.Downloader)
+		if err != nil {
+			return err
+		}
+		if err := ytarchiver.RunCanary(context.Background(), conf, dl); err != nil {
+			fmt.Printf("%s: %s: %v\n", p.Root, dl, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s: ok\n", p.Root, dl)
+	}
+
+	if failed {
+		return ErrCanaryFailed
+	}
+	return nil
+}
+
+func cmdBreakers(args []string) error {
+	if len(args) == 0 {
+		return ErrBreakersCommand
+	}
+	action := args[0]
+
+	// Channels come before any flags.
+	args = args[1:]
+	var ids []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ids = append(ids, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	if action != "list" && action != "clear" {
+		return ErrBreakersCommand
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		if action == "clear" {
+			if err := ytarchiver.ClearBreakers(p.Root, ids...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		chans, err := ytarchiver.ReadBreakers(p.Root)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, c := range chans {
+			if len(ids) > 0 && !slices.Contains(ids, c.ChannelID) {
+				continue
+			}
+			state := "closed"
+			if c.Open(now) {
+				state = "open until " + c.OpenUntil.Format(time.RFC1123)
+			}
+			fmt.Printf("%s: %d consecutive failure(s), %s\n\t%s\n", c.ChannelID, c.Failures, state, c.LastError)
+		}
+	}
+
+	return nil
+}
+
+func cmdUpdateDownloader(args []string) error {
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+		if conf.DownloaderUpdate == ytarchiver.DownloaderUpdateOff {
+			return ErrUpdateDisabled
+		}
+
+		dl, err := ytarchiver.UpdateDownloader(context.Background(), conf)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s (%s)\n", p.Root, dl.Path, dl)
+	}
+
+	return nil
+}
+
+func cmdExportIA(args []string) error {
+	var opts ytarchiver.IAExportOptions
+
+	// Options come before the destination, and channel IDs before any
+	// flags.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		switch name, val, _ := strings.Cut(opt, "="); name {
+		case "copy":
+			opts.Copy = true
+		case "collection":
+			opts.Collection = val
+		case "prefix":
+			opts.Prefix = val
+		default:
+			return ErrExportIACommand
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return ErrExportIACommand
+	}
+	dest := args[0]
+	args = args[1:]
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		opts.Channels = append(opts.Channels, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		n, err := ytarchiver.ExportIA(p.Root, dest, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("exported %d item(s) from %s to %s\n", n, p.Root, dest)
+	}
+	return nil
+}
+
+func cmdTestSelectors(args []string) error {
+	var (
+		ident string
+		limit int
+	)
+
+	// Options come before any flags.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		name, val, ok := strings.Cut(opt, "=")
+		if name != "channel" && name != "limit" {
+			break
+		}
+		// Also accepted as a separate argument.
+		if !ok && len(args) > 1 {
+			val = args[1]
+			args = args[1:]
+		}
+		args = args[1:]
+
+		switch name {
+		case "channel":
+			ident = val
+		case "limit":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return ErrTestSelectors
+			}
+			limit = n
+		}
+	}
+	if ident == "" {
+		return ErrTestSelectors
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	found := false
+	for _, p := range cfg.profiles() {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+		// Only the profiles archiving the channel are of interest.
+		if !slices.ContainsFunc(conf.Channels, func(c ytarchiver.YouTubeChannel) bool {
+			return c.Identity() == ident
+		}) {
+			continue
+		}
+		found = true
+
+		a, err := ytarchiver.NewArchiver(conf)
+		if err != nil {
+			return err
+		}
+		tests, err := a.TestSelectors(ident, limit)
+		if err != nil {
+			return err
+		}
+		if p.Name != "" {
+			fmt.Printf("Profile %s:\n", p.Name)
+		}
+		printSelectorTests(tests)
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", ytarchiver.ErrUnknownChannel, ident)
+	}
+	return nil
+}
+
+// printSelectorTests prints a table of the verdict of each selector on each
+// video tested, with the selectors numbered in a key above it.
+func printSelectorTests(tests []ytarchiver.SelectorTest) {
+	if len(tests) == 0 {
+		fmt.Println("no videos found")
+		return
+	}
+	if len(tests[0].Verdicts) == 0 {
+		fmt.Println("no selectors apply; every video is archived")
+	}
+	for i, v := range tests[0].Verdicts {
+		fmt.Printf("[%d] %s\n", i+1, v.Selector)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "VIDEO\tPUBLISHED")
+	for i := range tests[0].Verdicts {
+		fmt.Fprintf(tw, "\t[%d]", i+1)
+	}
+	fmt.Fprintln(tw, "\tRESULT\tTITLE")
+
+	for _, t := range tests {
+		pub := "?"
+		if !t.Published.IsZero() {
+			pub = t.Published.Format(time.DateOnly)
+		}
+		fmt.Fprintf(tw, "%s\t%s", t.VideoID, pub)
+		for _, v := range t.Verdicts {
+			switch {
+			case !v.Applies:
+				fmt.Fprint(tw, "\t-")
+			case v.Accepted:
+				fmt.Fprint(tw, "\taccept")
+			default:
+				fmt.Fprint(tw, "\treject")
+			}
+		}
+		result := "skip"
+		if t.Selected() {
+			result = "archive"
+		}
+		if t.Archived {
+			result += " (archived)"
+		}
+		fmt.Fprintf(tw, "\t%s\t%s\n", result, t.Title)
+	}
+	tw.Flush()
+}
+
+func cmdCheckConfig(args []string) error {
+	// -resolve comes before any flags.
+	resolve := len(args) > 0 && (args[0] == "-resolve" || args[0] == "--resolve")
+	if resolve {
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		fmt.Printf("[FAIL] %v\n", err)
+		return ErrCheckFailed
+	}
+
+	ok := true
+	for _, p := range cfg.profiles() {
+		ok = checkProfile(p, resolve) && ok
+	}
+
+	if !ok {
+		return ErrCheckFailed
+	}
+	fmt.Println("[ok] config is valid")
+	return nil
+}
+
+// checkProfile prints a summary of what p archives, reporting false if
+// there is a problem with it. If resolve is set, the channels and URLs are
+// looked up using the API.
+func checkProfile(p profile, resolve bool) bool {
+	if p.Name != "" {
+		fmt.Printf("Profile %s:\n", p.Name)
+	}
+	ok := true
+	fail := func(format string, v ...any) {
+		fmt.Printf("\t[FAIL] "+format+"\n", v...)
+		ok = false
+	}
+
+	conf, err := p.ArchiverConfig()
+	if err != nil {
+		fail("%v", err)
+		return false
+	}
+	var cerr ytarchiver.ConfigError
+	if errors.As(ytarchiver.ValidateConfig(conf), &cerr) {
+		for _, prob := range cerr {
+			fail("%v", prob)
+		}
+	}
+
+	fmt.Println("root:", conf.Root)
+	if sch, err := newScheduler(p.Config, time.Now()); err != nil {
+		fail("%v", err)
+	} else {
+		for _, d := range sch.Describe() {
+			fmt.Println("schedule:", d)
+		}
+	}
+	for _, s := range conf.Selectors {
+		fmt.Println("selector:", ytarchiver.DescribeSelector(s))
+	}
+	for _, s := range conf.Exclusions {
+		fmt.Println("exclude:", ytarchiver.DescribeSelector(s))
+	}
+
+	var cl ytarchiver.YouTubeClient
+	ctx := context.Background()
+	if resolve {
+		if cl, err = ytarchiver.NewClient(ctx, conf); err != nil {
+			fail("%v", err)
+			resolve = false
+		}
+	}
+
+	for i, ch := range conf.Channels {
+		fmt.Println("channel", ch.Identity())
+		if len(ch.Tabs) > 0 {
+			fmt.Println("\ttabs:", strings.Join(ch.Tabs, ", "))
+		}
+		if ch.MetadataOnly {
+			fmt.Println("\tmetadata only")
+		}
+		if s := p.Channels[i].Schedule; s != "" {
+			fmt.Printf("\tschedule: %q\n", s)
+		}
+		for _, s := range ch.Selectors {
+			fmt.Println("\tselector:", ytarchiver.DescribeSelector(s))
+		}
+
+		if !resolve {
+			continue
+		}
+		c, err := cl.ListChannel(ctx, ch)
+		switch {
+		case err != nil:
+			fail("%v", err)
+		case c == nil:
+			fail("channel not found")
+		default:
+			fmt.Printf("\tresolved: %s (%s)\n", c.Id, c.Snippet.Title)
+		}
+	}
+
+	for _, u := range conf.URLs {
+		fmt.Println("url", u)
+		if err := ytarchiver.CheckURL(u); err != nil {
+			fail("%v", err)
+			continue
+		}
+
+		if !resolve {
+			continue
+		}
+		chans, err := ytarchiver.ResolveURLs(ctx, cl, []string{u})
+		if err != nil {
+			fail("%v", err)
+		}
+		for _, ch := range chans {
+			fmt.Println("\tresolved:", ch.Identity())
+		}
+	}
+
+	return ok
+}
+
+func cmdStatus(args []string) error {
+	// -json comes before any flags.
+	asJSON := len(args) > 0 && (args[0] == "-json" || args[0] == "--json")
+	if asJSON {
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	var stats []*controlStatus
+	for _, p := range cfg.profiles() {
+		resp, err := queryControl(cfg.ControlSocket, strings.TrimSpace("status "+p.Name))
+		if err != nil {
+			return fmt.Errorf("ytarchiver: status: %w", err)
+		}
+		stats = append(stats, resp.Status)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(stats)
+	}
+
+	for _, st := range stats {
+		printStatus(st)
+	}
+	return nil
+}
+
+// printStatus prints a human-readable report of st.
+func printStatus(st *controlStatus) {
+	if st.Profile != "" {
+		fmt.Printf("Profile %s:\n", st.Profile)
+	}
+
+	if len(st.Progress) > 0 {
+		fmt.Printf("Run in progress: %d download(s)\n", len(st.Progress))
+		if st.BandwidthLimit != 0 {
+			fmt.Printf("Bandwidth: %.2f of %.2f MiB/s\n", st.BandwidthUsed/(1<<20), float64(st.BandwidthLimit)/(1<<20))
+		}
+	} else {
+		fmt.Println("Idle")
+	}
+	fmt.Printf("Next run: %s\n", st.NextRun.Format(time.RFC1123))
+	if len(st.History) > 0 {
+		last := st.History[len(st.History)-1]
+		fmt.Printf("Last run: %s, %d video(s), %d failed, %d error(s)\n",
+			last.End.Format(time.RFC1123), last.Videos, last.Failed, len(last.Errors))
+	}
+	fmt.Printf("Disk: %d MiB used, %d MiB free\n", st.DiskUsed>>20, st.DiskFree>>20)
+	fmt.Printf("Quota: ~%d of %d units used, resets %s\n",
+		st.QuotaUsed, st.QuotaLimit, st.QuotaReset.Format(time.RFC1123))
+	fmt.Printf("Quarantined: %d video(s)\n", st.Quarantined)
+	fmt.Printf("Unavailable: %d video(s)\n", st.Unavailable)
+
+	fmt.Println("Channels:")
+	for _, c := range st.Channels {
+		if c.LastRun == nil {
+			fmt.Printf("\t%s: never archived\n", c.Channel)
+			continue
+		}
+
+		outcome := "ok"
+		if len(c.LastRun.Errors) > 0 {
+			outcome = fmt.Sprintf("%d error(s)", len(c.LastRun.Errors))
+		}
+		fmt.Printf("\t%s: last run %s (%s), %d archived, %d failed, %d pending, %d quarantined, %d unavailable\n",
+			c.Channel, c.LastRun.LastRun.Format(time.RFC1123), outcome,
+			c.LastRun.Archived, c.LastRun.Failed, c.LastRun.Pending, c.Quarantined, c.Unavailable)
+	}
+}
+
+func cmdTrigger(args []string) error {
+	// The operation and its arguments come before any flags.
+	var op []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		op = append(op, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	if _, err := queryControl(cfg.ControlSocket, strings.Join(append([]string{"trigger"}, op...), " ")); err != nil {
+		return fmt.Errorf("ytarchiver: trigger: %w", err)
+	}
+	fmt.Println("Triggered")
+	return nil
+}
+
+func cmdReport(args []string) error {
+	var asHTML, notify bool
+	out := ""
+	// Options come before channel IDs, and channel IDs before any flags,
+	// which begin at the first unknown option.
+options:
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "-")
+		switch name, val, _ := strings.Cut(opt, "="); name {
+		case "html":
+			asHTML = true
+		case "notify":
+			notify = true
+		case "out":
+			if val == "" {
+				return ErrReportCommand
+			}
+			out = val
+		default:
+			break options
+		}
+		args = args[1:]
+	}
+	var chans []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		chans = append(chans, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := NewConfig(args)
+	if err != nil {
+		return fmt.Errorf("ytarchiver: parsing config: %w", err)
+	}
+
+	profiles := cfg.profiles()
+	for _, p := range profiles {
+		if p.Root == "" {
+			return ErrNoRoot
+		}
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return err
+		}
+		r, err := ytarchiver.NewReport(p.Root, chans...)
+		if err != nil {
+			return err
+		}
+
+		var text, page strings.Builder
+		if err := r.Markdown(&text); err != nil {
+			return err
+		}
+		if err := r.HTML(&page); err != nil {
+			return err
+		}
+		body := text.String()
+		if asHTML {
+			body = page.String()
+		}
+
+		switch {
+		case out != "":
+			// Each profile has its own root, and so its own report.
+			path := out
+			if len(profiles) > 1 {
+				path += "." + p.Name
+			}
+			if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+				return err
+			}
+			fmt.Println("Wrote", path)
+		case !notify:
+			fmt.Print(body)
+		}
+
+		if notify {
+			if len(conf.Notifiers) == 0 {
+				return ErrNoNotifiers
+			}
+			err := ytarchiver.Notify(context.Background(), conf.Notifiers, ytarchiver.Event{
+				Kind:    ytarchiver.EventReport,
+				Title:   "Archive report for " + p.Root,
+				Message: text.String(),
+				HTML:    page.String(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -2,7 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/cristalhq/aconfig"
 	ytarchiver "github.com/ejv2/yt-archiver"
@@ -14,9 +20,70 @@ var configSearchPaths = []string{
 	"/usr/share/ytarchive/ytarchive.json",
 }
 
+// Every setting may also be given by an environment variable named after its
+// key, with this prefix (e.g YTARCHIVER_API_KEY).
+const envPrefix = "YTARCHIVER"
+
+const (
+	// configEnv names the config file to use, unless -config is given.
+	configEnv = envPrefix + "_CONFIG"
+	// channelsEnv lists channels to archive in addition to any configured,
+	// separated by commas or whitespace. Each is a channel ID, handle or
+	// URL, as accepted by the init command.
+	channelsEnv = envPrefix + "_CHANNELS"
+)
+
 var (
 	ErrIntervalTooShort = errors.New("interval must be at least 30s")
 	ErrBlankAPIKey      = errors.New("blank API key supplied: an API key is required: go to https://console.cloud.google.com")
+	ErrBadJitter        = errors.New("jitter must be at least 0 and less than 1")
+	ErrNoSchedule       = errors.New("one of interval or schedule must be set")
+	ErrTwoSchedules     = errors.New("only one of interval or schedule may be set")
+	ErrWatchSkipped     = errors.New("watch_upcoming requires the recheck upcoming policy")
+	ErrNoRoot           = errors.New("root must be set")
+	ErrTwoAPIKeys       = errors.New("only one of api_key or api_key_file may be set")
+	ErrUnsetEnv         = errors.New("unset environment variable")
+	ErrInvalidLogFormat = errors.New("invalid log format (want 'text' or 'json')")
+)
+
+var (
+	ErrUnnamedProfile   = errors.New("every profile must have a name")
+	ErrDuplicateProfile = errors.New("duplicate profile name")
+	ErrProfileChannels  = errors.New("channels and urls must be given in each profile when profiles are used")
+)
+
+var (
+	ErrInvalidUpcoming = errors.New("invalid upcoming policy (want 'recheck' or 'skip')")
+	upcomingPolicies   = map[string]int{"": ytarchiver.UpcomingRecheck,
+		"recheck": ytarchiver.UpcomingRecheck,
+		"skip":    ytarchiver.UpcomingSkip}
+	ErrInvalidEnumeration = errors.New("invalid enumeration (want 'playlist' or 'activities')")
+	enumerationStrategies = map[string]int{"": ytarchiver.EnumeratePlaylist,
+		"playlist":   ytarchiver.EnumeratePlaylist,
+		"activities": ytarchiver.EnumerateActivities}
+	ErrInvalidUnavailable = errors.New("invalid unavailable policy (want 'tombstone' or 'retry')")
+	unavailablePolicies   = map[string]int{"": ytarchiver.TombstoneUnavailable,
+		"tombstone": ytarchiver.TombstoneUnavailable,
+		"retry":     ytarchiver.RetryUnavailable}
+	ErrInvalidWatchPage = errors.New("invalid watch page capture (want 'none', 'warc' or 'html')")
+	watchPageFormats    = map[string]int{"": ytarchiver.WatchPageNone,
+		"none": ytarchiver.WatchPageNone,
+		"warc": ytarchiver.WatchPageWARC,
+		"html": ytarchiver.WatchPageHTML}
+	ErrInvalidStorageForecast = errors.New("invalid storage forecast policy (want 'off', 'warn' or 'refuse')")
+	storageForecastPolicies   = map[string]int{"": ytarchiver.ForecastOff,
+		"off":    ytarchiver.ForecastOff,
+		"warn":   ytarchiver.ForecastWarn,
+		"refuse": ytarchiver.ForecastRefuse}
+	ErrInvalidDownloaderUpdate = errors.New("invalid downloader update policy (want 'off', 'self' or 'managed')")
+	downloaderUpdatePolicies   = map[string]int{"": ytarchiver.DownloaderUpdateOff,
+		"off":     ytarchiver.DownloaderUpdateOff,
+		"self":    ytarchiver.DownloaderUpdateSelf,
+		"managed": ytarchiver.DownloaderUpdateManaged}
+	ErrInvalidDigestInterval = errors.New("invalid digest interval (want 'daily' or 'weekly')")
+	digestIntervals          = map[string]time.Duration{"": 24 * time.Hour,
+		"daily":  24 * time.Hour,
+		"weekly": 7 * 24 * time.Hour}
 )
 
 // configSelector-related stuff.
@@ -24,6 +91,11 @@ var (
 	ErrInvalidRegexType = errors.New("regex selector: invalid match type (want 'title' or 'description')")
 	regexMatchTypes     = map[string]int{"title": ytarchiver.SelectorRegexTitle,
 		"description": ytarchiver.SelectorRegexDescription}
+	ErrInvalidScope = errors.New("invalid selector scope (want 'all', 'backfill' or 'new')")
+	selectorScopes  = map[string]int{"": ytarchiver.ScopeAll,
+		"all":      ytarchiver.ScopeAll,
+		"backfill": ytarchiver.ScopeBackfill,
+		"new":      ytarchiver.ScopeNew}
 )
 
 type configSelector struct {
@@ -33,9 +105,39 @@ type configSelector struct {
 	}
 	Playlist string
 	Videos   []string
+	// Case insensitive words or phrases in the title.
+	Keywords struct {
+		Include []string
+		Exclude []string
+	}
+	// Category names or IDs, with names resolved in CategoryRegion (US if
+	// empty).
+	Categories     []string
+	CategoryRegion string
+	// BCP-47 language tags of the audio (or metadata) or captions.
+	Languages        []string
+	LanguageUnknown  bool
+	CaptionLanguages []string
+
+	// Which videos the selector applies to: "all" (the default),
+	// "backfill" or "new".
+	Scope string
 }
 
 func (c configSelector) Selector() (ytarchiver.VideoSelector, error) {
+	scope, ok := selectorScopes[c.Scope]
+	if !ok {
+		return nil, ErrInvalidScope
+	}
+
+	sel, err := c.selector()
+	if sel == nil || err != nil || scope == ytarchiver.ScopeAll {
+		return sel, err
+	}
+	return ytarchiver.ScopedSelector{Selector: sel, Scope: scope}, nil
+}
+
+func (c configSelector) selector() (ytarchiver.VideoSelector, error) {
 	switch {
 	case c.Regex.Pattern != "":
 		t, ok := regexMatchTypes[c.Regex.Type]
@@ -45,52 +147,400 @@ func (c configSelector) Selector() (ytarchiver.VideoSelector, error) {
 		return ytarchiver.NewSelectorRegex(t, c.Regex.Pattern)
 	case c.Playlist != "":
 		return &ytarchiver.PlaylistSelector{PlaylistID: c.Playlist}, nil
+	case len(c.Keywords.Include) > 0 || len(c.Keywords.Exclude) > 0:
+		return ytarchiver.KeywordSelector(c.Keywords), nil
 	case len(c.Videos) > 0:
 		return ytarchiver.NewIDSelector(c.Videos), nil
+	case len(c.Categories) > 0:
+		return &ytarchiver.CategorySelector{Categories: c.Categories, RegionCode: c.CategoryRegion}, nil
+	case len(c.Languages) > 0:
+		return ytarchiver.LanguageSelector{Languages: c.Languages, MatchUnknown: c.LanguageUnknown}, nil
+	case len(c.CaptionLanguages) > 0:
+		return ytarchiver.CaptionSelector{Languages: c.CaptionLanguages}, nil
 	default:
 		// Ignore empty.
 		return nil, nil
 	}
 }
 
-type Config struct {
-	// Fields copied from ytarchiver config.
-	Root     string `required:"true"`
-	Channels []struct {
-		ID       string
-		Handle   string
+// configNotifier selects one of the built-in notifiers by whichever of its
+// fields is set.
+type configNotifier struct {
+	Email struct {
+		Addr     string
 		Username string
+		Password string
+		From     string
+		To       []string
+	}
+	Telegram struct {
+		Token  string
+		ChatID string
+	}
+	Ntfy struct {
+		URL   string
+		Token string
+	}
+	Gotify struct {
+		URL   string
+		Token string
+	}
+	Webhook struct {
+		URL   string
+		Token string
+	}
+}
 
-		Selectors []configSelector
+func (c configNotifier) Notifier() ytarchiver.Notifier {
+	switch {
+	case c.Email.Addr != "":
+		return ytarchiver.SMTPNotifier(c.Email)
+	case c.Telegram.Token != "":
+		return ytarchiver.TelegramNotifier(c.Telegram)
+	case c.Ntfy.URL != "":
+		return ytarchiver.NtfyNotifier(c.Ntfy)
+	case c.Gotify.URL != "":
+		return ytarchiver.GotifyNotifier(c.Gotify)
+	case c.Webhook.URL != "":
+		return ytarchiver.WebhookNotifier(c.Webhook)
+	default:
+		// Ignore empty.
+		return nil
 	}
-	APIKey          string `required:"true"`
-	MaxParallel     uint
-	Downloader      string
-	MaxRetries      uint
-	Selectors       []configSelector
-	DumpVideoInfo   bool
-	DumpChannelInfo bool
+}
+
+type configChannel struct {
+	ID       string
+	Handle   string
+	Username string
+
+	Selectors      []configSelector
+	DownloaderArgs []string
+	MetadataOnly   bool
+	// Tabs of the channel to archive: any of "videos", "streams" and
+	// "shorts". Podcasts can be archived by giving their playlist URL in
+	// URLs instead.
+	Tabs []string
+
+	// Cron expression on which this channel is archived instead of with
+	// the other channels.
+	Schedule string
+}
+
+// Identity returns the identity the archiver will use for this channel.
+func (c configChannel) Identity() string {
+	return ytarchiver.YouTubeChannel{ID: c.ID, Handle: c.Handle, Username: c.Username}.Identity()
+}
+
+// configProfile is a separate archive run by the same daemon, with its own
+// root, API key, channels and schedule. Fields left empty are inherited from
+// the top level of the config, except for the channels and URLs.
+type configProfile struct {
+	Name        string
+	Root        string
+	APIKey      string
+	APIKeyFile  string
+	Channels    []configChannel
+	ChannelsDir string
+	URLs        []string
+	Selectors   []configSelector
+	Exclude     []configSelector
+	Interval    time.Duration
+	Schedule    string
+}
+
+// A profile is one of the archives run by the daemon. The config of a
+// profile has no further profiles.
+type profile struct {
+	// Empty if the config has no profiles.
+	Name string
+	Config
+}
+
+// Lists of objects cannot be given by environment variables (see
+// channelsEnv instead).
+type Config struct {
+	// Fields copied from ytarchiver config.
+	Root     string
+	Channels []configChannel `env:"-"`
+	// Directory of channel fragment files (e.g /etc/ytarchive/channels.d),
+	// each defining a single channel as in Channels in JSON or YAML. Their
+	// channels are added to Channels.
+	ChannelsDir string
+	// aconfig would otherwise name this ur_ls.
+	URLs   []string `json:"urls" flag:"urls" env:"URLS"`
+	APIKey string
+	// File from which to read the API key instead, such as a secret
+	// mounted into a container. Surrounding whitespace is ignored.
+	APIKeyFile string
+	// OAuth client with which requests are made as a user instead, once
+	// logged in by the oauth-login command, so that the user's liked
+	// videos and watch later playlists can be archived by giving their
+	// URLs (e.g "https://www.youtube.com/playlist?list=LL").
+	OAuthClientID      string `json:"oauth_client_id" flag:"oauth_client_id" env:"OAUTH_CLIENT_ID"`
+	OAuthClientSecret  string `json:"oauth_client_secret" flag:"oauth_client_secret" env:"OAUTH_CLIENT_SECRET"`
+	APIEndpoint        string
+	APIRateLimit       float64
+	APIBurst           uint
+	MaxParallel        uint
+	Downloader         string
+	DownloaderArgs     []string
+	Aria2c             string `json:"aria2c" flag:"aria2c" env:"ARIA2C"`
+	Aria2cConnections  uint   `json:"aria2c_connections" flag:"aria2c_connections" env:"ARIA2C_CONNECTIONS"`
+	MaxRetries         uint
+	MaxVideoFailures   uint
+	QuarantineBackoff  time.Duration
+	MaxChannelFailures uint
+	ChannelCooldown    time.Duration
+	CanaryInterval     time.Duration
+	CanaryVideo        string
+	Selectors          []configSelector `env:"-"`
+	// Selectors of videos never archived from any channel, such as a
+	// title regex of "#shorts".
+	Exclude            []configSelector `env:"-"`
+	DumpVideoInfo      bool
+	DumpChannelInfo    bool
+	MetadataRefreshAge time.Duration
+	Upcoming           string
+	// How new uploads are found: "playlist" (the default) or
+	// "activities", which uses less quota on channels which rarely upload.
+	Enumeration string
+	// How the watch page of each downloaded video is captured alongside
+	// it: "none" (the default), "warc" or "html". Either includes the top
+	// comments, which uses a little quota.
+	WatchPage string
+	// How videos permanently unavailable to the downloader are handled:
+	// "tombstone" (the default) to stop attempting them, other than every
+	// UnavailableRecheck if set, or "retry" to quarantine them as any
+	// other failure.
+	Unavailable        string
+	UnavailableRecheck time.Duration
+	GracePeriod        time.Duration
+	// Interval at which upcoming videos and live streams are polled
+	// between runs, so that each is archived as soon as it has finished.
+	// Disabled if zero. Requires the recheck upcoming policy.
+	WatchUpcoming   time.Duration
+	ChannelCacheTTL time.Duration
+	EmbedMetadata   bool
+	EmbedChapters   bool
+	EmbedThumbnail  bool
+	Storyboards     bool
+	PosterFrames    bool
+	FFmpeg          string `json:"ffmpeg" flag:"ffmpeg" env:"FFMPEG"`
+	AutoMigrate     bool
+	Region          string
+	GeoProxy        string
+	// Priority of downloader processes, and the cgroup (and its memory
+	// limit in bytes) in which they run, so that archiving does not starve
+	// other services. The I/O priority and cgroup are Linux only.
+	DownloaderNice        int
+	DownloaderIdleIO      bool
+	DownloaderCgroup      string
+	DownloaderMemoryLimit uint64
+	// Fragments of fragmented formats fetched at once per video, and the
+	// size in bytes of the ranges in which other formats are requested.
+	// Both have defaults suited to MaxParallel if zero, with yt-dlp.
+	ConcurrentFragments uint
+	HTTPChunkSize       uint64
+	// Maximum total speed of all downloads, in bytes per second.
+	BandwidthLimit uint64
 
 	// Interval between each refresh of the archives.
 	Interval time.Duration
+	// Cron expression (e.g "0 3 * * *") on which to refresh the archives,
+	// as an alternative to Interval.
+	Schedule string
+	// Fraction of Interval by which each interval is randomly lengthened
+	// or shortened (e.g 0.1 for ±10%).
+	Jitter float64
+	// Perform an archive run as soon as the daemon starts, rather than
+	// waiting for the first scheduled run.
+	RunOnStartup bool
+	// Skip the startup run if the last successful run started less than
+	// this long ago. Zero never skips it.
+	StartupSkipWithin time.Duration
+	// Maximum random delay added before the first run, so that many
+	// instances started together do not all hit the API at once.
+	Splay time.Duration
+	// Notifiers to alert at the end of each run, or if either of the
+	// thresholds below are crossed.
+	Notify                 []configNotifier `env:"-"`
+	NotifyFailureThreshold uint
+	MinFreeSpace           uint64
+	// Notifiers sent a digest of the videos archived since the last
+	// instead, every DigestInterval: "daily" (the default) or "weekly".
+	// Videos link to the web UI at WebURL if set, or else to YouTube.
+	Digest         []configNotifier `env:"-"`
+	DigestInterval string
+	WebURL         string
+	// What to do with videos which are not expected to fit on disk, going
+	// by the space taken by those already archived: "off" (the default),
+	// "warn" or "refuse" to leave them until there is space.
+	StorageForecast string
+	// Store videos by the hash of their contents under objects/ in the
+	// root, linked to from each channel directory. Run "objects store" to
+	// move videos already archived into the store.
+	ContentAddressed bool
+	// rclone remote (e.g "b2:bucket/archive") to which new and changed
+	// files are copied after each run, and the rclone executable and any
+	// extra arguments to use. Disabled if SyncRemote is empty.
+	SyncRemote string
+	Rclone     string
+	RcloneArgs []string
+	// Identity of this instance (e.g its hostname) among several sharing
+	// one root, which enables sharding: each channel is archived by
+	// whichever instance leases it first. Leases lapse after LeaseTTL
+	// unless renewed.
+	ShardID  string
+	LeaseTTL time.Duration
+	// How the downloader is kept up to date: "off" (the default), "self"
+	// to run its self-update, or "managed" to download verified yt-dlp
+	// releases into DownloaderDir and use those instead. Checked at most
+	// every DownloaderUpdateInterval, for DownloaderPin if set or else the
+	// latest release.
+	DownloaderUpdate         string
+	DownloaderUpdateInterval time.Duration
+	DownloaderPin            string
+	DownloaderDir            string
+	// Dead man's switch URL pinged at the start and end of each run.
+	HealthcheckURL string
+	// Executable consulted before each video is downloaded, which may
+	// veto or delay it. See ytarchiver.CommandHook.
+	PreDownloadHook string
+	// Path of a unix socket on which to accept control commands, such as
+	// status or trigger. Disabled if empty. Changes take effect on restart.
+	ControlSocket string
+	// OTLP/HTTP endpoint (e.g "http://localhost:4318") to which traces
+	// are exported. Tracing is disabled if empty.
+	OTLPEndpoint string
+	// Address (e.g "localhost:9100") on which Prometheus metrics of the
+	// API quota and requests are served at /metrics. Disabled if empty.
+	// Changes take effect on restart.
+	MetricsAddr string
+
+	// Refresh the metadata of archived videos after each full archive
+	// run. Each video is refreshed at most once every MetadataRefreshAge.
+	RefreshMetadata bool
+
+	// Separate archives run by this daemon, each in place of the channels
+	// above. The control socket and tracing settings are shared by all.
+	Profiles []configProfile `env:"-"`
+
+	// Format of the log: "text" (the default), written to stderr, or
+	// "json", written to stdout as one object per line. Changes take
+	// effect on restart.
+	LogFormat string
+}
+
+// profiles returns each profile of c, or c itself as a single unnamed
+// profile if it has none.
+func (c Config) profiles() []profile {
+	if len(c.Profiles) == 0 {
+		return []profile{{Config: c}}
+	}
+
+	profs := make([]profile, len(c.Profiles))
+	for i, p := range c.Profiles {
+		pc := c
+		pc.Profiles = nil
+		pc.Channels, pc.ChannelsDir, pc.URLs = p.Channels, p.ChannelsDir, p.URLs
+		if p.Root != "" {
+			pc.Root = p.Root
+		}
+		if p.APIKey != "" || p.APIKeyFile != "" {
+			pc.APIKey, pc.APIKeyFile = p.APIKey, p.APIKeyFile
+		}
+		if p.Selectors != nil {
+			pc.Selectors = p.Selectors
+		}
+		if p.Exclude != nil {
+			pc.Exclude = p.Exclude
+		}
+		if p.Interval != 0 || p.Schedule != "" {
+			pc.Interval, pc.Schedule = p.Interval, p.Schedule
+		}
+
+		profs[i] = profile{Name: p.Name, Config: pc}
+	}
+
+	return profs
 }
 
 func (c Config) ArchiverConfig() (ytarchiver.Config, error) {
 	cfg := ytarchiver.Config{
-		Root:            c.Root,
-		APIKey:          c.APIKey,
-		MaxParallel:     c.MaxParallel,
-		Downloader:      c.Downloader,
-		MaxRetries:      c.MaxRetries,
-		DumpVideoInfo:   c.DumpVideoInfo,
-		DumpChannelInfo: c.DumpChannelInfo,
+		Root:               c.Root,
+		URLs:               c.URLs,
+		APIKey:             c.APIKey,
+		OAuthClientID:      c.OAuthClientID,
+		OAuthClientSecret:  c.OAuthClientSecret,
+		APIEndpoint:        c.APIEndpoint,
+		APIRateLimit:       c.APIRateLimit,
+		APIBurst:           c.APIBurst,
+		MaxParallel:        c.MaxParallel,
+		Downloader:         c.Downloader,
+		DownloaderArgs:     c.DownloaderArgs,
+		Aria2c:             c.Aria2c,
+		Aria2cConnections:  c.Aria2cConnections,
+		MaxRetries:         c.MaxRetries,
+		MaxVideoFailures:   c.MaxVideoFailures,
+		QuarantineBackoff:  c.QuarantineBackoff,
+		MaxChannelFailures: c.MaxChannelFailures,
+		ChannelCooldown:    c.ChannelCooldown,
+		CanaryInterval:     c.CanaryInterval,
+		CanaryVideo:        c.CanaryVideo,
+		DumpVideoInfo:      c.DumpVideoInfo,
+		DumpChannelInfo:    c.DumpChannelInfo,
+		MetadataRefreshAge: c.MetadataRefreshAge,
+		ChannelCacheTTL:    c.ChannelCacheTTL,
+		EmbedMetadata:      c.EmbedMetadata,
+		EmbedChapters:      c.EmbedChapters,
+		EmbedThumbnail:     c.EmbedThumbnail,
+		Storyboards:        c.Storyboards,
+		PosterFrames:       c.PosterFrames,
+		FFmpeg:             c.FFmpeg,
+		AutoMigrate:        c.AutoMigrate,
+		Region:             c.Region,
+		GeoProxy:           c.GeoProxy,
+	}
+
+	upcoming, ok := upcomingPolicies[c.Upcoming]
+	if !ok {
+		return cfg, ErrInvalidUpcoming
 	}
+	cfg.Upcoming = upcoming
+	enumeration, ok := enumerationStrategies[c.Enumeration]
+	if !ok {
+		return cfg, ErrInvalidEnumeration
+	}
+	cfg.Enumeration = enumeration
+	unavailable, ok := unavailablePolicies[c.Unavailable]
+	if !ok {
+		return cfg, ErrInvalidUnavailable
+	}
+	cfg.Unavailable = unavailable
+	watchPage, ok := watchPageFormats[c.WatchPage]
+	if !ok {
+		return cfg, ErrInvalidWatchPage
+	}
+	cfg.WatchPage = watchPage
+	cfg.UnavailableRecheck = c.UnavailableRecheck
+	cfg.GracePeriod = c.GracePeriod
+	cfg.DownloaderNice = c.DownloaderNice
+	cfg.DownloaderIdleIO = c.DownloaderIdleIO
+	cfg.DownloaderCgroup = c.DownloaderCgroup
+	cfg.DownloaderMemoryLimit = c.DownloaderMemoryLimit
+	cfg.ConcurrentFragments = c.ConcurrentFragments
+	cfg.HTTPChunkSize = c.HTTPChunkSize
+	cfg.BandwidthLimit = c.BandwidthLimit
 
 	for _, c := range c.Channels {
 		ch := ytarchiver.YouTubeChannel{
-			ID:       c.ID,
-			Handle:   c.Handle,
-			Username: c.Username,
+			ID:             c.ID,
+			Handle:         c.Handle,
+			Username:       c.Username,
+			DownloaderArgs: c.DownloaderArgs,
+			MetadataOnly:   c.MetadataOnly,
+			Tabs:           c.Tabs,
 		}
 
 		for _, s := range c.Selectors {
@@ -99,7 +549,9 @@ func (c Config) ArchiverConfig() (ytarchiver.Config, error) {
 				return cfg, err
 			}
 
-			ch.Selectors = append(ch.Selectors, conv)
+			if conv != nil {
+				ch.Selectors = append(ch.Selectors, conv)
+			}
 		}
 
 		cfg.Channels = append(cfg.Channels, ch)
@@ -111,7 +563,60 @@ func (c Config) ArchiverConfig() (ytarchiver.Config, error) {
 			return cfg, err
 		}
 
-		cfg.Selectors = append(cfg.Selectors, conv)
+		if conv != nil {
+			cfg.Selectors = append(cfg.Selectors, conv)
+		}
+	}
+	for _, s := range c.Exclude {
+		conv, err := s.Selector()
+		if err != nil {
+			return cfg, err
+		}
+		if conv != nil {
+			cfg.Exclusions = append(cfg.Exclusions, conv)
+		}
+	}
+
+	for _, n := range c.Notify {
+		if conv := n.Notifier(); conv != nil {
+			cfg.Notifiers = append(cfg.Notifiers, conv)
+		}
+	}
+	cfg.NotifyFailureThreshold = c.NotifyFailureThreshold
+	for _, n := range c.Digest {
+		if conv := n.Notifier(); conv != nil {
+			cfg.DigestNotifiers = append(cfg.DigestNotifiers, conv)
+		}
+	}
+	digestInterval, ok := digestIntervals[c.DigestInterval]
+	if !ok {
+		return cfg, ErrInvalidDigestInterval
+	}
+	cfg.DigestInterval = digestInterval
+	cfg.WebURL = c.WebURL
+	cfg.MinFreeSpace = c.MinFreeSpace
+	storageForecast, ok := storageForecastPolicies[c.StorageForecast]
+	if !ok {
+		return cfg, ErrInvalidStorageForecast
+	}
+	cfg.StorageForecast = storageForecast
+	cfg.ContentAddressed = c.ContentAddressed
+	cfg.SyncRemote = c.SyncRemote
+	cfg.Rclone = c.Rclone
+	cfg.RcloneArgs = c.RcloneArgs
+	cfg.ShardID = c.ShardID
+	cfg.LeaseTTL = c.LeaseTTL
+	downloaderUpdate, ok := downloaderUpdatePolicies[c.DownloaderUpdate]
+	if !ok {
+		return cfg, ErrInvalidDownloaderUpdate
+	}
+	cfg.DownloaderUpdate = downloaderUpdate
+	cfg.DownloaderUpdateInterval = c.DownloaderUpdateInterval
+	cfg.DownloaderPin = c.DownloaderPin
+	cfg.DownloaderDir = c.DownloaderDir
+	cfg.HealthcheckURL = c.HealthcheckURL
+	if c.PreDownloadHook != "" {
+		cfg.PreDownloadHook = ytarchiver.CommandHook(c.PreDownloadHook)
 	}
 
 	if err := ValidateConfig(c); err != nil {
@@ -126,26 +631,228 @@ func (c Config) ArchiverConfig() (ytarchiver.Config, error) {
 	return cfg, nil
 }
 
-func NewConfig() (Config, error) {
+// NewConfig loads the configuration from the first config file found, the
+// environment and the given command line arguments, in increasing order of
+// precedence. No config file is needed if everything required is given
+// otherwise.
+//
+// References to environment variables of the form ${NAME} in any string
+// setting are replaced with their values, and API keys are read from their
+// files, so that secrets need not be kept in the config file. Channels are
+// then added from any channel fragment directories.
+func NewConfig(args []string) (Config, error) {
+	if path := os.Getenv(configEnv); path != "" && !hasFlag(args, "config") {
+		args = append([]string{"-config", path}, args...)
+	}
+
 	cfg := Config{}
 	loader := aconfig.LoaderFor(&cfg, aconfig.Config{
 		SkipDefaults: true,
 		FileFlag:     "config",
 		Files:        configSearchPaths,
+		Args:         args,
+		EnvPrefix:    envPrefix,
+		// Such as configEnv and channelsEnv.
+		AllowUnknownEnvs: true,
 	})
 
-	err := loader.Load()
-	return cfg, err
+	if err := loader.Load(); err != nil {
+		return cfg, err
+	}
+	if err := expandEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+	cfg.Channels, cfg.URLs = addChannelsEnv(cfg.Channels, cfg.URLs, os.Getenv(channelsEnv))
+
+	var err error
+	if cfg.APIKey, err = readAPIKey(cfg.APIKey, cfg.APIKeyFile); err != nil {
+		return cfg, err
+	}
+	if cfg.Channels, err = addChannelsDir(cfg.Channels, cfg.ChannelsDir); err != nil {
+		return cfg, err
+	}
+	for i := range cfg.Profiles {
+		p := &cfg.Profiles[i]
+		if p.APIKey, err = readAPIKey(p.APIKey, p.APIKeyFile); err != nil {
+			return cfg, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		if p.Channels, err = addChannelsDir(p.Channels, p.ChannelsDir); err != nil {
+			return cfg, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// envRef matches a reference to an environment variable in a setting.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces references to environment variables in every string
+// within v, which must be settable.
+func expandEnv(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		var err error
+		v.SetString(envRef.ReplaceAllStringFunc(v.String(), func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("%w: %s", ErrUnsetEnv, name)
+			}
+			return val
+		}))
+		return err
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if err := expandEnv(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := expandEnv(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasFlag reports if the flag name is given in args.
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// addChannelsEnv appends the channels listed in env, as by channelsEnv, to
+// chans or urls.
+func addChannelsEnv(chans []configChannel, urls []string, env string) ([]configChannel, []string) {
+	for _, t := range strings.FieldsFunc(env, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		if c, ok := parseChannel(t); ok {
+			chans = append(chans, c)
+		} else {
+			urls = append(urls, t)
+		}
+	}
+	return chans, urls
+}
+
+// parseChannel returns the channel given by its ID or handle in s. It
+// reports false if s is a URL instead.
+func parseChannel(s string) (configChannel, bool) {
+	switch {
+	case strings.Contains(s, "/"):
+		return configChannel{}, false
+	case strings.HasPrefix(s, "UC") && len(s) == 24:
+		return configChannel{ID: s}, true
+	default:
+		return configChannel{Handle: s}, true
+	}
+}
+
+// addChannelsDir appends the channels in the fragment directory dir, if
+// any, to chans.
+func addChannelsDir(chans []configChannel, dir string) ([]configChannel, error) {
+	if dir == "" {
+		return chans, nil
+	}
+
+	frag, err := readChannelsDir(dir)
+	return append(chans, frag...), err
+}
+
+// readAPIKey returns the API key in file, or key if there is no file.
+func readAPIKey(key, file string) (string, error) {
+	if file == "" {
+		return key, nil
+	}
+	if key != "" {
+		return "", ErrTwoAPIKeys
+	}
+
+	dat, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("api key file: %w", err)
+	}
+	return strings.TrimSpace(string(dat)), nil
 }
 
 func ValidateConfig(cfg Config) error {
-	// Prevents spamming the YouTube API.
-	if cfg.Interval.Seconds() < 30 {
+	if len(cfg.Profiles) == 0 {
+		return validateProfile(cfg)
+	}
+
+	if len(cfg.Channels) > 0 || len(cfg.URLs) > 0 {
+		return ErrProfileChannels
+	}
+
+	names := make(map[string]bool)
+	for _, p := range cfg.profiles() {
+		switch {
+		case p.Name == "":
+			return ErrUnnamedProfile
+		case names[p.Name]:
+			return fmt.Errorf("%w: %s", ErrDuplicateProfile, p.Name)
+		}
+		names[p.Name] = true
+
+		if err := validateProfile(p.Config); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateProfile validates the config of a single profile.
+func validateProfile(cfg Config) error {
+	if cfg.Root == "" {
+		return ErrNoRoot
+	}
+
+	switch {
+	case cfg.Schedule != "" && cfg.Interval != 0:
+		return ErrTwoSchedules
+	case cfg.Schedule != "":
+		if _, err := parseCron(cfg.Schedule); err != nil {
+			return err
+		}
+	case cfg.Interval == 0:
+		return ErrNoSchedule
+	case cfg.Interval.Seconds() < 30:
+		// Prevents spamming the YouTube API.
 		return ErrIntervalTooShort
 	}
 
+	for _, c := range cfg.Channels {
+		if c.Schedule == "" {
+			continue
+		}
+		if _, err := parseCron(c.Schedule); err != nil {
+			return fmt.Errorf("channel %s: %w", c.Identity(), err)
+		}
+	}
+
+	if cfg.WatchUpcoming > 0 && cfg.Upcoming == "skip" {
+		return ErrWatchSkipped
+	}
+
+	if cfg.Jitter < 0 || cfg.Jitter >= 1 {
+		return ErrBadJitter
+	}
+
+	if cfg.LogFormat != "" && cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return ErrInvalidLogFormat
+	}
+
 	// Try to save people who didn't read the manual.
-	if cfg.APIKey == "" || cfg.APIKey == "YOUR_KEY_HERE" {
+	if (cfg.APIKey == "" && cfg.OAuthClientID == "") || cfg.APIKey == "YOUR_KEY_HERE" {
 		return ErrBlankAPIKey
 	}
 
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+)
+
+// controlHistory is the number of recent runs reported by the status
+// command.
+const controlHistory = 10
+
+var (
+	ErrUnknownControl = errors.New("unknown control command")
+	ErrUnknownProfile = errors.New("unknown profile")
+	ErrTriggerUsage   = errors.New("usage: trigger [run | channel <channel> | refresh-cache | refresh-metadata]")
+	ErrTriggerPending = errors.New("a triggered operation is already pending")
+	ErrNoControl      = errors.New("no control socket configured")
+	ErrDaemonDown     = errors.New("daemon is not running")
+)
+
+// Operations which may be triggered.
+const (
+	// Archive every channel.
+	triggerRun = iota
+	// Archive a single channel.
+	triggerChannel
+	// Fetch the details of every channel again.
+	triggerRefreshCache
+	// Refresh the metadata of archived videos.
+	triggerRefreshMetadata
+)
+
+var triggerOps = map[string]int{
+	"run":              triggerRun,
+	"channel":          triggerChannel,
+	"refresh-cache":    triggerRefreshCache,
+	"refresh-metadata": triggerRefreshMetadata,
+}
+
+// controlStatus is the response to the status command.
+type controlStatus struct {
+	// Name of the profile reported on, if the config has profiles.
+	Profile string `json:"profile,omitempty"`
+	// Downloads in progress. Empty if no run is in progress.
+	Progress []ytarchiver.Progress `json:"progress"`
+	// When the next scheduled run is due.
+	NextRun time.Time `json:"next_run"`
+	// Most recent runs, oldest first.
+	History []ytarchiver.RunRecord `json:"history"`
+	// Each configured channel, in order.
+	Channels []channelStatus `json:"channels"`
+	// Number of quarantined and unavailable videos across every channel.
+	Quarantined int `json:"quarantined"`
+	Unavailable int `json:"unavailable"`
+	// Size of the archive and the space left on its filesystem, in bytes.
+	DiskUsed uint64 `json:"disk_used"`
+	DiskFree uint64 `json:"disk_free"`
+	// Total speed of the downloads in progress and the limit on it, in
+	// bytes per second. The limit is zero if there is none.
+	BandwidthUsed  float64 `json:"bandwidth_used"`
+	BandwidthLimit uint64  `json:"bandwidth_limit"`
+	// Estimated API quota used since it last reset, out of the default
+	// daily quota, and when it next resets.
+	QuotaUsed  int       `json:"quota_used"`
+	QuotaLimit int       `json:"quota_limit"`
+	QuotaReset time.Time `json:"quota_reset"`
+}
+
+// channelStatus is the state of a single channel reported by the status
+// command.
+type channelStatus struct {
+	// Identity of the channel, as configured.
+	Channel string `json:"channel"`
+	// Outcome of the most recent run over the channel. Nil if it has never
+	// been archived.
+	LastRun     *ytarchiver.ChannelRecord `json:"last_run,omitempty"`
+	Quarantined int                       `json:"quarantined"`
+	Unavailable int                       `json:"unavailable"`
+}
+
+// controlResponse is written back to the control socket in response to each
+// command, with one of its fields set.
+type controlResponse struct {
+	Error     string         `json:"error,omitempty"`
+	Status    *controlStatus `json:"status,omitempty"`
+	Triggered bool           `json:"triggered,omitempty"`
+}
+
+// triggerRequest asks the main loop to perform an operation immediately.
+type triggerRequest struct {
+	// One of the trigger* constants.
+	Op int
+	// For triggerChannel, the identity of the channel to archive, as
+	// configured, and the profile it belongs to.
+	Channel string
+	Profile string
+}
+
+// controlServer answers commands sent to the control socket. Each
+// connection sends a single command line and receives a single JSON encoded
+// controlResponse.
+//
+// Commands are answered without involving the main loop, so that they are
+// answered even while a run is in progress.
+type controlServer struct {
+	mut      sync.Mutex
+	profiles []controlProfile
+
+	// Operations requested by the trigger command, which the main loop
+	// must receive from. At most one may be pending.
+	trigger chan triggerRequest
+}
+
+func newControlServer() *controlServer {
+	return &controlServer{trigger: make(chan triggerRequest, 1)}
+}
+
+// controlProfile is the state of a profile reported by the server.
+type controlProfile struct {
+	name     string
+	ar       *ytarchiver.Archiver
+	next     time.Time
+	channels []string
+}
+
+// Set updates the archivers and next run times reported by the server.
+func (c *controlServer) Set(runs []*profileRun) {
+	profs := make([]controlProfile, len(runs))
+	for i, p := range runs {
+		profs[i] = controlProfile{p.Name, p.ar, p.sch.Next(), nil}
+		for _, c := range p.Channels {
+			profs[i].channels = append(profs[i].channels, c.Identity())
+		}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.profiles = profs
+}
+
+// Listen starts serving commands on a unix socket at path, replacing any
+// stale socket left behind.
+func (c *controlServer) Listen(path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("control socket: %w", err)
+	}
+	// Commands may reveal configuration and start runs.
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("control socket: %w", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Println("Control socket:", err)
+				return
+			}
+			go c.handle(conn)
+		}
+	}()
+
+	return nil
+}
+
+func (c *controlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+
+	var resp controlResponse
+	switch args := strings.Fields(line); {
+	case len(args) == 0:
+		resp.Error = ErrUnknownControl.Error()
+	case args[0] == "status":
+		// The first profile is reported unless another is named.
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		resp.Status, err = c.status(name)
+	case args[0] == "trigger":
+		err = c.Trigger(args[1:])
+		resp.Triggered = err == nil
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownControl, args[0])
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// Trigger asks the main loop to perform the operation named by args as soon
+// as possible. Without args, every channel is archived.
+func (c *controlServer) Trigger(args []string) error {
+	req := triggerRequest{Op: triggerRun}
+	if len(args) > 0 {
+		op, ok := triggerOps[strings.TrimLeft(args[0], "-")]
+		if !ok {
+			return ErrTriggerUsage
+		}
+		req.Op = op
+		args = args[1:]
+	}
+
+	switch {
+	case req.Op == triggerChannel && len(args) == 1:
+		req.Channel = args[0]
+	case req.Op == triggerChannel, len(args) > 0:
+		return ErrTriggerUsage
+	}
+
+	if req.Op == triggerChannel {
+		c.mut.Lock()
+		i := slices.IndexFunc(c.profiles, func(p controlProfile) bool { return slices.Contains(p.channels, req.Channel) })
+		if i >= 0 {
+			req.Profile = c.profiles[i].name
+		}
+		c.mut.Unlock()
+
+		if i < 0 {
+			return fmt.Errorf("%w: %s", ytarchiver.ErrUnknownChannel, req.Channel)
+		}
+	}
+
+	select {
+	case c.trigger <- req:
+		return nil
+	default:
+		return ErrTriggerPending
+	}
+}
+
+func (c *controlServer) status(name string) (*controlStatus, error) {
+	c.mut.Lock()
+	profs := c.profiles
+	c.mut.Unlock()
+
+	i := 0
+	if name != "" {
+		i = slices.IndexFunc(profs, func(p controlProfile) bool { return p.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+		}
+	}
+	ar, next := profs[i].ar, profs[i].next
+
+	hist, err := ar.History()
+	if err != nil {
+		return nil, err
+	}
+	if len(hist) > controlHistory {
+		hist = hist[len(hist)-controlHistory:]
+	}
+
+	st := &controlStatus{
+		Profile:    profs[i].name,
+		Progress:   ar.Progress(),
+		NextRun:    next,
+		History:    hist,
+		QuotaLimit: ytarchiver.DailyQuota,
+	}
+	st.QuotaUsed, st.QuotaReset = ar.QuotaUsed()
+	st.BandwidthUsed, st.BandwidthLimit = ar.Bandwidth()
+	if st.DiskUsed, st.DiskFree, err = ytarchiver.DiskUsage(ar.Root); err != nil {
+		return nil, err
+	}
+
+	recs, err := ytarchiver.ReadChannelRecords(ar.Root)
+	if err != nil {
+		return nil, err
+	}
+	quar, err := ytarchiver.ReadQuarantine(ar.Root)
+	if err != nil {
+		return nil, err
+	}
+	st.Quarantined = len(quar)
+	unavail, err := ytarchiver.ReadUnavailable(ar.Root)
+	if err != nil {
+		return nil, err
+	}
+	st.Unavailable = len(unavail)
+
+	for _, id := range profs[i].channels {
+		cs := channelStatus{Channel: id}
+		if rec, ok := recs[id]; ok {
+			cs.LastRun = &rec
+			for _, q := range quar {
+				if q.ChannelID != "" && q.ChannelID == rec.ChannelID {
+					cs.Quarantined++
+				}
+			}
+			for _, u := range unavail {
+				if u.ChannelID == rec.ChannelID {
+					cs.Unavailable++
+				}
+			}
+		}
+		st.Channels = append(st.Channels, cs)
+	}
+
+	return st, nil
+}
+
+// queryControl sends a single command to the control socket at path and
+// returns the response.
+func queryControl(path, cmd string) (controlResponse, error) {
+	var resp controlResponse
+	if path == "" {
+		return resp, ErrNoControl
+	}
+
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrDaemonDown, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	if _, err := fmt.Fprintln(conn, cmd); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
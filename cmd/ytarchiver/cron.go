@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBadCron = errors.New("bad cron expression")
+
+// cronMacros are the supported shorthand schedules.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSearchLimit bounds the search for the next matching time, so that
+// expressions which can never match (e.g "0 0 30 2 *") terminate.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronSchedule is a parsed five field cron expression. Each field is a
+// bitset of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// If either day field is restricted, a day matches if either matches
+	// (as in traditional cron).
+	domStar, dowStar bool
+}
+
+// parseCronField parses a comma-separated list of values, ranges (a-b) and
+// steps (*/n or a-b/n), each in the range [min, max].
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepstr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepstr); err != nil || step < 1 {
+				return 0, fmt.Errorf("%w: bad step %q", ErrBadCron, stepstr)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			lostr, histr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(lostr); err != nil {
+				return 0, fmt.Errorf("%w: bad value %q", ErrBadCron, lostr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(histr); err != nil {
+					return 0, fmt.Errorf("%w: bad value %q", ErrBadCron, histr)
+				}
+			} else if hasStep {
+				// "a/n" means "a-max/n".
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%w: %q out of range %d-%d", ErrBadCron, part, min, max)
+		}
+
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// parseCron parses a standard five field cron expression (minute, hour,
+// day of month, month, day of week) or one of the @ macros.
+func parseCron(spec string) (cronSchedule, error) {
+	if m, ok := cronMacros[spec]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("%w: want 5 fields, got %d", ErrBadCron, len(fields))
+	}
+
+	var c cronSchedule
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return c, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return c, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return c, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return c, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return c, err
+	}
+
+	// Both 0 and 7 are Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return c, nil
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first matching time strictly after t, or the zero time
+// if the schedule never matches.
+func (c cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	// 2024-01-01 is a Monday.
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"step", "*/15 * * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 10, 15)},
+		{"step into next hour", "*/15 * * * *", date(2024, 1, 1, 10, 45), date(2024, 1, 1, 11, 0)},
+		{"strictly after", "*/15 * * * *", date(2024, 1, 1, 10, 15), date(2024, 1, 1, 10, 30)},
+		{"seconds ignored", "*/15 * * * *", date(2024, 1, 1, 10, 14).Add(59 * time.Second), date(2024, 1, 1, 10, 15)},
+		{"ranged step", "0 9-17/4 * * *", date(2024, 1, 1, 10, 0), date(2024, 1, 1, 13, 0)},
+		{"ranged step into next day", "0 9-17/4 * * *", date(2024, 1, 1, 17, 30), date(2024, 1, 2, 9, 0)},
+		{"start with step", "0 20/2 * * *", date(2024, 1, 1, 21, 0), date(2024, 1, 1, 22, 0)},
+		{"list", "0,30 6,18 * * *", date(2024, 1, 1, 6, 10), date(2024, 1, 1, 6, 30)},
+		{"list into next day", "0,30 6,18 * * *", date(2024, 1, 1, 18, 45), date(2024, 1, 2, 6, 0)},
+		{"weekday range", "30 2 * * 1-5", date(2024, 1, 5, 3, 0), date(2024, 1, 8, 2, 30)},
+		{"sunday as 7", "0 12 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 12, 0)},
+		{"sunday as 0", "0 12 * * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 12, 0)},
+		{"day of month only", "0 0 13 * *", date(2024, 1, 5, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"day of week only", "0 0 * * 5", date(2024, 1, 6, 0, 0), date(2024, 1, 12, 0, 0)},
+		{"day of week with stepped day of month", "0 0 */1 * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"either day field, week first", "0 0 13 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"either day field, month first", "0 0 13 * 5", date(2024, 1, 12, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"month rollover", "59 23 * * *", date(2024, 1, 31, 23, 59), date(2024, 2, 1, 23, 59)},
+		{"skips short months", "0 0 31 * *", date(2024, 1, 31, 0, 0), date(2024, 3, 31, 0, 0)},
+		{"month list", "0 0 1 2,8 *", date(2024, 3, 1, 0, 0), date(2024, 8, 1, 0, 0)},
+		{"year rollover", "@yearly", date(2024, 6, 1, 0, 0), date(2025, 1, 1, 0, 0)},
+		{"hourly", "@hourly", date(2024, 12, 31, 23, 30), date(2025, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.spec, err)
+			}
+			if got := c.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("%q: Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-3 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@fortnightly",
+	} {
+		if _, err := parseCron(spec); !errors.Is(err, ErrBadCron) {
+			t.Errorf("parseCron(%q) = %v, want %v", spec, err, ErrBadCron)
+		}
+	}
+}
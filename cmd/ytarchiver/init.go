@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+)
+
+// defaultInitInterval is the refresh interval of a generated config.
+const defaultInitInterval = "6h"
+
+var (
+	ErrInitExists     = errors.New("config file already exists (use -force to overwrite)")
+	ErrInitIncomplete = errors.New("an API key, root and at least one channel are required")
+)
+
+// initConfig is the starter config written by the init command.
+type initConfig struct {
+	Root        string        `json:"root"`
+	APIKey      string        `json:"api_key"`
+	APIEndpoint string        `json:"api_endpoint,omitempty"`
+	Channels    []initChannel `json:"channels,omitempty"`
+	URLs        []string      `json:"urls,omitempty"`
+	Interval    string        `json:"interval"`
+}
+
+// initChannel is a channel of initConfig. The keys of list items in the
+// config are matched against field names, rather than converted.
+type initChannel struct {
+	ID string `json:"ID"`
+}
+
+// stringsFlag is a flag which may be given more than once.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string     { return strings.Join(*s, ",") }
+func (s *stringsFlag) Set(v string) error { *s = append(*s, v); return nil }
+
+func cmdInit(args []string) error {
+	var chans stringsFlag
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	out := fs.String("o", configSearchPaths[0], "path of the config file to write")
+	key := fs.String("api-key", "", "YouTube Data API key")
+	endpoint := fs.String("api-endpoint", "", "YouTube API base URL, if not the default")
+	root := fs.String("root", "", "directory in which to archive videos")
+	interval := fs.String("interval", defaultInitInterval, "interval between archive runs")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Var(&chans, "channel", "channel, playlist or video URL or handle to archive (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		return fmt.Errorf("%s: %w", *out, ErrInitExists)
+	}
+
+	// Anything not given by flags is asked for.
+	in := bufio.NewReader(os.Stdin)
+	var err error
+	if *key == "" {
+		fmt.Println("Create an API key at https://console.cloud.google.com/apis/credentials")
+		if *key, err = prompt(in, "API key", ""); err != nil {
+			return err
+		}
+	}
+	if *root == "" {
+		if *root, err = prompt(in, "Archive root", "./archive"); err != nil {
+			return err
+		}
+	}
+	if len(chans) == 0 {
+		for {
+			c, err := prompt(in, "Channel URL or handle (blank to finish)", "")
+			if err != nil {
+				return err
+			}
+			if c == "" {
+				break
+			}
+			chans = append(chans, c)
+		}
+	}
+	if *key == "" || *root == "" || len(chans) == 0 {
+		return ErrInitIncomplete
+	}
+
+	conf := initConfig{Root: *root, APIKey: *key, APIEndpoint: *endpoint, Interval: *interval}
+	if conf.Root, err = filepath.Abs(conf.Root); err != nil {
+		return err
+	}
+
+	cl, err := ytarchiver.NewClient(context.Background(), ytarchiver.Config{APIKey: *key, APIEndpoint: *endpoint})
+	if err != nil {
+		return err
+	}
+	for _, c := range chans {
+		if err := conf.add(context.Background(), cl, c); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(conf.Root, 0755); err != nil {
+		return err
+	}
+	if err := ytarchiver.Migrate(conf.Root, nil); err != nil {
+		return err
+	}
+
+	dat, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(dat, '\n'), 0600); err != nil {
+		return err
+	}
+
+	// Make sure that the daemon will accept what was written.
+	cfg, err := NewConfig([]string{"-config", *out})
+	if err == nil {
+		err = ValidateConfig(cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("generated config is invalid: %w", err)
+	}
+
+	fmt.Printf("Wrote %s archiving %d channel(s) and %d URL(s) into %s\n", *out, len(conf.Channels), len(conf.URLs), conf.Root)
+	return nil
+}
+
+// add looks up the channel, playlist or video given by target and adds it
+// to c. Channels are added by ID; playlists and videos are kept as URLs.
+func (c *initConfig) add(ctx context.Context, cl ytarchiver.YouTubeClient, target string) error {
+	var ch ytarchiver.YouTubeChannel
+	if pc, ok := parseChannel(target); ok {
+		ch.ID, ch.Handle = pc.ID, pc.Handle
+	} else {
+		chans, err := ytarchiver.ResolveURLs(ctx, cl, []string{target})
+		if err != nil {
+			return err
+		}
+		if len(chans) == 0 {
+			return fmt.Errorf("%s: %w", target, ytarchiver.ErrEmptyResults)
+		}
+		if chans[0].PlaylistID != "" || len(chans[0].VideoIDs) > 0 {
+			fmt.Printf("%s: %s\n", target, chans[0].Identity())
+			c.URLs = append(c.URLs, target)
+			return nil
+		}
+		ch = chans[0]
+	}
+
+	found, err := cl.ListChannel(ctx, ch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", target, err)
+	}
+	if found == nil {
+		return fmt.Errorf("%s: channel not found: %w", target, ytarchiver.ErrEmptyResults)
+	}
+
+	fmt.Printf("%s: %s (%s)\n", target, found.Id, found.Snippet.Title)
+	c.Channels = append(c.Channels, initChannel{ID: found.Id})
+	return nil
+}
+
+// prompt asks a question on stdout and returns the answer read from in, or
+// def if it is blank.
+func prompt(in *bufio.Reader, question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logOutput is where the log is written, as chosen by LogFormat when the
+// daemon starts.
+var logOutput io.Writer = os.Stderr
+
+// jsonLogLine is a single line of the log in the json format.
+type jsonLogLine struct {
+	Time time.Time `json:"time"`
+	Msg  string    `json:"msg"`
+}
+
+// jsonLogWriter writes each line of the log to an encoder as a JSON object.
+type jsonLogWriter struct {
+	mut sync.Mutex
+	enc *json.Encoder
+}
+
+// Write writes p as a single object. Like redactWriter, this relies on the
+// log package writing a whole line at a time.
+func (jw *jsonLogWriter) Write(p []byte) (int, error) {
+	jw.mut.Lock()
+	defer jw.mut.Unlock()
+
+	if err := jw.enc.Encode(jsonLogLine{time.Now(), strings.TrimSuffix(string(p), "\n")}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setupLog switches the log to the given format. In the json format, what
+// the archiver prints to stdout is logged too, so that stdout carries
+// nothing but the log.
+func setupLog(format string) error {
+	if format != "json" {
+		return nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	logOutput = &jsonLogWriter{enc: json.NewEncoder(os.Stdout)}
+	log.SetFlags(0)
+	os.Stdout = w
+
+	go func() {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			log.Print(sc.Text())
+		}
+	}()
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,8 +21,25 @@ const (
 	VersionRev   = 1
 )
 
-func initialize() (Config, *ytarchiver.Archiver, error) {
-	cfg, err := NewConfig()
+// A profileRun is a profile being run by the daemon.
+type profileRun struct {
+	profile
+	ar  *ytarchiver.Archiver
+	sch *scheduler
+}
+
+// Printf logs a message about the profile.
+func (p *profileRun) Printf(format string, v ...any) {
+	if p.Name != "" {
+		format = "[" + p.Name + "] " + format
+	}
+	log.Printf(format, v...)
+}
+
+// initialize loads the config and creates the archiver and scheduler of each
+// profile. Runs are cancelled along with ctx.
+func initialize(ctx context.Context) (Config, []*profileRun, error) {
+	cfg, err := NewConfig(os.Args[1:])
 	if err != nil {
 		return Config{}, nil, fmt.Errorf("ytarchiver: parsing config: %s", err.Error())
 	}
@@ -28,64 +48,287 @@ func initialize() (Config, *ytarchiver.Archiver, error) {
 		return Config{}, nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	conf, err := cfg.ArchiverConfig()
+	var runs []*profileRun
+	for _, p := range cfg.profiles() {
+		conf, err := p.ArchiverConfig()
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("ytarchiver: loading config: %w", err)
+		}
+
+		ar, err := ytarchiver.NewArchiverWithContext(ctx, conf)
+		if err != nil {
+			return Config{}, nil, err
+		}
+
+		sch, err := newScheduler(p.Config, time.Now())
+		if err != nil {
+			return Config{}, nil, err
+		}
+
+		runs = append(runs, &profileRun{profile: p, ar: ar, sch: sch})
+	}
+
+	return cfg, runs, nil
+}
+
+// nextRun returns the time at which the next scheduled run of any profile
+// falls due, or the zero time if none ever will.
+func nextRun(runs []*profileRun) time.Time {
+	var next time.Time
+	for _, p := range runs {
+		if n := p.sch.Next(); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+
+	return next
+}
+
+// startWatching starts polling upcoming videos for each profile which
+// wants it, until the returned function is called.
+func startWatching(runs []*profileRun) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, p := range runs {
+		if p.WatchUpcoming > 0 {
+			go p.ar.WatchUpcoming(ctx, p.WatchUpcoming)
+		}
+	}
+
+	return cancel
+}
+
+// quotaResetMargin is waited after the API quota is expected to reset
+// before trying again, in case of clock differences.
+const quotaResetMargin = 5 * time.Minute
+
+func doArchive(t time.Time, p *profileRun) error {
+	p.Printf("Starting archive run on %d channel(s)", len(p.Channels))
+	err := p.ar.Archive()
+	if err != nil {
+		p.Printf("%v", err)
+	}
+
+	p.Printf("Archive OK; time elapsed %v", time.Since(t))
+
+	if p.RefreshMetadata && !errors.Is(err, ytarchiver.ErrQuotaExceeded) {
+		t := time.Now()
+		if err := p.ar.RefreshMetadata(); err != nil {
+			p.Printf("%v", err)
+		}
+		p.Printf("Metadata refresh done; time elapsed %v", time.Since(t))
+	}
+
+	return err
+}
+
+func doArchiveChannels(t time.Time, p *profileRun, chans []string) error {
+	p.Printf("Starting archive run on %s", strings.Join(chans, ", "))
+	err := p.ar.ArchiveChannels(chans...)
 	if err != nil {
-		return Config{}, nil, fmt.Errorf("ytarchiver: loading config: %w", err)
+		p.Printf("%v", err)
+	}
+
+	p.Printf("Archive OK; time elapsed %v", time.Since(t))
+	return err
+}
+
+// postponeForQuota delays all scheduled runs of p until after the API quota
+// resets if err was caused by exhausting it.
+func postponeForQuota(err error, p *profileRun) {
+	if !errors.Is(err, ytarchiver.ErrQuotaExceeded) {
+		return
+	}
+
+	reset := ytarchiver.QuotaReset(time.Now()).Add(quotaResetMargin)
+	p.Printf("API quota exhausted; postponing scheduled runs until %v", reset.Format(time.RFC1123))
+	p.sch.Postpone(reset)
+}
+
+// runDue archives whichever channels of p are due.
+func runDue(t time.Time, p *profileRun) {
+	var err error
+
+	chans, all := p.sch.Pop(t)
+	if all {
+		err = doArchive(t, p)
+	} else if len(chans) > 0 {
+		err = doArchiveChannels(t, p, chans)
+	}
+
+	postponeForQuota(err, p)
+}
+
+// catchUp performs the startup run, if configured and not recently done.
+func catchUp(p *profileRun) {
+	if !p.RunOnStartup {
+		return
 	}
 
-	ar, err := ytarchiver.NewArchiver(conf)
+	_, last, err := p.ar.LastRun()
 	if err != nil {
-		return Config{}, nil, err
+		p.Printf("Could not read previous run state: %v", err)
+	}
+	if p.StartupSkipWithin > 0 && time.Since(last) < p.StartupSkipWithin {
+		p.Printf("Skipping startup run; last successful run was at %v", last.Format(time.RFC1123))
+		return
 	}
 
-	return cfg, ar, nil
+	postponeForQuota(doArchive(time.Now(), p), p)
 }
 
-func doArchive(t time.Time, ar *ytarchiver.Archiver, cfg Config) {
-	log.Printf("Starting archive run on %d channel(s)", len(cfg.Channels))
-	if err := ar.Archive(); err != nil {
-		fmt.Println(err)
+// runTriggered performs the operation requested by req on p.
+func runTriggered(req triggerRequest, p *profileRun) {
+	t := time.Now()
+	switch req.Op {
+	case triggerRun:
+		postponeForQuota(doArchive(t, p), p)
+	case triggerChannel:
+		if p.Name == req.Profile {
+			postponeForQuota(doArchiveChannels(t, p, []string{req.Channel}), p)
+		}
+	case triggerRefreshCache:
+		p.Printf("Refreshing channel details")
+		if err := p.ar.RefreshChannels(); err != nil {
+			p.Printf("%v", err)
+		}
+		p.Printf("Channel refresh done; time elapsed %v", time.Since(t))
+	case triggerRefreshMetadata:
+		p.Printf("Refreshing metadata")
+		if err := p.ar.RefreshMetadata(); err != nil {
+			p.Printf("%v", err)
+		}
+		p.Printf("Metadata refresh done; time elapsed %v", time.Since(t))
 	}
+}
 
-	log.Printf("Archive OK; time elapsed %v", time.Since(t))
+func logSchedule(p *profileRun) {
+	p.Printf("Ready on %d worker(s) and %d channel(s)", p.MaxParallel, len(p.Channels))
+	for _, d := range p.sch.Describe() {
+		p.Printf("Archiving %s", d)
+	}
 }
 
 func main() {
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Printf("Starting ytarchiver v%d.%d.%d-%d...", VersionMajor, VersionMinor, VersionPatch, VersionRev)
 
-	cfg, ar, err := initialize()
+	// Cancelled on SIGTERM, interrupting any run in progress so that the
+	// daemon exits promptly with the state of the run saved.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	cfg, runs, err := initialize(ctx)
+	if err != nil {
+		log.Println(err)
+		log.Fatalln("Run 'ytarchiver doctor' for a full diagnosis")
+	}
+	if err := setupLog(cfg.LogFormat); err != nil {
+		log.Fatalln(err)
+	}
+	log.SetOutput(newRedactWriter(logOutput, runs))
+
+	shutdownTracing, err := setupTracing(cfg)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	exitchan := make(chan os.Signal, 1)
 	signal.Notify(exitchan, os.Interrupt, syscall.SIGTERM)
+	// Runs block the main loop, so this is handled separately.
+	go func() {
+		<-exitchan
+		log.Println("Caught fatal signal; exitting gracefully...")
+		stop()
+		<-exitchan
+		log.Fatalln("Caught second fatal signal; exitting immediately")
+	}()
 	reloadchan := make(chan os.Signal, 1)
 	signal.Notify(reloadchan, syscall.SIGHUP)
+	// Deprecated alias of the trigger control command.
 	archivechan := make(chan os.Signal, 1)
 	signal.Notify(archivechan, syscall.SIGALRM)
 
-	log.Printf("Archiver ready on %d worker(s), %d channel(s) and archiving approx. every %v", cfg.MaxParallel, len(cfg.Channels), cfg.Interval)
-	tk := time.NewTicker(cfg.Interval)
-	for {
+	for _, p := range runs {
+		logSchedule(p)
+	}
+
+	ctl := newControlServer()
+	ctl.Set(runs)
+	if cfg.ControlSocket != "" {
+		if err := ctl.Listen(cfg.ControlSocket); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if cfg.MetricsAddr != "" {
+		if err := ctl.ServeMetrics(cfg.MetricsAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	for _, p := range runs {
+		catchUp(p)
+	}
+
+	stopWatch := startWatching(runs)
+
+	// Profiles are run one after another, so a long run of one delays any
+	// others falling due meanwhile.
+	tk := timerAt(nextRun(runs))
+	for ctx.Err() == nil {
 		select {
 		case <-archivechan:
-			t := time.Now()
-			doArchive(t, ar, cfg)
+			log.Println("SIGALRM is deprecated; use the trigger control command instead")
+			if err := ctl.Trigger(nil); err != nil {
+				log.Println(err)
+			}
+		case req := <-ctl.trigger:
+			for _, p := range runs {
+				runTriggered(req, p)
+			}
+			tk.Stop()
+			tk = timerAt(nextRun(runs))
+			ctl.Set(runs)
 		case t := <-tk.C:
-			doArchive(t, ar, cfg)
-		case <-exitchan:
-			log.Println("Caught fatal signal; exitting gracefully...")
-			os.Exit(0)
+			for _, p := range runs {
+				runDue(t, p)
+			}
+			tk = timerAt(nextRun(runs))
+			ctl.Set(runs)
+		case <-ctx.Done():
 		case <-reloadchan:
 			log.Println("Got SIGHUP; reloading configuration...")
-			cfg, ar, err = initialize()
+			cfg, runs, err = initialize(ctx)
 			if err != nil {
 				log.Println("Got error in configuration while live reloading!")
 				log.Fatalln(err)
 			}
-			log.Printf("Now ready on %d worker(s), %d channel(s) and archiving approx. every %v", cfg.MaxParallel, len(cfg.Channels), cfg.Interval)
-			tk.Reset(cfg.Interval)
+			log.SetOutput(newRedactWriter(logOutput, runs))
+			for _, p := range runs {
+				logSchedule(p)
+			}
+			stopWatch()
+			stopWatch = startWatching(runs)
+			tk.Stop()
+			tk = timerAt(nextRun(runs))
+			ctl.Set(runs)
 		}
 	}
+
+	stopWatch()
+	tctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(tctx); err != nil {
+		log.Println("Flushing traces:", err)
+	}
+	cancel()
+	if cfg.ControlSocket != "" {
+		os.Remove(cfg.ControlSocket)
+	}
+	log.Println("Shut down cleanly")
 }
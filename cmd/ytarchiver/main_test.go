@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ejv2/yt-archiver/internal/ytartest"
+	"google.golang.org/api/youtube/v3"
+)
+
+const testChannel = "UCtestchannel"
+
+// addVideo uploads the video id to testChannel now.
+func addVideo(e *ytartest.Env, id string) {
+	e.API.AddVideo(testChannel, &youtube.Video{
+		Id:      id,
+		Snippet: &youtube.VideoSnippet{Title: id, PublishedAt: time.Now().UTC().Format(time.RFC3339)},
+	})
+}
+
+// startDaemon initialises the daemon as it starts, with the config file at
+// path.
+func startDaemon(t *testing.T, path string) []*profileRun {
+	t.Helper()
+
+	args := os.Args
+	os.Args = []string{"ytarchiver", "-config", path}
+	defer func() { os.Args = args }()
+
+	_, runs, err := initialize(context.Background())
+	if err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("%d profiles, want 1", len(runs))
+	}
+	return runs
+}
+
+func TestDaemonLoop(t *testing.T) {
+	e := ytartest.New(t)
+	e.API.AddChannel(testChannel, "test")
+	addVideo(e, "aaaaaaaaaaA")
+
+	path, err := e.WriteDaemonConfig(t.TempDir(), map[string]any{
+		"channels":            []map[string]any{{"ID": testChannel}},
+		"run_on_startup":      true,
+		"startup_skip_within": "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := func(ids ...string) {
+		t.Helper()
+		got, err := e.Downloader.Calls()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Sort(got); !slices.Equal(got, ids) {
+			t.Errorf("downloaded %q, want %q", got, ids)
+		}
+	}
+
+	runs := startDaemon(t, path)
+	start := time.Now()
+	catchUp(runs[0])
+	want("aaaaaaaaaaA")
+
+	// Each run falls due an interval after the last.
+	next := nextRun(runs)
+	if d := next.Sub(start); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("next run in %v, want an hour", d)
+	}
+	addVideo(e, "bbbbbbbbbbA")
+	runDue(next, runs[0])
+	want("aaaaaaaaaaA", "bbbbbbbbbbA")
+	if after := nextRun(runs); !after.After(next) {
+		t.Errorf("next run at %v, not after the last at %v", after, next)
+	}
+
+	// Restarting soon after a run skips the startup run, picking up from
+	// the archive as it was left at the next.
+	addVideo(e, "ccccccccccA")
+	runs = startDaemon(t, path)
+	catchUp(runs[0])
+	want("aaaaaaaaaaA", "bbbbbbbbbbA")
+	runDue(nextRun(runs), runs[0])
+	want("aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+)
+
+// metricsPath is the path at which metrics are served.
+const metricsPath = "/metrics"
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ServeMetrics starts serving the API quota and request metrics of each
+// profile at metricsPath on addr, in the Prometheus text format.
+func (c *controlServer) ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, c.metrics)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Println("Metrics:", err)
+		}
+	}()
+
+	return nil
+}
+
+func (c *controlServer) metrics(w http.ResponseWriter, r *http.Request) {
+	c.mut.Lock()
+	profs := c.profiles
+	c.mut.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetric(w, "ytarchiver_quota_limit_units", "gauge", "Default daily API quota of a project.")
+	fmt.Fprintf(w, "ytarchiver_quota_limit_units %d\n", ytarchiver.DailyQuota)
+
+	type sample struct {
+		labels string
+		value  string
+	}
+	var used, remaining, reset, rateLimit, calls, errs []sample
+	for _, p := range profs {
+		prof := `profile="` + labelEscaper.Replace(p.name) + `"`
+		n, at := p.ar.QuotaUsed()
+		used = append(used, sample{prof, strconv.Itoa(n)})
+		remaining = append(remaining, sample{prof, strconv.Itoa(max(0, ytarchiver.DailyQuota-n))})
+		reset = append(reset, sample{prof, strconv.FormatInt(at.Unix(), 10)})
+		rateLimit = append(rateLimit, sample{prof, strconv.FormatFloat(p.ar.APIRateLimit, 'g', -1, 64)})
+
+		st := p.ar.APIStats()
+		for _, ep := range slices.Sorted(maps.Keys(st.Calls)) {
+			calls = append(calls, sample{prof + `,endpoint="` + ep + `"`, strconv.FormatUint(st.Calls[ep], 10)})
+		}
+		for _, code := range slices.Sorted(maps.Keys(st.Errors)) {
+			errs = append(errs, sample{prof + `,code="` + strconv.Itoa(code) + `"`, strconv.FormatUint(st.Errors[code], 10)})
+		}
+	}
+
+	for _, m := range []struct {
+		name, kind, help string
+		samples          []sample
+	}{
+		{"ytarchiver_quota_used_units", "gauge", "Estimated API quota used since it last reset.", used},
+		{"ytarchiver_quota_remaining_units", "gauge", "Estimated API quota left until it next resets, out of the default daily quota.", remaining},
+		{"ytarchiver_quota_reset_timestamp_seconds", "gauge", "Time at which the API quota next resets.", reset},
+		{"ytarchiver_api_rate_limit_per_second", "gauge", "Configured limit on the rate of API requests, or zero if unlimited.", rateLimit},
+		{"ytarchiver_api_requests_total", "counter", "API requests made, by endpoint.", calls},
+		{"ytarchiver_api_errors_total", "counter", "API requests which failed, by HTTP status (403 if the quota is exhausted or access denied, 429 if rate limited).", errs},
+	} {
+		writeMetric(w, m.name, m.kind, m.help)
+		for _, s := range m.samples {
+			fmt.Fprintf(w, "%s{%s} %s\n", m.name, s.labels, s.value)
+		}
+	}
+}
+
+// writeMetric writes the HELP and TYPE lines of the metric name.
+func writeMetric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// redacted replaces secrets in log output.
+const redacted = "[REDACTED]"
+
+// redactWriter writes to w with every occurrence of a secret replaced.
+type redactWriter struct {
+	w io.Writer
+	r *strings.Replacer
+}
+
+// newRedactWriter returns a writer which redacts the API keys of each of
+// runs from anything written to w.
+func newRedactWriter(w io.Writer, runs []*profileRun) io.Writer {
+	var pairs []string
+	for _, p := range runs {
+		if p.APIKey != "" {
+			pairs = append(pairs, p.APIKey, redacted)
+		}
+	}
+
+	return redactWriter{w, strings.NewReplacer(pairs...)}
+}
+
+// Write writes p, redacted, to the underlying writer. Each call to the log
+// package writes a whole line, so secrets are never split between calls.
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.r.WriteString(rw.w, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// jitter randomly lengthens or shortens d by up to frac of itself.
+func jitter(d time.Duration, frac float64) time.Duration {
+	if frac == 0 {
+		return d
+	}
+
+	return d + time.Duration((rand.Float64()*2-1)*frac*float64(d))
+}
+
+// splay returns a random delay of up to max.
+func splay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return rand.N(max)
+}
+
+// A scheduleEntry archives a set of channels each time it falls due.
+type scheduleEntry struct {
+	// Identities of the channels archived, or nil for every channel.
+	Channels []string
+	// Human readable description of the schedule.
+	Desc string
+
+	next func(time.Time) time.Time
+	due  time.Time
+}
+
+// scheduler decides when each channel is next archived. Channels with their
+// own schedule are archived on that alone; all others share the global
+// interval or schedule.
+type scheduler struct {
+	entries []*scheduleEntry
+}
+
+func newScheduler(cfg Config, now time.Time) (*scheduler, error) {
+	s := &scheduler{}
+
+	var global []string
+	custom := false
+	for _, c := range cfg.Channels {
+		if c.Schedule == "" {
+			global = append(global, c.Identity())
+			continue
+		}
+
+		cron, err := parseCron(c.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", c.Identity(), err)
+		}
+		s.entries = append(s.entries, &scheduleEntry{
+			Channels: []string{c.Identity()},
+			Desc:     fmt.Sprintf("%s on %q", c.Identity(), c.Schedule),
+			next:     cron.Next,
+		})
+		custom = true
+	}
+
+	// Without any custom schedules, the global entry covers every channel
+	// (including any added in the future).
+	if !custom {
+		global = nil
+	}
+	if !custom || len(global) > 0 {
+		e := &scheduleEntry{Channels: global}
+		if cfg.Schedule != "" {
+			cron, err := parseCron(cfg.Schedule)
+			if err != nil {
+				return nil, err
+			}
+			e.Desc = fmt.Sprintf("%d channel(s) on %q", len(cfg.Channels)-len(s.entries), cfg.Schedule)
+			e.next = cron.Next
+		} else {
+			e.Desc = fmt.Sprintf("%d channel(s) approx. every %v", len(cfg.Channels)-len(s.entries), cfg.Interval)
+			e.next = func(t time.Time) time.Time {
+				return t.Add(jitter(cfg.Interval, cfg.Jitter))
+			}
+		}
+		s.entries = append(s.entries, e)
+	}
+
+	for _, e := range s.entries {
+		e.due = e.next(now).Add(splay(cfg.Splay))
+	}
+
+	return s, nil
+}
+
+// Next returns the time at which the next entry falls due, or the zero time
+// if none ever will.
+func (s *scheduler) Next() time.Time {
+	var next time.Time
+	for _, e := range s.entries {
+		if !e.due.IsZero() && (next.IsZero() || e.due.Before(next)) {
+			next = e.due
+		}
+	}
+
+	return next
+}
+
+// Pop returns the channels due to be archived at now and schedules their
+// next run. all reports whether every channel is due.
+func (s *scheduler) Pop(now time.Time) (chans []string, all bool) {
+	for _, e := range s.entries {
+		if e.due.IsZero() || e.due.After(now) {
+			continue
+		}
+
+		if e.Channels == nil {
+			all = true
+		}
+		chans = append(chans, e.Channels...)
+		e.due = e.next(now)
+	}
+
+	return chans, all
+}
+
+// Postpone moves any entry falling due before until to until.
+func (s *scheduler) Postpone(until time.Time) {
+	for _, e := range s.entries {
+		if !e.due.IsZero() && e.due.Before(until) {
+			e.due = until
+		}
+	}
+}
+
+// Describe returns a description of each entry in the schedule.
+func (s *scheduler) Describe() []string {
+	desc := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		desc[i] = e.Desc
+	}
+
+	return desc
+}
+
+// timerAt returns a timer which fires at next, or never if next is zero.
+func timerAt(next time.Time) *time.Timer {
+	if next.IsZero() {
+		t := time.NewTimer(time.Hour)
+		t.Stop()
+		return t
+	}
+
+	return time.NewTimer(time.Until(next))
+}
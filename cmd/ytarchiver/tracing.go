@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// setupTracing exports the archiver's spans to the OTLP endpoint in cfg, if
+// any, returning a function which flushes any remaining spans.
+//
+// The tracer provider is installed globally, and so is not replaced when
+// the configuration is reloaded.
+func setupTracing(cfg Config) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "ytarchiver"),
+		attribute.String("service.version", fmt.Sprintf("%d.%d.%d-%d", VersionMajor, VersionMinor, VersionPatch, VersionRev)),
+	)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
@@ -2,8 +2,97 @@ package ytarchiver
 
 import (
 	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Policies for handling upcoming videos, premieres and live streams, which
+// cannot be archived until they have finished.
+const (
+	// Remember upcoming videos and re-check them once their scheduled
+	// start has passed, even if they are no longer among the most recent
+	// uploads.
+	UpcomingRecheck = iota
+	// Skip upcoming videos, only archiving them if they are still among
+	// the most recent uploads once finished.
+	UpcomingSkip
+)
+
+// Policies for handling videos which the downloader reports to be
+// permanently unavailable, such as those blocked in the region or removed
+// over a copyright claim.
+const (
+	// Record the video as unavailable (see ReadUnavailable) and stop
+	// attempting it, other than to recheck it every
+	// Config.UnavailableRecheck.
+	TombstoneUnavailable = iota
+	// Treat the video as any other failure, quarantining it.
+	RetryUnavailable
+)
+
+// Strategies for finding new uploads on channels which have already been
+// enumerated in full.
+const (
+	// Visit the first page of each of the channel's playlists.
+	EnumeratePlaylist = iota
+	// List the channel's activities since it was last enumerated, which
+	// needs no further request to check for upcoming videos when there
+	// are no new uploads. Falls back to EnumeratePlaylist if the
+	// activities look inconsistent, and pages the uploads anyway at least
+	// weekly in case the activities have silently missed any. Only applies
+	// to channels archiving all of their uploads.
+	EnumerateActivities
+)
+
+// Formats in which the watch page of each downloaded video is captured,
+// preserving context which the API metadata misses. See CaptureWatchPage.
+const (
+	// Do not capture the watch page.
+	WatchPageNone = iota
+	// Capture the request for and response of the watch page, and its top
+	// comments, as a WARC file suffixed WatchPageWARCSuffix.
+	WatchPageWARC
+	// Save the HTML of the watch page as served, suffixed
+	// WatchPageHTMLSuffix, and its top comments as JSON, suffixed
+	// CommentsSuffix.
+	WatchPageHTML
+)
+
+// Policies for the videos of a run which the storage forecast expects not
+// to fit in the space left on the archive's filesystem. See StorageForecast.
+const (
+	// Do not forecast.
+	ForecastOff = iota
+	// Download them anyway, but warn once per run.
+	ForecastWarn
+	// Skip them, leaving them to be archived once there is space.
+	ForecastRefuse
+)
+
+// defaultChannelCacheTTL is used if Config.ChannelCacheTTL is zero.
+const defaultChannelCacheTTL = 24 * time.Hour
+
+// defaultMetadataRefreshAge is used if Config.MetadataRefreshAge is zero.
+const defaultMetadataRefreshAge = 30 * 24 * time.Hour
+
+// Limits on the number of connections aria2c may open per download.
+const (
+	defaultAria2cConnections = 4
+	maxAria2cConnections     = 16
 )
 
+// Limits on the number of fragments the downloader may fetch at once per
+// download. Unless configured, fragmentBudget fragments are shared between
+// the parallel downloads.
+const (
+	fragmentBudget         = 16
+	maxConcurrentFragments = 32
+)
+
+// defaultHTTPChunkSize is used with yt-dlp if Config.HTTPChunkSize is zero.
+const defaultHTTPChunkSize = 10 << 20
+
 var defaultConfig = Config{
 	Root:        ".",
 	Channels:    []YouTubeChannel{{Handle: "GoogleDevelopers"}},
@@ -20,29 +109,256 @@ type Config struct {
 	Root string
 	// Channels configured for archive by the system.
 	Channels []YouTubeChannel
+	// YouTube URLs of further channels, playlists or videos to archive.
+	// These are resolved into Channels when the Archiver is created; see
+	// ResolveURLs.
+	URLs []string
 	// API key for the YouTube public API.
 	// Does not require OAuth2.
 	// https://console.cloud.google.com/apis/credentials
+	// The key is sent in a header, and so never appears in errors.
 	APIKey string
-	// Maximum number of parallel downloader goroutines.
+	// Base URL of the YouTube API, if not the default. Intended for tests
+	// against a local server.
+	APIEndpoint string
+	// OAuth client (of the "TVs and Limited Input devices" type) with
+	// which requests are made as a user instead of with APIKey, once
+	// logged in with OAuthLogin. This is needed to archive the user's
+	// liked videos and watch later playlists.
+	OAuthClientID     string
+	OAuthClientSecret string
+	// Time after a video is published before it is downloaded, to give
+	// premieres time to settle, re-uploads time to happen and YouTube time
+	// to finish processing the best encodes. Zero downloads immediately.
+	GracePeriod time.Duration
+	// ISO 3166-1 alpha-2 code of the region from which videos are
+	// downloaded (e.g "GB"). If set, videos blocked there are skipped
+	// rather than left to fail in the downloader, unless GeoProxy is set.
+	Region string
+	// Proxy URL passed to the downloader for videos blocked in Region.
+	GeoProxy string
+	// Consulted before each selected video is downloaded, if set.
+	// See CommandHook for running an external command.
+	PreDownloadHook PreDownloadHook
+	// Client used to access the YouTube API in place of one built from
+	// APIKey. Intended for tests; APIKey may be empty if set.
+	Client YouTubeClient
+	// Maximum sustained rate of requests to the API, in requests per
+	// second. Zero means unlimited.
+	APIRateLimit float64
+	// Maximum number of requests which may be made in a burst above
+	// APIRateLimit. Treated as one if zero.
+	APIBurst uint
+	// Maximum number of parallel downloader goroutines. NewArchiver uses
+	// that of DefaultConfig if zero, though ValidateConfig, which checks
+	// the config as given, reports it.
 	MaxParallel uint
 	// Path to a YouTube downloader executable.
 	// Must be youtube-dl or a fork thereof.
 	Downloader string
+	// How the downloader is kept up to date: DownloaderUpdateOff (the
+	// default), DownloaderUpdateSelf or DownloaderUpdateManaged. Updates
+	// are checked for before a run at most every DownloaderUpdateInterval,
+	// which defaults to a day if zero.
+	DownloaderUpdate         int
+	DownloaderUpdateInterval time.Duration
+	// Release (e.g "2024.08.06") to which the downloader is updated, rather
+	// than the latest.
+	DownloaderPin string
+	// Directory, used for nothing else, into which managed releases are
+	// downloaded. Defaults to "bin" in the StateDir of the root if empty.
+	DownloaderDir string
+	// Extra arguments appended to every downloader invocation, after
+	// those generated by the archiver. Per-channel arguments are appended
+	// after these.
+	DownloaderArgs []string
+	// Niceness of downloader processes, and so of anything they start,
+	// from 1 (slightly below normal priority) to 19 (only when otherwise
+	// idle). On Windows, up to 9 selects the below normal priority class
+	// and above that the idle class. Zero leaves it unchanged.
+	DownloaderNice int
+	// Run downloader processes in the idle I/O scheduling class, so that
+	// they only use the disk when nothing else is. Linux only.
+	DownloaderIdleIO bool
+	// Path of a cgroup v2 directory (e.g a delegated subtree of a systemd
+	// service) in which downloader processes are run. Linux only.
+	DownloaderCgroup string
+	// Memory limit in bytes set on DownloaderCgroup when the archiver is
+	// created, which is shared by all the downloaders in it. Zero leaves
+	// the limit of the cgroup unchanged.
+	DownloaderMemoryLimit uint64
+	// Path to an aria2c executable which the downloader will hand off
+	// fetching to. Leave empty to use the downloader's own fetcher.
+	// Requires yt-dlp.
+	Aria2c string
+	// Number of connections aria2c opens per download.
+	// Defaults to 4 if zero and may not exceed 16.
+	Aria2cConnections uint
+	// Number of fragments of fragmented (DASH and HLS) formats which the
+	// downloader fetches at once for each video. If zero, 16 are shared
+	// between the MaxParallel downloads, at least one each, as throttled
+	// single connections are otherwise the bottleneck of large backfills.
+	// May not exceed 32. Requires yt-dlp, and the default is only applied
+	// when the downloader appears to be yt-dlp.
+	ConcurrentFragments uint
+	// Size in bytes of the ranges in which other formats are requested,
+	// as YouTube throttles long single requests. Defaults to 10MiB if zero.
+	// Requires yt-dlp, as for ConcurrentFragments.
+	HTTPChunkSize uint64
+	// Maximum total speed of all downloads in flight, in bytes per second,
+	// however many there are. Each download is limited to an equal share,
+	// and restarted (resuming where it left off) when its share changes
+	// substantially. Zero is unlimited.
+	BandwidthLimit uint64
 	// The daemon will retry a download a maximum of
 	// this many times before giving up and reporting an error.
 	// If MaxRetries is zero, retries indefinetely. This can be
 	// dangerous, so set with care.
 	MaxRetries uint
+	// Number of times a video may fail to archive before it is no longer
+	// attempted until cleared from the quarantine (see ClearQuarantine).
+	// Defaults to 5 if zero.
+	MaxVideoFailures uint
+	// Time after a video first fails before it is attempted again. This
+	// doubles with each subsequent failure, up to a week. Defaults to an
+	// hour if zero.
+	QuarantineBackoff time.Duration
+	// Number of consecutive runs over a channel which may fail as a whole,
+	// such as because it was deleted or access to it was revoked, before
+	// it is skipped for ChannelCooldown. Defaults to 5 if zero.
+	MaxChannelFailures uint
+	// Time for which a channel is skipped once it has failed too many runs
+	// in a row. Defaults to a day if zero.
+	ChannelCooldown time.Duration
+	// Interval at which the downloader is checked to still work before a
+	// run, by simulating the download of CanaryVideo, a short video known
+	// to be available ("Me at the zoo" if empty). While the check fails,
+	// as when a change to YouTube breaks the downloader, it is repeated
+	// every run and videos which fail are not quarantined or counted
+	// against their channel. Notifiers are told when it breaks and
+	// recovers. Disabled if zero.
+	CanaryInterval time.Duration
+	CanaryVideo    string
+	// How long channel details (name, uploads playlist) and video
+	// categories are cached before being fetched again, so that renames
+	// are picked up. They are cached in the StateDir of the root, so that
+	// restarting does not fetch them again. Defaults to 24 hours if zero.
+	ChannelCacheTTL time.Duration
+	// How upcoming videos are handled. One of the Upcoming* constants.
+	Upcoming int
+	// How new uploads are found. One of the Enumerate* constants.
+	Enumeration int
+	// How videos permanently unavailable to the downloader are handled.
+	// One of TombstoneUnavailable or RetryUnavailable.
+	Unavailable int
+	// Time after an unavailable video was last checked before it is
+	// attempted again, in case it has since become available. Never if
+	// zero.
+	UnavailableRecheck time.Duration
 	// Selectors are critera which must be met in order for a
 	// video to be archived.
 	Selectors []VideoSelector
+	// Exclusions are criteria for videos which are never archived from
+	// any channel (e.g a title regex matching "#shorts"), whatever the
+	// other selectors say. They are checked before Selectors and those of
+	// each channel of the same cost (see SelectorCost).
+	Exclusions []VideoSelector
 	// Output video information to a "{ID}.info.json" file in the
 	// same directory as the video files.
 	DumpVideoInfo bool
 	// Output channel information to a "channel.json" file in the
 	// same directory as the video files.
 	DumpChannelInfo bool
+	// How long after the metadata of a video was last refreshed it is
+	// refreshed again by RefreshMetadata. Defaults to 30 days if zero.
+	MetadataRefreshAge time.Duration
+	// Embed video metadata, chapter markers and the thumbnail into the
+	// downloaded media file respectively, so that it remains
+	// self-describing without the sidecar files. All require ffmpeg.
+	EmbedMetadata  bool
+	EmbedChapters  bool
+	EmbedThumbnail bool
+	// Generate a storyboard of thumbnails for previews on the seek bar of
+	// the web interface after each video is downloaded. See
+	// GenerateStoryboard. Requires ffmpeg.
+	Storyboards bool
+	// Extract a poster frame from each downloaded video for which no
+	// thumbnail was downloaded, named with PosterSuffix and used as its
+	// thumbnail. Requires ffmpeg.
+	PosterFrames bool
+	// How the watch page of each downloaded video is captured. One of the
+	// WatchPage* constants.
+	WatchPage int
+	// Base URL of watch pages, to which the video ID is appended, if not
+	// the default. Intended for tests against a local server.
+	WatchPageURL string
+	// Automatically migrate an archive root with an outdated layout
+	// when creating the archiver. Otherwise, the archiver warns that the
+	// root needs migrating with Migrate and carries on with its layout as
+	// it is.
+	AutoMigrate bool
+	// Path to an ffmpeg executable passed to the downloader.
+	// If empty, ffmpeg is looked up in $PATH when required.
+	FFmpeg string
+	// Notifiers are sent an Event at the end of each archive run, and
+	// if either of the below thresholds are crossed.
+	Notifiers []Notifier
+	// Number of videos which may fail to download in a single run
+	// before notifiers are alerted.
+	NotifyFailureThreshold uint
+	// DigestNotifiers are sent a digest of the videos archived since the
+	// last, at the end of the first run once DigestInterval has passed,
+	// rather than being told of every run.
+	DigestNotifiers []Notifier
+	DigestInterval  time.Duration
+	// Base URL of the web UI (see cmd/ytarchiver-web), which digests link
+	// to instead of YouTube if set.
+	WebURL string
+	// Free space in bytes below which notifiers are warned at the end of
+	// each run. Zero disables the check.
+	MinFreeSpace uint64
+	// Store each downloaded video in ObjectsDir of the root, named by the
+	// hash of its contents, and link to it from the channel directory, so
+	// that identical videos are stored once and the archive is easily
+	// verified and backed up incrementally. See StoreObjects to store the
+	// videos already archived.
+	ContentAddressed bool
+	// rclone remote (e.g "b2:bucket/archive") to which the files of the
+	// root are copied at the end of each run. Only files which changed
+	// since they were last copied are copied again, so an interrupted
+	// sync resumes where it left off. Disabled if empty.
+	SyncRemote string
+	// Path to the rclone executable. If empty, rclone is looked up in
+	// $PATH.
+	Rclone string
+	// Extra arguments passed to rclone, such as --bwlimit.
+	RcloneArgs []string
+	// Identity of this instance (e.g its hostname) among several sharing
+	// the root, each of which must have a different one. If set, each
+	// channel is archived by whichever instance claims it first for the
+	// run, holding a lease on it which lapses after LeaseTTL (10 minutes
+	// if zero) unless renewed, should the instance die. The shared state
+	// is updated under a lock. Sharing over NFS requires NFSv3 or later.
+	ShardID  string
+	LeaseTTL time.Duration
+	// Policy for videos which, going by the space taken per second by the
+	// videos already archived, are not expected to fit on the archive's
+	// filesystem (keeping MinFreeSpace free) once the videos before them in
+	// the run have been downloaded. One of the Forecast* constants.
+	StorageForecast int
+	// Healthchecks.io style URL pinged at the start of each run (with
+	// "/start" appended) and at its end (with "/fail" appended if it
+	// failed), with a summary of the run in the body.
+	HealthcheckURL string
+	// TracerProvider receives spans for each run, channel, video download
+	// and API request. If nil, the global tracer provider is used, which
+	// discards them unless set with otel.SetTracerProvider.
+	TracerProvider trace.TracerProvider
+}
+
+// needFFmpeg reports if any enabled option requires ffmpeg.
+func (c Config) needFFmpeg() bool {
+	return c.EmbedMetadata || c.EmbedChapters || c.EmbedThumbnail || c.Storyboards || c.PosterFrames
 }
 
 // DefaultConfig returns the default configuration with the given API key specified.
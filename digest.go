@@ -0,0 +1,168 @@
+package ytarchiver
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A DigestVideo is a newly archived video awaiting the next digest.
+type DigestVideo struct {
+	VideoID      string    `json:"video_id"`
+	ChannelID    string    `json:"channel_id"`
+	Title        string    `json:"title"`
+	Archived     time.Time `json:"archived"`
+	MetadataOnly bool      `json:"metadata_only,omitempty"`
+}
+
+// digestState records the videos archived since the last digest was sent.
+type digestState struct {
+	// Time at which the last digest was sent, or at which collection
+	// began if none has been.
+	Sent   time.Time     `json:"sent"`
+	Videos []DigestVideo `json:"videos"`
+}
+
+// recordDigest adds the videos archived by the run with the given outcomes
+// to the next digest, and sends it to Config.DigestNotifiers if it is due.
+// A digest with no videos is not sent. runMut must be held.
+func (a *Archiver) recordDigest(outcomes []VideoOutcome) error {
+	if len(a.DigestNotifiers) == 0 {
+		return nil
+	}
+
+	var st digestState
+	err := a.withStateLock(func() error {
+		if err := loadState(a.Root, stateDigest, &st); err != nil {
+			return err
+		}
+		if st.Sent.IsZero() {
+			st.Sent = time.Now()
+		}
+		for _, o := range outcomes {
+			if o.Outcome != OutcomeDownloaded && o.Outcome != OutcomeMetadata {
+				continue
+			}
+			st.Videos = append(st.Videos, DigestVideo{
+				VideoID:      o.VideoID,
+				ChannelID:    o.ChannelID,
+				Title:        o.Title,
+				Archived:     time.Now(),
+				MetadataOnly: o.Outcome == OutcomeMetadata,
+			})
+		}
+		return saveState(a.Root, stateDigest, st)
+	})
+	if err != nil || time.Since(st.Sent) < a.DigestInterval {
+		return err
+	}
+
+	if len(st.Videos) > 0 {
+		ev := a.digestEvent(st)
+		ev.Time = time.Now()
+		sent := false
+		for _, n := range a.DigestNotifiers {
+			ctx, cancel := context.WithTimeout(a.ctx, notifyTimeout)
+			if err := n.Notify(ctx, ev); err != nil {
+				fmt.Printf("notify: %v\n", err)
+			} else {
+				sent = true
+			}
+			cancel()
+		}
+		// Kept for the next run if no notifier took it.
+		if !sent {
+			return nil
+		}
+	}
+	return a.withStateLock(func() error {
+		return saveState(a.Root, stateDigest, digestState{Sent: time.Now()})
+	})
+}
+
+// digestEntry is a video as shown in a digest.
+type digestEntry struct {
+	DigestVideo
+	Channel   string
+	Link      string
+	Thumbnail string
+}
+
+// digestTemplate renders the HTML of a digest.
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: auto;">
+<h1>{{.Title}}</h1>
+<p>Archived since {{.Since.Format "Mon, 02 Jan 2006 15:04 MST"}}.</p>
+<table style="border-collapse: collapse;">
+{{range .Videos}}<tr>
+<td style="padding: 0.3em;"><a href="{{.Link}}"><img src="{{.Thumbnail}}" alt="" width="160"></a></td>
+<td style="padding: 0.3em; vertical-align: top;"><a href="{{.Link}}"><b>{{if .Title}}{{.Title}}{{else}}{{.VideoID}}{{end}}</b></a><br>
+{{.Channel}}{{if .MetadataOnly}} (metadata only){{end}}</td>
+</tr>
+{{end}}</table>
+</body></html>
+`))
+
+// digestEvent returns the digest of the videos in st.
+func (a *Archiver) digestEvent(st digestState) Event {
+	names := make(map[string]string)
+	entries := make([]digestEntry, len(st.Videos))
+	msg := &strings.Builder{}
+	title := fmt.Sprintf("%d new video(s) archived", len(st.Videos))
+	fmt.Fprintf(msg, "%s since %s:\n", title, st.Sent.Format(time.RFC1123))
+
+	for i, v := range st.Videos {
+		dir := filepath.Join(a.Root, v.ChannelID)
+		if _, ok := names[v.ChannelID]; !ok {
+			names[v.ChannelID] = v.ChannelID
+			if ci, err := ReadChannelInfo(dir); err == nil && ci.Name != "" {
+				names[v.ChannelID] = ci.Name
+			}
+		}
+
+		e := digestEntry{DigestVideo: v, Channel: names[v.ChannelID], Link: youtubeWatchURL + v.VideoID}
+		if a.WebURL != "" {
+			e.Link = strings.TrimSuffix(a.WebURL, "/") + "/vid/" + v.ChannelID + "/" + v.VideoID
+		}
+		e.Thumbnail = a.digestThumbnail(dir, v)
+		entries[i] = e
+
+		fmt.Fprintf(msg, "\n- %s (%s)\n  %s", v.Title, e.Channel, e.Link)
+	}
+
+	page := &strings.Builder{}
+	if err := digestTemplate.Execute(page, struct {
+		Title  string
+		Since  time.Time
+		Videos []digestEntry
+	}{title, st.Sent, entries}); err != nil {
+		// Only the text is sent.
+		page.Reset()
+	}
+
+	return Event{
+		Kind:    EventDigest,
+		Title:   title,
+		Message: msg.String(),
+		HTML:    page.String(),
+	}
+}
+
+// digestThumbnail returns the URL of the thumbnail of v, in the channel
+// directory dir: the archived thumbnail as served by the web UI if
+// Config.WebURL is set and there is one, or else that on YouTube.
+func (a *Archiver) digestThumbnail(dir string, v DigestVideo) string {
+	if a.WebURL != "" {
+		for _, ext := range append(thumbnailExts, PosterSuffix) {
+			if _, err := os.Stat(filepath.Join(dir, v.VideoID+ext)); err == nil {
+				return strings.TrimSuffix(a.WebURL, "/") + "/videos/" + v.ChannelID + "/" + v.VideoID + ext
+			}
+		}
+	}
+	return "https://i.ytimg.com/vi/" + v.VideoID + "/mqdefault.jpg"
+}
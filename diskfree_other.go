@@ -0,0 +1,10 @@
+//go:build !unix
+
+package ytarchiver
+
+import "errors"
+
+// diskFree is not supported on this platform.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("free space not supported on this platform")
+}
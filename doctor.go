@@ -0,0 +1,247 @@
+package ytarchiver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// Diagnostic severities, in increasing order of seriousness.
+const (
+	DiagnosticOK = iota
+	DiagnosticWarn
+	DiagnosticFail
+)
+
+const (
+	// downloaderMaxAge is the age after which a downloader release is
+	// considered likely to have broken extractors.
+	downloaderMaxAge = 180 * 24 * time.Hour
+	// maxClockSkew is the largest acceptable difference between the local
+	// clock and that of the API servers.
+	maxClockSkew = 5 * time.Minute
+	// clockCheckURL is requested to obtain a trusted Date header.
+	clockCheckURL = "https://www.googleapis.com/"
+)
+
+// A Diagnostic is the result of a single check performed by Doctor.
+type Diagnostic struct {
+	// Short name of the check performed.
+	Check string
+	// One of the Diagnostic* severity constants.
+	Severity int
+	// What was found.
+	Message string
+	// Suggested fix for the problem. Empty if there is nothing to be done.
+	Hint string
+}
+
+func (d Diagnostic) String() string {
+	sev := "ok"
+	switch d.Severity {
+	case DiagnosticWarn:
+		sev = "WARN"
+	case DiagnosticFail:
+		sev = "FAIL"
+	}
+
+	if d.Hint == "" {
+		return fmt.Sprintf("[%s] %s: %s", sev, d.Check, d.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s\n\thint: %s", sev, d.Check, d.Message, d.Hint)
+}
+
+// Doctor runs a series of checks on cfg and the surrounding environment,
+// returning a diagnostic for each. Unlike NewArchiver, Doctor does not stop
+// at the first problem, so that every problem can be reported at once.
+//
+// Doctor performs one cheap API request to validate the API key and one
+// request to an API server to check the local clock.
+func Doctor(ctx context.Context, cfg Config) []Diagnostic {
+	diags := []Diagnostic{
+		doctorDownloader(cfg),
+		doctorFFmpeg(cfg),
+	}
+	if cfg.Aria2c != "" {
+		diags = append(diags, doctorAria2c(cfg))
+	}
+	diags = append(diags,
+		doctorRoot(cfg),
+		doctorAPIKey(ctx, cfg),
+		doctorClock(ctx),
+	)
+
+	return diags
+}
+
+// DoctorFailed reports if any of diags has failed.
+func DoctorFailed(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == DiagnosticFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+func doctorDownloader(cfg Config) Diagnostic {
+	d := Diagnostic{Check: "downloader"}
+
+	dl, err := DetectDownloader(cfg.Downloader)
+	if err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = fmt.Sprintf("%s: %v", cfg.Downloader, err)
+		d.Hint = "install yt-dlp and set the downloader path to its location"
+		return d
+	}
+
+	d.Message = fmt.Sprintf("%s (%s)", cfg.Downloader, dl)
+
+	// Both youtube-dl and yt-dlp version by release date.
+	if rel, err := time.Parse("2006.01.02", dl.Version); err == nil && time.Since(rel) > downloaderMaxAge {
+		d.Severity = DiagnosticWarn
+		d.Message += fmt.Sprintf(" (released %d days ago)", int(time.Since(rel).Hours()/24))
+		d.Hint = "extractors in old releases are often broken by YouTube changes; update the downloader"
+	}
+	if dl.Flavor == FlavorYoutubeDL {
+		d.Severity = DiagnosticWarn
+		d.Hint = "youtube-dl is rarely updated; consider switching to yt-dlp"
+	}
+	if unsup := dl.Unsupported(cfg); len(unsup) > 0 {
+		d.Severity = DiagnosticWarn
+		d.Message += "; does not support " + strings.Join(unsup, ", ")
+		d.Hint = "update the downloader, or remove the options it does not support from the configuration"
+	}
+
+	return d
+}
+
+func doctorFFmpeg(cfg Config) Diagnostic {
+	d := Diagnostic{Check: "ffmpeg", Message: "found"}
+
+	if err := checkFFmpeg(cfg.FFmpeg); err != nil {
+		d.Message = err.Error()
+		d.Hint = "install ffmpeg or set the ffmpeg path"
+
+		// The downloader merges separate audio and video streams with
+		// ffmpeg, so without it we are limited to low quality formats.
+		d.Severity = DiagnosticWarn
+		if cfg.needFFmpeg() {
+			d.Severity = DiagnosticFail
+			d.Message += " (required to embed metadata, generate storyboards or poster frames)"
+		}
+	}
+
+	return d
+}
+
+func doctorAria2c(cfg Config) Diagnostic {
+	d := Diagnostic{Check: "aria2c", Message: "found"}
+
+	if err := checkDownloader(cfg.Aria2c); err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = fmt.Sprintf("%s: %v", cfg.Aria2c, err)
+		d.Hint = "install aria2c or disable it in the configuration"
+	} else if cfg.Aria2cConnections > maxAria2cConnections {
+		d.Severity = DiagnosticFail
+		d.Message = fmt.Sprintf("%d connections requested (max %d)", cfg.Aria2cConnections, maxAria2cConnections)
+	}
+
+	return d
+}
+
+func doctorRoot(cfg Config) Diagnostic {
+	d := Diagnostic{Check: "root"}
+
+	fi, err := os.Stat(cfg.Root)
+	if err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = err.Error()
+		d.Hint = "create the archive root directory"
+		return d
+	}
+	if !fi.IsDir() {
+		d.Severity = DiagnosticFail
+		d.Message = cfg.Root + " is not a directory"
+		return d
+	}
+
+	d.Message = fmt.Sprintf("%s (mode %v)", cfg.Root, fi.Mode().Perm())
+	if _, err := CheckRoot(cfg.Root, true); err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = err.Error()
+	} else if err := probeRoot(cfg.Root); err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = fmt.Sprintf("%s is not writable: %v", cfg.Root, err)
+		d.Hint = "ensure the archiver's user owns the archive root"
+	} else if fi.Mode().Perm()&0002 != 0 {
+		d.Severity = DiagnosticWarn
+		d.Hint = "the archive root is world-writable"
+	}
+
+	return d
+}
+
+func doctorAPIKey(ctx context.Context, cfg Config) Diagnostic {
+	d := Diagnostic{Check: "api key", Message: "valid"}
+
+	if cfg.APIKey == "" {
+		d.Severity = DiagnosticFail
+		d.Message = "no API key configured"
+		d.Hint = "create an API key at https://console.cloud.google.com/apis/credentials"
+		return d
+	}
+
+	cl := &http.Client{Transport: apiKeyTransport{cfg.APIKey, http.DefaultTransport}}
+	srv, err := youtube.NewService(ctx, option.WithHTTPClient(cl))
+	if err == nil {
+		// Costs a single unit of quota.
+		_, err = srv.VideoCategories.List([]string{"snippet"}).RegionCode("US").Context(ctx).Do()
+	}
+	if err != nil {
+		d.Severity = DiagnosticFail
+		d.Message = err.Error()
+		d.Hint = "check that the key is correct and that the YouTube Data API v3 is enabled for its project"
+	}
+
+	return d
+}
+
+func doctorClock(ctx context.Context) Diagnostic {
+	d := Diagnostic{Check: "clock"}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, clockCheckURL, nil)
+	if err != nil {
+		panic("doctor: bad clock check request: " + err.Error())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		d.Severity = DiagnosticWarn
+		d.Message = "could not reach API servers: " + err.Error()
+		return d
+	}
+	resp.Body.Close()
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.Severity = DiagnosticWarn
+		d.Message = "API servers sent no usable date"
+		return d
+	}
+
+	skew := time.Since(remote).Round(time.Second)
+	d.Message = fmt.Sprintf("skew of %v from API servers", skew)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		d.Severity = DiagnosticWarn
+		d.Hint = "synchronise the system clock (e.g with NTP); scheduled runs and upload dates may be wrong"
+	}
+
+	return d
+}
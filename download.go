@@ -1,44 +1,147 @@
 package ytarchiver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	youtubeWatchURL = "https://youtube.com/watch?v="
+	// interruptGrace is how long an interrupted downloader has to exit
+	// before it is killed.
+	interruptGrace = 5 * time.Second
+	// stderrTail is the number of bytes kept of the end of the errors
+	// printed by the downloader.
+	stderrTail = 4096
 )
 
 var ErrYoutubeDownloader = errors.New("ytarchiver: youtube downloader error")
 
-func youtubeDownload(cfg Config, videoID string, outPath string) error {
+// youtubeDownload runs the downloader dl for the given video, retrying as
+// configured, limited to the rate of lease. If report is non-nil, it is
+// called with each progress update printed by the downloader.
+//
+// If ctx is cancelled, the downloader is interrupted, so that it may clean
+// up after itself, and ctx.Err() is returned.
+func youtubeDownload(ctx context.Context, cfg Config, dl DownloaderInfo, videoID string, outPath string, lease *bandwidthLease, report func(Progress)) error {
 	uri := youtubeWatchURL + videoID
 	var err error
 
 	for i := uint(0); cfg.MaxRetries == 0 || i < cfg.MaxRetries; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		proc := exec.Cmd{
-			Path: cfg.Downloader,
+			Path: dl.Path,
 			Args: []string{
-				cfg.Downloader,
+				dl.Path,
 				"-o", outPath,
 				"--merge-output-format", "mp4",
+				"--newline",
 			},
 		}
 
-		if cfg.DumpVideoInfo {
-			proc.Args = append(proc.Args, "--write-info-json")
+		proc.Args = append(proc.Args, dl.featureArgs(cfg)...)
+		rate := lease.Take()
+		if rate != 0 {
+			proc.Args = append(proc.Args, "--limit-rate", strconv.FormatUint(rate, 10))
 		}
+		proc.Args = append(proc.Args, cfg.DownloaderArgs...)
 		proc.Args = append(proc.Args, uri)
+		var stderr tailBuffer
+		proc.Stderr = &stderr
+		// Anything it started may hold stderr open after it has gone.
+		proc.WaitDelay = interruptGrace
 
-		err = proc.Run()
+		out, perr := proc.StdoutPipe()
+		if perr != nil {
+			return fmt.Errorf("%w: %v", ErrYoutubeDownloader, perr)
+		}
+		started, lerr := limitProcess(&proc, cfg)
+		if lerr != nil {
+			return fmt.Errorf("%w: %v", ErrYoutubeDownloader, lerr)
+		}
+		err = proc.Start()
+		if lerr := started(); lerr != nil {
+			fmt.Printf("%s: resource limits: %v\n", videoID, lerr)
+		}
 		if err != nil {
 			err = fmt.Errorf("%w: %v", ErrYoutubeDownloader, err)
 			continue
 		}
+		interrupt := func() {
+			if proc.Process.Signal(os.Interrupt) != nil {
+				proc.Process.Kill()
+			}
+			// Anything it started may hold its output open after it
+			// has gone.
+			time.AfterFunc(interruptGrace, func() {
+				proc.Process.Kill()
+				out.Close()
+			})
+		}
+		stop := context.AfterFunc(ctx, interrupt)
+		// The limit can only be changed by restarting the downloader.
+		var restarted atomic.Bool
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-lease.Changed():
+				case <-done:
+					return
+				}
+				if lease.Rate() > rate {
+					select {
+					case <-time.After(bandwidthSettle):
+					case <-done:
+						return
+					}
+				}
+				if lease.Rate() != rate {
+					restarted.Store(true)
+					interrupt()
+					return
+				}
+			}
+		}()
+		scanProgress(out, func(p Progress) {
+			p.Limit = rate
+			if report != nil {
+				report(p)
+			}
+		})
+
+		err = proc.Wait()
+		stop()
+		close(done)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && restarted.Load() {
+			// Not a failure, so not counted as a retry.
+			i--
+			continue
+		}
+		if err != nil && proc.ProcessState == nil {
+			err = fmt.Errorf("%w: %v", ErrYoutubeDownloader, err)
+			continue
+		}
 		if !proc.ProcessState.Success() {
+			// No number of retries will help.
+			if ue, ok := unavailableError(string(stderr)); ok {
+				return fmt.Errorf("%w: %w", ErrYoutubeDownloader, ue)
+			}
 			err = fmt.Errorf("%w: pid %d exitted with code %d", ErrYoutubeDownloader, proc.ProcessState.Pid(), proc.ProcessState.ExitCode())
 			continue
 		}
@@ -50,41 +153,149 @@ func youtubeDownload(cfg Config, videoID string, outPath string) error {
 	return err
 }
 
+// tailBuffer keeps the last stderrTail bytes written to it.
+type tailBuffer []byte
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	*t = append(*t, p...)
+	if len(*t) > stderrTail {
+		*t = (*t)[len(*t)-stderrTail:]
+	}
+	return len(p), nil
+}
+
+// isYtDlp reports if the downloader at path appears to be yt-dlp, rather
+// than youtube-dl or some other fork lacking its options.
+func isYtDlp(path string) bool {
+	return strings.Contains(filepath.Base(path), "yt-dlp")
+}
+
+// crawlBatch is the number of directory entries read at a time by crawlRoot.
+const crawlBatch = 1024
+
+// isSidecarExt reports if ext is the extension of a file written next to a
+// video by the downloader or archiver, other than the video itself and its
+// info.
+func isSidecarExt(ext string) bool {
+	switch ext {
+	case ".webp", ".jpg", ".png", ".vtt", ".srt", ".ass", ".lrc", ".html", ".gz":
+		return true
+	default:
+		return false
+	}
+}
+
+// formatExt matches the extension of a format downloaded separately to be
+// merged into a video, such as "f137.mp4".
+var formatExt = regexp.MustCompile(`^f[0-9][0-9a-z-]*\.`)
+
+// isPartialFile reports if name is that of a file left behind by a download
+// which has not finished, rather than of an archived video or its metadata.
+func isPartialFile(name string) bool {
+	for _, ext := range []string{".part", ".tmp", ".ytdl"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	_, ext, _ := strings.Cut(name, ".")
+	return strings.Contains(ext, ".part-Frag") || strings.HasPrefix(ext, "temp.") || formatExt.MatchString(ext)
+}
+
 // crawlRoot looks at each file and directory in the root of the downloads
 // dir and marks already downloaded videos as present in the videos map.
 func crawlRoot(a *Archiver) error {
 	for _, ch := range a.Channels {
-		cch := a.chancache[ch.Identity()]
+		cch, ok := a.cachedChannel(ch.Identity())
+		if !ok {
+			continue
+		}
 
-		dir, err := os.ReadDir(a.Root + string(os.PathSeparator) + cch.ID)
+		videos, described, err := crawlChannel(filepath.Join(a.Root, cch.ID))
 		if err != nil {
 			// This is ok and expected as not all channels will yet have
 			// been started to be archived.
 			continue
 		}
+		if videos != nil {
+			cch.Videos = videos
+		}
+		if described.Len() != 0 {
+			cch.Described = described
+		}
+	}
 
-		if len(dir) != 0 && cch.Videos == nil {
-			cch.Videos = make(map[string]struct{})
+	// Videos restored from a backup of the state are archived, even if
+	// their files have not (yet) been moved to the root.
+	seen := make(map[string][]string)
+	if err := loadState(a.Root, stateSeen, &seen); err != nil {
+		return err
+	}
+	for _, ch := range a.Channels {
+		cch, ok := a.cachedChannel(ch.Identity())
+		if !ok || len(seen[cch.ID]) == 0 {
+			continue
+		}
+		if cch.Videos == nil {
+			cch.Videos = newVideoSet()
 		}
+		for _, id := range seen[cch.ID] {
+			cch.Videos.Add(id)
+		}
+	}
 
-		for _, f := range dir {
-			if f.IsDir() {
-				continue
-			}
-			if strings.HasSuffix(f.Name(), ".json") {
+	return nil
+}
+
+// crawlChannel returns the videos archived in the channel directory at
+// path, and those of which only the metadata is archived. videos is nil if
+// the directory is empty.
+func crawlChannel(path string) (videos, described *videoSet, err error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dir.Close()
+
+	// Channels with many uploads have several files per video, so the
+	// directory is read in batches rather than all at once.
+	metas := newVideoSet()
+	for {
+		ents, err := dir.ReadDir(crawlBatch)
+		if len(ents) != 0 && videos == nil {
+			videos = newVideoSet()
+		}
+
+		for _, f := range ents {
+			// A video is not archived until its download has
+			// finished.
+			if f.IsDir() || f.Name() == ChannelInfoName || isPartialFile(f.Name()) {
 				continue
 			}
 
-			name := f.Name()
-			estart := strings.IndexByte(name, '.')
-			if estart != -1 {
-				name = name[:estart]
+			name, ext, _ := strings.Cut(f.Name(), ".")
+			// Name should now contain the raw video ID
+			switch {
+			case strings.HasSuffix(ext, "json"):
+				metas.Add(name)
+			case isSidecarExt(filepath.Ext(f.Name())):
+				// Written for metadata-only videos too.
+			default:
+				videos.Add(name)
 			}
+		}
 
-			// Name should now contain the raw video ID so insert it
-			cch.Videos[name] = struct{}{}
+		if err != nil {
+			break
 		}
 	}
 
-	return nil
+	// Only the packed IDs are of any use; anything else is not a video.
+	described = newVideoSet()
+	for p := range metas.packed {
+		if id := unpackVideoID(p); !videos.Has(id) {
+			described.Add(id)
+		}
+	}
+
+	return videos, described, nil
 }
@@ -0,0 +1,173 @@
+package ytarchiver
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Downloader flavours.
+const (
+	// A downloader whose options could not be listed. It is assumed to
+	// support every option, as yt-dlp does.
+	FlavorUnknown = iota
+	FlavorYtDlp
+	// youtube-dl, or a fork lacking the options of yt-dlp.
+	FlavorYoutubeDL
+)
+
+// flavorNames are the names of each downloader flavour.
+var flavorNames = map[int]string{
+	FlavorUnknown:   "unknown downloader",
+	FlavorYtDlp:     "yt-dlp",
+	FlavorYoutubeDL: "youtube-dl",
+}
+
+// helpOption matches each long option listed by the --help of the
+// downloader, such as "    -U, --update    Update this program...".
+var helpOption = regexp.MustCompile(`(?m)^\s+(?:-[^-\s]+,\s+)?(--[a-z0-9][a-z0-9-]*)`)
+
+// A DownloaderInfo describes the flavour, version and options of a
+// downloader, as detected by DetectDownloader.
+type DownloaderInfo struct {
+	Path string
+	// One of the Flavor* constants.
+	Flavor int
+	// Version reported by the downloader, usually the date of its release
+	// (e.g "2024.08.06").
+	Version string
+	// Long options listed by the downloader. Nil if they could not be
+	// listed.
+	options map[string]bool
+}
+
+// DetectDownloader runs the downloader exe to find its version and the
+// options it supports. It fails only if the downloader cannot be run.
+func DetectDownloader(exe string) (DownloaderInfo, error) {
+	d := DownloaderInfo{Path: exe}
+
+	out, err := exec.Command(exe, "--version").Output()
+	if err != nil {
+		return d, err
+	}
+	d.Version, _, _ = strings.Cut(strings.TrimSpace(string(out)), "\n")
+
+	if help, err := exec.Command(exe, "--help").Output(); err == nil {
+		for _, m := range helpOption.FindAllStringSubmatch(string(help), -1) {
+			if d.options == nil {
+				d.options = make(map[string]bool)
+			}
+			d.options[m[1]] = true
+		}
+	}
+
+	switch {
+	case d.options == nil && isYtDlp(exe):
+		d.Flavor = FlavorYtDlp
+	case d.options == nil:
+		d.Flavor = FlavorUnknown
+	case d.options["--compat-options"]:
+		d.Flavor = FlavorYtDlp
+	default:
+		d.Flavor = FlavorYoutubeDL
+	}
+	return d, nil
+}
+
+func (d DownloaderInfo) String() string {
+	return fmt.Sprintf("%s %s", flavorNames[d.Flavor], d.Version)
+}
+
+// Supports reports if the downloader supports the long option opt (e.g
+// "--live-from-start").
+func (d DownloaderInfo) Supports(opt string) bool {
+	return d.options == nil || d.options[opt]
+}
+
+// featureArgs returns the arguments enabling the features of cfg which are
+// passed to the downloader as options, in the form the downloader accepts.
+// Features it does not support at all are left out (see Unsupported).
+func (d DownloaderInfo) featureArgs(cfg Config) []string {
+	var args []string
+	if cfg.DumpVideoInfo {
+		args = append(args, "--write-info-json")
+	}
+	if cfg.EmbedMetadata {
+		// Renamed by yt-dlp.
+		if !d.Supports("--embed-metadata") && d.Supports("--add-metadata") {
+			args = append(args, "--add-metadata")
+		} else {
+			args = append(args, "--embed-metadata")
+		}
+	}
+	if cfg.EmbedChapters && d.Supports("--embed-chapters") {
+		args = append(args, "--embed-chapters")
+	}
+	if cfg.EmbedThumbnail {
+		args = append(args, "--embed-thumbnail")
+	}
+	if cfg.FFmpeg != "" {
+		args = append(args, "--ffmpeg-location", cfg.FFmpeg)
+	}
+	if cfg.Aria2c != "" {
+		n := cfg.Aria2cConnections
+		if !d.Supports("--downloader") && d.Supports("--external-downloader") {
+			args = append(args,
+				"--external-downloader", cfg.Aria2c,
+				"--external-downloader-args", fmt.Sprintf("-x %d -s %d -k 1M", n, n),
+			)
+		} else {
+			args = append(args,
+				"--downloader", cfg.Aria2c,
+				"--downloader-args", fmt.Sprintf("aria2c:-x %d -s %d -k 1M", n, n),
+			)
+		}
+	}
+	if cfg.ConcurrentFragments != 0 && d.Supports("--concurrent-fragments") {
+		args = append(args, "--concurrent-fragments", strconv.FormatUint(uint64(cfg.ConcurrentFragments), 10))
+	}
+	if cfg.HTTPChunkSize != 0 && d.Supports("--http-chunk-size") {
+		args = append(args, "--http-chunk-size", strconv.FormatUint(cfg.HTTPChunkSize, 10))
+	}
+	return args
+}
+
+// Unsupported returns the options which cfg would pass to the downloader,
+// whether for the features it enables or in its downloader arguments (or
+// those of its channels), which the downloader does not support, sorted.
+// An old downloader may fail on each video given such options, or not do
+// what was asked.
+func (d DownloaderInfo) Unsupported(cfg Config) []string {
+	var unsup []string
+	check := func(opt string) {
+		if strings.HasPrefix(opt, "--") && !d.Supports(opt) && !slices.Contains(unsup, opt) {
+			unsup = append(unsup, opt)
+		}
+	}
+
+	if cfg.EmbedChapters {
+		check("--embed-chapters")
+	}
+	if cfg.ConcurrentFragments != 0 {
+		check("--concurrent-fragments")
+	}
+	for _, arg := range d.featureArgs(cfg) {
+		check(arg)
+	}
+	for _, arg := range cfg.DownloaderArgs {
+		opt, _, _ := strings.Cut(arg, "=")
+		check(opt)
+	}
+	for _, ch := range cfg.Channels {
+		for _, arg := range ch.DownloaderArgs {
+			opt, _, _ := strings.Cut(arg, "=")
+			check(opt)
+		}
+	}
+
+	slices.Sort(unsup)
+	return unsup
+}
@@ -0,0 +1,308 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// defaultBytesPerSecond is the rate at which archived video is assumed to
+// take up space if there are no archived videos with known durations to
+// measure, which is roughly that of 1080p video.
+const defaultBytesPerSecond = 400 << 10
+
+// rateSample is the greatest number of archived videos measured to find the
+// rate at which they take up space.
+const rateSample = 1000
+
+// isoDuration matches the ISO 8601 durations of videos given by the API,
+// such as "PT1H2M3S" or "P1DT2H".
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration parses an ISO 8601 duration of a video. It reports false
+// if d is not one, or is zero, as it is for upcoming videos.
+func parseISODuration(d string) (time.Duration, bool) {
+	m := isoDuration.FindStringSubmatch(d)
+	if m == nil {
+		return 0, false
+	}
+
+	var dur time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, false
+		}
+		dur += time.Duration(n) * unit
+	}
+	return dur, dur > 0
+}
+
+// A StorageForecast estimates the disk space needed to archive a number of
+// videos, from their durations and the space taken by those already
+// archived.
+type StorageForecast struct {
+	// When the forecast was made.
+	Time time.Time `json:"time"`
+	// Number of videos to be archived, and of those the number of unknown
+	// duration, which are not included in Bytes.
+	Videos          int `json:"videos"`
+	UnknownDuration int `json:"unknown_duration"`
+	// Total duration of the videos, in seconds.
+	Seconds int64 `json:"seconds"`
+	// Space taken per second of archived video, in bytes.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	// Estimated space needed, in bytes.
+	Bytes uint64 `json:"bytes"`
+	// Space available on the archive's filesystem, and the amount of it to
+	// be kept free (see Config.MinFreeSpace), in bytes.
+	Free    uint64 `json:"free"`
+	Reserve uint64 `json:"reserve"`
+}
+
+// Add adds a video of duration d, zero if unknown, to f. It reports if the
+// videos added so far are still expected to fit.
+func (f *StorageForecast) Add(d time.Duration) bool {
+	f.Videos++
+	if d <= 0 {
+		f.UnknownDuration++
+		return f.Fits()
+	}
+
+	f.Seconds += int64(d.Seconds())
+	f.Bytes += uint64(d.Seconds() * f.BytesPerSecond)
+	return f.Fits()
+}
+
+// Fits reports if the forecast space is expected to be available.
+func (f StorageForecast) Fits() bool {
+	return f.Bytes+f.Reserve <= f.Free
+}
+
+func (f StorageForecast) String() string {
+	s := fmt.Sprintf("%d video(s), %v long, need ~%d MiB of %d MiB free",
+		f.Videos, time.Duration(f.Seconds)*time.Second, f.Bytes>>20, f.Free>>20)
+	if f.Reserve != 0 {
+		s += fmt.Sprintf(" (keeping %d MiB)", f.Reserve>>20)
+	}
+	if f.UnknownDuration > 0 {
+		s += fmt.Sprintf(", %d of unknown duration", f.UnknownDuration)
+	}
+	return s
+}
+
+// newStorageForecast returns an empty forecast for the archive at root.
+func newStorageForecast(root string, reserve uint64) (StorageForecast, error) {
+	f := StorageForecast{Time: time.Now(), Reserve: reserve}
+
+	var err error
+	if f.BytesPerSecond, err = archiveRate(root); err != nil {
+		return f, err
+	}
+	if f.Free, err = diskFree(root); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// archiveRate returns the average space taken per second of the archived
+// videos of known duration at root, in bytes, measuring at most rateSample
+// of them. Their durations are only known if Config.DumpVideoInfo was set.
+func archiveRate(root string) (float64, error) {
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+
+	var size, secs int64
+	n := 0
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+
+		dir := filepath.Join(root, c.Name())
+		metas, err := filepath.Glob(filepath.Join(dir, "*"+VideoMetaSuffix))
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range metas {
+			if n >= rateSample {
+				break
+			}
+
+			vm, err := ReadVideoMeta(dir, strings.TrimSuffix(filepath.Base(m), VideoMetaSuffix))
+			if err != nil || vm.MetadataOnly || vm.Duration <= 0 {
+				continue
+			}
+			// Metadata written before sizes were recorded does not
+			// give one.
+			if vm.Size == 0 {
+				fi, err := os.Stat(filepath.Join(dir, vm.ID+"."+vm.Extension))
+				if err != nil {
+					continue
+				}
+				vm.Size = fi.Size()
+			}
+
+			size += vm.Size
+			secs += int64(vm.Duration)
+			n++
+		}
+	}
+
+	if secs == 0 {
+		return defaultBytesPerSecond, nil
+	}
+	return float64(size) / float64(secs), nil
+}
+
+// videoLength returns the duration of the video of pi, from its metadata in
+// vc, or zero if unknown.
+func videoLength(ctx context.Context, vc *videoCache, pi *youtube.PlaylistItem) (time.Duration, error) {
+	v, err := vc.Get(ctx, pi.ContentDetails.VideoId)
+	if err != nil || v == nil || v.ContentDetails == nil {
+		return 0, err
+	}
+
+	d, _ := parseISODuration(v.ContentDetails.Duration)
+	return d, nil
+}
+
+// Forecast estimates the disk space needed to archive every video of the
+// configured channels which has not yet been archived, as a dry run: the
+// channels are enumerated in full and the selectors applied, but nothing
+// is downloaded. Videos recorded as unavailable are not counted. The
+// forecast is recorded for ReadForecast.
+//
+// Enumerating in full uses a request per 50 videos of each channel.
+func (a *Archiver) Forecast() (StorageForecast, error) {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	ctx := a.ctx
+	f, err := newStorageForecast(a.Root, a.MinFreeSpace)
+	if err != nil {
+		return f, err
+	}
+	unavail, err := loadTombstones(a.Root)
+	if err != nil {
+		return f, err
+	}
+	// Read without recording the start of any backfill, which is left to
+	// the first run.
+	backfill := make(map[string]time.Time)
+	if err := loadState(a.Root, stateBackfill, &backfill); err != nil {
+		return f, err
+	}
+
+	vc := newVideoCache(a.client)
+	for _, ch := range a.Channels {
+		chc, ok := a.cachedChannel(ch.Identity())
+		if !ok {
+			return f, fmt.Errorf("%w: %s", ErrCacheMiss, ch.Identity())
+		}
+		sels := a.channelSelectors(ch)
+		if err := a.refreshSelectors(ctx, sels); err != nil {
+			return f, err
+		}
+		start, ok := backfill[chc.ID]
+		if !ok {
+			start = time.Now()
+		}
+
+		visit := func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+			id := pi.ContentDetails.VideoId
+			if chc.Videos.Has(id) || !unavail.Allowed(id, time.Now(), a.UnavailableRecheck) {
+				return nil
+			}
+			for _, m := range sels {
+				if ok, err := a.selects(ctx, m, pi, vc, inBacklog(pi, start)); err != nil || !ok {
+					return err
+				}
+			}
+
+			d, err := videoLength(ctx, vc, pi)
+			f.Add(d)
+			return err
+		}
+
+		// The channel itself is left untouched, so that the next run
+		// is unaffected.
+		cc := *chc
+		cc.Upcoming = nil
+		if len(ch.VideoIDs) > 0 {
+			err = cc.ForeachVideo(ctx, ch.VideoIDs, vc, visit)
+		} else {
+			for _, pl := range cc.Playlists {
+				err = cc.foreachPipelined(ctx, a.client, pl, vc, visit)
+				if err != nil && pl != cc.UploadsID && !cc.Playlist && isNotFound(err) {
+					err = nil
+				}
+				if err != nil && !errors.Is(err, ErrEmptyResults) {
+					break
+				}
+				err = nil
+			}
+		}
+		if err != nil {
+			return f, fmt.Errorf("forecast %s: %w", chc.ID, err)
+		}
+	}
+
+	return f, saveState(a.Root, stateForecast, f)
+}
+
+// ReadForecast returns the most recent forecast made by Archiver.Forecast
+// for the archive at root, or a zero forecast if none has been made.
+func ReadForecast(root string) (StorageForecast, error) {
+	return readForecast(osReader(root))
+}
+
+// readForecast is ReadForecast for the root read by read.
+func readForecast(read readFunc) (StorageForecast, error) {
+	var f StorageForecast
+	err := readState(read, stateForecast, &f)
+	return f, err
+}
+
+// forecastRun checks that the video of pi, of channel cid, is expected to
+// fit in the space left once the videos already queued this run have been
+// downloaded, according to Config.StorageForecast. It returns a reason to
+// skip the video if it should not be downloaded. runMut must be held.
+func (a *Archiver) forecastRun(ctx context.Context, cid string, pi *youtube.PlaylistItem, vc *videoCache) (string, error) {
+	if a.runForecast == nil {
+		return "", nil
+	}
+
+	d, err := videoLength(ctx, vc, pi)
+	if err != nil {
+		return "", err
+	}
+	before := *a.runForecast
+	if a.runForecast.Add(d) {
+		return "", nil
+	}
+
+	if a.StorageForecast == ForecastRefuse {
+		// Skipped videos need no space.
+		*a.runForecast = before
+		return fmt.Sprintf("would not fit on disk (~%d MiB free)", a.runForecast.Free>>20), nil
+	}
+	if !a.forecastWarned {
+		a.forecastWarned = true
+		fmt.Printf("[%s] storage forecast: %v\n", cid, *a.runForecast)
+	}
+	return "", nil
+}
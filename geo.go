@@ -0,0 +1,44 @@
+package ytarchiver
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// GeoBlocked reports if v is unavailable in region, an ISO 3166-1 alpha-2
+// code, according to its region restrictions. v must include the
+// contentDetails part.
+func GeoBlocked(v *youtube.Video, region string) bool {
+	if v == nil || v.ContentDetails == nil || v.ContentDetails.RegionRestriction == nil {
+		return false
+	}
+
+	rr := v.ContentDetails.RegionRestriction
+	match := func(r string) bool { return strings.EqualFold(r, region) }
+	if len(rr.Allowed) > 0 {
+		return !slices.ContainsFunc(rr.Allowed, match)
+	}
+	return slices.ContainsFunc(rr.Blocked, match)
+}
+
+// checkGeo looks up whether pi is blocked in the configured region,
+// returning the proxy through which it must be downloaded, or a reason to
+// skip it if there is none.
+func (a *Archiver) checkGeo(ctx context.Context, pi *youtube.PlaylistItem, vc *videoCache) (proxy, skip string, err error) {
+	if a.Region == "" {
+		return "", "", nil
+	}
+
+	v, err := vc.Get(ctx, pi.ContentDetails.VideoId)
+	if err != nil || !GeoBlocked(v, a.Region) {
+		return "", "", err
+	}
+
+	if a.GeoProxy == "" {
+		return "", "blocked in region " + strings.ToUpper(a.Region), nil
+	}
+	return a.GeoProxy, "", nil
+}
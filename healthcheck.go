@@ -0,0 +1,29 @@
+package ytarchiver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// pingHealthcheck pings Config.HealthcheckURL with the given suffix (one of
+// "/start", "/fail" or "" for success) and body, if configured. As with
+// notifications, failing to ping is only printed.
+func (a *Archiver) pingHealthcheck(suffix, body string) {
+	if a.HealthcheckURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, notifyTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(a.HealthcheckURL, "/") + suffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err == nil {
+		err = postNotification(req)
+	}
+	if err != nil {
+		fmt.Printf("healthcheck: %v\n", err)
+	}
+}
@@ -0,0 +1,136 @@
+package ytarchiver
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxHistory is the number of runs kept in the run history.
+const maxHistory = 100
+
+// A RunRecord records the outcome of a single archive run.
+type RunRecord struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Number of channels archived.
+	Channels int `json:"channels"`
+	// Number of videos queued for download, including any which failed.
+	Videos int `json:"videos"`
+	// Number of videos which failed to download.
+	Failed int `json:"failed"`
+	// Each error encountered, prefixed with the channel it occurred on.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ReadHistory reads the history of the most recent archive runs on the
+// archive at root, oldest first. Unlike Archiver.History, this may be used
+// while an archiver is running on root.
+func ReadHistory(root string) ([]RunRecord, error) {
+	var hist []RunRecord
+	err := loadState(root, stateHistory, &hist)
+	return hist, err
+}
+
+// History returns the history of the most recent archive runs, oldest
+// first. At most 100 runs are kept.
+func (a *Archiver) History() ([]RunRecord, error) {
+	return ReadHistory(a.Root)
+}
+
+// recordHistory appends a record of a run over chans which started at start
+// and produced err to the run history.
+func (a *Archiver) recordHistory(start time.Time, chans []YouTubeChannel, err ArchiveError) error {
+	rec := RunRecord{
+		Start:    start,
+		End:      time.Now(),
+		Channels: len(chans),
+		Videos:   a.runVideos,
+		Failed:   videoFailures(err),
+	}
+	for _, cerr := range err {
+		for _, e := range cerr.Errors {
+			rec.Errors = append(rec.Errors, fmt.Sprintf("%s: %v", cerr.ChannelID, e))
+		}
+	}
+
+	hist, herr := ReadHistory(a.Root)
+	if herr != nil {
+		return herr
+	}
+	hist = append(hist, rec)
+	if len(hist) > maxHistory {
+		hist = hist[len(hist)-maxHistory:]
+	}
+
+	return saveState(a.Root, stateHistory, hist)
+}
+
+// A ChannelRecord records the outcome of the most recent run over a single
+// channel.
+type ChannelRecord struct {
+	// ID of the channel, if it could be looked up.
+	ChannelID string    `json:"channel_id,omitempty"`
+	LastRun   time.Time `json:"last_run"`
+	// Number of new videos archived, including those whose metadata
+	// alone was archived.
+	Archived int `json:"archived"`
+	// Number of videos which failed to download.
+	Failed int `json:"failed"`
+	// Number of videos waiting to be archived, such as upcoming premieres
+	// and videos within the grace period.
+	Pending int `json:"pending"`
+	// Each error encountered.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ReadChannelRecords reads the record of the most recent run over each
+// channel of the archive at root, by channel identity (see
+// YouTubeChannel.Identity). Like ReadHistory, this may be used while an
+// archiver is running on root.
+func ReadChannelRecords(root string) (map[string]ChannelRecord, error) {
+	recs := make(map[string]ChannelRecord)
+	err := loadState(root, stateChannels, &recs)
+	return recs, err
+}
+
+// recordChannels records the outcome of a run which started at start for
+// each of chans, which produced err. runMut must be held.
+func (a *Archiver) recordChannels(start time.Time, chans []YouTubeChannel, err ArchiveError) error {
+	recs, rerr := ReadChannelRecords(a.Root)
+	if rerr != nil {
+		return rerr
+	}
+
+	for _, ch := range chans {
+		rec := ChannelRecord{LastRun: start}
+		if chc, ok := a.cachedChannel(ch.Identity()); ok {
+			rec.ChannelID = chc.ID
+			rec.Pending = len(chc.Upcoming)
+		}
+		for _, v := range a.outcomes.videos {
+			if v.ChannelID != rec.ChannelID {
+				continue
+			}
+			switch v.Outcome {
+			case OutcomeDownloaded, OutcomeMetadata:
+				rec.Archived++
+			case OutcomeFailed:
+				if v.ErrorClass != ErrorClassCanceled {
+					rec.Failed++
+				}
+			}
+		}
+		for _, cerr := range err {
+			if cerr.ChannelID != ch.Identity() {
+				continue
+			}
+			for _, e := range cerr.Errors {
+				rec.Errors = append(rec.Errors, e.Error())
+			}
+		}
+
+		recs[ch.Identity()] = rec
+	}
+
+	return saveState(a.Root, stateChannels, recs)
+}
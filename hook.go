@@ -0,0 +1,142 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	// hookTimeout bounds the time taken by a pre-download hook command.
+	hookTimeout = time.Minute
+	// defaultHookDelay is how long a video is delayed by a hook command
+	// which does not say.
+	defaultHookDelay = time.Hour
+)
+
+// Exit statuses of a pre-download hook command.
+const (
+	hookExitAllow = 0
+	hookExitVeto  = 1
+	hookExitDelay = 2
+)
+
+var ErrPreDownloadHook = errors.New("ytarchiver: pre-download hook")
+
+// HookDecision is the verdict of a pre-download hook on a video. The zero
+// value allows the download.
+type HookDecision struct {
+	// Skip the video for this run. It is offered to the hook again on the
+	// next run.
+	Veto bool
+	// If in the future, skip the video without consulting the hook again
+	// until then.
+	Until time.Time
+	// Human-readable reason for a veto or delay.
+	Reason string
+}
+
+// A PreDownloadHook is consulted before each video selected for archiving is
+// queued, and may veto or delay it. If it returns an error, the video is
+// skipped for this run and the error reported.
+type PreDownloadHook func(ctx context.Context, pi *youtube.PlaylistItem) (HookDecision, error)
+
+// CommandHook returns a PreDownloadHook which runs the executable at path
+// for each video, with the details of the video in the environment as
+// YTARCHIVER_VIDEO_ID, YTARCHIVER_CHANNEL_ID and YTARCHIVER_TITLE.
+//
+// The command allows the download by exiting with status 0, vetoes it
+// with status 1 or delays it with status 2. The first line printed is the
+// reason; for a delay, it may instead be a duration (e.g "30m") for which to
+// delay. Any other status is an error.
+func CommandHook(path string) PreDownloadHook {
+	return func(ctx context.Context, pi *youtube.PlaylistItem) (HookDecision, error) {
+		ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, path)
+		cmd.Env = append(os.Environ(),
+			"YTARCHIVER_VIDEO_ID="+pi.ContentDetails.VideoId,
+			"YTARCHIVER_CHANNEL_ID="+pi.Snippet.ChannelId,
+			"YTARCHIVER_TITLE="+pi.Snippet.Title,
+		)
+		out, errout := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd.Stdout, cmd.Stderr = out, errout
+
+		err := cmd.Run()
+		var eerr *exec.ExitError
+		if err != nil && !errors.As(err, &eerr) {
+			return HookDecision{}, err
+		}
+
+		line, _, _ := strings.Cut(out.String(), "\n")
+		line = strings.TrimSpace(line)
+		switch code := cmd.ProcessState.ExitCode(); code {
+		case hookExitAllow:
+			return HookDecision{}, nil
+		case hookExitVeto:
+			return HookDecision{Veto: true, Reason: line}, nil
+		case hookExitDelay:
+			d, perr := time.ParseDuration(line)
+			if perr != nil {
+				d = defaultHookDelay
+			} else {
+				line = ""
+			}
+			return HookDecision{Until: time.Now().Add(d), Reason: line}, nil
+		default:
+			msg, _, _ := strings.Cut(errout.String(), "\n")
+			return HookDecision{}, fmt.Errorf("%s exited with code %d: %s", path, code, msg)
+		}
+	}
+}
+
+// checkPreDownload consults the pre-download hook, if any, about pi,
+// returning a reason if it should not be downloaded now, or an error if the
+// hook failed. runMut must be held.
+func (a *Archiver) checkPreDownload(ctx context.Context, pi *youtube.PlaylistItem) (skip string, err error) {
+	if a.PreDownloadHook == nil {
+		return "", nil
+	}
+
+	id := pi.ContentDetails.VideoId
+	now := time.Now()
+	if until, ok := a.hookDelays[id]; ok {
+		if now.Before(until) {
+			return "delayed by pre-download hook until " + until.Format(time.RFC3339), nil
+		}
+		delete(a.hookDelays, id)
+	}
+
+	d, err := a.PreDownloadHook(ctx, pi)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrPreDownloadHook, id, err)
+	}
+
+	switch {
+	case d.Veto:
+		return hookReason("vetoed by pre-download hook", d.Reason), nil
+	case d.Until.After(now):
+		if a.hookDelays == nil {
+			a.hookDelays = make(map[string]time.Time)
+		}
+		a.hookDelays[id] = d.Until
+		return hookReason("delayed by pre-download hook until "+d.Until.Format(time.RFC3339), d.Reason), nil
+	default:
+		return "", nil
+	}
+}
+
+func hookReason(what, why string) string {
+	if why == "" {
+		return what
+	}
+	return what + ": " + why
+}
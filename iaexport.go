@@ -0,0 +1,283 @@
+package ytarchiver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultIAPrefix is used if IAExportOptions.Prefix is empty.
+const defaultIAPrefix = "youtube-"
+
+var ErrIAIdentifier = errors.New("invalid Internet Archive identifier")
+
+// iaIdentifier matches the identifiers the Internet Archive accepts for
+// items.
+var iaIdentifier = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+
+// iaFormats are the names the Internet Archive gives the formats of files,
+// by extension. Others are left for it to work out.
+var iaFormats = map[string]string{
+	".mp4":  "MPEG4",
+	".m4v":  "MPEG4",
+	".webm": "WebM",
+	".mkv":  "Matroska",
+	".m4a":  "M4A",
+	".opus": "Opus",
+	".mp3":  "VBR MP3",
+	".jpg":  "JPEG",
+	".png":  "PNG",
+	".webp": "WebP",
+	".vtt":  "Web Video Text Tracks",
+	".srt":  "SubRip",
+	".json": "JSON",
+	".html": "HTML",
+}
+
+// audioExts are the extensions of audio-only downloads, which are items of
+// the audio media type rather than movies.
+var audioExts = []string{"m4a", "opus", "mp3"}
+
+// IAExportOptions configures ExportIA.
+type IAExportOptions struct {
+	// Prefix of the identifier of each item, followed by the video ID.
+	// Identifiers are unique across the Internet Archive, so this should
+	// be distinctive. Defaults to "youtube-".
+	Prefix string
+	// Collection to which the items are to be uploaded, if any.
+	Collection string
+	// IDs of the channels whose videos are exported. Every channel if
+	// empty.
+	Channels []string
+	// Copy the files into the items rather than hard-linking them, as is
+	// otherwise done where possible.
+	Copy bool
+}
+
+// iaMetadata is an item's _meta.xml file.
+type iaMetadata struct {
+	XMLName     xml.Name `xml:"metadata"`
+	Identifier  string   `xml:"identifier"`
+	MediaType   string   `xml:"mediatype"`
+	Collection  string   `xml:"collection,omitempty"`
+	Title       string   `xml:"title"`
+	Description string   `xml:"description,omitempty"`
+	Creator     string   `xml:"creator,omitempty"`
+	Date        string   `xml:"date,omitempty"`
+	Subjects    []string `xml:"subject"`
+	Runtime     string   `xml:"runtime,omitempty"`
+	OriginalURL string   `xml:"originalurl"`
+	ExternalID  string   `xml:"external-identifier"`
+	Scanner     string   `xml:"scanner"`
+}
+
+// iaFiles is an item's _files.xml file.
+type iaFiles struct {
+	XMLName xml.Name `xml:"files"`
+	Files   []iaFile `xml:"file"`
+}
+
+type iaFile struct {
+	Name   string `xml:"name,attr"`
+	Source string `xml:"source,attr"`
+	Format string `xml:"format,omitempty"`
+	Size   int64  `xml:"size"`
+	MTime  int64  `xml:"mtime"`
+	MD5    string `xml:"md5"`
+	SHA1   string `xml:"sha1"`
+}
+
+// ExportIA packages each downloaded video of the archive at root into an
+// item directory in dest laid out for upload to the Internet Archive, with
+// the video, its metadata, thumbnail and subtitles alongside the item's
+// _meta.xml and _files.xml. Only videos with a metadata file (see
+// Config.DumpVideoInfo) are exported. Exporting again refreshes existing
+// items. It returns the number of items exported.
+func ExportIA(root, dest string, opts IAExportOptions) (int, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = defaultIAPrefix
+	}
+
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+		if len(opts.Channels) > 0 && !slices.Contains(opts.Channels, c.Name()) {
+			continue
+		}
+
+		dir := filepath.Join(root, c.Name())
+		ci, err := ReadChannelInfo(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return n, err
+		}
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return n, err
+		}
+
+		for _, f := range files {
+			id, ok := strings.CutSuffix(f.Name(), VideoMetaSuffix)
+			if !ok {
+				continue
+			}
+			vm, err := ReadVideoMeta(dir, id)
+			if err != nil {
+				return n, err
+			}
+			if vm.MetadataOnly {
+				continue
+			}
+
+			if err := exportIAItem(dir, dest, ci, vm, opts); err != nil {
+				return n, fmt.Errorf("export %s: %w", id, err)
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// exportIAItem exports the video vm in the channel directory dir, of the
+// channel ci, as an item in dest.
+func exportIAItem(dir, dest string, ci ChannelInfo, vm VideoMeta, opts IAExportOptions) error {
+	ident := opts.Prefix + vm.ID
+	if !iaIdentifier.MatchString(ident) {
+		return fmt.Errorf("%w: %q", ErrIAIdentifier, ident)
+	}
+	item := filepath.Join(dest, ident)
+	if err := os.MkdirAll(item, 0755); err != nil {
+		return err
+	}
+
+	// Everything named after the video belongs to it.
+	names, err := filepath.Glob(filepath.Join(dir, vm.ID+".*"))
+	if err != nil {
+		return err
+	}
+	var files iaFiles
+	for _, src := range names {
+		name := filepath.Base(src)
+		if strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		f, err := exportIAFile(src, filepath.Join(item, name), opts.Copy)
+		if err != nil {
+			return err
+		}
+		files.Files = append(files.Files, f)
+	}
+
+	meta := iaMetadata{
+		Identifier:  ident,
+		MediaType:   "movies",
+		Collection:  opts.Collection,
+		Title:       vm.Title,
+		Description: vm.Description,
+		Creator:     ci.Name,
+		Subjects:    vm.Tags,
+		OriginalURL: youtubeWatchURL + vm.ID,
+		ExternalID:  "urn:youtube:" + vm.ID,
+		Scanner:     "ytarchiver",
+	}
+	if slices.Contains(audioExts, vm.Extension) {
+		meta.MediaType = "audio"
+	}
+	if !vm.UploadedAt.IsZero() {
+		meta.Date = vm.UploadedAt.Format("2006-01-02")
+	}
+	if vm.Duration > 0 {
+		meta.Runtime = fmt.Sprintf("%02d:%02d:%02d", vm.Duration/3600, vm.Duration/60%60, vm.Duration%60)
+	}
+
+	if err := writeXML(filepath.Join(item, ident+"_meta.xml"), meta); err != nil {
+		return err
+	}
+	return writeXML(filepath.Join(item, ident+"_files.xml"), files)
+}
+
+// exportIAFile links or copies the file at src to dst, and describes it for
+// _files.xml.
+func exportIAFile(src, dst string, copyFile bool) (iaFile, error) {
+	f := iaFile{Name: filepath.Base(dst), Source: "original", Format: iaFormats[filepath.Ext(dst)]}
+
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	// Links into the object store (see Config.ContentAddressed) are
+	// relative, so the object itself is exported.
+	if p, err := filepath.EvalSymlinks(src); err == nil {
+		src = p
+	}
+	if copyFile || os.Link(src, dst) != nil {
+		if err := copyPath(src, dst); err != nil {
+			return f, err
+		}
+	}
+
+	in, err := os.Open(dst)
+	if err != nil {
+		return f, err
+	}
+	defer in.Close()
+
+	md, sh := md5.New(), sha1.New()
+	if f.Size, err = io.Copy(io.MultiWriter(md, sh), in); err != nil {
+		return f, err
+	}
+	fi, err := in.Stat()
+	if err != nil {
+		return f, err
+	}
+	f.MTime = fi.ModTime().Unix()
+	f.MD5, f.SHA1 = hex.EncodeToString(md.Sum(nil)), hex.EncodeToString(sh.Sum(nil))
+
+	return f, nil
+}
+
+// copyPath copies the file at src to a new file at dst.
+func copyPath(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeXML writes v to the file at path as indented XML.
+func writeXML(path string, v any) error {
+	dat, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	dat = append([]byte(xml.Header), dat...)
+	return os.WriteFile(path, append(dat, '\n'), 0644)
+}
@@ -0,0 +1,399 @@
+// Package fakeyt provides an in-memory fake of the parts of the YouTube Data
+// API used by the archiver, for use in tests through ytarchiver.Config.Client.
+package fakeyt
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"google.golang.org/api/youtube/v3"
+)
+
+// DefaultPageSize is the number of playlist items returned per page unless
+// Client.PageSize is set.
+const DefaultPageSize = 50
+
+var ErrBadPageToken = errors.New("fakeyt: invalid page token")
+
+// Calls counts the requests made of a Client.
+type Calls struct {
+	Channels      int
+	PlaylistItems int
+	Videos        int
+	Categories    int
+	Captions      int
+	Activities    int
+	Comments      int
+}
+
+// Client is a fake ytarchiver.YouTubeClient. The zero value is not usable;
+// use New.
+type Client struct {
+	// Number of playlist items returned per page. DefaultPageSize if zero.
+	PageSize int
+	// Err, if non-nil, is returned by every request.
+	Err error
+
+	mut       sync.Mutex
+	channels  map[string]*youtube.Channel
+	playlists map[string][]*youtube.PlaylistItem
+	videos    map[string]*youtube.Video
+	cats      []*youtube.VideoCategory
+	captions  map[string][]*youtube.Caption
+	// Activities of each channel by ID, newest first.
+	activities map[string][]*youtube.Activity
+	comments   map[string][]*youtube.CommentThread
+	calls      Calls
+}
+
+// New returns an empty fake client.
+func New() *Client {
+	return &Client{
+		channels:  make(map[string]*youtube.Channel),
+		playlists: make(map[string][]*youtube.PlaylistItem),
+		videos:    make(map[string]*youtube.Video),
+		captions:  make(map[string][]*youtube.Caption),
+
+		activities: make(map[string][]*youtube.Activity),
+		comments:   make(map[string][]*youtube.CommentThread),
+	}
+}
+
+// UploadsID returns the ID of the uploads playlist of the channel with the
+// given ID, as YouTube derives it.
+func UploadsID(channelID string) string {
+	return "UU" + strings.TrimPrefix(channelID, "UC")
+}
+
+// AddChannel adds a channel with the given ID and handle (without the "@")
+// and an empty uploads playlist.
+func (c *Client) AddChannel(id, handle string) *youtube.Channel {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	ch := &youtube.Channel{
+		Id: id,
+		Snippet: &youtube.ChannelSnippet{
+			Title:     handle,
+			CustomUrl: "@" + handle,
+		},
+		ContentDetails: &youtube.ChannelContentDetails{
+			RelatedPlaylists: &youtube.ChannelContentDetailsRelatedPlaylists{
+				Uploads: UploadsID(id),
+			},
+		},
+	}
+	c.channels[id] = ch
+	return ch
+}
+
+// AddVideo adds a video to the channel with the given ID. It becomes the
+// newest item of the channel's uploads playlist and newest upload activity,
+// as on YouTube.
+func (c *Client) AddVideo(channelID string, v *youtube.Video) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if v.Snippet == nil {
+		v.Snippet = &youtube.VideoSnippet{}
+	}
+	if v.Snippet.LiveBroadcastContent == "" {
+		v.Snippet.LiveBroadcastContent = "none"
+	}
+	v.Snippet.ChannelId = channelID
+	c.videos[v.Id] = v
+
+	item := &youtube.PlaylistItem{
+		Snippet: &youtube.PlaylistItemSnippet{
+			ChannelId:   channelID,
+			Title:       v.Snippet.Title,
+			Description: v.Snippet.Description,
+			PublishedAt: v.Snippet.PublishedAt,
+			ResourceId:  &youtube.ResourceId{Kind: "youtube#video", VideoId: v.Id},
+		},
+		ContentDetails: &youtube.PlaylistItemContentDetails{
+			VideoId:          v.Id,
+			VideoPublishedAt: v.Snippet.PublishedAt,
+		},
+	}
+	c.addPlaylistItem(UploadsID(channelID), item)
+	c.addActivity(channelID, &youtube.Activity{
+		Snippet: &youtube.ActivitySnippet{
+			ChannelId:   channelID,
+			Title:       v.Snippet.Title,
+			PublishedAt: v.Snippet.PublishedAt,
+			Type:        "upload",
+		},
+		ContentDetails: &youtube.ActivityContentDetails{
+			Upload: &youtube.ActivityContentDetailsUpload{VideoId: v.Id},
+		},
+	})
+}
+
+// AddPlaylistItem prepends item to the playlist with the given ID.
+func (c *Client) AddPlaylistItem(playlistID string, item *youtube.PlaylistItem) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.addPlaylistItem(playlistID, item)
+}
+
+func (c *Client) addPlaylistItem(playlistID string, item *youtube.PlaylistItem) {
+	c.playlists[playlistID] = append([]*youtube.PlaylistItem{item}, c.playlists[playlistID]...)
+}
+
+// AddActivity prepends an activity to those of the channel with the given
+// ID, such as an upload not in its uploads playlist.
+func (c *Client) AddActivity(channelID string, a *youtube.Activity) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.addActivity(channelID, a)
+}
+
+func (c *Client) addActivity(channelID string, a *youtube.Activity) {
+	c.activities[channelID] = append([]*youtube.Activity{a}, c.activities[channelID]...)
+}
+
+// AddCategory adds a video category, available in every region.
+func (c *Client) AddCategory(id, title string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.cats = append(c.cats, &youtube.VideoCategory{
+		Id:      id,
+		Snippet: &youtube.VideoCategorySnippet{Title: title, Assignable: true},
+	})
+}
+
+// AddCaption adds a caption track in the given language to a video.
+func (c *Client) AddCaption(videoID, language string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.captions[videoID] = append(c.captions[videoID], &youtube.Caption{
+		Id:      videoID + "." + language,
+		Snippet: &youtube.CaptionSnippet{VideoId: videoID, Language: language, TrackKind: "standard"},
+	})
+}
+
+// AddComment adds a top-level comment by author to a video.
+func (c *Client) AddComment(videoID, author, text string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.comments[videoID] = append(c.comments[videoID], &youtube.CommentThread{
+		Id: videoID + "." + strconv.Itoa(len(c.comments[videoID])),
+		Snippet: &youtube.CommentThreadSnippet{
+			VideoId: videoID,
+			TopLevelComment: &youtube.Comment{Snippet: &youtube.CommentSnippet{
+				VideoId:           videoID,
+				AuthorDisplayName: author,
+				TextDisplay:       text,
+				TextOriginal:      text,
+			}},
+		},
+	})
+}
+
+// Calls returns the number of requests made so far.
+func (c *Client) Calls() Calls {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.calls
+}
+
+func (c *Client) ListChannel(ctx context.Context, ch ytarchiver.YouTubeChannel) (*youtube.Channel, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Channels++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	if ch.Identity() == "unknown" {
+		return nil, ytarchiver.ErrChannelNotIdentified
+	}
+	if ch.ID != "" {
+		return c.channels[ch.ID], nil
+	}
+	for _, r := range c.channels {
+		if ch.Handle != "" && strings.EqualFold(r.Snippet.CustomUrl, "@"+strings.TrimPrefix(ch.Handle, "@")) {
+			return r, nil
+		}
+		if ch.Username != "" && strings.EqualFold(r.Snippet.Title, ch.Username) {
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *Client) ListChannels(ctx context.Context, ids []string) ([]*youtube.Channel, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Channels++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var chans []*youtube.Channel
+	for _, id := range ids {
+		if ch, ok := c.channels[id]; ok {
+			chans = append(chans, ch)
+		}
+	}
+	return chans, nil
+}
+
+func (c *Client) ListPlaylistItems(ctx context.Context, playlistID, pageToken string) (*youtube.PlaylistItemListResponse, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.PlaylistItems++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if pageToken != "" {
+		var err error
+		if start, err = strconv.Atoi(pageToken); err != nil {
+			return nil, ErrBadPageToken
+		}
+	}
+
+	items := c.playlists[playlistID]
+	if start > len(items) {
+		return nil, ErrBadPageToken
+	}
+	size := c.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	end := min(start+size, len(items))
+
+	r := &youtube.PlaylistItemListResponse{
+		Items:    items[start:end],
+		PageInfo: &youtube.PageInfo{TotalResults: int64(len(items)), ResultsPerPage: int64(size)},
+	}
+	if end < len(items) {
+		r.NextPageToken = strconv.Itoa(end)
+	}
+	r.HTTPStatusCode = 200
+	return r, nil
+}
+
+func (c *Client) ListVideos(ctx context.Context, parts []string, ids []string) ([]*youtube.Video, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Videos++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var vids []*youtube.Video
+	for _, id := range ids {
+		if v, ok := c.videos[id]; ok {
+			vids = append(vids, v)
+		}
+	}
+	return vids, nil
+}
+
+func (c *Client) ListVideoCategories(ctx context.Context, regionCode string) ([]*youtube.VideoCategory, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Categories++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	return append([]*youtube.VideoCategory(nil), c.cats...), nil
+}
+
+func (c *Client) ListCaptions(ctx context.Context, videoID string) ([]*youtube.Caption, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Captions++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	return append([]*youtube.Caption(nil), c.captions[videoID]...), nil
+}
+
+func (c *Client) ListCommentThreads(ctx context.Context, videoID string) ([]*youtube.CommentThread, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Comments++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	return append([]*youtube.CommentThread(nil), c.comments[videoID]...), nil
+}
+
+// ListActivities pages activities as ListPlaylistItems pages playlists.
+// Activities with no valid publish time are always included.
+func (c *Client) ListActivities(ctx context.Context, channelID string, after time.Time, pageToken string) (*youtube.ActivityListResponse, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.calls.Activities++
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var items []*youtube.Activity
+	for _, a := range c.activities[channelID] {
+		if t, err := time.Parse(time.RFC3339, a.Snippet.PublishedAt); err != nil || t.After(after) {
+			items = append(items, a)
+		}
+	}
+
+	start := 0
+	if pageToken != "" {
+		var err error
+		if start, err = strconv.Atoi(pageToken); err != nil {
+			return nil, ErrBadPageToken
+		}
+	}
+	if start > len(items) {
+		return nil, ErrBadPageToken
+	}
+	size := c.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	end := min(start+size, len(items))
+
+	r := &youtube.ActivityListResponse{
+		Items:    items[start:end],
+		PageInfo: &youtube.PageInfo{TotalResults: int64(len(items)), ResultsPerPage: int64(size)},
+	}
+	if end < len(items) {
+		r.NextPageToken = strconv.Itoa(end)
+	}
+	r.HTTPStatusCode = 200
+	return r, nil
+}
+
+func (c *Client) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Err
+}
@@ -0,0 +1,200 @@
+package ytartest
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the files kept next to the fake downloader script.
+const (
+	downloaderName  = "yt-dlp"
+	downloaderCalls = "calls"
+	downloaderFail  = "fail"
+	downloaderBlock = "blocked"
+	downloaderHang  = "hang"
+	downloaderEmpty = "empty"
+)
+
+// downloaderScript behaves enough like yt-dlp for the archiver: it answers
+// --version and --help (listing the options it accepts), prints progress and
+// writes a placeholder video (and its info, if asked) to the output path, or
+// only checks the video with --simulate. Videos listed in the fail file are
+// left half-downloaded, as if the downloader had been interrupted. Those in
+// the blocked file fail with the error given there, as unavailable videos do.
+// Those in the hang file are left half-downloaded until they are taken out
+// of it, or the downloader is interrupted, and those in the empty file are
+// "downloaded" into an empty file.
+const downloaderScript = `#!/bin/sh
+dir=$(dirname "$0")
+out=""; url=""; info=0; skip=0; thumb=0; simulate=0
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--version) echo "ytartest 1.0"; exit 0 ;;
+	--help)
+		echo "Usage: yt-dlp [OPTIONS] URL [URL...]"
+		for o in help version compat-options newline merge-output-format write-info-json \
+			embed-metadata embed-chapters embed-thumbnail ffmpeg-location downloader \
+			downloader-args proxy concurrent-fragments http-chunk-size limit-rate \
+			skip-download write-thumbnail write-subs simulate no-playlist; do
+			echo "    --$o"
+		done
+		exit 0 ;;
+	-o) shift; out="$1" ;;
+	--write-info-json) info=1 ;;
+	--skip-download) skip=1 ;;
+	--write-thumbnail) thumb=1 ;;
+	--simulate) simulate=1 ;;
+	--merge-output-format|--ffmpeg-location|--downloader|--downloader-args|--proxy|--concurrent-fragments|--http-chunk-size|--limit-rate) shift ;;
+	-*) ;;
+	*) url="$1" ;;
+	esac
+	shift
+done
+
+id=${url##*=}
+if [ $simulate = 1 ]; then
+	if grep -qxF "$id" "$dir/fail" 2>/dev/null; then
+		echo "ERROR: [youtube] $id: simulated failure" >&2
+		exit 1
+	fi
+	exit 0
+fi
+cid=$(basename "$(dirname "$out")")
+mkdir -p "$(dirname "$out")"
+echo "$id" >>"$dir/calls"
+
+msg=$(grep "^$id	" "$dir/blocked" 2>/dev/null | cut -f2-)
+if [ -n "$msg" ]; then
+	echo "ERROR: [youtube] $id: $msg" >&2
+	exit 1
+fi
+
+if grep -qxF "$id" "$dir/fail" 2>/dev/null; then
+	echo "[download]  50.0% of 1.00MiB at  1.00MiB/s ETA 00:01"
+	echo "partial $id" >"$out.mp4.part"
+	echo "ERROR: [youtube] $id: simulated failure" >&2
+	exit 1
+fi
+if grep -qxF "$id" "$dir/hang" 2>/dev/null; then
+	echo "[download]  50.0% of 1.00MiB at  1.00MiB/s ETA 00:01"
+	echo "partial $id" >"$out.mp4.part"
+	while grep -qxF "$id" "$dir/hang" 2>/dev/null; do
+		sleep 0.1
+	done
+	echo "ERROR: [youtube] $id: killed" >&2
+	exit 1
+fi
+if grep -qxF "$id" "$dir/empty" 2>/dev/null; then
+	: >"$out.mp4"
+	exit 0
+fi
+
+if [ $info = 1 ]; then
+	printf '{"id":"%s","channel_id":"%s","title":"%s","ext":"mp4"}\n' "$id" "$cid" "$id" >"$out.info.json"
+fi
+if [ $thumb = 1 ]; then
+	echo "thumbnail $id" >"$out.webp"
+fi
+if [ $skip = 0 ]; then
+	echo "[download]  50.0% of 1.00MiB at  1.00MiB/s ETA 00:01"
+	echo "[download] 100% of 1.00MiB in 00:01"
+	echo "video $id" >"$out.mp4"
+fi
+`
+
+// Downloader is a fake downloader script which records the videos it is
+// asked for.
+type Downloader struct {
+	// Path of the script, to be used as Config.Downloader.
+	Path string
+	dir  string
+}
+
+// NewDownloader writes a fake downloader into dir.
+func NewDownloader(dir string) (*Downloader, error) {
+	d := &Downloader{Path: filepath.Join(dir, downloaderName), dir: dir}
+	if err := os.WriteFile(d.Path, []byte(downloaderScript), 0755); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Fail makes every later download of the given videos fail, leaving a
+// partial file behind.
+func (d *Downloader) Fail(ids ...string) error {
+	return d.list(downloaderFail, ids)
+}
+
+// Hang makes every later download of the given videos stop halfway, so
+// that the archiver can be stopped, or its state inspected, mid-download.
+// They fail once healed, as if the downloader had been killed.
+func (d *Downloader) Hang(ids ...string) error {
+	return d.list(downloaderHang, ids)
+}
+
+// Empty makes every later download of the given videos succeed without
+// writing anything but an empty file, as a broken downloader might.
+func (d *Downloader) Empty(ids ...string) error {
+	return d.list(downloaderEmpty, ids)
+}
+
+// list appends ids to the list file with the given name.
+func (d *Downloader) list(name string, ids []string) error {
+	f, err := os.OpenFile(filepath.Join(d.dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(strings.Join(ids, "\n") + "\n")
+	return err
+}
+
+// Block makes every later download of the video id fail with the error
+// msg, such as "Video unavailable. This video is private".
+func (d *Downloader) Block(id, msg string) error {
+	f, err := os.OpenFile(filepath.Join(d.dir, downloaderBlock), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(id + "\t" + msg + "\n")
+	return err
+}
+
+// Heal undoes all previous calls to Fail, Block, Hang and Empty. Downloads
+// left hanging fail.
+func (d *Downloader) Heal() error {
+	for _, name := range []string{downloaderFail, downloaderBlock, downloaderHang, downloaderEmpty} {
+		err := os.Remove(filepath.Join(d.dir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls returns the IDs of the videos the downloader has been run for, in
+// the order in which the runs started.
+func (d *Downloader) Calls() ([]string, error) {
+	f, err := os.Open(filepath.Join(d.dir, downloaderCalls))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		ids = append(ids, sc.Text())
+	}
+	return ids, sc.Err()
+}
@@ -0,0 +1,202 @@
+package ytartest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/ejv2/yt-archiver/internal/fakeyt"
+	"google.golang.org/api/youtube/v3"
+)
+
+// APIServer serves the parts of the YouTube Data API used by the archiver
+// over HTTP from a fake client, so that the real API client can be tested
+// by setting Config.APIEndpoint to URL.
+type APIServer struct {
+	*httptest.Server
+	Client *fakeyt.Client
+}
+
+// NewAPIServer starts a server backed by cl. It must be closed when done.
+func NewAPIServer(cl *fakeyt.Client) *APIServer {
+	s := &APIServer{Client: cl}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /youtube/v3/channels", s.channels)
+	mux.HandleFunc("GET /youtube/v3/playlistItems", s.playlistItems)
+	mux.HandleFunc("GET /youtube/v3/videos", s.videos)
+	mux.HandleFunc("GET /youtube/v3/videoCategories", s.videoCategories)
+	mux.HandleFunc("GET /youtube/v3/captions", s.captions)
+	mux.HandleFunc("GET /youtube/v3/activities", s.activities)
+	mux.HandleFunc("GET /youtube/v3/commentThreads", s.commentThreads)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *APIServer) channels(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var ids []string
+	for _, id := range q["id"] {
+		ids = append(ids, strings.Split(id, ",")...)
+	}
+	if len(ids) > 1 {
+		chans, err := s.Client.ListChannels(r.Context(), ids)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, youtube.ChannelListResponse{Kind: "youtube#channelListResponse", Items: chans})
+		return
+	}
+
+	ch := ytarchiver.YouTubeChannel{
+		ID:       q.Get("id"),
+		Handle:   q.Get("forHandle"),
+		Username: q.Get("forUsername"),
+	}
+
+	c, err := s.Client.ListChannel(r.Context(), ch)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := youtube.ChannelListResponse{Kind: "youtube#channelListResponse"}
+	if c != nil {
+		resp.Items = append(resp.Items, c)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *APIServer) playlistItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	resp, err := s.Client.ListPlaylistItems(r.Context(), q.Get("playlistId"), q.Get("pageToken"))
+	if errors.Is(err, fakeyt.ErrBadPageToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp.Kind = "youtube#playlistItemListResponse"
+	writeJSON(w, resp)
+}
+
+func (s *APIServer) videos(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// The client may send the IDs either as repeated parameters or joined
+	// by commas.
+	var ids []string
+	for _, id := range q["id"] {
+		ids = append(ids, strings.Split(id, ",")...)
+	}
+
+	vids, err := s.Client.ListVideos(r.Context(), strings.Split(q.Get("part"), ","), ids)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, youtube.VideoListResponse{Kind: "youtube#videoListResponse", Items: vids})
+}
+
+func (s *APIServer) videoCategories(w http.ResponseWriter, r *http.Request) {
+	cats, err := s.Client.ListVideoCategories(r.Context(), r.URL.Query().Get("regionCode"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, youtube.VideoCategoryListResponse{Kind: "youtube#videoCategoryListResponse", Items: cats})
+}
+
+func (s *APIServer) captions(w http.ResponseWriter, r *http.Request) {
+	caps, err := s.Client.ListCaptions(r.Context(), r.URL.Query().Get("videoId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, youtube.CaptionListResponse{Kind: "youtube#captionListResponse", Items: caps})
+}
+
+func (s *APIServer) activities(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	after, err := time.Parse(time.RFC3339, q.Get("publishedAfter"))
+	if err != nil && q.Get("publishedAfter") != "" {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.Client.ListActivities(r.Context(), q.Get("channelId"), after, q.Get("pageToken"))
+	if errors.Is(err, fakeyt.ErrBadPageToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp.Kind = "youtube#activityListResponse"
+	writeJSON(w, resp)
+}
+
+func (s *APIServer) commentThreads(w http.ResponseWriter, r *http.Request) {
+	threads, err := s.Client.ListCommentThreads(r.Context(), r.URL.Query().Get("videoId"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, youtube.CommentThreadListResponse{Kind: "youtube#commentThreadListResponse", Items: threads})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with a Google API error for err. Quota errors from the
+// fake are reported as such, so that the archiver's quota handling can be
+// exercised over HTTP.
+func writeError(w http.ResponseWriter, err error) {
+	code, reason := http.StatusInternalServerError, "backendError"
+	switch {
+	case errors.Is(err, ytarchiver.ErrQuotaExceeded):
+		code, reason = http.StatusForbidden, "quotaExceeded"
+	case errors.Is(err, ytarchiver.ErrChannelNotIdentified):
+		code, reason = http.StatusBadRequest, "missingRequiredParameter"
+	case errors.Is(err, context.Canceled):
+		code, reason = http.StatusServiceUnavailable, "backendError"
+	}
+
+	type item struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Errors  []item `json:"errors"`
+		} `json:"error"`
+	}
+	body.Error.Code = code
+	body.Error.Message = err.Error()
+	body.Error.Errors = []item{{reason, err.Error()}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
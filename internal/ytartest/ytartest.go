@@ -0,0 +1,115 @@
+// Package ytartest provides fixtures for end-to-end tests of the archiver and
+// its daemon which need no network access: a fake API server, a fake
+// downloader and a fresh archive root.
+package ytartest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/ejv2/yt-archiver/internal/fakeyt"
+)
+
+// APIKey is the key passed to the fake API server, which ignores it.
+const APIKey = "ytartest"
+
+// Env is a self-contained archiving environment. Everything in it is
+// cleaned up when the test which created it completes.
+type Env struct {
+	// Archive root, already initialised at the current layout version.
+	Root string
+	// Fake API data, served over HTTP by Server.
+	API        *fakeyt.Client
+	Server     *APIServer
+	Downloader *Downloader
+}
+
+// New creates a new environment for t.
+func New(t testing.TB) *Env {
+	t.Helper()
+
+	e := &Env{
+		Root: NewRoot(t),
+		API:  fakeyt.New(),
+	}
+	e.Server = NewAPIServer(e.API)
+	t.Cleanup(e.Server.Close)
+
+	var err error
+	if e.Downloader, err = NewDownloader(t.TempDir()); err != nil {
+		t.Fatalf("ytartest: %v", err)
+	}
+
+	return e
+}
+
+// NewRoot returns an empty archive root for t at the current layout version.
+func NewRoot(t testing.TB) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := ytarchiver.Migrate(root, nil); err != nil {
+		t.Fatalf("ytartest: %v", err)
+	}
+
+	return root
+}
+
+// Config returns an archiver configuration for the environment, archiving
+// the given channels. Requests are made over HTTP to the fake API server.
+func (e *Env) Config(chans ...ytarchiver.YouTubeChannel) ytarchiver.Config {
+	cfg := ytarchiver.DefaultConfig(APIKey)
+	cfg.Root = e.Root
+	cfg.APIEndpoint = e.Server.URL + "/"
+	cfg.Downloader = e.Downloader.Path
+	cfg.Channels = chans
+	cfg.MaxRetries = 1
+
+	return cfg
+}
+
+// WriteDaemonConfig writes a daemon configuration file for the environment
+// into dir and returns its path. The settings in extra are added to, or
+// override, those needed to use the environment.
+func (e *Env) WriteDaemonConfig(dir string, extra map[string]any) (string, error) {
+	conf := map[string]any{
+		"root":         e.Root,
+		"api_key":      APIKey,
+		"api_endpoint": e.Server.URL + "/",
+		"downloader":   e.Downloader.Path,
+		"max_retries":  1,
+		"interval":     "1h",
+	}
+	for k, v := range extra {
+		conf[k] = v
+	}
+
+	dat, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "ytarchive.json")
+	return path, os.WriteFile(path, dat, 0644)
+}
+
+// Videos returns the IDs of the videos downloaded into the environment's
+// archive for the channel with the given ID.
+func (e *Env) Videos(channelID string) ([]string, error) {
+	ents, err := os.ReadDir(filepath.Join(e.Root, channelID))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, ent := range ents {
+		if id, ok := strings.CutSuffix(ent.Name(), ".mp4"); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,168 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestName is the name of the manifest file in the archive root.
+const ManifestName = "ytarchiver.json"
+
+var ErrLayoutOutdated = errors.New("archive layout is outdated")
+
+// Manifest describes an archive root. It is stored as JSON in the root under
+// ManifestName.
+type Manifest struct {
+	// Version of the on-disk layout of the archive.
+	LayoutVersion int `json:"layout_version"`
+	// When the archive was first created, or first recorded in a
+	// manifest for older archives.
+	Created time.Time `json:"created"`
+	// When the manifest was last changed (e.g by a migration).
+	Updated time.Time `json:"updated"`
+}
+
+// ReadManifest reads the manifest of the archive at root.
+//
+// Archives from before manifests were introduced are reported using their
+// layout marker, if they have one, or otherwise as layout version 1. This
+// does not write anything to root.
+func ReadManifest(root string) (Manifest, error) {
+	return readManifest(osReader(root))
+}
+
+func readManifest(read readFunc) (Manifest, error) {
+	var m Manifest
+
+	dat, err := read(ManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		m.LayoutVersion, err = readLayoutMarker(read)
+		return m, err
+	}
+	if err != nil {
+		return m, fmt.Errorf("read manifest: %w", err)
+	}
+
+	if err = json.Unmarshal(dat, &m); err != nil {
+		return m, fmt.Errorf("read manifest: %w", err)
+	}
+	if m.LayoutVersion < 1 {
+		return m, fmt.Errorf("read manifest: %w %d", ErrLayoutVersion, m.LayoutVersion)
+	}
+
+	return m, nil
+}
+
+// writeManifest atomically replaces the manifest of the archive at root.
+func writeManifest(root string, m Manifest) error {
+	now := time.Now()
+	if m.Created.IsZero() {
+		m.Created = now
+	}
+	m.Updated = now
+
+	dat, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	path := filepath.Join(root, ManifestName)
+	if err = os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	// The manifest supersedes the layout marker.
+	os.Remove(filepath.Join(root, rootMarkerName))
+	return nil
+}
+
+// readLayoutMarker returns the layout version recorded in the layout marker
+// of the root read by read, or 1 if there is no marker.
+func readLayoutMarker(read readFunc) (int, error) {
+	dat, err := read(rootMarkerName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read layout marker: %w", err)
+	}
+
+	ver, err := strconv.Atoi(strings.TrimSpace(string(dat)))
+	if err != nil {
+		return 0, fmt.Errorf("read layout marker: %w: %q", ErrLayoutVersion, dat)
+	}
+
+	return ver, nil
+}
+
+// A migration upgrades an archive by a single layout version.
+//
+// Migrations must be safe to run again if interrupted part-way through, as
+// the manifest is only updated once a migration has completed.
+type migration struct {
+	Description string
+	Run         func(root string) error
+}
+
+// migrations[i] upgrades an archive from layout version i+1 to i+2.
+// Appending a migration here must be accompanied by incrementing
+// LayoutVersion.
+var migrations = []migration{
+	{"write normalized metadata for each video", migrateVideoMeta},
+}
+
+// Migrate upgrades the archive at root to LayoutVersion one version at a
+// time, recording progress in the manifest after each step so that an
+// interrupted migration resumes where it left off. If step is non-nil, it is
+// called before each migration is run.
+//
+// The archiver must not be running on root during migration.
+func Migrate(root string, step func(from, to int, desc string)) error {
+	if len(migrations) != LayoutVersion-1 {
+		panic("migrate: LayoutVersion does not match registered migrations")
+	}
+
+	m, err := ReadManifest(root)
+	if err != nil {
+		return err
+	}
+	if m.LayoutVersion > LayoutVersion {
+		return fmt.Errorf("migrate: %w %d (this version supports up to %d)", ErrLayoutVersion, m.LayoutVersion, LayoutVersion)
+	}
+	if entries, err := os.ReadDir(root); err == nil && isNewRoot(entries) {
+		m.LayoutVersion = LayoutVersion
+	}
+
+	for m.LayoutVersion < LayoutVersion {
+		mg := migrations[m.LayoutVersion-1]
+		if step != nil {
+			step(m.LayoutVersion, m.LayoutVersion+1, mg.Description)
+		}
+
+		if err := mg.Run(root); err != nil {
+			return fmt.Errorf("migrate to layout %d: %w", m.LayoutVersion+1, err)
+		}
+
+		m.LayoutVersion++
+		if err := writeManifest(root, m); err != nil {
+			return err
+		}
+	}
+
+	// Ensure a manifest exists even if nothing needed doing.
+	if _, err := os.Stat(filepath.Join(root, ManifestName)); err != nil {
+		return writeManifest(root, m)
+	}
+
+	return nil
+}
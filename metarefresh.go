@@ -0,0 +1,304 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VideoHistorySuffix is appended to a video ID to form the name of the file
+// recording changes to its metadata.
+const VideoHistorySuffix = ".history.json"
+
+// refreshParts are the parts requested when refreshing video metadata.
+var refreshParts = []string{"snippet", "statistics"}
+
+// A VideoChange records a change to the metadata of an archived video, as
+// observed by RefreshMetadata. The history file of a video is a JSON array
+// of changes, oldest first.
+type VideoChange struct {
+	// When the change was observed (not when it was made).
+	Time time.Time `json:"time"`
+	// Name of the VideoMeta field which changed, as in its JSON encoding.
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ReadVideoHistory reads the history of the video id in the channel
+// directory dir. A video without any recorded changes has no history.
+func ReadVideoHistory(dir, id string) ([]VideoChange, error) {
+	var hist []VideoChange
+
+	dat, err := os.ReadFile(filepath.Join(dir, id+VideoHistorySuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read video history: %w", err)
+	}
+	if err = json.Unmarshal(dat, &hist); err != nil {
+		return nil, fmt.Errorf("read video history %s: %w", id, err)
+	}
+
+	return hist, nil
+}
+
+// ReadChannelHistory reads the history of each video in the channel
+// directory dir which has any recorded changes, by video ID.
+func ReadChannelHistory(dir string) (map[string][]VideoChange, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read video history: %w", err)
+	}
+
+	hists := make(map[string][]VideoChange)
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), VideoHistorySuffix)
+		if !ok {
+			continue
+		}
+		if hists[id], err = ReadVideoHistory(dir, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return hists, nil
+}
+
+// A MetadataChange is a change to the metadata of an archived video of a
+// channel, as reported to notifiers.
+type MetadataChange struct {
+	ChannelID string `json:"channel_id"`
+	VideoID   string `json:"video_id"`
+	VideoChange
+}
+
+// appendVideoHistory appends changes to the history of the video id in the
+// channel directory dir.
+func appendVideoHistory(dir, id string, changes []VideoChange) error {
+	hist, err := ReadVideoHistory(dir, id)
+	if err != nil {
+		return err
+	}
+	hist = append(hist, changes...)
+
+	dat, err := json.MarshalIndent(hist, "", "\t")
+	if err != nil {
+		return fmt.Errorf("write video history: %w", err)
+	}
+
+	path := filepath.Join(dir, id+VideoHistorySuffix)
+	if err = os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		return fmt.Errorf("write video history: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("write video history: %w", err)
+	}
+
+	return nil
+}
+
+// RefreshMetadata re-fetches the title, description and view count of each
+// archived video of the configured channels whose metadata was last
+// refreshed longer than Config.MetadataRefreshAge ago, recording any changes
+// to the title or description in the history file of the video, and
+// telling notifiers of them with an EventMetadataChanged. Only videos with
+// metadata files (see Config.DumpVideoInfo) are refreshed.
+//
+// As with archive runs, RefreshMetadata waits for any run in progress and
+// fails immediately with ErrQuotaExceeded while the quota is exhausted.
+func (a *Archiver) RefreshMetadata() error {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	if now := time.Now(); now.Before(a.quotaReset) {
+		return fmt.Errorf("%w: waiting until %v", ErrQuotaExceeded, a.quotaReset.Format(time.RFC1123))
+	}
+
+	var err ArchiveError
+	var changes []MetadataChange
+	for _, ch := range a.Channels {
+		chc, ok := a.cachedChannel(ch.Identity())
+		if !ok {
+			continue
+		}
+
+		cerr := channelError{ChannelID: chc.ID}
+		if e := a.refreshChannelMetadata(chc.ID, &changes); e != nil {
+			cerr.Add(e)
+			err = append(err, cerr)
+		}
+
+		if errors.Is(cerr, ErrQuotaExceeded) {
+			a.quotaReset = QuotaReset(time.Now())
+			break
+		}
+	}
+	// Changes found before any error are still reported.
+	if len(changes) > 0 {
+		a.notifyChanges(changes)
+	}
+
+	if len(err) == 0 {
+		return nil
+	}
+	return err
+}
+
+// refreshChannelMetadata refreshes the stale metadata of the videos in the
+// directory of the channel cid, appending any changes to changes.
+func (a *Archiver) refreshChannelMetadata(cid string, changes *[]MetadataChange) error {
+	age := a.MetadataRefreshAge
+	if age == 0 {
+		age = defaultMetadataRefreshAge
+	}
+
+	dir := filepath.Join(a.Root, cid)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("refresh metadata: %w", err)
+	}
+
+	stale := make(map[string]VideoMeta)
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), VideoMetaSuffix)
+		if !ok {
+			continue
+		}
+
+		vm, err := ReadVideoMeta(dir, id)
+		if err != nil {
+			return fmt.Errorf("refresh metadata: %w", err)
+		}
+		if time.Since(vm.RefreshedAt) > age {
+			stale[id] = vm
+		}
+	}
+
+	ids := make([]string, 0, len(stale))
+	for id := range stale {
+		ids = append(ids, id)
+	}
+
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), videoBatchSize)]
+		ids = ids[len(batch):]
+
+		vids, err := a.client.ListVideos(a.ctx, refreshParts, batch)
+		if err != nil {
+			return fmt.Errorf("refresh metadata: list videos: %w", err)
+		}
+
+		now := time.Now()
+		for _, v := range vids {
+			vm, ok := stale[v.Id]
+			if !ok {
+				continue
+			}
+
+			var vchanges []VideoChange
+			if v.Snippet.Title != vm.Title {
+				vchanges = append(vchanges, VideoChange{now, "title", vm.Title, v.Snippet.Title})
+				vm.Title = v.Snippet.Title
+			}
+			if v.Snippet.Description != vm.Description {
+				vchanges = append(vchanges, VideoChange{now, "description", vm.Description, v.Snippet.Description})
+				vm.Description = v.Snippet.Description
+			}
+			if v.Statistics != nil {
+				vm.Views = v.Statistics.ViewCount
+			}
+			if v.Snippet.Tags != nil {
+				vm.Tags = v.Snippet.Tags
+			}
+			vm.RefreshedAt = now
+
+			if len(vchanges) > 0 {
+				if err := appendVideoHistory(dir, v.Id, vchanges); err != nil {
+					return err
+				}
+			}
+			for _, c := range vchanges {
+				*changes = append(*changes, MetadataChange{ChannelID: cid, VideoID: v.Id, VideoChange: c})
+			}
+			if err := saveVideoMeta(dir, vm); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// notifyChanges tells notifiers of the changes found by a metadata refresh,
+// with a line diff of each.
+func (a *Archiver) notifyChanges(changes []MetadataChange) {
+	videos := make(map[string]bool)
+	msg := &strings.Builder{}
+	for _, c := range changes {
+		videos[c.VideoID] = true
+		fmt.Fprintf(msg, "%s of %s%s (channel %s) changed:\n%s\n", c.Field, youtubeWatchURL, c.VideoID, c.ChannelID, LineDiff(c.Old, c.New))
+	}
+
+	a.notify(Event{
+		Kind:    EventMetadataChanged,
+		Title:   fmt.Sprintf("Metadata of %d archived video(s) changed", len(videos)),
+		Message: strings.TrimSuffix(msg.String(), "\n"),
+		Changes: changes,
+	})
+}
+
+// LineDiff returns the lines removed from old, prefixed with "-", and those
+// added in new, prefixed with "+", around the lines they have in common,
+// prefixed with a space.
+func LineDiff(old, new string) string {
+	lines := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "\n")
+	}
+	a, b := lines(old), lines(new)
+
+	// Length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := &strings.Builder{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(diff, "  %s\n", a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(diff, "- %s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(diff, "+ %s\n", b[j])
+			j++
+		}
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,219 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// postNotification sends req, failing on any unsuccessful status.
+func postNotification(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotify, err)
+	}
+	resp.Body.Close()
+
+	if isHTTPError(resp.StatusCode) {
+		return fmt.Errorf("%w: %s: http status %d", ErrNotify, req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPNotifier sends events by email.
+type SMTPNotifier struct {
+	// Address of the SMTP server (host:port). The connection is upgraded
+	// with STARTTLS if the server supports it.
+	Addr string
+	// Credentials for PLAIN authentication. No authentication is
+	// attempted if Username is empty.
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (n SMTPNotifier) Notify(ctx context.Context, ev Event) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, _ := strings.Cut(n.Addr, ":")
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(msg, "Subject: [ytarchiver] %s\r\n", ev.Title)
+	fmt.Fprintf(msg, "Date: %s\r\n", ev.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	body := strings.ReplaceAll(ev.Message, "\n", "\r\n")
+	if ev.HTML == "" {
+		fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(body)
+	} else {
+		// Clients unable to show the HTML fall back to the text.
+		mw := multipart.NewWriter(msg)
+		fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+		fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+		if err == nil {
+			io.WriteString(w, body)
+			// Lines of HTML may be longer than SMTP allows.
+			w, err = mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {"text/html; charset=utf-8"},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("%w: email: %v", ErrNotify, err)
+		}
+		qw := quotedprintable.NewWriter(w)
+		io.WriteString(qw, ev.HTML)
+		qw.Close()
+		mw.Close()
+	}
+
+	// net/smtp has no support for contexts.
+	if err := smtp.SendMail(n.Addr, auth, n.From, n.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("%w: email: %v", ErrNotify, err)
+	}
+	return nil
+}
+
+// TelegramNotifier sends events as messages from a Telegram bot.
+type TelegramNotifier struct {
+	// Bot token, as issued by @BotFather.
+	Token string
+	// Chat to message. The bot must be a member of the chat.
+	ChatID string
+}
+
+func (n TelegramNotifier) Notify(ctx context.Context, ev Event) error {
+	form := url.Values{
+		"chat_id": {n.ChatID},
+		"text":    {ev.Title + "\n\n" + ev.Message},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://api.telegram.org/bot"+n.Token+"/sendMessage", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: telegram: %v", ErrNotify, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return postNotification(req)
+}
+
+// NtfyNotifier publishes events to an ntfy topic.
+type NtfyNotifier struct {
+	// URL of the topic, e.g "https://ntfy.sh/mytopic".
+	URL string
+	// Access token, for protected topics.
+	Token string
+}
+
+func (n NtfyNotifier) Notify(ctx context.Context, ev Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(ev.Message))
+	if err != nil {
+		return fmt.Errorf("%w: ntfy: %v", ErrNotify, err)
+	}
+	req.Header.Set("Title", ev.Title)
+	if ev.Failure {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return postNotification(req)
+}
+
+// GotifyNotifier sends events to a Gotify server.
+type GotifyNotifier struct {
+	// Base URL of the server, e.g "https://gotify.example.com".
+	URL string
+	// Application token.
+	Token string
+}
+
+func (n GotifyNotifier) Notify(ctx context.Context, ev Event) error {
+	prio := 4
+	if ev.Failure {
+		prio = 8
+	}
+
+	dat, err := json.Marshal(map[string]any{
+		"title":    ev.Title,
+		"message":  ev.Message,
+		"priority": prio,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: gotify: %v", ErrNotify, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(n.URL, "/")+"/message", bytes.NewReader(dat))
+	if err != nil {
+		return fmt.Errorf("%w: gotify: %v", ErrNotify, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", n.Token)
+
+	return postNotification(req)
+}
+
+// WebhookNotifier posts each event as JSON to a URL, including the outcome
+// of every new video at the end of each run, for consumption by other
+// automation.
+type WebhookNotifier struct {
+	URL string
+	// Sent as a bearer token, if set.
+	Token string
+}
+
+// webhookPayload is the body posted by WebhookNotifier.
+type webhookPayload struct {
+	Kind    string           `json:"kind"`
+	Time    time.Time        `json:"time"`
+	Title   string           `json:"title"`
+	Message string           `json:"message"`
+	Failure bool             `json:"failure"`
+	Summary *ArchiveSummary  `json:"summary,omitempty"`
+	Changes []MetadataChange `json:"changes,omitempty"`
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, ev Event) error {
+	dat, err := json.Marshal(webhookPayload{
+		Kind:    eventKindNames[ev.Kind],
+		Time:    ev.Time,
+		Title:   ev.Title,
+		Message: ev.Message,
+		Failure: ev.Failure,
+		Summary: ev.Summary,
+		Changes: ev.Changes,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: webhook: %v", ErrNotify, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(dat))
+	if err != nil {
+		return fmt.Errorf("%w: webhook: %v", ErrNotify, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return postNotification(req)
+}
@@ -0,0 +1,183 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event kinds reported to notifiers.
+const (
+	// An archive run completed, successfully or otherwise.
+	EventRunComplete = iota
+	// More videos than Config.NotifyFailureThreshold failed to download
+	// during a run.
+	EventVideoFailures
+	// Free space in the archive root fell below Config.MinFreeSpace.
+	EventLowDiskSpace
+	// A channel failed too many runs in a row, and so will be skipped for
+	// Config.ChannelCooldown.
+	EventChannelSuspended
+	// The downloader failed to extract Config.CanaryVideo, and so is most
+	// likely broken for every video.
+	EventDownloaderBroken
+	// The downloader passed the canary check again after it had failed.
+	EventDownloaderRecovered
+	// An archive completeness report was made (see NewReport).
+	EventReport
+	// A digest of the videos archived since the last, sent to
+	// Config.DigestNotifiers every Config.DigestInterval.
+	EventDigest
+	// A metadata refresh found that the title or description of archived
+	// videos changed.
+	EventMetadataChanged
+)
+
+// notifyTimeout bounds the time spent delivering each notification.
+const notifyTimeout = 30 * time.Second
+
+var ErrNotify = errors.New("notification failed")
+
+// An Event is something which happened in the archiver which the user may
+// wish to be notified of.
+type Event struct {
+	// One of the Event* kind constants.
+	Kind int
+	Time time.Time
+	// Short summary of the event, suitable as a subject line.
+	Title string
+	// Full description of the event.
+	Message string
+	// Set if the event reports a problem.
+	Failure bool
+	// Outcome of each new video, for EventRunComplete only.
+	Summary *ArchiveSummary
+	// Each change, for EventMetadataChanged only.
+	Changes []MetadataChange
+	// Optional HTML rendering of Message, for notifiers which can show it.
+	HTML string
+}
+
+// eventKindNames are the names of each event kind in machine-readable
+// payloads.
+var eventKindNames = map[int]string{
+	EventRunComplete:         "run_complete",
+	EventVideoFailures:       "video_failures",
+	EventLowDiskSpace:        "low_disk_space",
+	EventChannelSuspended:    "channel_suspended",
+	EventDownloaderBroken:    "downloader_broken",
+	EventDownloaderRecovered: "downloader_recovered",
+	EventReport:              "report",
+	EventDigest:              "digest",
+	EventMetadataChanged:     "metadata_changed",
+}
+
+// A Notifier delivers events to the user, such as by email or a push
+// notification service.
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// notify delivers ev to every configured notifier. Failing to notify is
+// never fatal to the archiver, so errors are only printed.
+func (a *Archiver) notify(ev Event) {
+	if err := Notify(a.ctx, a.Notifiers, ev); err != nil {
+		fmt.Printf("notify: %v\n", err)
+	}
+}
+
+// Notify delivers ev to each of notifiers, stamped with the current time.
+// Every notifier is tried, and the errors of those which failed are joined.
+func Notify(ctx context.Context, notifiers []Notifier, ev Event) error {
+	ev.Time = time.Now()
+	var errs []error
+	for _, n := range notifiers {
+		nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		errs = append(errs, n.Notify(nctx, ev))
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// videoFailures returns the number of videos which failed to download in
+// the run which produced err.
+func videoFailures(err ArchiveError) int {
+	n := 0
+	for _, cerr := range err {
+		for _, e := range cerr.Errors {
+			if errors.Is(e, ErrYoutubeDownloader) || errors.Is(e, ErrVideo) {
+				n++
+			}
+		}
+	}
+
+	return n
+}
+
+// runSummary describes a run over chans which started at start and
+// produced err.
+func runSummary(start time.Time, chans []YouTubeChannel, err ArchiveError) string {
+	msg := fmt.Sprintf("Archived %d channel(s) in %v.", len(chans), time.Since(start).Round(time.Second))
+	if len(err) != 0 {
+		msg += "\n\n" + err.Error()
+	}
+
+	return msg
+}
+
+// notifyRun delivers the notifications due at the end of a run over chans
+// which started at start and produced err. runMut must be held.
+func (a *Archiver) notifyRun(start time.Time, chans []YouTubeChannel, err ArchiveError) {
+	summary := runSummary(start, chans, err)
+	if len(err) != 0 {
+		a.pingHealthcheck("/fail", summary)
+	} else {
+		a.pingHealthcheck("", summary)
+	}
+
+	if len(a.Notifiers) == 0 {
+		return
+	}
+
+	ev := Event{
+		Kind:    EventRunComplete,
+		Title:   "Archive run complete",
+		Message: summary,
+		Summary: &ArchiveSummary{
+			Start:    start,
+			End:      time.Now(),
+			Channels: len(chans),
+			Videos:   a.outcomes.videos,
+		},
+	}
+	if len(err) != 0 {
+		ev.Title = "Archive run failed"
+		ev.Failure = true
+	}
+	a.notify(ev)
+
+	if n := videoFailures(err); n > 0 && uint(n) > a.NotifyFailureThreshold {
+		a.notify(Event{
+			Kind:    EventVideoFailures,
+			Title:   fmt.Sprintf("%d video(s) failed to download", n),
+			Message: fmt.Sprintf("%d video(s) failed to download during the last archive run (threshold %d).", n, a.NotifyFailureThreshold),
+			Failure: true,
+		})
+	}
+
+	if a.MinFreeSpace == 0 {
+		return
+	}
+	free, ferr := diskFree(a.Root)
+	if ferr != nil {
+		fmt.Printf("notify: checking free space: %v\n", ferr)
+	} else if free < a.MinFreeSpace {
+		a.notify(Event{
+			Kind:    EventLowDiskSpace,
+			Title:   "Archive disk space low",
+			Message: fmt.Sprintf("Only %d MiB free in %s (warning below %d MiB).", free>>20, a.Root, a.MinFreeSpace>>20),
+			Failure: true,
+		})
+	}
+}
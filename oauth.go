@@ -0,0 +1,157 @@
+package ytarchiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"google.golang.org/api/youtube/v3"
+)
+
+// oauthTokenFile is the file within StateDir holding the OAuth token of the
+// root. It is not named as a state file, so that the token is left out of
+// state backups.
+const oauthTokenFile = "oauth.token"
+
+// Playlists private to the user authorised with OAuth, which are archived
+// by giving their URLs (e.g "https://www.youtube.com/playlist?list=LL").
+const (
+	LikedPlaylist      = "LL"
+	WatchLaterPlaylist = "WL"
+)
+
+var (
+	ErrOAuth         = errors.New("ytarchiver: oauth")
+	ErrOAuthRequired = errors.New("ytarchiver: oauth is required to archive liked videos or watch later (set an OAuth client and log in)")
+)
+
+// isPrivatePlaylist reports if id is one of the playlists private to the
+// user authorised with OAuth.
+func isPrivatePlaylist(id string) bool {
+	return id == LikedPlaylist || id == WatchLaterPlaylist
+}
+
+// oauthConfig returns the OAuth client configured by cfg, with read-only
+// access to the user's account.
+func oauthConfig(cfg Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.OAuthClientID,
+		ClientSecret: cfg.OAuthClientSecret,
+		Endpoint:     endpoints.Google,
+		Scopes:       []string{youtube.YoutubeReadonlyScope},
+	}
+}
+
+// OAuthLogin authorises the archiver at cfg.Root to read the account of a
+// user by the OAuth device flow: prompt is given a URL and a code to enter
+// there, after which OAuthLogin waits for the user to grant access and
+// keeps the token in the root. The OAuth client must be of the "TVs and
+// Limited Input devices" type.
+func OAuthLogin(ctx context.Context, cfg Config, prompt func(url, code string)) error {
+	if cfg.OAuthClientID == "" {
+		return fmt.Errorf("%w: no client configured", ErrOAuth)
+	}
+
+	oc := oauthConfig(cfg)
+	da, err := oc.DeviceAuth(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	prompt(da.VerificationURI, da.UserCode)
+
+	tok, err := oc.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	if err := saveOAuthToken(cfg.Root, tok); err != nil {
+		return err
+	}
+	// The user may have logged in to another account.
+	newAPICache(cfg.Root, 0).Forget(channelCacheKey(YouTubeChannel{Mine: true}))
+
+	return nil
+}
+
+// loadOAuthToken reads the OAuth token of the root.
+func loadOAuthToken(root string) (*oauth2.Token, error) {
+	dat, err := os.ReadFile(filepath.Join(root, StateDir, oauthTokenFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: not logged in (run oauth-login)", ErrOAuth)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(dat, tok); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	return tok, nil
+}
+
+// saveOAuthToken replaces the OAuth token of the root, readable only by its
+// owner.
+func saveOAuthToken(root string, tok *oauth2.Token) error {
+	dat, err := json.Marshal(tok)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+
+	dir := filepath.Join(root, StateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	path := filepath.Join(dir, oauthTokenFile)
+	if err := os.WriteFile(path+".tmp", dat, 0600); err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("%w: %v", ErrOAuth, err)
+	}
+	return nil
+}
+
+// savingTokenSource keeps each token refreshed by src in the root, so that
+// the refresh token survives restarts even if it is rotated.
+type savingTokenSource struct {
+	src  oauth2.TokenSource
+	root string
+
+	mut  sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		if err := saveOAuthToken(s.root, tok); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return tok, nil
+}
+
+// oauthTokenSource returns the source of tokens for the OAuth client
+// configured by cfg, starting from the token kept in the root.
+func oauthTokenSource(ctx context.Context, cfg Config) (oauth2.TokenSource, error) {
+	tok, err := loadOAuthToken(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	src := oauthConfig(cfg).TokenSource(ctx, tok)
+	return &savingTokenSource{src: src, root: cfg.Root, last: tok.AccessToken}, nil
+}
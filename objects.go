@@ -0,0 +1,317 @@
+package ytarchiver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ObjectsDir is the directory within the archive root holding the media
+// files of a content-addressed archive (see Config.ContentAddressed). Each
+// is named by the SHA-256 hash of its contents, under a directory named by
+// the first two digits of the hash.
+const ObjectsDir = "objects"
+
+var ErrObjectCorrupt = errors.New("object does not match its hash")
+
+// hashFile returns the hex SHA-256 hash of the contents of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// objectPath returns the path in the archive at root of the object with the
+// given hash.
+func objectPath(root, hash string) string {
+	return filepath.Join(root, ObjectsDir, hash[:2], hash)
+}
+
+// storeObject moves the file at path, within the archive at root, into the
+// object store, leaving a relative symlink to the object in its place. If
+// the store already holds a file with the same contents, the file is
+// replaced by a link to it instead. The file is never missing from path,
+// even if interrupted. Files which are already links are left alone.
+func storeObject(root, path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	obj := objectPath(root, hash)
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return err
+	}
+
+	if ofi, err := os.Stat(obj); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Link(path, obj); err != nil {
+			// Not on the same filesystem, perhaps.
+			if err := copyPath(path, obj+".tmp"); err != nil {
+				os.Remove(obj + ".tmp")
+				return err
+			}
+			if err := os.Rename(obj+".tmp", obj); err != nil {
+				return err
+			}
+		}
+		// Objects are immutable; changing one would change all of
+		// the views of it.
+		if err := os.Chmod(obj, 0444); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if ofi.Size() != fi.Size() {
+		return fmt.Errorf("%w: %s", ErrObjectCorrupt, obj)
+	}
+
+	target, err := filepath.Rel(filepath.Dir(path), obj)
+	if err != nil {
+		return err
+	}
+	os.Remove(path + ".tmp")
+	if err := os.Symlink(target, path+".tmp"); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// isChannelDir reports if the entry e of the archive root is a channel
+// directory, rather than a file or one of the directories of the archiver.
+func isChannelDir(e fs.DirEntry) bool {
+	return e.IsDir() && !strings.HasPrefix(e.Name(), ".") && e.Name() != ObjectsDir
+}
+
+// StoreObjects moves the media files of the archive at root which are not
+// yet in the object store into it, as is done for each new video if
+// Config.ContentAddressed is set. Identical files are stored once. If
+// progress is non-nil, it is called with the path of each file stored. It
+// returns the number of files stored.
+//
+// The archiver must not be running on root while its files are stored.
+func StoreObjects(root string, progress func(path string)) (int, error) {
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+
+		dir := filepath.Join(root, c.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return n, err
+		}
+		seen := make(map[string]bool)
+		for _, f := range files {
+			id, _, _ := strings.Cut(f.Name(), ".")
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			path, err := videoFile(dir, id)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			if fi, err := os.Lstat(path); err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+
+			if err := storeObject(root, path); err != nil {
+				return n, fmt.Errorf("store %s: %w", path, err)
+			}
+			if progress != nil {
+				progress(path)
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// An ObjectFault is a problem found with the object store by VerifyObjects.
+type ObjectFault struct {
+	// Path of the object or link, relative to the root.
+	Path string
+	Err  error
+}
+
+func (f ObjectFault) Error() string {
+	return f.Path + ": " + f.Err.Error()
+}
+
+// VerifyObjects checks that each object in the store of the archive at root
+// still matches its hash, and that each link to the store in its channel
+// directories refers to an object. It returns the number of objects
+// checked and the faults found.
+func VerifyObjects(root string) (int, []ObjectFault, error) {
+	var faults []ObjectFault
+	n := 0
+	err := walkObjects(root, func(path, hash string) error {
+		got, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if got != hash {
+			rel, _ := filepath.Rel(root, path)
+			faults = append(faults, ObjectFault{rel, ErrObjectCorrupt})
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, faults, err
+	}
+
+	err = walkViews(root, func(path, obj string) error {
+		if _, err := os.Stat(obj); err != nil {
+			rel, _ := filepath.Rel(root, path)
+			faults = append(faults, ObjectFault{rel, err})
+		}
+		return nil
+	})
+	return n, faults, err
+}
+
+// CollectObjects removes the objects in the store of the archive at root
+// which are no longer linked to from any channel directory. It returns the
+// number of objects removed and the space freed in bytes.
+//
+// The archiver must not be running on root while objects are collected.
+func CollectObjects(root string) (int, uint64, error) {
+	linked := make(map[string]bool)
+	err := walkViews(root, func(_, obj string) error {
+		linked[filepath.Base(obj)] = true
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n, freed := 0, uint64(0)
+	err = walkObjects(root, func(path, hash string) error {
+		if linked[hash] {
+			return nil
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		n++
+		freed += uint64(fi.Size())
+		return nil
+	})
+	return n, freed, err
+}
+
+// walkObjects calls fn with the path and hash of each object in the store
+// of the archive at root.
+func walkObjects(root string, fn func(path, hash string) error) error {
+	prefixes, err := os.ReadDir(filepath.Join(root, ObjectsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prefixes {
+		if !p.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, ObjectsDir, p.Name())
+		objs, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, o := range objs {
+			// Skip anything left behind by an interrupted store.
+			if !o.Type().IsRegular() || !strings.HasPrefix(o.Name(), p.Name()) || strings.HasSuffix(o.Name(), ".tmp") {
+				continue
+			}
+			if err := fn(filepath.Join(dir, o.Name()), o.Name()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkViews calls fn with the path of each link into the object store in
+// the channel directories of the archive at root, and the path of the
+// object it refers to.
+func walkViews(root string, fn func(path, obj string) error) error {
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	store := filepath.Join(root, ObjectsDir) + string(filepath.Separator)
+
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+		dir := filepath.Join(root, c.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.Type()&fs.ModeSymlink == 0 {
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(dir, target)
+			}
+			if !strings.HasPrefix(target, store) {
+				continue
+			}
+			if err := fn(path, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
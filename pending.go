@@ -0,0 +1,112 @@
+package ytarchiver
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// pendingVideo is a video submitted for archiving which has not finished.
+type pendingVideo struct {
+	ChannelID    string `json:"channel_id"`
+	MetadataOnly bool   `json:"metadata_only,omitempty"`
+}
+
+// pendingVideos tracks the videos of a channel submitted for archiving
+// during a run which have not finished. They are persisted in statePending,
+// so that those left unfinished by a run which was interrupted, or crashed,
+// are resumed by the next, whether or not they would still be selected.
+type pendingVideos struct {
+	a   *Archiver
+	cid string
+
+	mu     sync.Mutex
+	videos map[string]pendingVideo
+}
+
+// loadPending returns the videos of the channel cid left pending by the
+// last run over it.
+func (a *Archiver) loadPending(cid string) (*pendingVideos, error) {
+	all := make(map[string]pendingVideo)
+	if err := loadState(a.Root, statePending, &all); err != nil {
+		return nil, err
+	}
+
+	p := &pendingVideos{a: a, cid: cid, videos: make(map[string]pendingVideo)}
+	for id, v := range all {
+		if v.ChannelID == cid {
+			p.videos[id] = v
+		}
+	}
+	return p, nil
+}
+
+// IDs returns the IDs of the pending videos, ordered by ID.
+func (p *pendingVideos) IDs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ids := make([]string, 0, len(p.videos))
+	for id := range p.videos {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// MetadataOnly reports if only the metadata of the pending video id was to
+// be archived.
+func (p *pendingVideos) MetadataOnly(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.videos[id].MetadataOnly
+}
+
+// Add records the video id as pending, before it is submitted.
+func (p *pendingVideos) Add(id string, metadataOnly bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.videos[id] = pendingVideo{ChannelID: p.cid, MetadataOnly: metadataOnly}
+	return p.save()
+}
+
+// Remove records that the videos with the given IDs are no longer pending.
+func (p *pendingVideos) Remove(ids ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.videos)
+	for _, id := range ids {
+		delete(p.videos, id)
+	}
+	if len(p.videos) == n {
+		return nil
+	}
+	return p.save()
+}
+
+// save saves the pending videos. Those of other channels are reloaded
+// first, as other instances may be archiving them (see Config.ShardID).
+// p.mu must be held.
+func (p *pendingVideos) save() error {
+	err := p.a.withStateLock(func() error {
+		all := make(map[string]pendingVideo)
+		if err := loadState(p.a.Root, statePending, &all); err != nil {
+			return err
+		}
+		for id, v := range all {
+			if v.ChannelID == p.cid {
+				delete(all, id)
+			}
+		}
+		for id, v := range p.videos {
+			all[id] = v
+		}
+		return saveState(p.a.Root, statePending, all)
+	})
+	if err != nil {
+		return fmt.Errorf("save pending videos of %s: %w", p.cid, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PosterSuffix is appended to a video ID to form the name of the poster
+// frame extracted for a video without a thumbnail.
+const PosterSuffix = ".poster.jpg"
+
+// posterPosition is how far through a video its poster frame is taken, so
+// as to skip any fade in or title card.
+const posterPosition = 0.1
+
+// GeneratePosterFrame extracts a frame of the video file at path as its
+// poster, named by replacing the extension of path with PosterSuffix. ffmpeg
+// is the path to an ffmpeg executable, or empty to look it up in $PATH.
+func GeneratePosterFrame(ctx context.Context, ffmpeg, path string) error {
+	ffmpeg, err := lookFFmpeg(ffmpeg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFFmpeg, err)
+	}
+
+	dur, err := videoDuration(ctx, ffmpeg, path)
+	if err != nil {
+		return err
+	}
+	at := dur.Seconds() * posterPosition
+
+	poster := strings.TrimSuffix(path, filepath.Ext(path)) + PosterSuffix
+	proc := exec.CommandContext(ctx, ffmpeg,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-ss", fmt.Sprintf("%.3f", at),
+		"-i", path,
+		"-frames:v", "1", "-q:v", "3",
+		"-f", "image2", poster+".tmp")
+	if out, err := proc.CombinedOutput(); err != nil {
+		os.Remove(poster + ".tmp")
+		return fmt.Errorf("%w: %s: %v: %s", ErrFFmpeg, path, err, bytes.TrimSpace(out))
+	}
+	if err := os.Rename(poster+".tmp", poster); err != nil {
+		return fmt.Errorf("%w: %v", ErrFFmpeg, err)
+	}
+
+	return nil
+}
+
+// hasThumbnail reports if a thumbnail was downloaded for the video id in the
+// channel directory dir.
+func hasThumbnail(dir, id string) bool {
+	for _, ext := range thumbnailExts {
+		if _, err := os.Stat(filepath.Join(dir, id+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package ytarchiver
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// progressPattern matches the progress lines printed by youtube-dl and its
+// forks when run with --newline, such as:
+//
+//	[download]  42.1% of 10.00MiB at  1.21MiB/s ETA 00:05
+//	[download]  42.1% of ~ 10.00MiB at  1.21MiB/s ETA 00:05 (frag 3/12)
+//	[download] 100% of 10.00MiB in 00:08
+var progressPattern = regexp.MustCompile(`^\[download\]\s+(\d+(?:\.\d+)?)%(?:.*?\bat\s+(\S+))?(?:.*?\bETA\s+(\S+))?`)
+
+// Progress describes the state of a single in-flight video download, as
+// reported by the downloader.
+type Progress struct {
+	VideoID   string
+	ChannelID string
+	// Percentage of the download completed, from 0 to 100.
+	Percent float64
+	// Speed and ETA exactly as reported by the downloader (e.g "1.21MiB/s"
+	// and "00:05"). Either may be empty if not yet known.
+	Speed string
+	ETA   string
+	// Speed in bytes per second, or zero if not known.
+	Rate float64
+	// Limit on the speed in bytes per second imposed to keep within
+	// Config.BandwidthLimit, or zero if unlimited.
+	Limit uint64
+	// Time at which this progress was last reported.
+	Updated time.Time
+}
+
+// parseProgress parses a single line of downloader output into a progress
+// report. ok is false if the line does not contain progress information.
+func parseProgress(line string) (p Progress, ok bool) {
+	m := progressPattern.FindStringSubmatch(line)
+	if m == nil {
+		return Progress{}, false
+	}
+
+	pc, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return Progress{}, false
+	}
+
+	rate, _ := parseRate(m[2])
+	return Progress{
+		Percent: pc,
+		Speed:   m[2],
+		ETA:     m[3],
+		Rate:    rate,
+		Updated: time.Now(),
+	}, true
+}
+
+// scanProgress reads downloader output from r line by line, calling report
+// for each progress line encountered. It returns when r is exhausted.
+func scanProgress(r io.Reader, report func(Progress)) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if p, ok := parseProgress(sc.Text()); ok && report != nil {
+			report(p)
+		}
+	}
+
+	// Drain anything left so the downloader never blocks on a full pipe.
+	io.Copy(io.Discard, r)
+}
+
+// progressTracker keeps the latest progress report for each in-flight
+// download. It is safe for concurrent use.
+type progressTracker struct {
+	mut      sync.Mutex
+	inflight map[string]Progress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{inflight: make(map[string]Progress)}
+}
+
+func (t *progressTracker) Update(p Progress) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.inflight[p.VideoID] = p
+}
+
+func (t *progressTracker) Done(videoID string) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	delete(t.inflight, videoID)
+}
+
+// Snapshot returns the current progress of all in-flight downloads, ordered
+// by video ID.
+func (t *progressTracker) Snapshot() []Progress {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	ret := make([]Progress, 0, len(t.inflight))
+	for _, p := range t.inflight {
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].VideoID < ret[j].VideoID
+	})
+
+	return ret
+}
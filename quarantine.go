@@ -0,0 +1,115 @@
+package ytarchiver
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// defaultMaxVideoFailures is used if Config.MaxVideoFailures is zero.
+	defaultMaxVideoFailures = 5
+	// defaultQuarantineBackoff is used if Config.QuarantineBackoff is zero.
+	defaultQuarantineBackoff = time.Hour
+	// maxQuarantineBackoff caps the time between attempts at a video.
+	maxQuarantineBackoff = 7 * 24 * time.Hour
+)
+
+// A QuarantinedVideo is a video which has failed to archive, and so is only
+// retried after a backoff, or not at all once it has failed too many times.
+type QuarantinedVideo struct {
+	VideoID   string `json:"-"`
+	ChannelID string `json:"channel_id"`
+	// Number of consecutive failed attempts.
+	Failures int `json:"failures"`
+	// Error from the most recent attempt.
+	LastError   string    `json:"last_error"`
+	LastAttempt time.Time `json:"last_attempt"`
+	// Time before which the video will not be attempted again.
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// quarantine maps video IDs to their quarantine entries. It is persisted in
+// the state directory.
+type quarantine map[string]QuarantinedVideo
+
+func loadQuarantine(root string) (quarantine, error) {
+	q := make(quarantine)
+	err := loadState(root, stateQuarantine, &q)
+	return q, err
+}
+
+// Allowed reports if the video id may be attempted at now, given that it
+// may fail at most max times.
+func (q quarantine) Allowed(id string, now time.Time, max uint) bool {
+	e, ok := q[id]
+	if !ok {
+		return true
+	}
+
+	return uint(e.Failures) < max && !now.Before(e.NextAttempt)
+}
+
+// Fail records a failed attempt at the video id on channel cid at now,
+// backing off exponentially from base.
+func (q quarantine) Fail(cid, id string, err error, now time.Time, base time.Duration) {
+	e := q[id]
+	e.ChannelID = cid
+	e.Failures++
+	e.LastError = err.Error()
+	e.LastAttempt = now
+
+	// Avoid overflowing the shift long after reaching the cap.
+	backoff := maxQuarantineBackoff
+	if e.Failures <= 16 && base<<(e.Failures-1) < backoff {
+		backoff = base << (e.Failures - 1)
+	}
+	e.NextAttempt = now.Add(backoff)
+
+	q[id] = e
+}
+
+// ReadQuarantine returns the quarantined videos of the archive at root,
+// ordered by ID.
+func ReadQuarantine(root string) ([]QuarantinedVideo, error) {
+	return readQuarantine(osReader(root))
+}
+
+// readQuarantine is ReadQuarantine for the root read by read.
+func readQuarantine(read readFunc) ([]QuarantinedVideo, error) {
+	q := make(quarantine)
+	if err := readState(read, stateQuarantine, &q); err != nil {
+		return nil, err
+	}
+
+	vids := make([]QuarantinedVideo, 0, len(q))
+	for id, e := range q {
+		e.VideoID = id
+		vids = append(vids, e)
+	}
+	sort.Slice(vids, func(i, j int) bool {
+		return vids[i].VideoID < vids[j].VideoID
+	})
+
+	return vids, nil
+}
+
+// ClearQuarantine removes the videos with the given IDs from the quarantine
+// of the archive at root, so that they are attempted again on the next run
+// which comes across them. If no IDs are given, every video is removed.
+//
+// Changes made while an archive run is in progress may be lost.
+func ClearQuarantine(root string, ids ...string) error {
+	q, err := loadQuarantine(root)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		clear(q)
+	}
+	for _, id := range ids {
+		delete(q, id)
+	}
+
+	return saveState(root, stateQuarantine, q)
+}
@@ -0,0 +1,73 @@
+package ytarchiver
+
+import (
+	"slices"
+)
+
+// downloadQueue maps the IDs of videos requested to be downloaded to the IDs
+// of their channels. It is persisted in the state directory.
+type downloadQueue map[string]string
+
+func loadQueue(root string) (downloadQueue, error) {
+	q := make(downloadQueue)
+	err := loadState(root, stateQueue, &q)
+	return q, err
+}
+
+// QueueVideos queues the videos with the given IDs of the channel cid in the
+// archive at root to be downloaded on the next run over the channel, whether
+// or not they are selected, such as those of which only the metadata was
+// archived. Quarantined and unavailable videos are attempted again. Videos
+// already archived are ignored.
+func QueueVideos(root, cid string, ids ...string) error {
+	q, err := loadQueue(root)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		q[id] = cid
+	}
+	return saveState(root, stateQueue, q)
+}
+
+// ReadQueue returns the IDs of the queued videos of the archive at root by
+// channel ID, ordered by video ID.
+func ReadQueue(root string) (map[string][]string, error) {
+	return readQueue(osReader(root))
+}
+
+// readQueue is ReadQueue for the root read by read.
+func readQueue(read readFunc) (map[string][]string, error) {
+	q := make(downloadQueue)
+	if err := readState(read, stateQueue, &q); err != nil {
+		return nil, err
+	}
+
+	byChan := make(map[string][]string)
+	for id, cid := range q {
+		byChan[cid] = append(byChan[cid], id)
+	}
+	for _, ids := range byChan {
+		slices.Sort(ids)
+	}
+	return byChan, nil
+}
+
+// dequeue removes the videos with the given IDs from the queue of the
+// archive at root, once they have been attempted. The queue is read again
+// so that videos queued during the run are kept.
+func dequeue(root string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	q, err := loadQueue(root)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(q, id)
+	}
+	return saveState(root, stateQueue, q)
+}
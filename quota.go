@@ -0,0 +1,211 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+var ErrQuotaExceeded = errors.New("ytarchiver: API quota exceeded")
+
+// DailyQuota is the default daily API quota of a project, in units.
+const DailyQuota = 10000
+
+// Quota cost of each kind of API request made, in units.
+const (
+	quotaCostList     = 1
+	quotaCostCaptions = 50
+)
+
+// quotaReasons are the API error reasons which indicate that the daily
+// quota has been used up.
+var quotaReasons = map[string]bool{
+	"quotaExceeded":      true,
+	"dailyLimitExceeded": true,
+}
+
+// quotaLocation is the time zone in which the API quota resets at midnight.
+var quotaLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		// Without tzdata, assume standard time. During daylight saving
+		// this errs on the side of waiting an hour too long.
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return loc
+}()
+
+// apiError marks err as wrapping ErrQuotaExceeded if it is an API error
+// caused by exhausting the daily quota. Other errors are returned as-is.
+func apiError(err error) error {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return err
+	}
+
+	for _, e := range gerr.Errors {
+		if quotaReasons[e.Reason] {
+			return fmt.Errorf("%w: %v", ErrQuotaExceeded, err)
+		}
+	}
+	return err
+}
+
+// QuotaReset returns the first time after t at which the daily API quota
+// resets (midnight Pacific Time).
+func QuotaReset(t time.Time) time.Time {
+	pt := t.In(quotaLocation)
+	return time.Date(pt.Year(), pt.Month(), pt.Day()+1, 0, 0, 0, 0, quotaLocation)
+}
+
+// quotaCounter estimates the API quota used since it last reset, and counts
+// the requests made to each endpoint and those which failed since it was
+// created.
+type quotaCounter struct {
+	mut   sync.Mutex
+	used  int
+	reset time.Time
+	// calls to each endpoint, and failed calls by HTTP status.
+	calls  map[string]uint64
+	errors map[int]uint64
+}
+
+// Add records that n units of quota have been used.
+func (q *quotaCounter) Add(n int) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if now := time.Now(); !now.Before(q.reset) {
+		q.used, q.reset = 0, QuotaReset(now)
+	}
+	q.used += n
+}
+
+// Record records a request to endpoint costing cost units which failed with
+// err, if not nil.
+func (q *quotaCounter) Record(endpoint string, cost int, err error) {
+	q.Add(cost)
+
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.calls == nil {
+		q.calls = make(map[string]uint64)
+		q.errors = make(map[int]uint64)
+	}
+	q.calls[endpoint]++
+
+	var gerr *googleapi.Error
+	switch {
+	case errors.As(err, &gerr):
+		q.errors[gerr.Code]++
+	case errors.Is(err, ErrQuotaExceeded):
+		// The API error is only kept as text.
+		q.errors[http.StatusForbidden]++
+	}
+}
+
+// Used returns the units used since the quota last reset, and when it next
+// resets.
+func (q *quotaCounter) Used() (int, time.Time) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if now := time.Now(); !now.Before(q.reset) {
+		return 0, QuotaReset(now)
+	}
+	return q.used, q.reset
+}
+
+// Stats returns the requests counted.
+func (q *quotaCounter) Stats() APIStats {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	return APIStats{Calls: maps.Clone(q.calls), Errors: maps.Clone(q.errors)}
+}
+
+// countingClient counts the quota used by the requests made through a
+// YouTubeClient.
+type countingClient struct {
+	YouTubeClient
+	quota *quotaCounter
+}
+
+func (c countingClient) ListChannel(ctx context.Context, ch YouTubeChannel) (*youtube.Channel, error) {
+	r, err := c.YouTubeClient.ListChannel(ctx, ch)
+	c.quota.Record("channels", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListChannels(ctx context.Context, ids []string) ([]*youtube.Channel, error) {
+	r, err := c.YouTubeClient.ListChannels(ctx, ids)
+	c.quota.Record("channels", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListPlaylistItems(ctx context.Context, playlistID, pageToken string) (*youtube.PlaylistItemListResponse, error) {
+	r, err := c.YouTubeClient.ListPlaylistItems(ctx, playlistID, pageToken)
+	c.quota.Record("playlistItems", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListVideos(ctx context.Context, parts []string, ids []string) ([]*youtube.Video, error) {
+	r, err := c.YouTubeClient.ListVideos(ctx, parts, ids)
+	c.quota.Record("videos", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListVideoCategories(ctx context.Context, regionCode string) ([]*youtube.VideoCategory, error) {
+	r, err := c.YouTubeClient.ListVideoCategories(ctx, regionCode)
+	c.quota.Record("videoCategories", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListCaptions(ctx context.Context, videoID string) ([]*youtube.Caption, error) {
+	r, err := c.YouTubeClient.ListCaptions(ctx, videoID)
+	c.quota.Record("captions", quotaCostCaptions, err)
+	return r, err
+}
+
+func (c countingClient) ListActivities(ctx context.Context, channelID string, after time.Time, pageToken string) (*youtube.ActivityListResponse, error) {
+	r, err := c.YouTubeClient.ListActivities(ctx, channelID, after, pageToken)
+	c.quota.Record("activities", quotaCostList, err)
+	return r, err
+}
+
+func (c countingClient) ListCommentThreads(ctx context.Context, videoID string) ([]*youtube.CommentThread, error) {
+	r, err := c.YouTubeClient.ListCommentThreads(ctx, videoID)
+	c.quota.Record("commentThreads", quotaCostList, err)
+	return r, err
+}
+
+// QuotaUsed estimates the API quota used by the archiver since the quota
+// last reset, in units, and returns when it next resets. Requests made by
+// anything else using the same API key are not included.
+func (a *Archiver) QuotaUsed() (int, time.Time) {
+	return a.quota.Used()
+}
+
+// APIStats counts the requests made to the API by the archiver since it was
+// created. Requests served from its cache are not included.
+type APIStats struct {
+	// Requests made to each endpoint of the API, by its name (e.g
+	// "playlistItems").
+	Calls map[string]uint64
+	// Requests which failed, by HTTP status (e.g 403 if the quota is
+	// exhausted or access is denied, 429 if rate limited).
+	Errors map[int]uint64
+}
+
+// APIStats returns the requests made to the API by the archiver.
+func (a *Archiver) APIStats() APIStats {
+	return a.quota.Stats()
+}
@@ -0,0 +1,83 @@
+package ytarchiver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token bucket rate limiter. Tokens accrue at a constant
+// rate up to a maximum of burst; each event consumes one token.
+type tokenBucket struct {
+	mut    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full token bucket allowing rate events per second
+// and bursts of up to burst events. A burst of zero is treated as one.
+func newTokenBucket(rate float64, burst uint) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// reserve takes a token, returning how long the caller must wait before
+// the token may be used.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	// Tokens may go negative, queueing callers behind one another.
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait blocks until an event is permitted or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	wait := b.reserve()
+	if wait == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedTransport delays requests as required by a rate limiter
+// before passing them to the underlying transport.
+type rateLimitedTransport struct {
+	limiter *tokenBucket
+	base    http.RoundTripper
+}
+
+func (t rateLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(r.Context()); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(r)
+}
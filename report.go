@@ -0,0 +1,421 @@
+package ytarchiver
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// reportBarWidth is the width of the longest bar of the coverage histograms
+// of a Markdown report, in characters.
+const reportBarWidth = 30
+
+// A Report describes the completeness of the archive at a root, channel by
+// channel, as made by NewReport.
+type Report struct {
+	Root      string
+	Generated time.Time
+	// Size of the archive and the space left on its filesystem, in bytes.
+	DiskUsed, DiskFree uint64
+	// Ordered by channel name.
+	Channels []ChannelReport
+}
+
+// A ChannelReport describes the completeness of the archive of a channel.
+type ChannelReport struct {
+	ChannelID string
+	Name      string
+	// Videos archived, and those of which only the metadata was archived.
+	Archived     int
+	MetadataOnly int
+	// Oldest and newest archived uploads.
+	First, Last time.Time
+	// Archived and missing uploads by year, newest first. Missing videos
+	// of unknown date are left out.
+	Years []ReportYear
+	// Known uploads which are not archived, newest first, followed by those
+	// of unknown date.
+	Missing []MissingVideo
+	// Space taken by the video files, and by everything else (metadata,
+	// thumbnails, subtitles and the like), in bytes.
+	VideoBytes, OtherBytes int64
+	// Outcome of the most recent run over the channel. Nil if unknown.
+	LastRun *ChannelRecord
+}
+
+// A ReportYear counts the archived and missing uploads of a channel in one
+// year.
+type ReportYear struct {
+	Year              int
+	Archived, Missing int
+}
+
+// A MissingVideo is a known upload of a channel which is not archived.
+type MissingVideo struct {
+	VideoID    string
+	Title      string
+	UploadedAt time.Time
+	// Why the video is missing.
+	Reason string
+}
+
+// NewReport reports on the completeness of the archive at root. Only the
+// channels with the given IDs are included, or every channel if none are
+// given. Missing videos are those known to the archiver without being
+// archived: those of which only the metadata was archived and those
+// quarantined, unavailable or queued.
+func NewReport(root string, ids ...string) (Report, error) {
+	r := Report{Root: root, Generated: time.Now()}
+	var err error
+	if r.DiskUsed, r.DiskFree, err = DiskUsage(root); err != nil {
+		return r, err
+	}
+
+	quar, err := ReadQuarantine(root)
+	if err != nil {
+		return r, err
+	}
+	unavail, err := ReadUnavailable(root)
+	if err != nil {
+		return r, err
+	}
+	queue, err := ReadQueue(root)
+	if err != nil {
+		return r, err
+	}
+	recs, err := ReadChannelRecords(root)
+	if err != nil {
+		return r, err
+	}
+	lastRuns := make(map[string]ChannelRecord)
+	for _, rec := range recs {
+		if rec.ChannelID != "" && rec.LastRun.After(lastRuns[rec.ChannelID].LastRun) {
+			lastRuns[rec.ChannelID] = rec
+		}
+	}
+
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return r, err
+	}
+	for _, c := range chans {
+		if !isChannelDir(c) || c.Name() == StateDir {
+			continue
+		}
+		if len(ids) > 0 && !slices.Contains(ids, c.Name()) {
+			continue
+		}
+
+		cr, err := newChannelReport(filepath.Join(root, c.Name()), quar, unavail, queue[c.Name()])
+		if err != nil {
+			return r, fmt.Errorf("report %s: %w", c.Name(), err)
+		}
+		if rec, ok := lastRuns[cr.ChannelID]; ok {
+			cr.LastRun = &rec
+		}
+		r.Channels = append(r.Channels, cr)
+	}
+	slices.SortFunc(r.Channels, func(a, b ChannelReport) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	return r, nil
+}
+
+// newChannelReport reports on the channel directory dir.
+func newChannelReport(dir string, quar []QuarantinedVideo, unavail []UnavailableVideo, queued []string) (ChannelReport, error) {
+	cr := ChannelReport{ChannelID: filepath.Base(dir), Name: filepath.Base(dir)}
+	if ci, err := ReadChannelInfo(dir); err == nil && ci.Name != "" {
+		cr.Name = ci.Name
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cr, err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return cr, err
+	}
+	// Files are told apart the same way as by crawlChannel.
+	videos := make(map[string]bool)
+	metas := make(map[string]bool)
+	for _, f := range files {
+		if f.IsDir() || isPartialFile(f.Name()) {
+			continue
+		}
+		// Through any link into the object store.
+		info, err := os.Stat(filepath.Join(dir, f.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		name, ext, _ := strings.Cut(f.Name(), ".")
+		switch {
+		case f.Name() == ChannelInfoName, isSidecarExt(filepath.Ext(f.Name())):
+			cr.OtherBytes += info.Size()
+		case strings.HasSuffix(ext, "json"):
+			cr.OtherBytes += info.Size()
+			if strings.HasSuffix(f.Name(), VideoMetaSuffix) {
+				metas[name] = true
+			}
+		default:
+			cr.VideoBytes += info.Size()
+			videos[name] = true
+		}
+	}
+
+	missing := make(map[string]*MissingVideo)
+	years := make(map[int]*ReportYear)
+	year := func(t time.Time) *ReportYear {
+		if years[t.Year()] == nil {
+			years[t.Year()] = &ReportYear{Year: t.Year()}
+		}
+		return years[t.Year()]
+	}
+	for id := range videos {
+		cr.Archived++
+		// Without its metadata, the upload date of a video is unknown.
+		if !metas[id] {
+			continue
+		}
+		vm, err := ReadVideoMeta(dir, id)
+		if err != nil {
+			return cr, err
+		}
+		if vm.UploadedAt.IsZero() {
+			continue
+		}
+		year(vm.UploadedAt).Archived++
+		if cr.First.IsZero() || vm.UploadedAt.Before(cr.First) {
+			cr.First = vm.UploadedAt
+		}
+		if vm.UploadedAt.After(cr.Last) {
+			cr.Last = vm.UploadedAt
+		}
+	}
+	for id := range metas {
+		if videos[id] {
+			continue
+		}
+		vm, err := ReadVideoMeta(dir, id)
+		if err != nil {
+			return cr, err
+		}
+		cr.MetadataOnly++
+		missing[id] = &MissingVideo{VideoID: id, Title: vm.Title, UploadedAt: vm.UploadedAt, Reason: "metadata only"}
+	}
+
+	// Videos which failed before anything of them was archived are only
+	// known from the quarantine, unavailable videos and queue.
+	miss := func(id, reason string) {
+		if videos[id] {
+			return
+		}
+		if m := missing[id]; m != nil {
+			m.Reason += "; " + reason
+			return
+		}
+		missing[id] = &MissingVideo{VideoID: id, Reason: reason}
+	}
+	for _, q := range quar {
+		if q.ChannelID == cr.ChannelID {
+			miss(q.VideoID, fmt.Sprintf("failed %d time(s): %s", q.Failures, q.LastError))
+		}
+	}
+	for _, u := range unavail {
+		if u.ChannelID == cr.ChannelID {
+			miss(u.VideoID, "unavailable ("+u.Reason+")")
+		}
+	}
+	for _, id := range queued {
+		miss(id, "queued")
+	}
+
+	for _, m := range missing {
+		cr.Missing = append(cr.Missing, *m)
+		if !m.UploadedAt.IsZero() {
+			year(m.UploadedAt).Missing++
+		}
+	}
+	slices.SortFunc(cr.Missing, func(a, b MissingVideo) int {
+		if c := b.UploadedAt.Compare(a.UploadedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.VideoID, b.VideoID)
+	})
+	for _, y := range years {
+		cr.Years = append(cr.Years, *y)
+	}
+	slices.SortFunc(cr.Years, func(a, b ReportYear) int {
+		return b.Year - a.Year
+	})
+
+	return cr, nil
+}
+
+// Known returns the number of known uploads of the channel, archived or not.
+func (c ChannelReport) Known() int {
+	return c.Archived + len(c.Missing)
+}
+
+// Percent returns the percentage of the known uploads which are archived.
+func (c ChannelReport) Percent() int {
+	if c.Known() == 0 {
+		return 100
+	}
+	return c.Archived * 100 / c.Known()
+}
+
+// mostInYear returns the largest number of uploads of the channel in a
+// single year, for scaling histograms.
+func (c ChannelReport) mostInYear() int {
+	most := 1
+	for _, y := range c.Years {
+		most = max(most, y.Archived+y.Missing)
+	}
+	return most
+}
+
+// formatBytes formats n bytes in the largest binary unit in which it is at
+// least one.
+func formatBytes[T int64 | uint64](n T) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, i := float64(n)/1024, 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, units[i])
+}
+
+// reportDate formats t as a date, or "?" if it is unknown.
+func reportDate(t time.Time) string {
+	if t.IsZero() {
+		return "?"
+	}
+	return t.Format(time.DateOnly)
+}
+
+// Markdown writes the report to w as Markdown.
+func (r Report) Markdown(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Archive report\n\n")
+	ew.printf("Generated %s for `%s`: %s used, %s free.\n\n", r.Generated.Format(time.RFC1123), r.Root, formatBytes(r.DiskUsed), formatBytes(r.DiskFree))
+
+	ew.printf("| Channel | Archived | Missing | Coverage | Videos | Other |\n")
+	ew.printf("|---|---:|---:|---:|---:|---:|\n")
+	for _, c := range r.Channels {
+		ew.printf("| %s | %d | %d | %d%% | %s | %s |\n", mdEscape(c.Name), c.Archived, len(c.Missing), c.Percent(), formatBytes(c.VideoBytes), formatBytes(c.OtherBytes))
+	}
+
+	for _, c := range r.Channels {
+		ew.printf("\n## %s\n\n", mdEscape(c.Name))
+		ew.printf("Channel `%s`: %d of %d known uploads archived (%d%%), from %s to %s. ", c.ChannelID, c.Archived, c.Known(), c.Percent(), reportDate(c.First), reportDate(c.Last))
+		ew.printf("Videos take %s, and everything else %s.\n", formatBytes(c.VideoBytes), formatBytes(c.OtherBytes))
+		if c.LastRun != nil {
+			ew.printf("\nLast run %s: %d archived, %d failed, %d pending.\n", c.LastRun.LastRun.Format(time.RFC1123), c.LastRun.Archived, c.LastRun.Failed, c.LastRun.Pending)
+		}
+
+		if len(c.Years) > 0 {
+			most := c.mostInYear()
+			ew.printf("\n```\n")
+			for _, y := range c.Years {
+				arch := y.Archived * reportBarWidth / most
+				miss := (y.Archived+y.Missing)*reportBarWidth/most - arch
+				ew.printf("%d %s%s %d/%d\n", y.Year, strings.Repeat("#", arch), strings.Repeat(".", miss), y.Archived, y.Archived+y.Missing)
+			}
+			ew.printf("```\n")
+		}
+
+		if len(c.Missing) > 0 {
+			ew.printf("\n| Missing | Uploaded | Title | Reason |\n|---|---|---|---|\n")
+			for _, m := range c.Missing {
+				ew.printf("| `%s` | %s | %s | %s |\n", m.VideoID, reportDate(m.UploadedAt), mdEscape(m.Title), mdEscape(m.Reason))
+			}
+		}
+	}
+
+	return ew.err
+}
+
+// mdEscape escapes s for use in a Markdown table cell.
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+}
+
+// errWriter keeps the first error writing to w, after which nothing more is
+// written.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, v ...any) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, v...)
+	}
+}
+
+// reportTemplate renders a Report as a standalone HTML page, which is also
+// suitable as the body of an email.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes[int64],
+	"date":  reportDate,
+	"pct": func(n, most int) int {
+		return n * 100 / most
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Archive report</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; }
+td.n { text-align: right; }
+.bar { display: inline-block; height: 0.8em; background: #4a4; }
+.bar.miss { background: #d44; }
+</style></head><body>
+<h1>Archive report</h1>
+<p>Generated {{.Generated.Format "Mon, 02 Jan 2006 15:04:05 MST"}} for <code>{{.Root}}</code>: {{.Used}} used, {{.Free}} free.</p>
+<table><tr><th>Channel</th><th>Archived</th><th>Missing</th><th>Coverage</th><th>Videos</th><th>Other</th></tr>
+{{range .Channels}}<tr><td><a href="#{{.ChannelID}}">{{.Name}}</a></td><td class="n">{{.Archived}}</td><td class="n">{{len .Missing}}</td><td class="n">{{.Percent}}%</td><td class="n">{{bytes .VideoBytes}}</td><td class="n">{{bytes .OtherBytes}}</td></tr>
+{{end}}</table>
+{{range .Channels}}{{$most := .MostInYear}}
+<h2 id="{{.ChannelID}}">{{.Name}}</h2>
+<p>Channel <code>{{.ChannelID}}</code>: {{.Archived}} of {{.Known}} known uploads archived ({{.Percent}}%), from {{date .First}} to {{date .Last}}.
+Videos take {{bytes .VideoBytes}}, and everything else {{bytes .OtherBytes}}.</p>
+{{with .LastRun}}<p>Last run {{.LastRun.Format "Mon, 02 Jan 2006 15:04:05 MST"}}: {{.Archived}} archived, {{.Failed}} failed, {{.Pending}} pending.</p>{{end}}
+{{if .Years}}<table><tr><th>Year</th><th>Archived</th><th>Missing</th><th></th></tr>
+{{range .Years}}<tr><td>{{.Year}}</td><td class="n">{{.Archived}}</td><td class="n">{{.Missing}}</td><td style="width: 20em"><span class="bar" style="width: {{pct .Archived $most}}%"></span><span class="bar miss" style="width: {{pct .Missing $most}}%"></span></td></tr>
+{{end}}</table>{{end}}
+{{if .Missing}}<table><tr><th>Missing</th><th>Uploaded</th><th>Title</th><th>Reason</th></tr>
+{{range .Missing}}<tr><td><a href="https://www.youtube.com/watch?v={{.VideoID}}">{{.VideoID}}</a></td><td>{{date .UploadedAt}}</td><td>{{.Title}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}</body></html>
+`))
+
+// HTML writes the report to w as a standalone HTML page.
+func (r Report) HTML(w io.Writer) error {
+	type htmlChannel struct {
+		ChannelReport
+		MostInYear int
+	}
+	chans := make([]htmlChannel, len(r.Channels))
+	for i, c := range r.Channels {
+		chans[i] = htmlChannel{c, c.mostInYear()}
+	}
+
+	return reportTemplate.Execute(w, struct {
+		Report
+		Used, Free string
+		Channels   []htmlChannel
+	}{r, formatBytes(r.DiskUsed), formatBytes(r.DiskFree), chans})
+}
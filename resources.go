@@ -0,0 +1,32 @@
+package ytarchiver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxNice is the lowest priority a downloader may be given.
+const maxNice = 19
+
+var errLimitsUnsupported = errors.New("not supported on this platform")
+
+// hasResourceLimits reports if cfg limits the resources of downloaders.
+func (c Config) hasResourceLimits() bool {
+	return c.DownloaderNice != 0 || c.DownloaderIdleIO || c.DownloaderCgroup != "" || c.DownloaderMemoryLimit != 0
+}
+
+// setupResourceLimits checks the resource limits of cfg and prepares them to
+// be applied to each downloader by limitProcess.
+func setupResourceLimits(cfg Config) error {
+	if cfg.DownloaderNice < 0 || cfg.DownloaderNice > maxNice {
+		return fmt.Errorf("niceness %d out of range (want 0 to %d)", cfg.DownloaderNice, maxNice)
+	}
+	if cfg.DownloaderMemoryLimit != 0 && cfg.DownloaderCgroup == "" {
+		return errors.New("memory limit requires a cgroup")
+	}
+	if !cfg.hasResourceLimits() {
+		return nil
+	}
+
+	return setupPlatformLimits(cfg)
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package ytarchiver
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// I/O priorities, from linux/ioprio.h.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassIdle  = 3
+)
+
+// setupPlatformLimits checks that the downloader cgroup can be used, and
+// sets its memory limit.
+func setupPlatformLimits(cfg Config) error {
+	if cfg.DownloaderCgroup == "" {
+		return nil
+	}
+
+	// Moving processes into the cgroup requires write access to it.
+	procs := filepath.Join(cfg.DownloaderCgroup, "cgroup.procs")
+	f, err := os.OpenFile(procs, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cgroup: %v", err)
+	}
+	f.Close()
+
+	if cfg.DownloaderMemoryLimit != 0 {
+		max := strconv.FormatUint(cfg.DownloaderMemoryLimit, 10)
+		if err := os.WriteFile(filepath.Join(cfg.DownloaderCgroup, "memory.max"), []byte(max), 0); err != nil {
+			return fmt.Errorf("cgroup memory limit: %v", err)
+		}
+	}
+	return nil
+}
+
+// limitProcess prepares proc, before it is started, to run with the limits
+// of cfg. The returned function is called once it has started to apply
+// those which can only be applied to a running process, and may be called
+// even if it failed to start.
+func limitProcess(proc *exec.Cmd, cfg Config) (started func() error, err error) {
+	var cgroup *os.File
+	if cfg.DownloaderCgroup != "" {
+		// Started in the cgroup, so that nothing escapes it.
+		if cgroup, err = os.Open(cfg.DownloaderCgroup); err != nil {
+			return nil, err
+		}
+		proc.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(cgroup.Fd())}
+	}
+
+	return func() error {
+		if cgroup != nil {
+			cgroup.Close()
+		}
+		if proc.Process == nil {
+			return nil
+		}
+
+		// Set before the downloader has had time to start anything,
+		// which then inherits them.
+		pid := proc.Process.Pid
+		if cfg.DownloaderNice != 0 {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, cfg.DownloaderNice); err != nil {
+				return fmt.Errorf("nice: %v", err)
+			}
+		}
+		if cfg.DownloaderIdleIO {
+			_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), ioprioClassIdle<<ioprioClassShift)
+			if errno != 0 {
+				return fmt.Errorf("ionice: %v", errno)
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package ytarchiver
+
+import "os/exec"
+
+// setupPlatformLimits fails, as no limits are supported on this platform.
+func setupPlatformLimits(cfg Config) error {
+	return errLimitsUnsupported
+}
+
+// limitProcess does nothing, as no limits are supported on this platform.
+func limitProcess(proc *exec.Cmd, cfg Config) (started func() error, err error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,32 @@
+//go:build unix && !linux
+
+package ytarchiver
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// setupPlatformLimits checks that the limits of cfg are supported, which
+// are only the niceness.
+func setupPlatformLimits(cfg Config) error {
+	if cfg.DownloaderIdleIO || cfg.DownloaderCgroup != "" {
+		return fmt.Errorf("I/O priority and cgroups: %w", errLimitsUnsupported)
+	}
+	return nil
+}
+
+// limitProcess returns a function setting the niceness of proc once it has
+// started.
+func limitProcess(proc *exec.Cmd, cfg Config) (started func() error, err error) {
+	return func() error {
+		if proc.Process == nil || cfg.DownloaderNice == 0 {
+			return nil
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, proc.Process.Pid, cfg.DownloaderNice); err != nil {
+			return fmt.Errorf("nice: %v", err)
+		}
+		return nil
+	}, nil
+}
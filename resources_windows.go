@@ -0,0 +1,41 @@
+//go:build windows
+
+package ytarchiver
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// Process creation flags selecting priority classes, from winbase.h.
+const (
+	belowNormalPriorityClass = 0x00004000
+	idlePriorityClass        = 0x00000040
+)
+
+// idleNice is the niceness from which downloaders are given the idle
+// priority class, rather than below normal.
+const idleNice = 10
+
+// setupPlatformLimits checks that the limits of cfg are supported, which
+// are only the priority classes.
+func setupPlatformLimits(cfg Config) error {
+	if cfg.DownloaderIdleIO || cfg.DownloaderCgroup != "" {
+		return fmt.Errorf("I/O priority and cgroups: %w", errLimitsUnsupported)
+	}
+	return nil
+}
+
+// limitProcess prepares proc, before it is started, to run in the priority
+// class nearest the niceness of cfg.
+func limitProcess(proc *exec.Cmd, cfg Config) (started func() error, err error) {
+	switch {
+	case cfg.DownloaderNice >= idleNice:
+		proc.SysProcAttr = &syscall.SysProcAttr{CreationFlags: idlePriorityClass}
+	case cfg.DownloaderNice > 0:
+		proc.SysProcAttr = &syscall.SysProcAttr{CreationFlags: belowNormalPriorityClass}
+	}
+
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,208 @@
+package ytarchiver_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"github.com/ejv2/yt-archiver/internal/ytartest"
+)
+
+// waitDownloading waits for the downloader of e to be started for the video
+// id.
+func waitDownloading(t *testing.T, e *ytartest.Env, id string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		ids, err := e.Downloader.Calls()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Contains(ids, id) {
+			return
+		}
+	}
+	t.Fatalf("%s never downloaded", id)
+}
+
+func TestRetryFailed(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	cfg.QuarantineBackoff = time.Nanosecond
+	if err := e.Downloader.Fail("ccccccccccA"); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ytarchiver.NewArchiver(cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	if err = a.Archive(); err == nil {
+		t.Fatal("Archive succeeded despite a failed download")
+	}
+
+	// The failed video is not taken as archived, and is tried again.
+	if err := e.Downloader.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	got, err := e.Videos(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"}
+	if slices.Sort(got); !slices.Equal(got, want) {
+		t.Errorf("archived %q, want %q", got, want)
+	}
+	want = slices.Insert(want, 2, "ccccccccccA")
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+}
+
+func TestResumeAfterCrash(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	// The crash comes early in the first backfill of the channel, which
+	// spans two pages: one download at a time, the newest video hangs
+	// before the second page is reached.
+	e.API.PageSize = 2
+	cfg.MaxParallel = 1
+	if err := e.Downloader.Hang("ddddddddddA"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := ytarchiver.NewArchiverWithContext(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- a.Archive() }()
+	waitDownloading(t, e, "ddddddddddA")
+
+	// Keep the state as it is mid-run, as a crash would leave it, in place
+	// of whatever is saved as the run is stopped.
+	state := filepath.Join(e.Root, ytarchiver.StateDir)
+	crashed := filepath.Join(t.TempDir(), "state")
+	if err := os.CopyFS(crashed, os.DirFS(state)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-done
+	if err := os.RemoveAll(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.CopyFS(state, os.DirFS(crashed)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The video is resumed on restarting, though it would no longer be
+	// selected, and the rest of the backlog is enumerated as if the first
+	// run had never started.
+	if err := e.Downloader.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Channels[0].Selectors = []ytarchiver.VideoSelector{ytarchiver.NewIDSelector([]string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA"})}
+	archive(t, cfg)
+
+	got, err := e.Videos(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"}
+	if slices.Sort(got); !slices.Equal(got, want) {
+		t.Errorf("archived %q, want %q", got, want)
+	}
+	want = append(want, "ddddddddddA")
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+
+	// Nor is the resumed video once it has been archived.
+	archive(t, cfg)
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q after resuming, want %q", got, want)
+	}
+}
+
+func TestResumeAfterInterrupt(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	if err := e.Downloader.Hang("ccccccccccA"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := ytarchiver.NewArchiverWithContext(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- a.Archive() }()
+	waitDownloading(t, e, "ccccccccccA")
+	cancel()
+	if err := <-done; !errors.Is(err, ytarchiver.ErrInterrupted) {
+		t.Fatalf("Archive = %v, want %v", err, ytarchiver.ErrInterrupted)
+	}
+
+	if err := e.Downloader.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Channels[0].Selectors = []ytarchiver.VideoSelector{ytarchiver.NewIDSelector([]string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ddddddddddA"})}
+	archive(t, cfg)
+
+	got, err := e.Videos(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(got, "ccccccccccA") {
+		t.Errorf("interrupted video not resumed; archived %q", got)
+	}
+}
+
+func TestVerifyBeforeSeen(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	cfg.QuarantineBackoff = time.Nanosecond
+	if err := e.Downloader.Empty("bbbbbbbbbbA"); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ytarchiver.NewArchiver(cfg)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	if err = a.Archive(); !errors.Is(err, ytarchiver.ErrNotArchived) {
+		t.Fatalf("Archive = %v, want %v", err, ytarchiver.ErrNotArchived)
+	}
+
+	// The downloader exiting cleanly did not make the video seen, and its
+	// empty file is gone.
+	if _, err := os.Stat(filepath.Join(e.Root, testChannel, "bbbbbbbbbbA.mp4")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty video file left behind: %v", err)
+	}
+	if err := e.Downloader.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	got, err := e.Videos(testChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"}
+	if slices.Sort(got); !slices.Equal(got, want) {
+		t.Errorf("archived %q, want %q", got, want)
+	}
+	want = slices.Insert(want, 1, "bbbbbbbbbbA")
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LayoutVersion is the version of the on-disk archive layout written by this
+// package. It is recorded in the archive root so that archives written by
+// newer versions are not clobbered by older ones.
+const LayoutVersion = 2
+
+const (
+	// rootProbeName is created and then removed again to check that the
+	// archive root is writable.
+	rootProbeName = ".ytarchiver-probe"
+	// rootMarkerName recorded the layout version of the archive root
+	// before the manifest was introduced.
+	rootMarkerName = ".ytarchiver-layout"
+	// legacyProbeName is the probe file left behind by older versions.
+	legacyProbeName = ".ytarchiver"
+	legacyProbeText = "This file was created as a test by ytarchiver."
+)
+
+var ErrLayoutVersion = errors.New("unsupported archive layout version")
+
+// CheckRoot ensures that dir is usable as an archive root, returning the
+// layout version recorded in its manifest.
+//
+// If readOnly is set, dir is only required to be readable and nothing is
+// written; this is intended for consumers, such as a web interface, which
+// share the root with a running archiver. Otherwise, dir must be writable and
+// the manifest is written if missing, recording the current layout for a new
+// root. An existing root with an outdated layout is still usable, but the
+// error wraps ErrLayoutOutdated until it is migrated with Migrate.
+func CheckRoot(dir string, readOnly bool) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkLayout(m); err != nil || readOnly {
+		return m.LayoutVersion, err
+	}
+
+	// A new root has nothing to migrate.
+	if isNewRoot(entries) {
+		m.LayoutVersion = LayoutVersion
+	}
+	if err := probeRoot(dir); err != nil {
+		return m.LayoutVersion, err
+	}
+	removeLegacyProbe(dir)
+
+	if m.LayoutVersion < LayoutVersion {
+		return m.LayoutVersion, fmt.Errorf("%w: layout %d needs migrating to %d", ErrLayoutOutdated, m.LayoutVersion, LayoutVersion)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestName)); err != nil {
+		return m.LayoutVersion, writeManifest(dir, m)
+	}
+	return m.LayoutVersion, nil
+}
+
+// checkLayout checks that the layout recorded in m is supported.
+func checkLayout(m Manifest) error {
+	if m.LayoutVersion > LayoutVersion {
+		return fmt.Errorf("%w %d (this version supports up to %d)", ErrLayoutVersion, m.LayoutVersion, LayoutVersion)
+	}
+	return nil
+}
+
+// isNewRoot reports if a root with the given entries has never been
+// archived to, holding at most the probe files of earlier checks.
+func isNewRoot(entries []fs.DirEntry) bool {
+	for _, e := range entries {
+		if e.Name() != rootProbeName && e.Name() != legacyProbeName {
+			return false
+		}
+	}
+	return true
+}
+
+// probeRoot checks that dir is writable by creating and removing a file.
+func probeRoot(dir string) error {
+	testpath := filepath.Join(dir, rootProbeName)
+	f, err := os.Create(testpath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, "This file was created as a test by ytarchiver. Feel free to delete it.")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(testpath); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// removeLegacyProbe removes the probe file older versions never cleaned up.
+// It is only removed if it is recognisably ours.
+func removeLegacyProbe(dir string) {
+	path := filepath.Join(dir, legacyProbeName)
+	dat, err := os.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(dat, []byte(legacyProbeText)) {
+		return
+	}
+
+	os.Remove(path)
+}
+
+// DiskUsage returns the total size of the files within the archive root,
+// and the space left available on its filesystem, in bytes.
+func DiskUsage(root string) (used, free uint64, err error) {
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		used += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	free, err = diskFree(root)
+	return used, free, err
+}
@@ -0,0 +1,47 @@
+package ytarchiver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRootNew(t *testing.T) {
+	root := t.TempDir()
+
+	ver, err := CheckRoot(root, false)
+	if err != nil {
+		t.Fatalf("CheckRoot: %v", err)
+	}
+	if ver != LayoutVersion {
+		t.Errorf("layout of new root = %d, want %d", ver, LayoutVersion)
+	}
+
+	m, err := ReadManifest(root)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if m.LayoutVersion != LayoutVersion {
+		t.Errorf("manifest layout = %d, want %d", m.LayoutVersion, LayoutVersion)
+	}
+}
+
+func TestCheckRootOutdated(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "UCchannel"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ver, err := CheckRoot(root, false)
+	if ver != 1 || !errors.Is(err, ErrLayoutOutdated) {
+		t.Fatalf("CheckRoot = %d, %v; want 1, %v", ver, err, ErrLayoutOutdated)
+	}
+
+	if err := Migrate(root, nil); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if ver, err := CheckRoot(root, false); ver != LayoutVersion || err != nil {
+		t.Errorf("CheckRoot after Migrate = %d, %v; want %d, nil", ver, err, LayoutVersion)
+	}
+}
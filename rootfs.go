@@ -0,0 +1,91 @@
+package ytarchiver
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// A readFunc reads the named file, with a slash-separated name relative to
+// some directory.
+type readFunc func(name string) ([]byte, error)
+
+// osReader reads files relative to dir on the local filesystem.
+func osReader(dir string) readFunc {
+	return func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+}
+
+// fsReader reads files from fsys.
+func fsReader(fsys fs.FS) readFunc {
+	return func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}
+}
+
+// The following read an archive root which is not on the local filesystem,
+// such as one served from another host. The root is the root of fsys, and
+// directories within it are named as for fs.FS.
+
+// CheckRootFS is CheckRoot for the root in fsys, which is only ever read.
+func CheckRootFS(fsys fs.FS) (int, error) {
+	if _, err := fs.ReadDir(fsys, "."); err != nil {
+		return 0, err
+	}
+
+	m, err := ReadManifestFS(fsys)
+	if err != nil {
+		return 0, err
+	}
+	return m.LayoutVersion, checkLayout(m)
+}
+
+// ReadManifestFS is ReadManifest for the root in fsys.
+func ReadManifestFS(fsys fs.FS) (Manifest, error) {
+	return readManifest(fsReader(fsys))
+}
+
+// ReadChannelInfoFS is ReadChannelInfo for the channel directory dir in
+// fsys.
+func ReadChannelInfoFS(fsys fs.FS, dir string) (ChannelInfo, error) {
+	return readChannelInfo(fsReader(fsys), path.Join(dir, ChannelInfoName))
+}
+
+// ReadVideoMetaFS is ReadVideoMeta for the channel directory dir in fsys.
+func ReadVideoMetaFS(fsys fs.FS, dir, id string) (VideoMeta, error) {
+	return readVideoMeta(fsReader(fsys), id, path.Join(dir, id+VideoMetaSuffix))
+}
+
+// ReadQuarantineFS is ReadQuarantine for the root in fsys.
+func ReadQuarantineFS(fsys fs.FS) ([]QuarantinedVideo, error) {
+	return readQuarantine(fsReader(fsys))
+}
+
+// ReadUnavailableFS is ReadUnavailable for the root in fsys.
+func ReadUnavailableFS(fsys fs.FS) ([]UnavailableVideo, error) {
+	return readUnavailable(fsReader(fsys))
+}
+
+// ReadBreakersFS is ReadBreakers for the root in fsys.
+func ReadBreakersFS(fsys fs.FS) ([]ChannelBreaker, error) {
+	return readBreakers(fsReader(fsys))
+}
+
+// ReadQueueFS is ReadQueue for the root in fsys.
+func ReadQueueFS(fsys fs.FS) (map[string][]string, error) {
+	return readQueue(fsReader(fsys))
+}
+
+// ReadForecastFS is ReadForecast for the root in fsys.
+func ReadForecastFS(fsys fs.FS) (StorageForecast, error) {
+	return readForecast(fsReader(fsys))
+}
+
+// ReadHistoryFS is ReadHistory for the root in fsys.
+func ReadHistoryFS(fsys fs.FS) ([]RunRecord, error) {
+	var hist []RunRecord
+	err := readState(fsReader(fsys), stateHistory, &hist)
+	return hist, err
+}
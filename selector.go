@@ -5,6 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/youtube/v3"
@@ -26,12 +30,87 @@ const playlistStaleTimeout = 24 * time.Hour
 
 // A VideoSelector is a criterion for deciding if a given video should be downloaded.
 // All specified criteria must be matched before a given video will be archived.
+//
+// An Archiver never calls Should concurrently, but selectors shared between
+// several Archivers must be safe for concurrent use.
 type VideoSelector interface {
 	// Should indicates if a given matcher selects positively for this video.
 	// All matchers must return true for a given video the be selected.
-	// The selector is also passed the live YouTube API service connection,
-	// should it wish to do further investigation.
-	Should(*youtube.PlaylistItem, *youtube.Service) bool
+	// The selector is also passed the archiver's API client, should it
+	// wish to do further investigation.
+	Should(*youtube.PlaylistItem, YouTubeClient) bool
+}
+
+// A MetadataSelector is a VideoSelector which decides using the full
+// metadata of a video rather than just its playlist entry. The archiver
+// looks up metadata in batches shared by the upcoming check and every
+// MetadataSelector, so these should be preferred over selectors making
+// their own API requests.
+//
+// When archiving, ShouldVideo is called instead of Should. Metadata always
+// includes the snippet, contentDetails and liveStreamingDetails parts.
+type MetadataSelector interface {
+	VideoSelector
+	ShouldVideo(*youtube.Video) bool
+}
+
+// A CachedSelector is a VideoSelector which caches state obtained from the
+// API which must periodically be refreshed. Before archiving each channel,
+// the archiver refreshes any stale CachedSelectors which apply to it. A
+// selector shared between channels is therefore refreshed only once.
+//
+// If a refresh fails, the error is reported as part of the ArchiveError for
+// that channel and the channel is skipped for this run.
+type CachedSelector interface {
+	VideoSelector
+	// Stale reports if the cached state needs refreshing.
+	Stale() bool
+	// Refresh reloads the cached state from the API.
+	Refresh(context.Context, YouTubeClient) error
+}
+
+// Selector costs, in increasing order. The archiver checks cheaper selectors
+// first, so that once one has rejected a video no more expensive ones are
+// checked.
+const (
+	// Decided from the playlist entry of a video, or state cached by a
+	// CachedSelector.
+	CostFree = iota
+	// Decided from the full metadata of a video, which is looked up in
+	// batches anyway.
+	CostMetadata
+	// Makes API requests of its own for each video.
+	CostRequest
+)
+
+// A CostedSelector is a VideoSelector which declares what it costs to
+// check. The cost of other selectors is taken to be CostMetadata for a
+// MetadataSelector or CostRequest otherwise.
+type CostedSelector interface {
+	VideoSelector
+	// Cost returns one of the Cost* constants.
+	Cost() int
+}
+
+// SelectorCost returns the cost of checking m, as one of the Cost*
+// constants.
+func SelectorCost(m VideoSelector) int {
+	switch s := m.(type) {
+	case CostedSelector:
+		return s.Cost()
+	case MetadataSelector:
+		return CostMetadata
+	default:
+		return CostRequest
+	}
+}
+
+// sortSelectors orders sels from cheapest to most expensive, keeping the
+// order of those of the same cost.
+func sortSelectors(sels []VideoSelector) {
+	slices.SortStableFunc(sels, func(a, b VideoSelector) int {
+		return SelectorCost(a) - SelectorCost(b)
+	})
 }
 
 // SelectorRegex matches any videos for which the title
@@ -50,7 +129,19 @@ func NewSelectorRegex(match int, regex string) (SelectorRegex, error) {
 	return SelectorRegex{match, rp}, nil
 }
 
-func (s SelectorRegex) Should(vid *youtube.PlaylistItem, _ *youtube.Service) bool {
+func (s SelectorRegex) String() string {
+	field := "title"
+	if s.Match == SelectorRegexDescription {
+		field = "description"
+	}
+	return fmt.Sprintf("%s regex %q", field, s.patt)
+}
+
+func (s SelectorRegex) Cost() int {
+	return CostFree
+}
+
+func (s SelectorRegex) Should(vid *youtube.PlaylistItem, _ YouTubeClient) bool {
 	toMatch := ""
 	switch s.Match {
 	case SelectorRegexTitle:
@@ -72,28 +163,33 @@ func (s SelectorRegex) Should(vid *youtube.PlaylistItem, _ *youtube.Service) boo
 type PlaylistSelector struct {
 	PlaylistID string
 
+	mut        sync.Mutex
 	listLoaded *time.Time
 	list       map[string]struct{}
 }
 
-func (p *PlaylistSelector) loadPlaylist(s *youtube.Service) error {
-	// empty/initialize the contents map
-	p.list = make(map[string]struct{})
+func (p *PlaylistSelector) loadPlaylist(ctx context.Context, cl YouTubeClient) error {
+	list := make(map[string]struct{})
 
-	rq := s.PlaylistItems.List([]string{"contentDetails"}).PlaylistId(p.PlaylistID).MaxResults(50)
-	rq.Pages(context.Background(), func(r *youtube.PlaylistItemListResponse) error {
+	err := forEachPage(ctx, cl, p.PlaylistID, func(r *youtube.PlaylistItemListResponse) error {
 		for _, i := range r.Items {
 			if i == nil || i.ContentDetails == nil {
 				continue
 			}
 
-			p.list[i.ContentDetails.VideoId] = struct{}{}
+			list[i.ContentDetails.VideoId] = struct{}{}
 		}
 		return nil
 	})
+	if err != nil {
+		return fmt.Errorf("load playlist %s: %w", p.PlaylistID, err)
+	}
 
-	_, err := rq.Do()
-	return err
+	// Only replace the old contents once the new ones are complete.
+	now := time.Now()
+	p.list = list
+	p.listLoaded = &now
+	return nil
 }
 
 // we need to load if:
@@ -104,14 +200,37 @@ func (p *PlaylistSelector) needLoad() bool {
 	return p.listLoaded == nil || p.list == nil || time.Since(*p.listLoaded) > playlistStaleTimeout
 }
 
-func (p *PlaylistSelector) Should(vid *youtube.PlaylistItem, s *youtube.Service) bool {
-	// If we haven't retrieved the list yet, do it now
-	if p.needLoad() {
-		if p.loadPlaylist(s) != nil {
-			return false
-		}
-		now := time.Now()
-		p.listLoaded = &now
+func (p *PlaylistSelector) Stale() bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	return p.needLoad()
+}
+
+func (p *PlaylistSelector) Refresh(ctx context.Context, cl YouTubeClient) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	return p.loadPlaylist(ctx, cl)
+}
+
+func (p *PlaylistSelector) Cost() int {
+	return CostFree
+}
+
+func (p *PlaylistSelector) String() string {
+	return "playlist " + p.PlaylistID
+}
+
+// Should selects videos in the playlist. When used by an Archiver, the
+// playlist has always been loaded through Refresh beforehand. Otherwise, it
+// is loaded here if needed, and nothing is selected if that fails.
+func (p *PlaylistSelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.needLoad() && p.loadPlaylist(context.Background(), cl) != nil {
+		return false
 	}
 
 	_, ok := p.list[vid.ContentDetails.VideoId]
@@ -134,7 +253,15 @@ func NewIDSelector(ids []string) IDSelector {
 	return sel
 }
 
-func (i IDSelector) Should(vid *youtube.PlaylistItem, s *youtube.Service) bool {
+func (i IDSelector) String() string {
+	return fmt.Sprintf("list of %d video IDs", len(i.IDs))
+}
+
+func (i IDSelector) Cost() int {
+	return CostFree
+}
+
+func (i IDSelector) Should(vid *youtube.PlaylistItem, _ YouTubeClient) bool {
 	if vid == nil || vid.ContentDetails == nil {
 		return false
 	}
@@ -142,3 +269,367 @@ func (i IDSelector) Should(vid *youtube.PlaylistItem, s *youtube.Service) bool {
 	_, ok := i.matchmap[vid.ContentDetails.VideoId]
 	return ok
 }
+
+// categoryStaleTimeout is the time after which category names are resolved
+// again.
+const categoryStaleTimeout = 7 * 24 * time.Hour
+
+// defaultCategoryRegion is the region in which category names are resolved
+// if none is given.
+const defaultCategoryRegion = "US"
+
+var ErrUnknownCategory = errors.New("unknown video category")
+
+// CategorySelector selects videos in any of a set of categories, such as
+// "Music" or "Gaming". Categories may be given by ID or by name; names are
+// resolved through the API on Refresh, in the region RegionCode (US if
+// empty), and are case insensitive.
+type CategorySelector struct {
+	Categories []string
+	RegionCode string
+
+	mut      sync.Mutex
+	resolved *time.Time
+	ids      map[string]struct{}
+}
+
+// needsNames reports if any of the categories are given by name.
+func (c *CategorySelector) needsNames() bool {
+	for _, cat := range c.Categories {
+		if _, err := strconv.Atoi(cat); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CategorySelector) resolve(ctx context.Context, cl YouTubeClient) error {
+	ids := make(map[string]struct{}, len(c.Categories))
+
+	var names map[string]string
+	if c.needsNames() {
+		region := c.RegionCode
+		if region == "" {
+			region = defaultCategoryRegion
+		}
+
+		cats, err := cl.ListVideoCategories(ctx, region)
+		if err != nil {
+			return fmt.Errorf("resolve categories: %w", err)
+		}
+
+		names = make(map[string]string, len(cats))
+		for _, cat := range cats {
+			if cat.Snippet != nil {
+				names[strings.ToLower(cat.Snippet.Title)] = cat.Id
+			}
+		}
+	}
+
+	for _, cat := range c.Categories {
+		if _, err := strconv.Atoi(cat); err == nil {
+			ids[cat] = struct{}{}
+			continue
+		}
+
+		id, ok := names[strings.ToLower(cat)]
+		if !ok {
+			return fmt.Errorf("resolve categories: %w %q", ErrUnknownCategory, cat)
+		}
+		ids[id] = struct{}{}
+	}
+
+	now := time.Now()
+	c.ids = ids
+	c.resolved = &now
+	return nil
+}
+
+func (c *CategorySelector) needResolve() bool {
+	return c.resolved == nil || time.Since(*c.resolved) > categoryStaleTimeout
+}
+
+func (c *CategorySelector) Stale() bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.needResolve()
+}
+
+func (c *CategorySelector) Refresh(ctx context.Context, cl YouTubeClient) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.resolve(ctx, cl)
+}
+
+func (c *CategorySelector) String() string {
+	return "categories " + strings.Join(c.Categories, ", ")
+}
+
+func (c *CategorySelector) ShouldVideo(v *youtube.Video) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if v.Snippet == nil {
+		return false
+	}
+	_, ok := c.ids[v.Snippet.CategoryId]
+	return ok
+}
+
+// Should looks up the category of the video itself, resolving category
+// names first if needed. Nothing is selected if either fails. An Archiver
+// calls ShouldVideo instead.
+func (c *CategorySelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	ctx := context.Background()
+
+	c.mut.Lock()
+	if c.needResolve() && c.resolve(ctx, cl) != nil {
+		c.mut.Unlock()
+		return false
+	}
+	c.mut.Unlock()
+
+	vids, err := cl.ListVideos(ctx, []string{"snippet"}, []string{vid.ContentDetails.VideoId})
+	if err != nil || len(vids) == 0 {
+		return false
+	}
+	return c.ShouldVideo(vids[0])
+}
+
+// matchLanguage reports if the BCP-47 language tag lang is one of want. A
+// bare language in want (e.g "en") also matches its regional variants (e.g
+// "en-GB").
+func matchLanguage(lang string, want []string) bool {
+	for _, w := range want {
+		if strings.EqualFold(lang, w) ||
+			(len(lang) > len(w) && lang[len(w)] == '-' && strings.EqualFold(lang[:len(w)], w)) {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageSelector selects videos in any of a set of languages, given as
+// BCP-47 tags such as "en" or "pt-BR". The language of a video is its
+// default audio language, or failing that the language of its title and
+// description.
+type LanguageSelector struct {
+	Languages []string
+	// Also select videos which declare no language at all.
+	MatchUnknown bool
+}
+
+func (l LanguageSelector) String() string {
+	return "languages " + strings.Join(l.Languages, ", ")
+}
+
+func (l LanguageSelector) ShouldVideo(v *youtube.Video) bool {
+	if v.Snippet == nil {
+		return l.MatchUnknown
+	}
+
+	lang := v.Snippet.DefaultAudioLanguage
+	if lang == "" {
+		lang = v.Snippet.DefaultLanguage
+	}
+	if lang == "" {
+		return l.MatchUnknown
+	}
+	return matchLanguage(lang, l.Languages)
+}
+
+// Should looks up the video itself. Nothing is selected if that fails. An
+// Archiver calls ShouldVideo instead.
+func (l LanguageSelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	vids, err := cl.ListVideos(context.Background(), []string{"snippet"}, []string{vid.ContentDetails.VideoId})
+	if err != nil || len(vids) == 0 {
+		return false
+	}
+	return l.ShouldVideo(vids[0])
+}
+
+// CaptionSelector selects videos with captions in any of a set of languages,
+// given as for LanguageSelector. Automatic captions are not counted.
+//
+// Captions are listed separately for each video at a cost of 50 units of
+// API quota, so this selector is checked after cheaper ones.
+type CaptionSelector struct {
+	Languages []string
+}
+
+func (c CaptionSelector) String() string {
+	return "captions in " + strings.Join(c.Languages, ", ")
+}
+
+func (c CaptionSelector) Cost() int {
+	return CostRequest
+}
+
+func (c CaptionSelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	caps, err := cl.ListCaptions(context.Background(), vid.ContentDetails.VideoId)
+	if err != nil {
+		return false
+	}
+
+	for _, cp := range caps {
+		if cp.Snippet != nil && cp.Snippet.TrackKind != "asr" && matchLanguage(cp.Snippet.Language, c.Languages) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeywordSelector selects videos by simple keywords in their titles, as a
+// friendlier alternative to SelectorRegex. Matching is case insensitive.
+type KeywordSelector struct {
+	// Select only videos whose titles contain at least one of these, or
+	// any video if empty.
+	Include []string
+	// Reject videos whose titles contain any of these.
+	Exclude []string
+}
+
+func (k KeywordSelector) String() string {
+	var parts []string
+	if len(k.Include) > 0 {
+		parts = append(parts, fmt.Sprintf("keywords %q", k.Include))
+	}
+	if len(k.Exclude) > 0 {
+		parts = append(parts, fmt.Sprintf("excluded keywords %q", k.Exclude))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (k KeywordSelector) Cost() int {
+	return CostFree
+}
+
+func (k KeywordSelector) Should(vid *youtube.PlaylistItem, _ YouTubeClient) bool {
+	title := strings.ToLower(vid.Snippet.Title)
+	contains := func(kw string) bool {
+		return strings.Contains(title, strings.ToLower(kw))
+	}
+
+	if slices.ContainsFunc(k.Exclude, contains) {
+		return false
+	}
+	return len(k.Include) == 0 || slices.ContainsFunc(k.Include, contains)
+}
+
+// Selector scopes, deciding which videos a ScopedSelector applies to.
+const (
+	// Apply to every video.
+	ScopeAll = iota
+	// Apply only to the backlog of a channel: videos published before it
+	// was first archived.
+	ScopeBackfill
+	// Apply only to videos published since the channel was first
+	// archived.
+	ScopeNew
+)
+
+// ScopedSelector applies Selector only to the videos in Scope; all others
+// pass it. For example, a playlist selector scoped to the backfill limits the
+// initial archive to the highlights of a channel, while every new video is
+// archived.
+type ScopedSelector struct {
+	Selector VideoSelector
+	// One of the Scope* constants.
+	Scope int
+}
+
+// Applies reports if the selector applies to videos in the backlog of a
+// channel or not.
+func (s ScopedSelector) Applies(backfill bool) bool {
+	switch s.Scope {
+	case ScopeBackfill:
+		return backfill
+	case ScopeNew:
+		return !backfill
+	default:
+		return true
+	}
+}
+
+func (s ScopedSelector) String() string {
+	desc := DescribeSelector(s.Selector)
+	switch s.Scope {
+	case ScopeBackfill:
+		return desc + " (backfill only)"
+	case ScopeNew:
+		return desc + " (new videos only)"
+	default:
+		return desc
+	}
+}
+
+func (s ScopedSelector) Cost() int {
+	return SelectorCost(s.Selector)
+}
+
+// Should always applies the selector, as there is no way to tell if the
+// video is part of the backlog. An Archiver honours the scope.
+func (s ScopedSelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	return s.Selector.Should(vid, cl)
+}
+
+// ExcludeSelector selects the videos which Selector does not. If Selector
+// is scoped, videos out of its scope pass.
+type ExcludeSelector struct {
+	Selector VideoSelector
+}
+
+func (e ExcludeSelector) String() string {
+	return "exclusion of " + DescribeSelector(e.Selector)
+}
+
+func (e ExcludeSelector) Cost() int {
+	return SelectorCost(e.Selector)
+}
+
+func (e ExcludeSelector) Should(vid *youtube.PlaylistItem, cl YouTubeClient) bool {
+	return !e.Selector.Should(vid, cl)
+}
+
+// unwrapSelector returns the selector scoped or excluded by m, or m itself.
+func unwrapSelector(m VideoSelector) VideoSelector {
+	for {
+		switch s := m.(type) {
+		case ScopedSelector:
+			m = s.Selector
+		case ExcludeSelector:
+			m = s.Selector
+		default:
+			return m
+		}
+	}
+}
+
+// selectorApplies reports if m applies to videos in the backlog of a
+// channel or not.
+func selectorApplies(m VideoSelector, backfill bool) bool {
+	if e, ok := m.(ExcludeSelector); ok {
+		m = e.Selector
+	}
+	if s, ok := m.(ScopedSelector); ok {
+		return s.Applies(backfill)
+	}
+	return true
+}
+
+// channelSelectors returns the selectors applying to ch, in the order they
+// are checked: cheapest first, and of those of the same cost, the
+// exclusions, then the selectors of the archiver and then those of the
+// channel.
+func (a *Archiver) channelSelectors(ch YouTubeChannel) []VideoSelector {
+	sels := make([]VideoSelector, 0, len(a.Exclusions)+len(a.Selectors)+len(ch.Selectors))
+	for _, m := range a.Exclusions {
+		sels = append(sels, ExcludeSelector{m})
+	}
+	sels = append(sels, a.Selectors...)
+	sels = append(sels, ch.Selectors...)
+	sortSelectors(sels)
+	return sels
+}
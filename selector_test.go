@@ -0,0 +1,241 @@
+package ytarchiver_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	ytarchiver "github.com/ejv2/yt-archiver"
+	"google.golang.org/api/youtube/v3"
+)
+
+func mustRegex(t *testing.T, match int, regex string) ytarchiver.SelectorRegex {
+	t.Helper()
+
+	s, err := ytarchiver.NewSelectorRegex(match, regex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestArchiveSelectors(t *testing.T) {
+	tests := []struct {
+		name       string
+		selectors  []ytarchiver.VideoSelector
+		exclusions []ytarchiver.VideoSelector
+		want       []string
+	}{
+		{"none", nil, nil, []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"}},
+		{
+			"regex",
+			[]ytarchiver.VideoSelector{mustRegex(t, ytarchiver.SelectorRegexTitle, "^Live")},
+			nil,
+			[]string{"aaaaaaaaaaA", "ddddddddddA"},
+		},
+		{
+			"IDs",
+			[]ytarchiver.VideoSelector{ytarchiver.NewIDSelector([]string{"bbbbbbbbbbA", "ccccccccccA", "zzzzzzzzzzA"})},
+			nil,
+			[]string{"bbbbbbbbbbA", "ccccccccccA"},
+		},
+		{
+			"keywords",
+			[]ytarchiver.VideoSelector{ytarchiver.KeywordSelector{Include: []string{"SPEEDRUN", "day"}, Exclude: []string{"live"}}},
+			nil,
+			[]string{"bbbbbbbbbbA", "ccccccccccA"},
+		},
+		{
+			"category by name",
+			[]ytarchiver.VideoSelector{&ytarchiver.CategorySelector{Categories: []string{"gaming"}}},
+			nil,
+			[]string{"bbbbbbbbbbA", "ddddddddddA"},
+		},
+		{
+			"category by ID",
+			[]ytarchiver.VideoSelector{&ytarchiver.CategorySelector{Categories: []string{"10", "22"}}},
+			nil,
+			[]string{"aaaaaaaaaaA", "ccccccccccA"},
+		},
+		{
+			"language",
+			[]ytarchiver.VideoSelector{ytarchiver.LanguageSelector{Languages: []string{"en"}}},
+			nil,
+			[]string{"aaaaaaaaaaA", "bbbbbbbbbbA"},
+		},
+		{
+			"language or unknown",
+			[]ytarchiver.VideoSelector{ytarchiver.LanguageSelector{Languages: []string{"de"}, MatchUnknown: true}},
+			nil,
+			[]string{"ccccccccccA", "ddddddddddA"},
+		},
+		{
+			"playlist",
+			[]ytarchiver.VideoSelector{&ytarchiver.PlaylistSelector{PlaylistID: "PLtest"}},
+			nil,
+			[]string{"aaaaaaaaaaA", "ccccccccccA"},
+		},
+		{
+			"captions",
+			[]ytarchiver.VideoSelector{ytarchiver.CaptionSelector{Languages: []string{"fr"}}},
+			nil,
+			[]string{"bbbbbbbbbbA"},
+		},
+		{
+			"all must match",
+			[]ytarchiver.VideoSelector{
+				&ytarchiver.CategorySelector{Categories: []string{"Gaming"}},
+				ytarchiver.LanguageSelector{Languages: []string{"en"}},
+			},
+			nil,
+			[]string{"bbbbbbbbbbA"},
+		},
+		{
+			"exclusion",
+			nil,
+			[]ytarchiver.VideoSelector{ytarchiver.KeywordSelector{Include: []string{"live"}}},
+			[]string{"bbbbbbbbbbA", "ccccccccccA"},
+		},
+		{
+			"exclusion and selector",
+			[]ytarchiver.VideoSelector{&ytarchiver.CategorySelector{Categories: []string{"Gaming"}}},
+			[]ytarchiver.VideoSelector{ytarchiver.NewIDSelector([]string{"bbbbbbbbbbA"})},
+			[]string{"ddddddddddA"},
+		},
+		{
+			"new videos only",
+			[]ytarchiver.VideoSelector{ytarchiver.ScopedSelector{Selector: ytarchiver.NewIDSelector(nil), Scope: ytarchiver.ScopeNew}},
+			nil,
+			[]string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA"},
+		},
+		{
+			"backfill only",
+			[]ytarchiver.VideoSelector{ytarchiver.ScopedSelector{Selector: ytarchiver.NewIDSelector([]string{"ccccccccccA"}), Scope: ytarchiver.ScopeBackfill}},
+			nil,
+			[]string{"ccccccccccA"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, cfg := newTestEnv(t)
+			e.API.AddPlaylistItem("PLtest", playlistItem("aaaaaaaaaaA"))
+			e.API.AddPlaylistItem("PLtest", playlistItem("ccccccccccA"))
+			e.API.AddCaption("bbbbbbbbbbA", "fr")
+			e.API.AddCaption("ccccccccccA", "en")
+
+			cfg.Channels[0].Selectors = tt.selectors
+			cfg.Exclusions = tt.exclusions
+			archive(t, cfg)
+
+			if got := downloaded(t, e); !slices.Equal(got, tt.want) {
+				t.Errorf("downloaded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func playlistItem(videoID string) *youtube.PlaylistItem {
+	return &youtube.PlaylistItem{
+		Snippet:        &youtube.PlaylistItemSnippet{ResourceId: &youtube.ResourceId{Kind: "youtube#video", VideoId: videoID}},
+		ContentDetails: &youtube.PlaylistItemContentDetails{VideoId: videoID},
+	}
+}
+
+func TestScopedSelectorNewVideos(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	cfg.Channels[0].Selectors = []ytarchiver.VideoSelector{ytarchiver.ScopedSelector{
+		Selector: ytarchiver.KeywordSelector{Include: []string{"live"}},
+		Scope:    ytarchiver.ScopeNew,
+	}}
+	a := archive(t, cfg)
+
+	// The whole backlog was archived; of what is new, only what is
+	// selected is.
+	// Publish times are whole seconds, so keep clear of the start of the
+	// backfill.
+	published := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	for _, v := range []*youtube.Video{
+		{Id: "eeeeeeeeeeA", Snippet: &youtube.VideoSnippet{Title: "Live again", PublishedAt: published}},
+		{Id: "ffffffffffA", Snippet: &youtube.VideoSnippet{Title: "Another day out", PublishedAt: published}},
+	} {
+		e.API.AddVideo(testChannel, v)
+	}
+	if err := a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	want := []string{"aaaaaaaaaaA", "bbbbbbbbbbA", "ccccccccccA", "ddddddddddA", "eeeeeeeeeeA"}
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+}
+
+// countingSelector selects every video, counting how many it is asked
+// about.
+type countingSelector struct {
+	n *int
+}
+
+func (c countingSelector) Should(*youtube.PlaylistItem, ytarchiver.YouTubeClient) bool {
+	*c.n++
+	return true
+}
+
+func TestSelectorCostOrder(t *testing.T) {
+	e, cfg := newTestEnv(t)
+
+	// Though listed first, the expensive selector is only asked about the
+	// video which the free one selects.
+	var n int
+	cfg.Channels[0].Selectors = []ytarchiver.VideoSelector{
+		countingSelector{&n},
+		ytarchiver.NewIDSelector([]string{"ccccccccccA"}),
+	}
+	archive(t, cfg)
+
+	if n != 1 {
+		t.Errorf("expensive selector checked %d times, want 1", n)
+	}
+	if got := downloaded(t, e); !slices.Equal(got, []string{"ccccccccccA"}) {
+		t.Errorf("downloaded %q, want only ccccccccccA", got)
+	}
+}
+
+func TestCachedSelectors(t *testing.T) {
+	e, cfg := newTestEnv(t)
+	e.API.AddChannel("UCotherchannel", "other")
+	e.API.AddVideo("UCotherchannel", testVideo("xxxxxxxxxxA", 1, "Other video", "10", "en"))
+	e.API.AddPlaylistItem("PLtest", playlistItem("aaaaaaaaaaA"))
+	e.API.AddPlaylistItem("PLtest", playlistItem("xxxxxxxxxxA"))
+
+	// Both selectors are shared between the channels.
+	cfg.Channels = append(cfg.Channels, ytarchiver.YouTubeChannel{ID: "UCotherchannel"})
+	cfg.Selectors = []ytarchiver.VideoSelector{
+		&ytarchiver.PlaylistSelector{PlaylistID: "PLtest"},
+		&ytarchiver.CategorySelector{Categories: []string{"Music"}},
+	}
+	a := archive(t, cfg)
+	before := e.API.Calls()
+
+	want := []string{"aaaaaaaaaaA", "xxxxxxxxxxA"}
+	if got := downloaded(t, e); !slices.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+	if before.Categories != 1 {
+		t.Errorf("categories listed %d times, want once", before.Categories)
+	}
+
+	// Neither is refreshed until stale.
+	if err := a.Archive(); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	after := e.API.Calls()
+	if after.Categories != before.Categories {
+		t.Errorf("categories listed again while cached")
+	}
+	// Each run lists the uploads of both channels, but not the playlist.
+	if n := after.PlaylistItems - before.PlaylistItems; n != 2 {
+		t.Errorf("%d playlist requests on the second run, want 2", n)
+	}
+}
@@ -0,0 +1,151 @@
+package ytarchiver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// defaultSelectorTestLimit is used if the limit given to TestSelectors is
+// zero.
+const defaultSelectorTestLimit = 20
+
+// errEnoughVideos stops the enumeration of a channel's uploads once
+// TestSelectors has seen enough of them.
+var errEnoughVideos = errors.New("enough videos")
+
+// A SelectorVerdict is the decision of a single selector on a video.
+type SelectorVerdict struct {
+	// Description of the selector (see DescribeSelector).
+	Selector string
+	// Set unless the selector is scoped to the backlog or to new videos
+	// and the video is not one of those, in which case it selects the
+	// video regardless.
+	Applies  bool
+	Accepted bool
+}
+
+// A SelectorTest is the decision of each selector of a channel on one of its
+// videos, as made by TestSelectors.
+type SelectorTest struct {
+	VideoID   string
+	Title     string
+	Published time.Time
+	// Set if the video was published before the channel's backlog began,
+	// and so is considered by selectors scoped to the backlog.
+	Backlog bool
+	// Set if the video has already been archived.
+	Archived bool
+	// Verdict of each global selector and then each of the channel's, in
+	// configuration order.
+	Verdicts []SelectorVerdict
+}
+
+// Selected reports if every selector accepted the video, and so it would be
+// archived.
+func (t SelectorTest) Selected() bool {
+	for _, v := range t.Verdicts {
+		if !v.Accepted {
+			return false
+		}
+	}
+	return true
+}
+
+// TestSelectors applies the selectors of the configured channel with
+// identity ident to its limit most recent uploads (20 if zero), or the
+// first limit of its configured videos, as a dry run: every selector is
+// consulted, even once one has rejected a video, and nothing is archived or
+// recorded. Upcoming videos are left out, as they are not yet considered by
+// a run.
+//
+// This takes a request per 50 videos, plus any needed by the selectors.
+func (a *Archiver) TestSelectors(ident string, limit int) ([]SelectorTest, error) {
+	a.runMut.Lock()
+	defer a.runMut.Unlock()
+
+	if limit <= 0 {
+		limit = defaultSelectorTestLimit
+	}
+	chans, err := a.selectChannels([]string{ident})
+	if err != nil {
+		return nil, err
+	}
+	ch := chans[0]
+	chc, ok := a.cachedChannel(ch.Identity())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCacheMiss, ch.Identity())
+	}
+
+	ctx := a.ctx
+	sels := a.channelSelectors(ch)
+	if err := a.refreshSelectors(ctx, sels); err != nil {
+		return nil, err
+	}
+	// Read without recording the start of any backfill, which is left to
+	// the first run.
+	backfill := make(map[string]time.Time)
+	if err := loadState(a.Root, stateBackfill, &backfill); err != nil {
+		return nil, err
+	}
+	start, ok := backfill[chc.ID]
+	if !ok {
+		start = time.Now()
+	}
+
+	vc := newVideoCache(a.client)
+	var tests []SelectorTest
+	visit := func(cc *cachedChannel, pi *youtube.PlaylistItem) error {
+		if len(tests) == limit {
+			return errEnoughVideos
+		}
+
+		id := pi.ContentDetails.VideoId
+		t := SelectorTest{
+			VideoID:  id,
+			Backlog:  inBacklog(pi, start),
+			Archived: chc.Videos.Has(id),
+		}
+		if pi.Snippet != nil {
+			t.Title = pi.Snippet.Title
+		}
+		t.Published, _ = publishedAt(pi)
+		for _, m := range sels {
+			v := SelectorVerdict{Selector: DescribeSelector(m), Applies: selectorApplies(m, t.Backlog)}
+			ok, err := a.selects(ctx, m, pi, vc, t.Backlog)
+			if err != nil {
+				return err
+			}
+			v.Accepted = ok
+			t.Verdicts = append(t.Verdicts, v)
+		}
+		tests = append(tests, t)
+		return nil
+	}
+
+	// The channel itself is left untouched, and archived videos are
+	// visited too.
+	cc := *chc
+	cc.Videos, cc.Upcoming = nil, nil
+	if len(ch.VideoIDs) > 0 {
+		err = cc.ForeachVideo(ctx, ch.VideoIDs, vc, visit)
+	} else {
+		for _, pl := range cc.Playlists {
+			err = cc.foreachPipelined(ctx, a.client, pl, vc, visit)
+			if err != nil && pl != cc.UploadsID && !cc.Playlist && isNotFound(err) {
+				err = nil
+			}
+			if err != nil && !errors.Is(err, ErrEmptyResults) {
+				break
+			}
+			err = nil
+		}
+	}
+	if err != nil && !errors.Is(err, errEnoughVideos) {
+		return tests, fmt.Errorf("test selectors on %s: %w", chc.ID, err)
+	}
+
+	return tests, nil
+}
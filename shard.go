@@ -0,0 +1,315 @@
+package ytarchiver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// leaseDir is the directory within StateDir holding the lease of each
+// channel claimed by a sharded instance (see Config.ShardID).
+const leaseDir = "leases"
+
+// defaultLeaseTTL is used if Config.LeaseTTL is zero.
+const defaultLeaseTTL = 10 * time.Minute
+
+const (
+	// stateLockName is created in StateDir by a sharded instance while it
+	// updates the state shared with other instances.
+	stateLockName = "lock"
+	// stateLockStale is the age beyond which a state lock is assumed to
+	// have been left behind by an instance which died holding it.
+	stateLockStale = 30 * time.Second
+	// stateLockWait bounds the time spent waiting for the state lock.
+	stateLockWait = time.Minute
+)
+
+var ErrStateLocked = errors.New("ytarchiver: state locked by another instance")
+
+// A ChannelLease records the claim of a sharded instance on a channel.
+type ChannelLease struct {
+	ChannelID string    `json:"channel_id"`
+	Holder    string    `json:"holder"`
+	Acquired  time.Time `json:"acquired"`
+	Expires   time.Time `json:"expires"`
+}
+
+// ReadLeases returns the leases on the channels of the archive at root,
+// including any which have expired.
+func ReadLeases(root string) ([]ChannelLease, error) {
+	files, err := filepath.Glob(filepath.Join(root, StateDir, leaseDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]ChannelLease, 0, len(files))
+	for _, f := range files {
+		l, err := readLease(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return leases, err
+		}
+		leases = append(leases, l)
+	}
+	return leases, nil
+}
+
+func readLease(path string) (ChannelLease, error) {
+	var l ChannelLease
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+	return l, json.Unmarshal(dat, &l)
+}
+
+// leaseTTL returns the time for which a claimed channel is leased.
+func (a *Archiver) leaseTTL() time.Duration {
+	if a.LeaseTTL == 0 {
+		return defaultLeaseTTL
+	}
+	return a.LeaseTTL
+}
+
+// leasePath returns the path of the lease on the channel cid.
+func (a *Archiver) leasePath(cid string) string {
+	return filepath.Join(a.Root, StateDir, leaseDir, cid+".json")
+}
+
+// claimChannel claims the channel cid for this instance, reporting false if
+// another instance holds an unexpired lease on it. Only one instance can
+// claim an expired lease, which is first set aside so that no other can.
+func (a *Archiver) claimChannel(cid string) (bool, error) {
+	path := a.leasePath(cid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	l := ChannelLease{ChannelID: cid, Holder: a.ShardID, Acquired: now, Expires: now.Add(a.leaseTTL())}
+	dat, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(dat)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err == nil, err
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+
+		cur, err := readLease(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Released since.
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		// Held by this instance before it was restarted.
+		if cur.Holder == a.ShardID {
+			return true, writeFileAtomic(path, dat)
+		}
+		if now.Before(cur.Expires) {
+			fmt.Printf("[%s] leased to %s until %v, skipping\n", cid, cur.Holder, cur.Expires.Format(time.RFC3339))
+			return false, nil
+		}
+
+		var suffix [8]byte
+		rand.Read(suffix[:])
+		stale := path + "." + hex.EncodeToString(suffix[:]) + ".stale"
+		if err := os.Rename(path, stale); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		// It may have been claimed again since it was read, in which
+		// case it is put back.
+		if got, err := readLease(stale); err == nil && got.Holder != a.ShardID && time.Now().Before(got.Expires) {
+			os.Link(stale, path)
+			os.Remove(stale)
+			return false, nil
+		}
+		os.Remove(stale)
+	}
+
+	return false, nil
+}
+
+// releaseChannel releases the lease on the channel cid, if this instance
+// holds it.
+func (a *Archiver) releaseChannel(cid string) {
+	path := a.leasePath(cid)
+	if l, err := readLease(path); err == nil && l.Holder == a.ShardID {
+		os.Remove(path)
+	}
+}
+
+// leaseChannel claims the channel cid if sharding, returning a context
+// derived from ctx for archiving it, which is cancelled if the lease is
+// lost, and a function to release the lease once done. The context is nil
+// if the channel is claimed by another instance.
+//
+// Videos archived into the channel by other instances since this one last
+// looked are marked as archived.
+func (a *Archiver) leaseChannel(ctx context.Context, chc *cachedChannel) (context.Context, func(), error) {
+	if a.ShardID == "" {
+		return ctx, func() {}, nil
+	}
+
+	ok, err := a.claimChannel(chc.ID)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+
+	if videos, described, err := crawlChannel(filepath.Join(a.Root, chc.ID)); err == nil {
+		if chc.Videos == nil && videos != nil {
+			chc.Videos = newVideoSet()
+		}
+		for _, id := range videos.IDs() {
+			chc.Videos.Add(id)
+		}
+		for _, id := range described.IDs() {
+			if chc.Described == nil {
+				chc.Described = newVideoSet()
+			}
+			chc.Described.Add(id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(a.leaseTTL() / 3)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+
+			// Stop, rather than duplicate work, if another instance
+			// has taken over.
+			path := a.leasePath(chc.ID)
+			l, err := readLease(path)
+			if err != nil || l.Holder != a.ShardID {
+				fmt.Printf("[%s] lease lost, stopping\n", chc.ID)
+				cancel()
+				return
+			}
+			l.Expires = time.Now().Add(a.leaseTTL())
+			if dat, err := json.Marshal(l); err == nil {
+				if err := writeFileAtomic(path, dat); err != nil {
+					fmt.Printf("[%s] renewing lease: %v\n", chc.ID, err)
+				}
+			}
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		cancel()
+		a.releaseChannel(chc.ID)
+	}, nil
+}
+
+// withStateLock runs fn, which updates the state shared between instances,
+// holding the state lock if sharding.
+func (a *Archiver) withStateLock(fn func() error) error {
+	if a.ShardID == "" {
+		return fn()
+	}
+
+	dir := filepath.Join(a.Root, StateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, stateLockName)
+	deadline := time.Now().Add(stateLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintln(f, a.ShardID)
+			f.Close()
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > stateLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return ErrStateLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer os.Remove(path)
+
+	return fn()
+}
+
+// saveFailures saves the quarantined and unavailable videos after archiving
+// the channel cid. If sharding, those of other channels are reloaded first,
+// as other instances may have changed them since.
+func (a *Archiver) saveFailures(cid string) error {
+	return a.withStateLock(func() error {
+		if a.ShardID != "" {
+			q, err := loadQuarantine(a.Root)
+			if err != nil {
+				return err
+			}
+			for id, e := range q {
+				if e.ChannelID == cid {
+					delete(q, id)
+				}
+			}
+			for id, e := range a.quarantine {
+				if e.ChannelID == cid {
+					q[id] = e
+				}
+			}
+			a.quarantine = q
+
+			t, err := loadTombstones(a.Root)
+			if err != nil {
+				return err
+			}
+			for id, e := range t {
+				if e.ChannelID == cid {
+					delete(t, id)
+				}
+			}
+			for id, e := range a.unavailable {
+				if e.ChannelID == cid {
+					t[id] = e
+				}
+			}
+			a.unavailable = t
+		}
+
+		if err := saveState(a.Root, stateQuarantine, a.quarantine); err != nil {
+			return err
+		}
+		return saveState(a.Root, stateUnavailable, a.unavailable)
+	})
+}
@@ -0,0 +1,165 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// StateDir is the directory within the archive root in which the archiver
+// keeps its persistent state between runs.
+const StateDir = ".ytarchiver-state"
+
+// Names of the files kept in StateDir.
+const (
+	stateRuns        = "runs.json"
+	stateHistory     = "history.json"
+	stateQuarantine  = "quarantine.json"
+	stateBackfill    = "backfill.json"
+	stateBackfilled  = "backfilled.json"
+	stateChannels    = "channels.json"
+	stateQueue       = "queue.json"
+	stateUnavailable = "unavailable.json"
+	stateForecast    = "forecast.json"
+	stateSeen        = "seen.json"
+	statePending     = "pending.json"
+	stateBreakers    = "breakers.json"
+	stateDownloader  = "downloader.json"
+	stateCanary      = "canary.json"
+	stateDigest      = "digest.json"
+)
+
+// runState records the outcome of previous full archive runs.
+type runState struct {
+	// Start time of the most recent run.
+	LastRun time.Time `json:"last_run"`
+	// Start time of the most recent run which completed without errors.
+	LastSuccess time.Time `json:"last_success"`
+}
+
+// loadState reads the named state file from the archive at root into v.
+// A missing state file is not an error and leaves v untouched.
+func loadState(root, name string, v any) error {
+	return readState(osReader(root), name, v)
+}
+
+// readState is loadState for the root read by read.
+func readState(read readFunc, name string, v any) error {
+	dat, err := read(path.Join(StateDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load state %s: %w", name, err)
+	}
+
+	if err = json.Unmarshal(dat, v); err != nil {
+		return fmt.Errorf("load state %s: %w", name, err)
+	}
+	return nil
+}
+
+// saveState atomically replaces the named state file in the archive at root
+// with the contents of v.
+func saveState(root, name string, v any) error {
+	dir := filepath.Join(root, StateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("save state %s: %w", name, err)
+	}
+
+	dat, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fmt.Errorf("save state %s: %w", name, err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err = os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		return fmt.Errorf("save state %s: %w", name, err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("save state %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// LastRun returns the start times of the most recent full archive run and
+// of the most recent one to complete without errors, as persisted in the
+// archive root. Either is zero if there has been no such run.
+func (a *Archiver) LastRun() (last, lastSuccess time.Time, err error) {
+	var st runState
+	err = loadState(a.Root, stateRuns, &st)
+	return st.LastRun, st.LastSuccess, err
+}
+
+// recordRun persists the outcome of a full archive run started at start.
+func (a *Archiver) recordRun(start time.Time, success bool) error {
+	var st runState
+	if err := loadState(a.Root, stateRuns, &st); err != nil {
+		return err
+	}
+
+	st.LastRun = start
+	if success {
+		st.LastSuccess = start
+	}
+
+	return saveState(a.Root, stateRuns, st)
+}
+
+// backfillStart returns the time at which the channel with the given ID
+// was first archived, recording the current time if it has not been.
+func (a *Archiver) backfillStart(cid string) (time.Time, error) {
+	starts := make(map[string]time.Time)
+	if err := loadState(a.Root, stateBackfill, &starts); err != nil {
+		return time.Time{}, err
+	}
+	if t, ok := starts[cid]; ok {
+		return t, nil
+	}
+
+	now := time.Now()
+	starts[cid] = now
+	return now, saveState(a.Root, stateBackfill, starts)
+}
+
+// backfilled reports if every video of the channel with the given ID has
+// been enumerated, so that only its newest need be listed from now on.
+func (a *Archiver) backfilled(cid string) (bool, error) {
+	done := make(map[string]time.Time)
+	if err := loadState(a.Root, stateBackfilled, &done); err != nil {
+		return false, err
+	}
+	_, ok := done[cid]
+	return ok, nil
+}
+
+// markBackfilled records that every video of the channel with the given ID
+// has been enumerated. Until then, each run over it enumerates them all
+// again, however many were archived by the last.
+func (a *Archiver) markBackfilled(cid string) error {
+	done := make(map[string]time.Time)
+	if err := loadState(a.Root, stateBackfilled, &done); err != nil {
+		return err
+	}
+	if _, ok := done[cid]; ok {
+		return nil
+	}
+
+	done[cid] = time.Now()
+	return saveState(a.Root, stateBackfilled, done)
+}
+
+// inBacklog reports if pi was published before start. Videos with no
+// known publish time are assumed to be new.
+func inBacklog(pi *youtube.PlaylistItem, start time.Time) bool {
+	t, ok := publishedAt(pi)
+	return ok && t.Before(start)
+}
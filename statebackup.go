@@ -0,0 +1,139 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StateBackupVersion is the version of the format written by BackupState.
+const StateBackupVersion = 1
+
+var (
+	ErrStateBackup = errors.New("invalid state backup")
+	ErrStateExists = errors.New("archive already has state")
+)
+
+// stateBackup is the contents of a file written by BackupState.
+type stateBackup struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// IDs of the videos archived in each channel, by channel ID.
+	Seen map[string][]string `json:"seen"`
+	// Contents of each file in StateDir, by name.
+	Files map[string]json.RawMessage `json:"files"`
+}
+
+// BackupState writes the persistent state of the archive at root to w as a
+// single portable file: the videos archived in each channel, the run
+// history, quarantined and unavailable videos, queued videos and the
+// progress through each channel's backlog. It is restored by RestoreState,
+// so that the state survives moving the archive to another host, even if
+// the videos themselves are moved separately.
+func BackupState(root string, w io.Writer) error {
+	b := stateBackup{
+		Version: StateBackupVersion,
+		Created: time.Now(),
+		Seen:    make(map[string][]string),
+		Files:   make(map[string]json.RawMessage),
+	}
+
+	// Include videos restored from an earlier backup which have not been
+	// moved to the root since.
+	if err := loadState(root, stateSeen, &b.Seen); err != nil {
+		return err
+	}
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+		videos, _, err := crawlChannel(filepath.Join(root, c.Name()))
+		if err != nil {
+			return err
+		}
+		ids := append(b.Seen[c.Name()], videos.IDs()...)
+		slices.Sort(ids)
+		if ids = slices.Compact(ids); len(ids) > 0 {
+			b.Seen[c.Name()] = ids
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(root, StateDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, f := range files {
+		// The seen videos are backed up above.
+		if !isStateFile(f.Name()) || f.Name() == stateSeen {
+			continue
+		}
+		var raw json.RawMessage
+		if err := loadState(root, f.Name(), &raw); err != nil {
+			return err
+		}
+		b.Files[f.Name()] = raw
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(b); err != nil {
+		return fmt.Errorf("backup state: %w", err)
+	}
+	return nil
+}
+
+// RestoreState restores the state of the archive at root from a backup
+// written by BackupState to r. Videos recorded as archived by the backup
+// are not downloaded again, whether or not their files are in the root.
+// Unless overwrite is set, the archive must not already have any state.
+//
+// The archiver must not be running on root while its state is restored.
+func RestoreState(root string, r io.Reader, overwrite bool) error {
+	var b stateBackup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return fmt.Errorf("%w: %v", ErrStateBackup, err)
+	}
+	if b.Version < 1 || b.Version > StateBackupVersion {
+		return fmt.Errorf("%w: version %d (this version supports up to %d)", ErrStateBackup, b.Version, StateBackupVersion)
+	}
+	for name := range b.Files {
+		if !isStateFile(name) || name == stateSeen {
+			return fmt.Errorf("%w: unexpected file %q", ErrStateBackup, name)
+		}
+	}
+
+	if !overwrite {
+		files, err := os.ReadDir(filepath.Join(root, StateDir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, f := range files {
+			if isStateFile(f.Name()) {
+				return fmt.Errorf("%w: %s", ErrStateExists, filepath.Join(root, StateDir))
+			}
+		}
+	}
+
+	for name, raw := range b.Files {
+		if err := saveState(root, name, raw); err != nil {
+			return err
+		}
+	}
+	return saveState(root, stateSeen, b.Seen)
+}
+
+// isStateFile reports if name is the name of a file kept in StateDir.
+func isStateFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
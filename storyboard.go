@@ -0,0 +1,153 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of the files of a storyboard, written next to the video.
+const (
+	StoryboardSuffix    = ".storyboard.jpg"
+	StoryboardVTTSuffix = ".storyboard.vtt"
+)
+
+// Dimensions of a storyboard. Each thumbnail is scaled to fit a tile, and
+// at most storyboardColumns*storyboardRows are taken, so that even a long
+// video has a single sprite sheet of modest size.
+const (
+	storyboardTileWidth  = 160
+	storyboardTileHeight = 90
+	storyboardColumns    = 10
+	storyboardRows       = 10
+	// storyboardMinInterval is the least time between thumbnails.
+	storyboardMinInterval = 2 * time.Second
+)
+
+var ErrStoryboard = errors.New("ytarchiver: storyboard")
+
+// ffmpegDuration matches the duration of the input printed by ffmpeg.
+var ffmpegDuration = regexp.MustCompile(`Duration: (\d+):(\d\d):(\d\d(?:\.\d+)?)`)
+
+// GenerateStoryboard generates a storyboard for the video file at path, for
+// previews on a player's seek bar: a sprite sheet of evenly spaced
+// thumbnails, and a WebVTT file giving the region of the sheet shown for
+// each span of the video. ffmpeg is the path to an ffmpeg executable, or
+// empty to look it up in $PATH.
+func GenerateStoryboard(ctx context.Context, ffmpeg, path string) error {
+	ffmpeg, err := lookFFmpeg(ffmpeg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFFmpeg, err)
+	}
+
+	dur, err := videoDuration(ctx, ffmpeg, path)
+	if err != nil {
+		return err
+	}
+
+	maxTiles := storyboardColumns * storyboardRows
+	interval := max(storyboardMinInterval, dur/time.Duration(maxTiles))
+	tiles := min(maxTiles, int(math.Ceil(float64(dur)/float64(interval))))
+	rows := (tiles + storyboardColumns - 1) / storyboardColumns
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	sheet := base + StoryboardSuffix
+	filter := fmt.Sprintf("fps=1/%g,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%[2]d:%[3]d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		interval.Seconds(), storyboardTileWidth, storyboardTileHeight, storyboardColumns, rows)
+
+	proc := exec.CommandContext(ctx, ffmpeg,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", path,
+		"-vf", filter,
+		"-frames:v", "1", "-q:v", "5",
+		"-f", "image2", sheet+".tmp")
+	if out, err := proc.CombinedOutput(); err != nil {
+		os.Remove(sheet + ".tmp")
+		return fmt.Errorf("%w: %s: %v: %s", ErrStoryboard, path, err, bytes.TrimSpace(out))
+	}
+	if err := os.Rename(sheet+".tmp", sheet); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoryboard, err)
+	}
+
+	vtt := &strings.Builder{}
+	vtt.WriteString("WEBVTT\n")
+	for i := range tiles {
+		start := time.Duration(i) * interval
+		end := min(dur, start+interval)
+		x := (i % storyboardColumns) * storyboardTileWidth
+		y := (i / storyboardColumns) * storyboardTileHeight
+
+		fmt.Fprintf(vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), filepath.Base(sheet),
+			x, y, storyboardTileWidth, storyboardTileHeight)
+	}
+
+	vttPath := base + StoryboardVTTSuffix
+	if err := os.WriteFile(vttPath+".tmp", []byte(vtt.String()), 0644); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoryboard, err)
+	}
+	if err := os.Rename(vttPath+".tmp", vttPath); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoryboard, err)
+	}
+
+	return nil
+}
+
+// videoDuration returns the duration of the video at path, as reported by
+// ffmpeg.
+func videoDuration(ctx context.Context, ffmpeg, path string) (time.Duration, error) {
+	// Without an output, ffmpeg describes the input and then fails, so
+	// the exit status is of no interest.
+	out, _ := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-i", path).CombinedOutput()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m := ffmpegDuration.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("%w: %s: no duration found", ErrFFmpeg, path)
+	}
+	h, _ := strconv.Atoi(string(m[1]))
+	mins, _ := strconv.Atoi(string(m[2]))
+	sec, _ := strconv.ParseFloat(string(m[3]), 64)
+
+	dur := time.Duration(h)*time.Hour + time.Duration(mins)*time.Minute + time.Duration(sec*float64(time.Second))
+	if dur <= 0 {
+		return 0, fmt.Errorf("%w: %s: empty video", ErrFFmpeg, path)
+	}
+	return dur, nil
+}
+
+// vttTimestamp formats d as a WebVTT timestamp.
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// videoFile returns the path of the media file of the video with the given
+// ID in dir.
+func videoFile(dir, id string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, id+".*"))
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range matches {
+		_, ext, _ := strings.Cut(filepath.Base(m), ".")
+		if strings.HasSuffix(ext, "json") || isPartialFile(filepath.Base(m)) || isSidecarExt(filepath.Ext(m)) {
+			continue
+		}
+		return m, nil
+	}
+
+	return "", fmt.Errorf("%s: %w", id, os.ErrNotExist)
+}
@@ -0,0 +1,151 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Outcomes of a video considered during an archive run.
+const (
+	// The video was downloaded.
+	OutcomeDownloaded = "downloaded"
+	// Only the metadata of the video was archived.
+	OutcomeMetadata = "metadata"
+	// The video was not downloaded; see VideoOutcome.Reason.
+	OutcomeSkipped = "skipped"
+	// The video failed to download; see VideoOutcome.ErrorClass.
+	OutcomeFailed = "failed"
+)
+
+// Classes of error with which a video may fail.
+const (
+	ErrorClassDownloader  = "downloader"
+	ErrorClassMetadata    = "metadata"
+	ErrorClassPanic       = "panic"
+	ErrorClassCanceled    = "canceled"
+	ErrorClassUnavailable = "unavailable"
+	ErrorClassOther       = "other"
+)
+
+// VideoOutcome records what became of a single new video during a run.
+// Videos which had already been archived are not included.
+type VideoOutcome struct {
+	VideoID   string `json:"video_id"`
+	ChannelID string `json:"channel_id"`
+	Title     string `json:"title"`
+	// One of the Outcome* constants.
+	Outcome string `json:"outcome"`
+	// Why the video was skipped, such as the selector which rejected it.
+	Reason string `json:"reason,omitempty"`
+	// One of the ErrorClass* constants, and the error itself, if the
+	// video failed.
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ArchiveSummary describes the outcome of each video considered during an
+// archive run.
+type ArchiveSummary struct {
+	Start    time.Time      `json:"start"`
+	End      time.Time      `json:"end"`
+	Channels int            `json:"channels"`
+	Videos   []VideoOutcome `json:"videos"`
+}
+
+// Count returns the number of videos in s with the given outcome.
+func (s *ArchiveSummary) Count(outcome string) int {
+	n := 0
+	for _, v := range s.Videos {
+		if v.Outcome == outcome {
+			n++
+		}
+	}
+
+	return n
+}
+
+// errorClass classifies the cause of a video failure.
+func errorClass(err error) string {
+	var ue UnavailableError
+	switch {
+	case errors.As(err, &ue):
+		return ErrorClassUnavailable
+	case errors.Is(err, ErrWorkerPanic):
+		return ErrorClassPanic
+	case errors.Is(err, ErrYoutubeDownloader):
+		return ErrorClassDownloader
+	case errors.Is(err, ErrVideoMeta):
+		return ErrorClassMetadata
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassCanceled
+	default:
+		return ErrorClassOther
+	}
+}
+
+// DescribeSelector returns a short description of m, as used in skip
+// reasons.
+func DescribeSelector(m VideoSelector) string {
+	if s, ok := m.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", m)
+}
+
+// runOutcomes collects the outcomes of the videos considered during a run.
+// It is only touched with runMut held.
+type runOutcomes struct {
+	videos []VideoOutcome
+	// index of each video in videos, for those whose outcome is not yet
+	// known.
+	pending map[string]int
+}
+
+// Skip records that pi was skipped for the given reason.
+func (o *runOutcomes) Skip(pi *youtube.PlaylistItem, reason string) {
+	o.add(pi, OutcomeSkipped).Reason = reason
+}
+
+// Queue records that pi has been queued for archiving. Until Done or Fail
+// is called for it, it is treated as cancelled.
+func (o *runOutcomes) Queue(pi *youtube.PlaylistItem) {
+	v := o.add(pi, OutcomeFailed)
+	v.ErrorClass, v.Error = ErrorClassCanceled, "never attempted"
+
+	if o.pending == nil {
+		o.pending = make(map[string]int)
+	}
+	o.pending[v.VideoID] = len(o.videos) - 1
+}
+
+// Done records that the queued video id completed with the given outcome.
+func (o *runOutcomes) Done(id string, outcome string) {
+	if i, ok := o.pending[id]; ok {
+		v := &o.videos[i]
+		v.Outcome, v.ErrorClass, v.Error = outcome, "", ""
+		delete(o.pending, id)
+	}
+}
+
+// Fail records that the queued video id failed with err.
+func (o *runOutcomes) Fail(id string, err error) {
+	if i, ok := o.pending[id]; ok {
+		v := &o.videos[i]
+		v.ErrorClass, v.Error = errorClass(err), err.Error()
+		delete(o.pending, id)
+	}
+}
+
+func (o *runOutcomes) add(pi *youtube.PlaylistItem, outcome string) *VideoOutcome {
+	o.videos = append(o.videos, VideoOutcome{
+		VideoID:   pi.ContentDetails.VideoId,
+		ChannelID: pi.Snippet.ChannelId,
+		Title:     pi.Snippet.Title,
+		Outcome:   outcome,
+	})
+	return &o.videos[len(o.videos)-1]
+}
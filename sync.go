@@ -0,0 +1,195 @@
+package ytarchiver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateSync records the files of the root which have been synced to
+// Config.SyncRemote.
+const stateSync = "sync.json"
+
+// rcloneLinkSuffix is appended by rclone to the names of symlinks which it
+// copies as files (with --links).
+const rcloneLinkSuffix = ".rclonelink"
+
+// A syncedFile is the version of a file of the root last synced.
+type syncedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// syncExcluded reports if the file of the root with the slash-separated
+// path rel is never synced: the archiver's state and partial downloads.
+func syncExcluded(rel string) bool {
+	return strings.HasPrefix(rel, ".") || isPartialFile(path.Base(rel))
+}
+
+// pendingSync returns the slash-separated paths of the files of the root
+// which have changed since they were last synced according to synced, and
+// the current version of every file.
+func pendingSync(root string, synced map[string]syncedFile) ([]string, map[string]syncedFile, error) {
+	var pending []string
+	current := make(map[string]syncedFile)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if syncExcluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		// Links into the object store are synced as links.
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := syncedFile{fi.Size(), fi.ModTime().UTC()}
+		current[rel] = f
+		if old, ok := synced[rel]; !ok || old.Size != f.Size || !old.ModTime.Equal(f.ModTime) {
+			pending = append(pending, rel)
+		}
+		return nil
+	})
+
+	return pending, current, err
+}
+
+// rcloneLog is a line of the JSON log of rclone.
+type rcloneLog struct {
+	Level  string `json:"level"`
+	Msg    string `json:"msg"`
+	Object string `json:"object"`
+}
+
+// syncRemote copies the files of the root which have changed since the last
+// sync to Config.SyncRemote using rclone. Each file copied is recorded as
+// it is, so that an interrupted or failed sync resumes with the files which
+// were not.
+func (a *Archiver) syncRemote(ctx context.Context) error {
+	if a.SyncRemote == "" {
+		return nil
+	}
+
+	synced := make(map[string]syncedFile)
+	if err := loadState(a.Root, stateSync, &synced); err != nil {
+		return err
+	}
+	pending, current, err := pendingSync(a.Root, synced)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	fmt.Printf("[sync] copying %d file(s) to %s\n", len(pending), a.SyncRemote)
+
+	list, err := os.CreateTemp("", "ytarchiver-sync-*")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+	defer os.Remove(list.Name())
+	_, err = io.WriteString(list, strings.Join(pending, "\n")+"\n")
+	if cerr := list.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+
+	args := []string{"copy", "--files-from-raw", list.Name(), "--use-json-log", "--verbose"}
+	if a.ContentAddressed {
+		args = append(args, "--links")
+	}
+	args = append(append(args, a.RcloneArgs...), a.Root, a.SyncRemote)
+	exe, err := lookRclone(a.Rclone)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %v", ErrSync, err)
+	}
+
+	// Files are only recorded as synced once rclone reports them copied,
+	// unless it succeeds overall, as unchanged files are not reported.
+	var lastErr string
+	copied := 0
+	sc := bufio.NewScanner(stderr)
+	for sc.Scan() {
+		var l rcloneLog
+		if json.Unmarshal(sc.Bytes(), &l) != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l.Msg, "Copied"):
+			obj := strings.TrimSuffix(l.Object, rcloneLinkSuffix)
+			if f, ok := current[obj]; ok {
+				synced[obj] = f
+				copied++
+			}
+		case l.Level == "error":
+			lastErr = l.Msg
+			if l.Object != "" {
+				lastErr = l.Object + ": " + l.Msg
+			}
+		}
+	}
+	err = cmd.Wait()
+
+	if err == nil {
+		synced = current
+	} else {
+		// Forget files which no longer exist.
+		for rel := range synced {
+			if _, ok := current[rel]; !ok {
+				delete(synced, rel)
+			}
+		}
+	}
+	if serr := saveState(a.Root, stateSync, synced); serr != nil && err == nil {
+		return serr
+	}
+
+	if err != nil {
+		if lastErr != "" {
+			return fmt.Errorf("%w: %v (%d of %d file(s) copied): %s", ErrSync, err, copied, len(pending), lastErr)
+		}
+		return fmt.Errorf("%w: %v (%d of %d file(s) copied)", ErrSync, err, copied, len(pending))
+	}
+	return nil
+}
+
+// lookRclone returns exe, or the path of rclone in $PATH if exe is empty.
+func lookRclone(exe string) (string, error) {
+	if exe == "" {
+		return exec.LookPath("rclone")
+	}
+	return exe, nil
+}
@@ -0,0 +1,264 @@
+package ytarchiver
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Sources of the videos in a Google Takeout export.
+const (
+	TakeoutHistory    = "history"
+	TakeoutWatchLater = "watch-later"
+	TakeoutLiked      = "liked"
+	// Any other playlist.
+	TakeoutPlaylist = "playlist"
+)
+
+var ErrTakeout = errors.New("ytarchiver: takeout")
+
+// A TakeoutVideo is a video found in a Google Takeout export.
+type TakeoutVideo struct {
+	VideoID string
+	// Empty if the export does not say, as for playlists.
+	ChannelID string
+	// One of the Takeout* sources, and the name of the playlist if the
+	// video is from one.
+	Source   string
+	Playlist string
+}
+
+// takeoutHistoryEntry is an entry of watch-history.json.
+type takeoutHistoryEntry struct {
+	TitleURL  string `json:"titleUrl"`
+	Subtitles []struct {
+		URL string `json:"url"`
+	} `json:"subtitles"`
+}
+
+// takeoutHistoryLink matches a watched video in watch-history.html, and the
+// link to its channel which follows if it is still known.
+var takeoutHistoryLink = regexp.MustCompile(`href="(https://www\.youtube\.com/watch\?v=[\w-]+)"[^>]*>[^<]*</a>(?:<br>\s*<a href="(https://www\.youtube\.com/channel/[\w-]+)")?`)
+
+// ReadTakeout reads the videos in the YouTube watch history and playlists
+// (including watch later and liked videos) of a Google Takeout export at
+// path, which is either the zip file as downloaded or the directory it was
+// extracted into. The watch history may be exported as JSON or HTML. Each
+// video is returned once per source it appears in.
+func ReadTakeout(path string) ([]TakeoutVideo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTakeout, err)
+	}
+	if fi.IsDir() {
+		return readTakeoutFS(os.DirFS(path))
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTakeout, err)
+	}
+	defer zr.Close()
+	return readTakeoutFS(zr)
+}
+
+func readTakeoutFS(fsys fs.FS) ([]TakeoutVideo, error) {
+	var videos []TakeoutVideo
+	seen := make(map[TakeoutVideo]bool)
+	add := func(v TakeoutVideo) {
+		if v.VideoID != "" && !seen[v] {
+			seen[v] = true
+			videos = append(videos, v)
+		}
+	}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name := path.Base(p)
+		var vids []TakeoutVideo
+		switch {
+		case name == "watch-history.json":
+			vids, err = readTakeoutHistoryJSON(fsys, p)
+		case name == "watch-history.html":
+			vids, err = readTakeoutHistoryHTML(fsys, p)
+		case path.Base(path.Dir(p)) == "playlists" && path.Ext(name) == ".csv":
+			vids, err = readTakeoutPlaylist(fsys, p)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, v := range vids {
+			add(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTakeout, err)
+	}
+	if len(videos) == 0 {
+		return nil, fmt.Errorf("%w: no YouTube history or playlists found", ErrTakeout)
+	}
+
+	return videos, nil
+}
+
+// takeoutVideo returns the video of the watch URL watch, uploaded by the
+// channel at the URL channel if known.
+func takeoutVideo(watch, channel string) TakeoutVideo {
+	v := TakeoutVideo{Source: TakeoutHistory}
+	if t, err := parseTargetURL(watch); err == nil && t.Kind == targetVideo {
+		v.VideoID = t.ID
+	}
+	if t, err := parseTargetURL(channel); err == nil && t.Kind == targetChannel {
+		v.ChannelID = t.Channel.ID
+	}
+	return v
+}
+
+func readTakeoutHistoryJSON(fsys fs.FS, name string) ([]TakeoutVideo, error) {
+	dat, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []takeoutHistoryEntry
+	if err := json.Unmarshal(dat, &entries); err != nil {
+		return nil, err
+	}
+
+	var videos []TakeoutVideo
+	for _, e := range entries {
+		// Videos since removed have no URL.
+		if e.TitleURL == "" {
+			continue
+		}
+		channel := ""
+		if len(e.Subtitles) > 0 {
+			channel = e.Subtitles[0].URL
+		}
+		videos = append(videos, takeoutVideo(e.TitleURL, channel))
+	}
+
+	return videos, nil
+}
+
+func readTakeoutHistoryHTML(fsys fs.FS, name string) ([]TakeoutVideo, error) {
+	dat, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var videos []TakeoutVideo
+	for _, m := range takeoutHistoryLink.FindAllStringSubmatch(string(dat), -1) {
+		videos = append(videos, takeoutVideo(m[1], m[2]))
+	}
+	return videos, nil
+}
+
+// readTakeoutPlaylist reads the playlist CSV file name. Newer exports name
+// the file after the playlist with a "-videos" suffix and give just its
+// videos; older ones give the details of the playlist before a blank line.
+// Either way, the videos follow a header with a "Video ID" column.
+func readTakeoutPlaylist(fsys fs.FS, name string) ([]TakeoutVideo, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	title := strings.TrimSuffix(strings.TrimSuffix(path.Base(name), ".csv"), "-videos")
+	source := TakeoutPlaylist
+	switch strings.ToLower(title) {
+	case "watch later":
+		source = TakeoutWatchLater
+	case "liked videos", "liked music":
+		source = TakeoutLiked
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	col := -1
+	var videos []TakeoutVideo
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if col < 0 {
+			col = slices.IndexFunc(rec, func(s string) bool {
+				return strings.EqualFold(strings.TrimSpace(s), "video id")
+			})
+			continue
+		}
+		if col < len(rec) && strings.TrimSpace(rec[col]) != "" {
+			videos = append(videos, TakeoutVideo{VideoID: strings.TrimSpace(rec[col]), Source: source, Playlist: title})
+		}
+	}
+
+	return videos, nil
+}
+
+// TakeoutTargets groups videos by their channel into channels to archive,
+// each with an IDSelector of its videos, ordered by channel ID. The channels
+// of videos for which the export did not say are looked up using cl, which
+// takes a request per 50 videos; those no longer available are left out.
+func TakeoutTargets(ctx context.Context, cl YouTubeClient, videos []TakeoutVideo) ([]YouTubeChannel, error) {
+	byChannel := make(map[string][]string)
+	var unknown []string
+	looked := make(map[string]bool)
+	for _, v := range videos {
+		switch {
+		case v.ChannelID != "":
+			byChannel[v.ChannelID] = append(byChannel[v.ChannelID], v.VideoID)
+		case !looked[v.VideoID]:
+			looked[v.VideoID] = true
+			unknown = append(unknown, v.VideoID)
+		}
+	}
+
+	missing := 0
+	for len(unknown) > 0 {
+		batch := unknown[:min(videoBatchSize, len(unknown))]
+		unknown = unknown[len(batch):]
+
+		vids, err := cl.ListVideos(ctx, []string{"snippet"}, batch)
+		if err != nil {
+			return nil, fmt.Errorf("%w: look up videos: %v", ErrTakeout, err)
+		}
+		missing += len(batch) - len(vids)
+		for _, v := range vids {
+			byChannel[v.Snippet.ChannelId] = append(byChannel[v.Snippet.ChannelId], v.Id)
+		}
+	}
+	if missing > 0 {
+		fmt.Printf("takeout: %d video(s) no longer available\n", missing)
+	}
+
+	chans := make([]YouTubeChannel, 0, len(byChannel))
+	for cid, ids := range byChannel {
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+		chans = append(chans, YouTubeChannel{ID: cid, Selectors: []VideoSelector{NewIDSelector(ids)}})
+	}
+	slices.SortFunc(chans, func(a, b YouTubeChannel) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return chans, nil
+}
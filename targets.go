@@ -0,0 +1,143 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrTargetURL = errors.New("ytarchiver: unsupported target URL")
+
+// Kinds of target URL.
+const (
+	targetChannel = iota
+	targetPlaylist
+	targetVideo
+)
+
+// target is a parsed target URL.
+type target struct {
+	Kind int
+	// Set for targetChannel.
+	Channel YouTubeChannel
+	// ID of the playlist or video.
+	ID string
+}
+
+// parseTargetURL parses a YouTube URL into a target. Channel tab URLs (e.g
+// /@handle/streams) are taken to mean the whole channel.
+func parseTargetURL(raw string) (target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return target{}, fmt.Errorf("%w: %v", ErrTargetURL, err)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	if host == "youtu.be" && path[0] != "" {
+		return target{Kind: targetVideo, ID: path[0]}, nil
+	}
+	if host != "youtube.com" && host != "music.youtube.com" {
+		return target{}, fmt.Errorf("%w: %s", ErrTargetURL, raw)
+	}
+
+	switch {
+	case path[0] == "watch" && u.Query().Get("v") != "":
+		return target{Kind: targetVideo, ID: u.Query().Get("v")}, nil
+	case path[0] == "playlist" && u.Query().Get("list") != "":
+		return target{Kind: targetPlaylist, ID: u.Query().Get("list")}, nil
+	case len(path) < 2 && !strings.HasPrefix(path[0], "@"):
+		return target{}, fmt.Errorf("%w: %s", ErrTargetURL, raw)
+	case path[0] == "shorts", path[0] == "live", path[0] == "embed":
+		return target{Kind: targetVideo, ID: path[1]}, nil
+	case path[0] == "channel":
+		return target{Kind: targetChannel, Channel: YouTubeChannel{ID: path[1]}}, nil
+	case path[0] == "user":
+		return target{Kind: targetChannel, Channel: YouTubeChannel{Username: path[1]}}, nil
+	case path[0] == "c":
+		// Most custom URLs became handles of the same name.
+		return target{Kind: targetChannel, Channel: YouTubeChannel{Handle: path[1]}}, nil
+	case strings.HasPrefix(path[0], "@"):
+		return target{Kind: targetChannel, Channel: YouTubeChannel{Handle: path[0]}}, nil
+	default:
+		return target{}, fmt.Errorf("%w: %s", ErrTargetURL, raw)
+	}
+}
+
+// CheckURL returns an error if raw is not a URL accepted by ResolveURLs,
+// without looking anything up.
+func CheckURL(raw string) error {
+	_, err := parseTargetURL(raw)
+	return err
+}
+
+// ResolveURLs resolves YouTube URLs into channels to archive, looking up the
+// owners of any playlists and videos. Channel URLs (including those of
+// individual tabs) archive the whole channel, playlist URLs archive the
+// videos in the playlist and video URLs archive just those videos; videos
+// on the same channel are combined.
+func ResolveURLs(ctx context.Context, cl YouTubeClient, urls []string) ([]YouTubeChannel, error) {
+	var chans []YouTubeChannel
+	var videos []string
+	for _, raw := range urls {
+		t, err := parseTargetURL(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.Kind {
+		case targetChannel:
+			chans = append(chans, t.Channel)
+		case targetPlaylist:
+			// Private playlists are empty to anyone else, and may be
+			// empty anyway.
+			if isPrivatePlaylist(t.ID) {
+				chans = append(chans, YouTubeChannel{Mine: true, PlaylistID: t.ID})
+				continue
+			}
+			// The owner of a playlist is the channel of each of its
+			// items.
+			r, err := cl.ListPlaylistItems(ctx, t.ID, "")
+			if err != nil {
+				return nil, fmt.Errorf("resolve %s: %w", raw, err)
+			}
+			if len(r.Items) == 0 {
+				return nil, fmt.Errorf("resolve %s: %w", raw, ErrEmptyResults)
+			}
+			chans = append(chans, YouTubeChannel{ID: r.Items[0].Snippet.ChannelId, PlaylistID: t.ID})
+		case targetVideo:
+			videos = append(videos, t.ID)
+		}
+	}
+
+	byChannel := make(map[string]int)
+	for len(videos) > 0 {
+		batch := videos[:min(videoBatchSize, len(videos))]
+		videos = videos[len(batch):]
+
+		vids, err := cl.ListVideos(ctx, []string{"snippet"}, batch)
+		if err != nil {
+			return nil, fmt.Errorf("resolve videos: %w", err)
+		}
+		if len(vids) < len(batch) {
+			fmt.Printf("resolve videos: %d of %d not found\n", len(batch)-len(vids), len(batch))
+		}
+
+		for _, v := range vids {
+			cid := v.Snippet.ChannelId
+			i, ok := byChannel[cid]
+			if !ok {
+				i = len(chans)
+				byChannel[cid] = i
+				chans = append(chans, YouTubeChannel{ID: cid})
+			}
+			chans[i].VideoIDs = append(chans[i].VideoIDs, v.Id)
+		}
+	}
+
+	return chans, nil
+}
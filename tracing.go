@@ -0,0 +1,53 @@
+package ytarchiver
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created by the
+// archiver.
+const tracerName = "github.com/ejv2/yt-archiver"
+
+// Span attribute keys.
+const (
+	attrChannelID    = "ytarchiver.channel.id"
+	attrVideoID      = "ytarchiver.video.id"
+	attrMetadataOnly = "ytarchiver.video.metadata_only"
+	attrChannels     = "ytarchiver.channels"
+)
+
+// tracerProvider returns the configured tracer provider, or the global one
+// if none is configured.
+func (c Config) tracerProvider() trace.TracerProvider {
+	if c.TracerProvider != nil {
+		return c.TracerProvider
+	}
+
+	return otel.GetTracerProvider()
+}
+
+// tracedTransport wraps base so that each API request is recorded as a
+// span named after the API resource requested (e.g "youtube/v3/videos"),
+// which indicates its cost in quota.
+func tracedTransport(base http.RoundTripper, tp trace.TracerProvider) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithTracerProvider(tp),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
+
+// endSpan ends span, first recording err if it is non-nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
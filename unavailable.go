@@ -0,0 +1,168 @@
+package ytarchiver
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reasons for which the downloader may report a video to be permanently
+// unavailable.
+const (
+	UnavailableGeoBlocked  = "geo-blocked"
+	UnavailableCopyright   = "copyright"
+	UnavailableRemoved     = "removed"
+	UnavailablePrivate     = "private"
+	UnavailableTerminated  = "terminated"
+	UnavailableMembersOnly = "members-only"
+)
+
+// unavailablePhrases map phrases in the errors printed by the downloader to
+// the reasons they give, most specific first. They are matched without
+// regard to case.
+var unavailablePhrases = []struct{ phrase, reason string }{
+	{"available in your country", UnavailableGeoBlocked},
+	{"blocked it in your country", UnavailableGeoBlocked},
+	{"copyright claim", UnavailableCopyright},
+	{"copyright grounds", UnavailableCopyright},
+	{"account associated with this video has been terminated", UnavailableTerminated},
+	{"private video", UnavailablePrivate},
+	{"members-only", UnavailableMembersOnly},
+	{"removed by the uploader", UnavailableRemoved},
+	{"violating youtube's terms of service", UnavailableRemoved},
+	{"video unavailable", UnavailableRemoved},
+}
+
+// An UnavailableError is returned for a video which the downloader reports
+// to be permanently unavailable, for one of the Unavailable* reasons.
+type UnavailableError struct {
+	Reason string
+	// Error printed by the downloader.
+	Message string
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("video unavailable (%s): %s", e.Reason, e.Message)
+}
+
+// unavailableError returns the UnavailableError described by the errors
+// printed by the downloader to stderr, if any.
+func unavailableError(stderr string) (UnavailableError, bool) {
+	sc := bufio.NewScanner(strings.NewReader(stderr))
+	for sc.Scan() {
+		msg, ok := strings.CutPrefix(sc.Text(), "ERROR: ")
+		if !ok {
+			continue
+		}
+
+		lower := strings.ToLower(msg)
+		for _, p := range unavailablePhrases {
+			if strings.Contains(lower, p.phrase) {
+				return UnavailableError{Reason: p.reason, Message: msg}, true
+			}
+		}
+	}
+
+	return UnavailableError{}, false
+}
+
+// An UnavailableVideo is a video which the downloader reported to be
+// permanently unavailable, and so is no longer attempted (see
+// Config.Unavailable).
+type UnavailableVideo struct {
+	VideoID   string `json:"-"`
+	ChannelID string `json:"channel_id"`
+	// One of the Unavailable* reasons, and the error printed by the
+	// downloader when last checked.
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	// When the video was first found to be unavailable, and last found to
+	// be still unavailable.
+	FirstSeen   time.Time `json:"first_seen"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// tombstones maps the IDs of unavailable videos to their records. It is
+// persisted in the state directory.
+type tombstones map[string]UnavailableVideo
+
+func loadTombstones(root string) (tombstones, error) {
+	t := make(tombstones)
+	err := loadState(root, stateUnavailable, &t)
+	return t, err
+}
+
+// Allowed reports if the video id may be attempted at now, given that
+// unavailable videos are checked again every recheck, or never if zero.
+func (t tombstones) Allowed(id string, now time.Time, recheck time.Duration) bool {
+	e, ok := t[id]
+	if !ok {
+		return true
+	}
+
+	return recheck > 0 && !now.Before(e.LastChecked.Add(recheck))
+}
+
+// Mark records that the video id on channel cid was found to be unavailable
+// at now.
+func (t tombstones) Mark(cid, id string, err UnavailableError, now time.Time) {
+	e, ok := t[id]
+	if !ok {
+		e.FirstSeen = now
+	}
+	e.ChannelID = cid
+	e.Reason = err.Reason
+	e.Message = err.Message
+	e.LastChecked = now
+
+	t[id] = e
+}
+
+// ReadUnavailable returns the unavailable videos of the archive at root,
+// ordered by ID.
+func ReadUnavailable(root string) ([]UnavailableVideo, error) {
+	return readUnavailable(osReader(root))
+}
+
+// readUnavailable is ReadUnavailable for the root read by read.
+func readUnavailable(read readFunc) ([]UnavailableVideo, error) {
+	t := make(tombstones)
+	if err := readState(read, stateUnavailable, &t); err != nil {
+		return nil, err
+	}
+
+	vids := make([]UnavailableVideo, 0, len(t))
+	for id, e := range t {
+		e.VideoID = id
+		vids = append(vids, e)
+	}
+	sort.Slice(vids, func(i, j int) bool {
+		return vids[i].VideoID < vids[j].VideoID
+	})
+
+	return vids, nil
+}
+
+// ClearUnavailable removes the videos with the given IDs from the
+// unavailable videos of the archive at root, so that they are attempted
+// again on the next run which comes across them. If no IDs are given, every
+// video is removed.
+//
+// Changes made while an archive run is in progress may be lost.
+func ClearUnavailable(root string, ids ...string) error {
+	t, err := loadTombstones(root)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		clear(t)
+	}
+	for _, id := range ids {
+		delete(t, id)
+	}
+
+	return saveState(root, stateUnavailable, t)
+}
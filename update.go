@@ -0,0 +1,335 @@
+package ytarchiver
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Policies for keeping the downloader up to date, as extractors are often
+// broken by changes to YouTube. See UpdateDownloader.
+const (
+	// Leave the downloader alone.
+	DownloaderUpdateOff = iota
+	// Run the downloader's own self-update (-U, or --update-to if pinned).
+	// Requires a yt-dlp release binary which its user may write to.
+	DownloaderUpdateSelf
+	// Download yt-dlp releases into Config.DownloaderDir, verified against
+	// their published checksums, and use those in place of
+	// Config.Downloader.
+	DownloaderUpdateManaged
+)
+
+const (
+	// defaultDownloaderUpdateInterval is used if
+	// Config.DownloaderUpdateInterval is zero.
+	defaultDownloaderUpdateInterval = 24 * time.Hour
+	// downloaderDir is the directory in StateDir into which managed
+	// releases are downloaded if Config.DownloaderDir is empty.
+	downloaderDir = "bin"
+	// ytDlpLatestURL describes the latest release of yt-dlp.
+	ytDlpLatestURL = "https://api.github.com/repos/yt-dlp/yt-dlp/releases/latest"
+	// ytDlpDownloadURL is followed by the tag and name of an asset of a
+	// release of yt-dlp.
+	ytDlpDownloadURL = "https://github.com/yt-dlp/yt-dlp/releases/download/"
+	// ytDlpSums is the asset of each release listing the SHA-256 hashes
+	// of the others.
+	ytDlpSums = "SHA2-256SUMS"
+)
+
+var ErrDownloaderUpdate = errors.New("ytarchiver: update downloader")
+
+// downloaderState records the last check for a downloader update.
+type downloaderState struct {
+	Checked time.Time `json:"checked"`
+	Version string    `json:"version"`
+	// Path of the managed release in use, if any.
+	Path string `json:"path,omitempty"`
+}
+
+// UpdateDownloader updates the downloader of cfg as set by
+// Config.DownloaderUpdate, to Config.DownloaderPin if set or else the
+// latest release, and returns the downloader to use from then on. With
+// DownloaderUpdateOff, the downloader is only detected.
+//
+// The archiver does this itself before a run every
+// Config.DownloaderUpdateInterval.
+func UpdateDownloader(ctx context.Context, cfg Config) (DownloaderInfo, error) {
+	var (
+		dl  DownloaderInfo
+		err error
+	)
+	switch cfg.DownloaderUpdate {
+	case DownloaderUpdateSelf:
+		dl, err = selfUpdate(ctx, cfg)
+	case DownloaderUpdateManaged:
+		dl, err = managedUpdate(ctx, cfg)
+	default:
+		return DetectDownloader(cfg.Downloader)
+	}
+	if err != nil {
+		return dl, fmt.Errorf("%w: %v", ErrDownloaderUpdate, err)
+	}
+
+	st := downloaderState{Checked: time.Now(), Version: dl.Version}
+	if cfg.DownloaderUpdate == DownloaderUpdateManaged {
+		st.Path = dl.Path
+	}
+	return dl, saveState(cfg.Root, stateDownloader, st)
+}
+
+// selfUpdate runs the downloader's self-update.
+func selfUpdate(ctx context.Context, cfg Config) (DownloaderInfo, error) {
+	dl, err := DetectDownloader(cfg.Downloader)
+	if err != nil {
+		return dl, err
+	}
+
+	args := []string{"-U"}
+	if cfg.DownloaderPin != "" {
+		if dl.Version == cfg.DownloaderPin {
+			return dl, nil
+		}
+		if !dl.Supports("--update-to") {
+			return dl, fmt.Errorf("%s (%s) cannot update to a given release", cfg.Downloader, dl)
+		}
+		args = []string{"--update-to", cfg.DownloaderPin}
+	} else if !dl.Supports("--update") {
+		return dl, fmt.Errorf("%s (%s) cannot update itself", cfg.Downloader, dl)
+	}
+
+	out, err := exec.CommandContext(ctx, cfg.Downloader, args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return dl, fmt.Errorf("%s %s: %v: %s", cfg.Downloader, args[0], err, lines[len(lines)-1])
+	}
+	return DetectDownloader(cfg.Downloader)
+}
+
+// ytDlpAsset returns the name of the asset of each yt-dlp release which
+// runs on this platform.
+func ytDlpAsset() string {
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "linux/amd64":
+		return "yt-dlp_linux"
+	case "linux/arm64":
+		return "yt-dlp_linux_aarch64"
+	case "linux/arm":
+		return "yt-dlp_linux_armv7l"
+	case "darwin/amd64", "darwin/arm64":
+		return "yt-dlp_macos"
+	case "windows/amd64":
+		return "yt-dlp.exe"
+	case "windows/386":
+		return "yt-dlp_x86.exe"
+	default:
+		// Needs Python.
+		return "yt-dlp"
+	}
+}
+
+// managedDir returns the directory into which managed releases are
+// downloaded.
+func managedDir(cfg Config) string {
+	if cfg.DownloaderDir != "" {
+		return cfg.DownloaderDir
+	}
+	return filepath.Join(cfg.Root, StateDir, downloaderDir)
+}
+
+// managedUpdate downloads the release of yt-dlp to use into the managed
+// directory, unless it is already there, removing any other releases but
+// the one in use before.
+func managedUpdate(ctx context.Context, cfg Config) (DownloaderInfo, error) {
+	var st downloaderState
+	if err := loadState(cfg.Root, stateDownloader, &st); err != nil {
+		return DownloaderInfo{}, err
+	}
+	hc := &http.Client{Transport: tracedTransport(http.DefaultTransport, cfg.tracerProvider())}
+
+	tag := cfg.DownloaderPin
+	if tag == "" {
+		var rel struct {
+			TagName string `json:"tag_name"`
+		}
+		if err := getJSON(ctx, hc, ytDlpLatestURL, &rel); err != nil {
+			return DownloaderInfo{}, fmt.Errorf("latest release: %w", err)
+		}
+		tag = rel.TagName
+	}
+	if tag == "" || strings.ContainsAny(tag, `/\`) || strings.HasPrefix(tag, ".") {
+		return DownloaderInfo{}, fmt.Errorf("bad release tag %q", tag)
+	}
+
+	dir := managedDir(cfg)
+	asset := ytDlpAsset()
+	path := filepath.Join(dir, tag, asset)
+	if dl, err := DetectDownloader(path); err == nil {
+		return dl, nil
+	}
+
+	sum, err := releaseSum(ctx, hc, tag, asset)
+	if err != nil {
+		return DownloaderInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return DownloaderInfo{}, err
+	}
+	if err := downloadRelease(ctx, hc, ytDlpDownloadURL+tag+"/"+asset, path, sum); err != nil {
+		return DownloaderInfo{}, fmt.Errorf("download %s %s: %w", tag, asset, err)
+	}
+	dl, err := DetectDownloader(path)
+	if err != nil {
+		return dl, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// The previous release is kept to fall back on.
+	rels, _ := os.ReadDir(dir)
+	for _, r := range rels {
+		if r.Name() != tag && filepath.Join(dir, r.Name()) != filepath.Dir(st.Path) {
+			os.RemoveAll(filepath.Join(dir, r.Name()))
+		}
+	}
+	return dl, nil
+}
+
+// releaseSum returns the published SHA-256 hash of asset of the yt-dlp
+// release tag.
+func releaseSum(ctx context.Context, hc *http.Client, tag, asset string) (string, error) {
+	resp, err := get(ctx, hc, ytDlpDownloadURL+tag+"/"+ytDlpSums)
+	if err != nil {
+		return "", fmt.Errorf("checksums of %s: %w", tag, err)
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		sum, name, ok := strings.Cut(sc.Text(), "  ")
+		if ok && name == asset {
+			return sum, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("checksums of %s: %w", tag, err)
+	}
+	return "", fmt.Errorf("checksums of %s: no %s", tag, asset)
+}
+
+// downloadRelease downloads url to path, which is only replaced if the
+// download is complete and has the SHA-256 hash sum.
+func downloadRelease(ctx context.Context, hc *http.Client, url, path, sum string) error {
+	resp, err := get(ctx, hc, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".tmp")
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("hash %s does not match published %s", got, sum)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// get requests url, failing unless it succeeds.
+func get(ctx context.Context, hc *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// getJSON requests url and decodes the JSON response into v.
+func getJSON(ctx context.Context, hc *http.Client, url string, v any) error {
+	resp, err := get(ctx, hc, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// startDownloader returns the downloader to use when the archiver is
+// created: the managed release in use, if there is one, or else that
+// configured. If managing releases, one is downloaded if there is none.
+func (a *Archiver) startDownloader() (DownloaderInfo, error) {
+	if a.DownloaderUpdate != DownloaderUpdateManaged {
+		return DetectDownloader(a.Downloader)
+	}
+
+	var st downloaderState
+	if err := loadState(a.Root, stateDownloader, &st); err != nil {
+		return DownloaderInfo{}, err
+	}
+	if st.Path != "" {
+		if dl, err := DetectDownloader(st.Path); err == nil {
+			return dl, nil
+		}
+	}
+	return UpdateDownloader(a.ctx, a.Config)
+}
+
+// maintainDownloader updates the downloader if an update is due. Failing
+// to is only printed, as the current downloader may yet work. runMut must
+// be held.
+func (a *Archiver) maintainDownloader() {
+	if a.DownloaderUpdate == DownloaderUpdateOff {
+		return
+	}
+	interval := a.DownloaderUpdateInterval
+	if interval == 0 {
+		interval = defaultDownloaderUpdateInterval
+	}
+	var st downloaderState
+	if err := loadState(a.Root, stateDownloader, &st); err != nil {
+		fmt.Println("[update]", err)
+		return
+	}
+	if time.Since(st.Checked) < interval {
+		return
+	}
+
+	dl, err := UpdateDownloader(a.ctx, a.Config)
+	if err != nil {
+		fmt.Println("[update]", err)
+		return
+	}
+	if dl.Path != a.downloader.Path || dl.Version != a.downloader.Version {
+		fmt.Printf("[update] downloader updated from %s to %s\n", a.downloader, dl)
+	}
+	a.downloader = dl
+}
@@ -0,0 +1,177 @@
+package ytarchiver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidOption = errors.New("ytarchiver: invalid option")
+	ErrNilSelector   = errors.New("ytarchiver: nil selector")
+)
+
+// A ConfigProblem is a problem with a single field of a Config, as found by
+// ValidateConfig.
+type ConfigProblem struct {
+	// Path of the field within the Config, such as "Aria2cConnections" or
+	// "Channels[2].Tabs".
+	Field string
+	Err   error
+}
+
+func (p ConfigProblem) Error() string {
+	return p.Field + ": " + p.Err.Error()
+}
+
+func (p ConfigProblem) Unwrap() error {
+	return p.Err
+}
+
+// ConfigError is the error type returned by ValidateConfig, listing every
+// problem found with a Config rather than just the first.
+type ConfigError []ConfigProblem
+
+func (c ConfigError) Error() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "ytarchiver: %d config problem(s):\n", len(c))
+	for _, p := range c {
+		fmt.Fprintf(sb, "\t- %s\n", p.Error())
+	}
+
+	return sb.String()
+}
+
+func (c ConfigError) Unwrap() []error {
+	errs := make([]error, len(c))
+	for i, p := range c {
+		errs[i] = p
+	}
+
+	return errs
+}
+
+func (c *ConfigError) add(field string, err error) {
+	*c = append(*c, ConfigProblem{Field: field, Err: err})
+}
+
+// ValidateConfig checks cfg for problems, returning a ConfigError listing
+// all of them, or nil if there are none. Only cfg itself is checked: unlike
+// NewArchiver and Doctor, ValidateConfig touches neither the filesystem nor
+// the network, and runs no executables, so it is cheap enough to call as
+// the config is edited.
+func ValidateConfig(cfg Config) error {
+	var errs ConfigError
+	oauth := cfg.Client != nil || cfg.OAuthClientID != ""
+
+	if cfg.Root == "" {
+		errs.add("Root", fmt.Errorf("%w: no root", ErrDownloadDir))
+	}
+	if cfg.Client == nil && cfg.APIKey == "" && cfg.OAuthClientID == "" {
+		errs.add("APIKey", fmt.Errorf("%w: empty API key", ErrAPIKey))
+	}
+	if cfg.MaxParallel == 0 {
+		errs.add("MaxParallel", fmt.Errorf("%w: no parallel downloads", ErrInvalidOption))
+	}
+
+	for i, ch := range cfg.Channels {
+		field := fmt.Sprintf("Channels[%d]", i)
+		if ch.ID == "" && ch.Handle == "" && ch.Username == "" && !ch.Mine {
+			errs.add(field, ErrChannelNotIdentified)
+		}
+		if ch.Mine && !oauth {
+			errs.add(field, ErrOAuthRequired)
+		}
+		for _, tab := range ch.Tabs {
+			if _, ok := tabPrefixes[strings.ToLower(tab)]; !ok {
+				errs.add(field+".Tabs", fmt.Errorf("%w: %q", ErrUnknownTab, tab))
+			}
+		}
+		validateSelectors(&errs, field+".Selectors", ch.Selectors)
+	}
+	for i, u := range cfg.URLs {
+		field := fmt.Sprintf("URLs[%d]", i)
+		t, err := parseTargetURL(u)
+		switch {
+		case err != nil:
+			errs.add(field, err)
+		case t.Kind == targetPlaylist && isPrivatePlaylist(t.ID) && !oauth:
+			errs.add(field, ErrOAuthRequired)
+		}
+	}
+	validateSelectors(&errs, "Selectors", cfg.Selectors)
+	validateSelectors(&errs, "Exclusions", cfg.Exclusions)
+
+	enums := []struct {
+		field    string
+		val, max int
+	}{
+		{"Upcoming", cfg.Upcoming, UpcomingSkip},
+		{"Enumeration", cfg.Enumeration, EnumerateActivities},
+		{"Unavailable", cfg.Unavailable, RetryUnavailable},
+		{"WatchPage", cfg.WatchPage, WatchPageHTML},
+		{"StorageForecast", cfg.StorageForecast, ForecastRefuse},
+		{"DownloaderUpdate", cfg.DownloaderUpdate, DownloaderUpdateManaged},
+	}
+	for _, e := range enums {
+		if e.val < 0 || e.val > e.max {
+			errs.add(e.field, fmt.Errorf("%w: %d out of range (want 0 to %d)", ErrInvalidOption, e.val, e.max))
+		}
+	}
+
+	durations := []struct {
+		field string
+		val   time.Duration
+	}{
+		{"GracePeriod", cfg.GracePeriod},
+		{"DownloaderUpdateInterval", cfg.DownloaderUpdateInterval},
+		{"QuarantineBackoff", cfg.QuarantineBackoff},
+		{"ChannelCooldown", cfg.ChannelCooldown},
+		{"CanaryInterval", cfg.CanaryInterval},
+		{"ChannelCacheTTL", cfg.ChannelCacheTTL},
+		{"UnavailableRecheck", cfg.UnavailableRecheck},
+		{"MetadataRefreshAge", cfg.MetadataRefreshAge},
+		{"DigestInterval", cfg.DigestInterval},
+		{"LeaseTTL", cfg.LeaseTTL},
+	}
+	for _, d := range durations {
+		if d.val < 0 {
+			errs.add(d.field, fmt.Errorf("%w: negative duration %v", ErrInvalidOption, d.val))
+		}
+	}
+
+	if cfg.APIRateLimit < 0 {
+		errs.add("APIRateLimit", fmt.Errorf("%w: negative rate %v", ErrInvalidOption, cfg.APIRateLimit))
+	}
+	if cfg.Region != "" && len(cfg.Region) != 2 {
+		errs.add("Region", fmt.Errorf("%w: %q is not an ISO 3166-1 alpha-2 code", ErrInvalidOption, cfg.Region))
+	}
+	if cfg.Aria2cConnections > maxAria2cConnections {
+		errs.add("Aria2cConnections", fmt.Errorf("%w: %d connections requested (max %d)", ErrAria2c, cfg.Aria2cConnections, maxAria2cConnections))
+	}
+	if cfg.ConcurrentFragments > maxConcurrentFragments {
+		errs.add("ConcurrentFragments", fmt.Errorf("%w: %d concurrent fragments requested (max %d)", ErrDownloader, cfg.ConcurrentFragments, maxConcurrentFragments))
+	}
+	if cfg.DownloaderNice < 0 || cfg.DownloaderNice > maxNice {
+		errs.add("DownloaderNice", fmt.Errorf("%w: niceness %d out of range (want 0 to %d)", ErrLimits, cfg.DownloaderNice, maxNice))
+	}
+	if cfg.DownloaderMemoryLimit != 0 && cfg.DownloaderCgroup == "" {
+		errs.add("DownloaderMemoryLimit", fmt.Errorf("%w: memory limit requires a cgroup", ErrLimits))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateSelectors adds a problem to errs for each nil selector in sels,
+// which are the field of the given name.
+func validateSelectors(errs *ConfigError, field string, sels []VideoSelector) {
+	for i, m := range sels {
+		if m == nil {
+			errs.add(fmt.Sprintf("%s[%d]", field, i), ErrNilSelector)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ytarchiver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	cfg := DefaultConfig("key")
+	cfg.Root = t.TempDir()
+	cfg.Channels = []YouTubeChannel{{ID: "UCchannel"}}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig(valid) = %v", err)
+	}
+
+	cfg.Root = ""
+	cfg.MaxParallel = 0
+	cfg.Upcoming = -1
+	cfg.GracePeriod = -time.Hour
+	cfg.Channels = append(cfg.Channels, YouTubeChannel{Selectors: []VideoSelector{nil}})
+
+	want := []struct {
+		field string
+		err   error
+	}{
+		{"Root", ErrDownloadDir},
+		{"MaxParallel", ErrInvalidOption},
+		{"Channels[1]", ErrChannelNotIdentified},
+		{"Channels[1].Selectors[0]", ErrNilSelector},
+		{"Upcoming", ErrInvalidOption},
+		{"GracePeriod", ErrInvalidOption},
+	}
+
+	err := ValidateConfig(cfg)
+	var cerr ConfigError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("ValidateConfig = %v, want a ConfigError", err)
+	}
+	if len(cerr) != len(want) {
+		t.Fatalf("got %d problems, want %d:\n%v", len(cerr), len(want), cerr)
+	}
+	for i, w := range want {
+		if p := cerr[i]; p.Field != w.field || !errors.Is(p, w.err) {
+			t.Errorf("problem %d = %v, want %s: %v", i, p, w.field, w.err)
+		}
+		if !errors.Is(err, w.err) {
+			t.Errorf("errors.Is(err, %v) = false", w.err)
+		}
+	}
+}
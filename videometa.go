@@ -0,0 +1,277 @@
+package ytarchiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// VideoMetaSuffix is appended to a video ID to form the name of its
+	// metadata file in the channel directory.
+	VideoMetaSuffix = ".meta.json"
+	// VideoMetaVersion is the current version of the VideoMeta schema. It
+	// is incremented whenever a field is removed or changes meaning; new
+	// fields may be added without changing the version.
+	VideoMetaVersion = 1
+
+	// videoInfoSuffix is appended to a video ID by the downloader to form
+	// the name of its raw info file.
+	videoInfoSuffix = ".info.json"
+)
+
+// thumbnailExts are the extensions of thumbnails the downloader may write
+// next to a video, in order of preference.
+var thumbnailExts = []string{".webp", ".jpg", ".png"}
+
+// VideoMeta is the schema of the metadata file written alongside each video
+// when Config.DumpVideoInfo is set. Unlike the downloader's own info file,
+// this schema is stable across downloaders and their versions. For example:
+//
+//	{
+//		"version": 1,
+//		"id": "dQw4w9WgXcQ",
+//		"channel_id": "UCuAXFkgsw1L7xaCfnd5JJOw",
+//		"title": "Rick Astley - Never Gonna Give You Up",
+//		"description": "...",
+//		"duration": 213,
+//		"uploaded_at": "2009-10-25T06:57:33Z",
+//		"live": false,
+//		"ext": "mp4",
+//		"metadata_only": false,
+//		"thumbnail": "dQw4w9WgXcQ.webp",
+//		"thumbnail_url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/maxresdefault.jpg",
+//		"size": 48209843,
+//		"vcodec": "avc1.640028",
+//		"acodec": "mp4a.40.2",
+//		"width": 1920,
+//		"height": 1080,
+//		"views": 1700000000,
+//		"tags": ["rick astley", "never gonna give you up"],
+//		"refreshed_at": "2025-03-04T15:04:05Z"
+//	}
+type VideoMeta struct {
+	// Version of the schema, currently VideoMetaVersion.
+	Version int `json:"version"`
+	// Unique video ID. The video file is named ID + "." + Extension.
+	ID string `json:"id"`
+	// ID of the channel which uploaded the video.
+	ChannelID   string `json:"channel_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Duration in seconds.
+	Duration int `json:"duration"`
+	// When the video was uploaded. Only the date is accurate for some
+	// older videos.
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Set if the video was a live stream.
+	Live bool `json:"live"`
+	// File extension of the video file, without the leading ".".
+	Extension string `json:"ext"`
+	// Set if only the metadata of the video was archived, in which case
+	// there is no video file.
+	MetadataOnly bool `json:"metadata_only"`
+	// Path of the local thumbnail relative to the channel directory.
+	// Empty if no thumbnail was downloaded.
+	Thumbnail string `json:"thumbnail"`
+	// URL of the thumbnail on YouTube.
+	ThumbnailURL string `json:"thumbnail_url"`
+	// Size of the video file in bytes. Zero if there is no video file.
+	Size int64 `json:"size"`
+	// Codecs of the video and audio streams as reported by the downloader
+	// (e.g "avc1.640028"), and the resolution of the video. The container
+	// is given by Extension. Empty or zero if unknown.
+	VideoCodec string `json:"vcodec"`
+	AudioCodec string `json:"acodec"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	// View count as of RefreshedAt. Zero if never refreshed.
+	Views uint64 `json:"views"`
+	// Tags given by the uploader. May be empty.
+	Tags []string `json:"tags"`
+	// When the metadata was last refreshed by Archiver.RefreshMetadata.
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// videoInfo contains the fields of the downloader's info file used to
+// produce VideoMeta.
+type videoInfo struct {
+	ID          string   `json:"id"`
+	ChannelID   string   `json:"channel_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Duration    float64  `json:"duration"`
+	Timestamp   int64    `json:"timestamp"`
+	UploadDate  string   `json:"upload_date"`
+	WasLive     bool     `json:"was_live"`
+	Extension   string   `json:"ext"`
+	Thumbnail   string   `json:"thumbnail"`
+	VideoCodec  string   `json:"vcodec"`
+	AudioCodec  string   `json:"acodec"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	Tags        []string `json:"tags"`
+}
+
+var ErrVideoMeta = errors.New("ytarchiver: video metadata")
+
+// ReadVideoMeta reads the metadata file of the video id in the channel
+// directory dir.
+func ReadVideoMeta(dir, id string) (VideoMeta, error) {
+	return readVideoMeta(osReader(dir), id, id+VideoMetaSuffix)
+}
+
+// readVideoMeta reads the named metadata file of the video id with read.
+func readVideoMeta(read readFunc, id, name string) (VideoMeta, error) {
+	var vm VideoMeta
+
+	dat, err := read(name)
+	if err != nil {
+		return vm, fmt.Errorf("read video meta: %w", err)
+	}
+	if err = json.Unmarshal(dat, &vm); err != nil {
+		return vm, fmt.Errorf("read video meta %s: %w", id, err)
+	}
+
+	return vm, nil
+}
+
+// normalizeVideoInfo converts the downloader's info file for the video id
+// in the channel directory dir into VideoMeta.
+func normalizeVideoInfo(dir, id string) (VideoMeta, error) {
+	var info videoInfo
+
+	dat, err := os.ReadFile(filepath.Join(dir, id+videoInfoSuffix))
+	if err != nil {
+		return VideoMeta{}, fmt.Errorf("normalize video info: %w", err)
+	}
+	if err = json.Unmarshal(dat, &info); err != nil {
+		return VideoMeta{}, fmt.Errorf("normalize video info %s: %w", id, err)
+	}
+
+	vm := VideoMeta{
+		Version:      VideoMetaVersion,
+		ID:           info.ID,
+		ChannelID:    info.ChannelID,
+		Title:        info.Title,
+		Description:  info.Description,
+		Duration:     int(info.Duration),
+		Live:         info.WasLive,
+		Extension:    info.Extension,
+		ThumbnailURL: info.Thumbnail,
+		VideoCodec:   streamCodec(info.VideoCodec),
+		AudioCodec:   streamCodec(info.AudioCodec),
+		Width:        info.Width,
+		Height:       info.Height,
+		Tags:         info.Tags,
+	}
+	if vm.ID == "" {
+		vm.ID = id
+	}
+
+	// Not all extractors provide the exact timestamp.
+	if info.Timestamp != 0 {
+		vm.UploadedAt = time.Unix(info.Timestamp, 0).UTC()
+	} else if t, err := time.Parse("20060102", info.UploadDate); err == nil {
+		vm.UploadedAt = t
+	}
+
+	if fi, err := os.Stat(filepath.Join(dir, id+"."+vm.Extension)); err != nil {
+		// The downloader still describes the format it would have
+		// downloaded.
+		vm.MetadataOnly = true
+		vm.VideoCodec, vm.AudioCodec, vm.Width, vm.Height = "", "", 0, 0
+	} else {
+		vm.Size = fi.Size()
+	}
+
+	for _, ext := range append(thumbnailExts, PosterSuffix) {
+		if _, err := os.Stat(filepath.Join(dir, id+ext)); err == nil {
+			vm.Thumbnail = id + ext
+			break
+		}
+	}
+
+	return vm, nil
+}
+
+// streamCodec returns the codec reported by the downloader for a stream,
+// which is "none" if there is no such stream.
+func streamCodec(codec string) string {
+	if codec == "none" {
+		return ""
+	}
+	return codec
+}
+
+// writeVideoMeta normalizes the downloader's info file for the video id in
+// the channel directory dir and writes the result to its metadata file.
+func writeVideoMeta(dir, id string) error {
+	vm, err := normalizeVideoInfo(dir, id)
+	if err != nil {
+		return err
+	}
+
+	return saveVideoMeta(dir, vm)
+}
+
+// saveVideoMeta atomically replaces the metadata file for vm in the channel
+// directory dir.
+func saveVideoMeta(dir string, vm VideoMeta) error {
+	dat, err := json.MarshalIndent(vm, "", "\t")
+	if err != nil {
+		return fmt.Errorf("write video meta: %w", err)
+	}
+
+	path := filepath.Join(dir, vm.ID+VideoMetaSuffix)
+	if err = os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		return fmt.Errorf("write video meta: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("write video meta: %w", err)
+	}
+
+	return nil
+}
+
+// migrateVideoMeta writes the metadata file for every video in the archive
+// at root which has an info file.
+func migrateVideoMeta(root string) error {
+	chans, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chans {
+		if !isChannelDir(c) {
+			continue
+		}
+
+		dir := filepath.Join(root, c.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			id, ok := strings.CutSuffix(f.Name(), videoInfoSuffix)
+			if !ok {
+				continue
+			}
+
+			err := writeVideoMeta(dir, id)
+			// A truncated info file from an interrupted download
+			// should not prevent the rest of the archive migrating.
+			var serr *json.SyntaxError
+			if err != nil && !errors.As(err, &serr) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package ytarchiver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	// videoBatchSize is the maximum number of IDs the API accepts in one
+	// video lookup.
+	videoBatchSize = 50
+	// videoCacheMax bounds the number of videos kept in a video cache.
+	// Reaching it empties the cache, which is only ever a cost in quota.
+	videoCacheMax = 5000
+)
+
+// videoParts are the parts requested for every video looked up. They cover
+// everything needed by the archiver and the built-in selectors, so a single
+// lookup serves them all.
+var videoParts = []string{"snippet", "contentDetails", "liveStreamingDetails"}
+
+// videoCache caches full video metadata for the duration of a run, so that
+// the upcoming check and all selectors share one batched lookup per video
+// rather than each making their own. It is safe for concurrent use, so that
+// pages can be prefetched while earlier ones are being archived.
+type videoCache struct {
+	cl YouTubeClient
+
+	mut sync.Mutex
+	// videos maps IDs to metadata. A nil entry means that the video was
+	// looked up but did not exist.
+	videos map[string]*youtube.Video
+}
+
+func newVideoCache(cl YouTubeClient) *videoCache {
+	return &videoCache{cl: cl, videos: make(map[string]*youtube.Video)}
+}
+
+// fetch looks up ids, in as few requests as possible, and caches the
+// results. The returned map contains an entry for each of ids.
+func (c *videoCache) fetch(ctx context.Context, ids []string) (map[string]*youtube.Video, error) {
+	found := make(map[string]*youtube.Video, len(ids))
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), videoBatchSize)]
+		ids = ids[len(batch):]
+
+		vids, err := c.cl.ListVideos(ctx, videoParts, batch)
+		if err != nil {
+			return nil, fmt.Errorf("list videos: %w", err)
+		}
+
+		for _, id := range batch {
+			found[id] = nil
+		}
+		for _, v := range vids {
+			if v != nil {
+				found[v.Id] = v
+			}
+		}
+	}
+
+	// The lock is not held while waiting on the API.
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if len(c.videos)+len(found) > videoCacheMax {
+		clear(c.videos)
+	}
+	for id, v := range found {
+		c.videos[id] = v
+	}
+
+	return found, nil
+}
+
+// Prefetch looks up any of ids not already cached, in as few requests as
+// possible.
+func (c *videoCache) Prefetch(ctx context.Context, ids []string) error {
+	c.mut.Lock()
+	missing := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := c.videos[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	c.mut.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, err := c.fetch(ctx, missing)
+	return err
+}
+
+// Get returns the metadata for the video with the given ID, looking it up
+// if it is not already cached. It returns nil if there is no such video.
+func (c *videoCache) Get(ctx context.Context, id string) (*youtube.Video, error) {
+	c.mut.Lock()
+	v, ok := c.videos[id]
+	c.mut.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	found, err := c.fetch(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	return found[id], nil
+}
@@ -0,0 +1,135 @@
+package ytarchiver
+
+// videoIDLen is the length of a standard video ID.
+const videoIDLen = 11
+
+// videoIDAlphabet is the URL-safe base64 alphabet in which video IDs are
+// written.
+const videoIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// videoIDValues maps each byte of videoIDAlphabet to its value, and every
+// other byte to 0xff.
+var videoIDValues [256]byte
+
+func init() {
+	for i := range videoIDValues {
+		videoIDValues[i] = 0xff
+	}
+	for i := 0; i < len(videoIDAlphabet); i++ {
+		videoIDValues[videoIDAlphabet[i]] = byte(i)
+	}
+}
+
+// packVideoID packs a standard video ID, which is 64 bits encoded in 11
+// base64 characters, into an integer. ok is false if id is not a standard
+// ID, in which case it cannot be packed without loss.
+func packVideoID(id string) (packed uint64, ok bool) {
+	if len(id) != videoIDLen {
+		return 0, false
+	}
+
+	for i := 0; i < videoIDLen-1; i++ {
+		v := videoIDValues[id[i]]
+		if v == 0xff {
+			return 0, false
+		}
+		packed = packed<<6 | uint64(v)
+	}
+
+	// The final character only carries 4 bits.
+	v := videoIDValues[id[videoIDLen-1]]
+	if v == 0xff || v&3 != 0 {
+		return 0, false
+	}
+	return packed<<4 | uint64(v>>2), true
+}
+
+// unpackVideoID reverses packVideoID.
+func unpackVideoID(packed uint64) string {
+	var id [videoIDLen]byte
+
+	id[videoIDLen-1] = videoIDAlphabet[(packed&0xf)<<2]
+	packed >>= 4
+	for i := videoIDLen - 2; i >= 0; i-- {
+		id[i] = videoIDAlphabet[packed&0x3f]
+		packed >>= 6
+	}
+
+	return string(id[:])
+}
+
+// videoSet is a set of video IDs. Standard IDs are stored packed into
+// integers, which takes roughly a third of the memory of storing strings
+// and keeps the seen videos of channels with tens of thousands of uploads
+// cheap. Anything else is stored as is.
+//
+// As with maps, lookups and deletions on a nil set are permitted.
+type videoSet struct {
+	packed map[uint64]struct{}
+	other  map[string]struct{}
+}
+
+func newVideoSet() *videoSet {
+	return &videoSet{packed: make(map[uint64]struct{})}
+}
+
+func (s *videoSet) Add(id string) {
+	if p, ok := packVideoID(id); ok {
+		s.packed[p] = struct{}{}
+		return
+	}
+
+	if s.other == nil {
+		s.other = make(map[string]struct{})
+	}
+	s.other[id] = struct{}{}
+}
+
+func (s *videoSet) Has(id string) bool {
+	if s == nil {
+		return false
+	}
+
+	if p, ok := packVideoID(id); ok {
+		_, ok = s.packed[p]
+		return ok
+	}
+	_, ok := s.other[id]
+	return ok
+}
+
+func (s *videoSet) Delete(id string) {
+	if s == nil {
+		return
+	}
+
+	if p, ok := packVideoID(id); ok {
+		delete(s.packed, p)
+		return
+	}
+	delete(s.other, id)
+}
+
+// IDs returns the IDs in s, in no particular order.
+func (s *videoSet) IDs() []string {
+	if s == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, s.Len())
+	for p := range s.packed {
+		ids = append(ids, unpackVideoID(p))
+	}
+	for id := range s.other {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *videoSet) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	return len(s.packed) + len(s.other)
+}
@@ -0,0 +1,170 @@
+package ytarchiver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPackVideoID(t *testing.T) {
+	for _, id := range []string{
+		"dQw4w9WgXcQ",
+		"AAAAAAAAAAA",
+		"__________w",
+		"-_09azAZ-_E",
+		"jNQXAC9IVRw",
+	} {
+		p, ok := packVideoID(id)
+		if !ok {
+			t.Errorf("packVideoID(%q) failed", id)
+			continue
+		}
+		if got := unpackVideoID(p); got != id {
+			t.Errorf("unpackVideoID(packVideoID(%q)) = %q", id, got)
+		}
+	}
+
+	for _, id := range []string{
+		"",
+		"dQw4w9WgXc",
+		"dQw4w9WgXcQQ",
+		"dQw4w9WgX+Q",
+		"dQw4w9WgXc=",
+		"dQw4w9 gXcQ",
+		// The final character of a standard ID carries only 4 bits, so
+		// these cannot come back out as they went in.
+		"dQw4w9WgXcR",
+		"dQw4w9WgXc_",
+	} {
+		if p, ok := packVideoID(id); ok {
+			t.Errorf("packVideoID(%q) = %#x, want failure", id, p)
+		}
+	}
+}
+
+func TestVideoSet(t *testing.T) {
+	ids := []string{"dQw4w9WgXcQ", "jNQXAC9IVRw", "dQw4w9WgXcR", "short", ""}
+
+	s := newVideoSet()
+	for _, id := range ids {
+		s.Add(id)
+	}
+	s.Add(ids[0])
+
+	if len(s.packed) != 2 || len(s.other) != 3 {
+		t.Errorf("%d packed and %d other IDs, want 2 and 3", len(s.packed), len(s.other))
+	}
+	if s.Len() != len(ids) {
+		t.Errorf("Len() = %d, want %d", s.Len(), len(ids))
+	}
+	for _, id := range ids {
+		if !s.Has(id) {
+			t.Errorf("Has(%q) = false", id)
+		}
+	}
+	if s.Has("dQw4w9WgXcA") {
+		t.Error("Has(unadded ID) = true")
+	}
+
+	got := s.IDs()
+	slices.Sort(got)
+	want := slices.Sorted(slices.Values(ids))
+	if !slices.Equal(got, want) {
+		t.Errorf("IDs() = %q, want %q", got, want)
+	}
+
+	s.Delete("dQw4w9WgXcQ")
+	s.Delete("short")
+	if s.Has("dQw4w9WgXcQ") || s.Has("short") || s.Len() != len(ids)-2 {
+		t.Errorf("after Delete: IDs() = %q", s.IDs())
+	}
+
+	var nilSet *videoSet
+	nilSet.Delete("dQw4w9WgXcQ")
+	if nilSet.Has("dQw4w9WgXcQ") || nilSet.Len() != 0 || nilSet.IDs() != nil {
+		t.Error("nil set is not empty")
+	}
+}
+
+// benchVideoIDs returns n distinct standard video IDs.
+func benchVideoIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		// Spread the IDs over the whole space, as real ones are.
+		ids[i] = unpackVideoID(uint64(i) * 0x9e3779b97f4a7c15)
+	}
+	return ids
+}
+
+const benchVideoSetSize = 50000
+
+func BenchmarkVideoSetAdd(b *testing.B) {
+	ids := benchVideoIDs(benchVideoSetSize)
+
+	b.Run("packed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			s := newVideoSet()
+			for _, id := range ids {
+				s.Add(id)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			s := make(map[string]struct{})
+			for _, id := range ids {
+				s[id] = struct{}{}
+			}
+		}
+	})
+}
+
+func BenchmarkVideoSetHas(b *testing.B) {
+	ids := benchVideoIDs(benchVideoSetSize)
+	set := newVideoSet()
+	m := make(map[string]struct{})
+	for _, id := range ids[:len(ids)/2] {
+		set.Add(id)
+		m[id] = struct{}{}
+	}
+
+	b.Run("packed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; b.Loop(); i++ {
+			set.Has(ids[i%len(ids)])
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; b.Loop(); i++ {
+			_ = m[ids[i%len(ids)]]
+		}
+	})
+}
+
+func BenchmarkVideoSetIDs(b *testing.B) {
+	ids := benchVideoIDs(benchVideoSetSize)
+	set := newVideoSet()
+	m := make(map[string]struct{})
+	for _, id := range ids {
+		set.Add(id)
+		m[id] = struct{}{}
+	}
+
+	b.Run("packed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			set.IDs()
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			out := make([]string, 0, len(m))
+			for id := range m {
+				out = append(out, id)
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package ytarchiver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// minWatchInterval is the shortest interval at which WatchUpcoming polls.
+const minWatchInterval = time.Minute
+
+// vodReady reports if v, a video previously upcoming or live, has finished
+// and been processed into a video which can be downloaded. Until then, its
+// duration is zero.
+func vodReady(v *youtube.Video) bool {
+	if isUpcoming(v) || v.ContentDetails == nil {
+		return false
+	}
+
+	d := v.ContentDetails.Duration
+	return d != "" && d != "P0D"
+}
+
+// WatchUpcoming polls the tracked upcoming videos, premieres and live
+// streams every interval until ctx is done. As soon as one has finished and
+// its video is available, the channel it belongs to is archived, rather
+// than waiting for the next scheduled run.
+//
+// Polls are skipped while a run is in progress, as the run rechecks the
+// same videos. Upcoming videos are only tracked with UpcomingRecheck.
+func (a *Archiver) WatchUpcoming(ctx context.Context, interval time.Duration) {
+	tk := time.NewTicker(max(interval, minWatchInterval))
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			if err := a.pollUpcoming(ctx); err != nil {
+				fmt.Printf("watch upcoming: %v\n", err)
+			}
+		}
+	}
+}
+
+// pollUpcoming looks up every due upcoming video in a single batch, then
+// archives the channels of any which are ready.
+func (a *Archiver) pollUpcoming(ctx context.Context) error {
+	if !a.runMut.TryLock() {
+		return nil
+	}
+	defer a.runMut.Unlock()
+
+	if time.Now().Before(a.quotaReset) {
+		return nil
+	}
+
+	now := time.Now()
+	owner := make(map[string]YouTubeChannel)
+	var ids []string
+	for _, ch := range a.Channels {
+		chc, ok := a.cachedChannel(ch.Identity())
+		if !ok {
+			continue
+		}
+		for id, start := range chc.Upcoming {
+			if start.Before(now) {
+				owner[id] = ch
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	vc := newVideoCache(a.client)
+	if err := vc.Prefetch(ctx, ids); err != nil {
+		return err
+	}
+
+	var chans []YouTubeChannel
+	due := make(map[string]bool)
+	for _, id := range ids {
+		v, err := vc.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		// Deleted videos are dropped by the recheck.
+		ch := owner[id]
+		if (v == nil || vodReady(v)) && !due[ch.Identity()] {
+			due[ch.Identity()] = true
+			chans = append(chans, ch)
+		}
+	}
+	if len(chans) == 0 {
+		return nil
+	}
+
+	return a.archive(chans)
+}
@@ -0,0 +1,228 @@
+package ytarchiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Suffixes appended to a video ID to form the names of the snapshots of its
+// watch page. Comments are only written separately for WatchPageHTML, and
+// are otherwise included in the WARC.
+const (
+	WatchPageWARCSuffix = ".watch.warc.gz"
+	WatchPageHTMLSuffix = ".watch.html"
+	CommentsSuffix      = ".comments.json"
+)
+
+// maxWatchPageSize is the largest watch page which will be captured.
+const maxWatchPageSize = 16 << 20
+
+// watchPageTimeout limits the time taken to fetch a watch page.
+const watchPageTimeout = time.Minute
+
+// watchPageHeaders are sent with each request for a watch page, so that it
+// is served in full and in English, without first asking for consent to
+// cookies.
+var watchPageHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+	"Accept":          "text/html,application/xhtml+xml",
+	"Accept-Language": "en-US,en;q=0.5",
+	"Cookie":          "SOCS=CAI",
+}
+
+var ErrWatchPage = errors.New("error capturing watch page")
+
+// CaptureWatchPage captures the watch page of the video id, as served by
+// base (see Config.WatchPageURL), and its top comments into the channel
+// directory dir, in the format given by one of the WatchPage* constants.
+// The page captures context which the API does not, such as how the
+// description was rendered, but not the comments, which the page only
+// loads by script; they are fetched from the API using cl instead.
+func CaptureWatchPage(ctx context.Context, cl YouTubeClient, hc *http.Client, base string, format int, dir, id string) error {
+	if format == WatchPageNone {
+		return nil
+	}
+	if base == "" {
+		base = youtubeWatchURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, watchPageTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+id, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+	for k, v := range watchPageHeaders {
+		req.Header.Set(k, v)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: %s", ErrWatchPage, req.URL, resp.Status)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxWatchPageSize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+
+	threads, err := cl.ListCommentThreads(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%w: comments: %w", ErrWatchPage, err)
+	}
+	if threads == nil {
+		threads = []*youtube.CommentThread{}
+	}
+	comments, err := json.MarshalIndent(threads, "", "\t")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+
+	if format == WatchPageHTML {
+		if err := writeFileAtomic(filepath.Join(dir, id+WatchPageHTMLSuffix), page); err != nil {
+			return fmt.Errorf("%w: %v", ErrWatchPage, err)
+		}
+		if err := writeFileAtomic(filepath.Join(dir, id+CommentsSuffix), comments); err != nil {
+			return fmt.Errorf("%w: %v", ErrWatchPage, err)
+		}
+		return nil
+	}
+
+	warc, err := watchPageWARC(req, resp, page, id, comments)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, id+WatchPageWARCSuffix), warc); err != nil {
+		return fmt.Errorf("%w: %v", ErrWatchPage, err)
+	}
+	return nil
+}
+
+// watchPageWARC returns a gzipped WARC file holding the request req for the
+// watch page of the video id, its response resp with the body page, and the
+// JSON listing of its top comments.
+func watchPageWARC(req *http.Request, resp *http.Response, page []byte, id string, comments []byte) ([]byte, error) {
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+
+	info := warcRecord{Type: "warcinfo", Date: now, ContentType: "application/warc-fields",
+		Block: fmt.Appendf(nil, "software: ytarchiver\r\nformat: WARC File Format 1.1\r\nvideo-id: %s\r\n", id)}
+	if err := info.write(&buf); err != nil {
+		return nil, err
+	}
+
+	var reqBlock bytes.Buffer
+	fmt.Fprintf(&reqBlock, "GET %s HTTP/1.1\r\nHost: %s\r\n", req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&reqBlock)
+	reqBlock.WriteString("\r\n")
+	request := warcRecord{Type: "request", Date: now, URI: req.URL.String(), WarcinfoID: info.ID(),
+		ContentType: "application/http;msgtype=request", Block: reqBlock.Bytes()}
+	if err := request.write(&buf); err != nil {
+		return nil, err
+	}
+
+	// The body has been decoded, so the response is recorded as if it had
+	// been sent that way.
+	hdr := resp.Header.Clone()
+	for _, k := range []string{"Content-Encoding", "Transfer-Encoding", "Content-Length"} {
+		hdr.Del(k)
+	}
+	hdr.Set("Content-Length", fmt.Sprint(len(page)))
+	var respBlock bytes.Buffer
+	fmt.Fprintf(&respBlock, "HTTP/1.1 %s\r\n", resp.Status)
+	hdr.Write(&respBlock)
+	respBlock.WriteString("\r\n")
+	respBlock.Write(page)
+	digest := sha1.Sum(page)
+	response := warcRecord{Type: "response", Date: now, URI: req.URL.String(), WarcinfoID: info.ID(),
+		ConcurrentTo: request.ID(), PayloadDigest: "sha1:" + base32.StdEncoding.EncodeToString(digest[:]),
+		ContentType: "application/http;msgtype=response", Block: respBlock.Bytes()}
+	if err := response.write(&buf); err != nil {
+		return nil, err
+	}
+
+	res := warcRecord{Type: "resource", Date: now, URI: "urn:youtube:comments:" + id, WarcinfoID: info.ID(),
+		ContentType: "application/json", Block: comments}
+	if err := res.write(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// A warcRecord is a record of a WARC file.
+type warcRecord struct {
+	Type          string
+	Date          time.Time
+	URI           string
+	WarcinfoID    string
+	ConcurrentTo  string
+	PayloadDigest string
+	ContentType   string
+	Block         []byte
+
+	id string
+}
+
+// ID returns the record ID of r, generating it if not yet done.
+func (r *warcRecord) ID() string {
+	if r.id == "" {
+		var u [16]byte
+		rand.Read(u[:])
+		u[6] = u[6]&0x0f | 0x40
+		u[8] = u[8]&0x3f | 0x80
+		r.id = fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+	}
+	return r.id
+}
+
+// write writes r to w as its own gzip member, as is conventional for
+// compressed WARC files so that each record may be read on its own.
+func (r *warcRecord) write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+
+	fmt.Fprintf(zw, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Record-ID: %s\r\nWARC-Date: %s\r\n",
+		r.Type, r.ID(), r.Date.Format(time.RFC3339))
+	for _, f := range [][2]string{
+		{"WARC-Target-URI", r.URI},
+		{"WARC-Warcinfo-ID", r.WarcinfoID},
+		{"WARC-Concurrent-To", r.ConcurrentTo},
+		{"WARC-Payload-Digest", r.PayloadDigest},
+	} {
+		if f[1] != "" {
+			fmt.Fprintf(zw, "%s: %s\r\n", f[0], f[1])
+		}
+	}
+	fmt.Fprintf(zw, "Content-Type: %s\r\nContent-Length: %d\r\n\r\n", r.ContentType, len(r.Block))
+	zw.Write(r.Block)
+	zw.Write([]byte("\r\n\r\n"))
+
+	return zw.Close()
+}
+
+// writeFileAtomic writes dat to the file at path through a temporary file,
+// so that a partial file is never left behind.
+func writeFileAtomic(path string, dat []byte) error {
+	if err := os.WriteFile(path+".tmp", dat, 0644); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
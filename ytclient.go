@@ -0,0 +1,217 @@
+package ytarchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+// playlistPageSize is the number of items requested per page of a
+// playlist, which is the most the API allows.
+const playlistPageSize = 50
+
+// commentThreadCount is the number of comment threads requested for a
+// video, roughly as many as its watch page first shows.
+const commentThreadCount = 20
+
+// A YouTubeClient makes the requests to the YouTube Data API needed by the
+// archiver and its selectors. The default implementation, returned by
+// NewYouTubeClient, wraps a *youtube.Service; others may be substituted
+// through Config.Client, such as fakes for testing.
+//
+// Implementations must be safe for concurrent use.
+type YouTubeClient interface {
+	// ListChannel returns the id, snippet and contentDetails parts of the
+	// channel identified by ch (see YouTubeChannel.Identity), or nil if
+	// there is no such channel.
+	ListChannel(ctx context.Context, ch YouTubeChannel) (*youtube.Channel, error)
+	// ListChannels returns the same parts of the channels with the given
+	// IDs, of which there are at most 50. Channels which do not exist are
+	// omitted.
+	ListChannels(ctx context.Context, ids []string) ([]*youtube.Channel, error)
+	// ListPlaylistItems returns the page of the snippet and contentDetails
+	// parts of the items in a playlist with the given page token. The
+	// first page has an empty token.
+	ListPlaylistItems(ctx context.Context, playlistID, pageToken string) (*youtube.PlaylistItemListResponse, error)
+	// ListVideos returns the given parts of the videos with the given IDs,
+	// of which there are at most 50. Videos which do not exist are
+	// omitted.
+	ListVideos(ctx context.Context, parts []string, ids []string) ([]*youtube.Video, error)
+	// ListVideoCategories returns the snippets of the video categories
+	// available in the given region (an ISO 3166-1 alpha-2 code).
+	ListVideoCategories(ctx context.Context, regionCode string) ([]*youtube.VideoCategory, error)
+	// ListCaptions returns the snippets of the caption tracks of a video.
+	ListCaptions(ctx context.Context, videoID string) ([]*youtube.Caption, error)
+	// ListActivities returns the page of the snippet and contentDetails
+	// parts of the activities of a channel published after the given time,
+	// newest first, with the given page token. The first page has an empty
+	// token.
+	ListActivities(ctx context.Context, channelID string, after time.Time, pageToken string) (*youtube.ActivityListResponse, error)
+	// ListCommentThreads returns the snippets of the top comment threads
+	// of a video, as first shown on its watch page. A video with comments
+	// disabled has none.
+	ListCommentThreads(ctx context.Context, videoID string) ([]*youtube.CommentThread, error)
+}
+
+// NewYouTubeClient returns a YouTubeClient which makes requests through srv.
+func NewYouTubeClient(srv *youtube.Service) YouTubeClient {
+	return serviceClient{srv}
+}
+
+// NewClient returns cfg.Client if set, or else a client for the YouTube API
+// as configured by cfg.
+func NewClient(ctx context.Context, cfg Config) (YouTubeClient, error) {
+	if cfg.Client != nil {
+		return cfg.Client, nil
+	}
+
+	srv, err := newYouTubeService(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPIConnect, err)
+	}
+	return NewYouTubeClient(srv), nil
+}
+
+type serviceClient struct {
+	srv *youtube.Service
+}
+
+func (c serviceClient) ListChannel(ctx context.Context, ch YouTubeChannel) (*youtube.Channel, error) {
+	req := c.srv.Channels.List([]string{"id", "snippet", "contentDetails"}).Context(ctx)
+	if err := ch.requestAddIdentity(req); err != nil {
+		return nil, err
+	}
+
+	r, err := req.Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	if len(r.Items) == 0 {
+		return nil, nil
+	}
+	return r.Items[0], nil
+}
+
+func (c serviceClient) ListChannels(ctx context.Context, ids []string) ([]*youtube.Channel, error) {
+	r, err := c.srv.Channels.List([]string{"id", "snippet", "contentDetails"}).Id(ids...).Context(ctx).Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r.Items, nil
+}
+
+func (c serviceClient) ListPlaylistItems(ctx context.Context, playlistID, pageToken string) (*youtube.PlaylistItemListResponse, error) {
+	req := c.srv.PlaylistItems.List([]string{"contentDetails", "snippet"}).
+		PlaylistId(playlistID).
+		MaxResults(playlistPageSize).
+		Context(ctx)
+	if pageToken != "" {
+		req.PageToken(pageToken)
+	}
+
+	r, err := req.Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r, nil
+}
+
+func (c serviceClient) ListVideos(ctx context.Context, parts []string, ids []string) ([]*youtube.Video, error) {
+	r, err := c.srv.Videos.List(parts).Id(ids...).Context(ctx).Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r.Items, nil
+}
+
+func (c serviceClient) ListVideoCategories(ctx context.Context, regionCode string) ([]*youtube.VideoCategory, error) {
+	r, err := c.srv.VideoCategories.List([]string{"snippet"}).RegionCode(regionCode).Context(ctx).Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r.Items, nil
+}
+
+func (c serviceClient) ListCaptions(ctx context.Context, videoID string) ([]*youtube.Caption, error) {
+	r, err := c.srv.Captions.List([]string{"snippet"}, videoID).Context(ctx).Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r.Items, nil
+}
+
+func (c serviceClient) ListActivities(ctx context.Context, channelID string, after time.Time, pageToken string) (*youtube.ActivityListResponse, error) {
+	req := c.srv.Activities.List([]string{"snippet", "contentDetails"}).
+		ChannelId(channelID).
+		PublishedAfter(after.UTC().Format(time.RFC3339)).
+		MaxResults(playlistPageSize).
+		Context(ctx)
+	if pageToken != "" {
+		req.PageToken(pageToken)
+	}
+
+	r, err := req.Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r, nil
+}
+
+func (c serviceClient) ListCommentThreads(ctx context.Context, videoID string) ([]*youtube.CommentThread, error) {
+	r, err := c.srv.CommentThreads.List([]string{"snippet"}).
+		VideoId(videoID).
+		Order("relevance").
+		TextFormat("plainText").
+		MaxResults(commentThreadCount).
+		Context(ctx).
+		Do()
+	if isCommentsDisabled(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return r.Items, nil
+}
+
+// isCommentsDisabled reports if err is an API error caused by requesting
+// the comments of a video on which they are disabled.
+func isCommentsDisabled(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && slices.ContainsFunc(gerr.Errors, func(e googleapi.ErrorItem) bool {
+		return e.Reason == "commentsDisabled"
+	})
+}
+
+// isNotFound reports if err is an API error caused by requesting something
+// which does not exist.
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+// forEachPage calls fn with each page of the playlist, stopping at the
+// first error.
+func forEachPage(ctx context.Context, cl YouTubeClient, playlistID string, fn func(*youtube.PlaylistItemListResponse) error) error {
+	token := ""
+	for {
+		r, err := cl.ListPlaylistItems(ctx, playlistID, token)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+
+		if r.NextPageToken == "" {
+			return nil
+		}
+		token = r.NextPageToken
+	}
+}